@@ -0,0 +1,427 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lightningnetwork/lnd/tor"
+)
+
+// backendTunnel forwards the connections accepted on a loopback listener to a
+// host of the chain backend, dialing it through a custom dial function, and
+// optionally over TLS. Neither btcwallet's connections to the backend, nor
+// rpcclient's HTTP POST mode, nor the ZMQ subscriptions allow a client
+// certificate or a dialer to be set, so they connect to the tunnel instead,
+// which presents the certificate or dials through Tor on their behalf.
+type backendTunnel struct {
+	stopped int32 // To be used atomically.
+
+	// host is the address of the backend's host connections are forwarded
+	// to. It's guarded by connsMtx, as the connections forwarded to it are
+	// closed once it's replaced.
+	host string
+
+	// tlsConfig is the TLS config the forwarded connections are made
+	// with. If nil, they're forwarded as is. It's guarded by connsMtx, as
+	// the connections made with it are closed once it's replaced.
+	tlsConfig *tls.Config
+
+	dial     func(string, string) (net.Conn, error)
+	listener net.Listener
+
+	// conns is the set of connections currently being forwarded, which
+	// are closed once the tunnel is stopped.
+	conns    map[net.Conn]struct{}
+	connsMtx sync.Mutex
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// newBackendTunnel starts a tunnel forwarding connections to the given host,
+// dialing it through the given dial function. If a TLS config is passed, the
+// connections are forwarded over TLS.
+func newBackendTunnel(host string, tlsConfig *tls.Config,
+	dial func(string, string) (net.Conn, error)) (*backendTunnel, error) {
+
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for tunnel to %v: %v",
+			host, err)
+	}
+
+	t := &backendTunnel{
+		host:      host,
+		tlsConfig: tlsConfig,
+		dial:      dial,
+		listener:  listener,
+		conns:     make(map[net.Conn]struct{}),
+		quit:      make(chan struct{}),
+	}
+
+	t.wg.Add(1)
+	go t.acceptConns()
+
+	return t, nil
+}
+
+// Addr returns the loopback address the tunnel accepts connections on.
+func (t *backendTunnel) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// SetTLSConfig replaces the TLS config the connections are forwarded with,
+// and closes the connections currently being forwarded, so their clients
+// reconnect through the tunnel using the new config.
+func (t *backendTunnel) SetTLSConfig(tlsConfig *tls.Config) {
+	t.connsMtx.Lock()
+	defer t.connsMtx.Unlock()
+
+	t.tlsConfig = tlsConfig
+	for conn := range t.conns {
+		conn.Close()
+	}
+}
+
+// SetHost replaces the backend's host connections are forwarded to, and
+// closes the connections currently being forwarded, so their clients
+// reconnect through the tunnel to the new host.
+func (t *backendTunnel) SetHost(host string) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return err
+	}
+
+	t.connsMtx.Lock()
+	defer t.connsMtx.Unlock()
+
+	t.host = host
+	for conn := range t.conns {
+		conn.Close()
+	}
+
+	return nil
+}
+
+// Stop closes the tunnel's listener along with the connections it's
+// forwarding, and waits for them to be torn down.
+func (t *backendTunnel) Stop() error {
+	if !atomic.CompareAndSwapInt32(&t.stopped, 0, 1) {
+		return nil
+	}
+
+	close(t.quit)
+	err := t.listener.Close()
+
+	t.connsMtx.Lock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.connsMtx.Unlock()
+
+	t.wg.Wait()
+
+	return err
+}
+
+// acceptConns accepts connections on the tunnel's listener, and forwards each
+// of them to the backend's host until the tunnel is stopped.
+//
+// NOTE: This MUST be run as a goroutine.
+func (t *backendTunnel) acceptConns() {
+	defer t.wg.Done()
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.quit:
+			default:
+				ltndLog.Errorf("Tunnel on %v stopped "+
+					"accepting connections: %v", t.Addr(),
+					err)
+			}
+			return
+		}
+
+		if !t.track(conn) {
+			conn.Close()
+			return
+		}
+
+		t.wg.Add(1)
+		go t.forward(conn)
+	}
+}
+
+// forward establishes a connection to the backend's host, and copies the data
+// of the passed local connection to it and back until either is closed.
+//
+// NOTE: This MUST be run as a goroutine.
+func (t *backendTunnel) forward(local net.Conn) {
+	defer t.wg.Done()
+	defer t.untrack(local)
+
+	t.connsMtx.Lock()
+	host, tlsConfig := t.host, t.tlsConfig
+	t.connsMtx.Unlock()
+
+	// As the dial function may not support timeouts, we'll dial within a
+	// goroutine, and give up once the tunnel is stopped.
+	resultChan := make(chan dialResult, 1)
+	go func() {
+		conn, err := t.dial("tcp", host)
+		resultChan <- dialResult{conn: conn, err: err}
+	}()
+
+	var remote net.Conn
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			ltndLog.Errorf("Unable to connect to %v: %v", host,
+				result.err)
+			return
+		}
+		remote = result.conn
+
+	case <-t.quit:
+		closeLateConn(resultChan)
+		return
+	}
+
+	if tlsConfig != nil {
+		// The host was already validated once it was set.
+		hostname, _, _ := net.SplitHostPort(host)
+		tlsConfig = tunnelTLSConfig(tlsConfig, hostname)
+
+		tlsConn := tls.Client(remote, tlsConfig)
+		if !t.track(tlsConn) {
+			tlsConn.Close()
+			return
+		}
+		defer t.untrack(tlsConn)
+
+		if err := tlsConn.Handshake(); err != nil {
+			ltndLog.Errorf("TLS handshake with %v failed: %v",
+				host, err)
+			return
+		}
+		remote = tlsConn
+	} else {
+		if !t.track(remote) {
+			remote.Close()
+			return
+		}
+		defer t.untrack(remote)
+	}
+
+	// Once either side is done, we'll tear down both connections, which
+	// unblocks the other copy.
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+	local.Close()
+	remote.Close()
+	<-done
+}
+
+// track adds the passed connection to the ones closed once the tunnel is
+// stopped. If it has already been stopped, false is returned.
+func (t *backendTunnel) track(conn net.Conn) bool {
+	t.connsMtx.Lock()
+	defer t.connsMtx.Unlock()
+
+	select {
+	case <-t.quit:
+		return false
+	default:
+	}
+
+	t.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack closes the passed connection, and removes it from the ones closed
+// once the tunnel is stopped.
+func (t *backendTunnel) untrack(conn net.Conn) {
+	conn.Close()
+
+	t.connsMtx.Lock()
+	delete(t.conns, conn)
+	t.connsMtx.Unlock()
+}
+
+// tunnelTLSConfig returns a copy of the passed TLS config, which verifies the
+// server's certificate against the given hostname of the backend's host,
+// rather than the tunnel's loopback address, unless the config sets another
+// server name. If the passed config is nil, so is the returned one.
+func tunnelTLSConfig(tlsConfig *tls.Config, hostname string) *tls.Config {
+	if tlsConfig == nil {
+		return nil
+	}
+
+	tlsConfig = tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = hostname
+	}
+
+	return tlsConfig
+}
+
+// backendTunnels is a set of tunnels to the hosts of the chain backend, all
+// forwarding connections with the same TLS config and dial function. Each
+// host is served by a single tunnel, regardless of how many of the backend's
+// endpoints it's configured for.
+type backendTunnels struct {
+	tlsConfig *tls.Config
+	dial      func(string, string) (net.Conn, error)
+
+	tunnels map[string]*backendTunnel
+}
+
+// newBackendTunnels creates an empty set of tunnels, which forward
+// connections with the given TLS config and dial function once started.
+func newBackendTunnels(tlsConfig *tls.Config,
+	dial func(string, string) (net.Conn, error)) *backendTunnels {
+
+	return &backendTunnels{
+		tlsConfig: tlsConfig,
+		dial:      dial,
+		tunnels:   make(map[string]*backendTunnel),
+	}
+}
+
+// Addr returns the loopback address of the tunnel to the given host, starting
+// the tunnel if there's none yet.
+func (b *backendTunnels) Addr(host string) (string, error) {
+	if tunnel, ok := b.tunnels[host]; ok {
+		return tunnel.Addr(), nil
+	}
+
+	tunnel, err := newBackendTunnel(host, b.tlsConfig, b.dial)
+	if err != nil {
+		return "", err
+	}
+	b.tunnels[host] = tunnel
+
+	return tunnel.Addr(), nil
+}
+
+// Stop stops all of the tunnels, returning the first error encountered.
+func (b *backendTunnels) Stop() error {
+	var firstErr error
+	for _, tunnel := range b.tunnels {
+		err := tunnel.Stop()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// onionAddr returns the address clients should connect to the given host
+// through. If it's an onion host, a tunnel routing its connections through
+// Tor is started, and its loopback address is returned in its place. Other
+// hosts are returned as is.
+func (b *backendTunnels) onionAddr(host string) (string, error) {
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil || !tor.IsOnionHost(hostname) {
+		return host, nil
+	}
+
+	tunnelAddr, err := b.Addr(host)
+	if err != nil {
+		return "", err
+	}
+
+	ltndLog.Infof("Connecting to onion host %v through Tor via %v", host,
+		tunnelAddr)
+
+	return tunnelAddr, nil
+}
+
+// onionZMQAddr returns the address the ZMQ subscription to the given endpoint
+// should connect to. TCP endpoints on onion hosts are replaced with a tunnel
+// routing their connections through Tor, as with onionAddr. Other endpoints,
+// including IPC ones, are returned as is.
+func (b *backendTunnels) onionZMQAddr(endpoint string) (string, error) {
+	if !strings.HasPrefix(endpoint, zmqTCPPrefix) {
+		return endpoint, nil
+	}
+
+	addr, err := b.onionAddr(strings.TrimPrefix(endpoint, zmqTCPPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	return zmqTCPPrefix + addr, nil
+}
+
+// startOnionTunnels routes the connections to the onion hosts of the passed
+// bitcoind backends through Tor, by replacing them with the loopback
+// addresses of tunnels dialing them with the given dial function. As the ZMQ
+// subscriptions, as well as btcwallet's connections to bitcoind, can't be
+// given a dialer, this is the only way to reach an onion backend. If the RPC
+// hosts are already connected to through TLS tunnels, which dial them through
+// Tor themselves, only the ZMQ endpoints are tunneled. The returned function
+// stops all of the tunnels.
+func startOnionTunnels(backends []bitcoindBackend,
+	dial func(string, string) (net.Conn, error),
+	tunnelRPCHosts bool) (func() error, error) {
+
+	tunnels := newBackendTunnels(nil, dial)
+	for i, backend := range backends {
+		var err error
+		if tunnelRPCHosts {
+			backends[i].rpcHost, err = tunnels.onionAddr(
+				backend.rpcHost,
+			)
+			if err != nil {
+				tunnels.Stop()
+				return nil, err
+			}
+
+			if backend.walletRPCHost != "" {
+				backends[i].walletRPCHost, err =
+					tunnels.onionAddr(backend.walletRPCHost)
+				if err != nil {
+					tunnels.Stop()
+					return nil, err
+				}
+			}
+		}
+
+		backends[i].zmqPubRawBlock, err = tunnels.onionZMQAddr(
+			backend.zmqPubRawBlock,
+		)
+		if err != nil {
+			tunnels.Stop()
+			return nil, err
+		}
+		backends[i].zmqPubRawTx, err = tunnels.onionZMQAddr(
+			backend.zmqPubRawTx,
+		)
+		if err != nil {
+			tunnels.Stop()
+			return nil, err
+		}
+	}
+
+	return tunnels.Stop, nil
+}
@@ -0,0 +1,277 @@
+// +build !rpctest
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestStartOnionTunnels ensures that the onion RPC hosts and ZMQ endpoints of
+// bitcoind backends are replaced by tunnels forwarding their connections
+// through the passed dial function, while other hosts are left untouched.
+func TestStartOnionTunnels(t *testing.T) {
+	t.Parallel()
+
+	// The server echoes each line it receives, standing in for the onion
+	// hosts the dial function connects to through Tor.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				conn.Write([]byte(line))
+			}()
+		}
+	}()
+
+	var (
+		dialedAddrs []string
+		dialMtx     sync.Mutex
+	)
+	dial := func(network, addr string) (net.Conn, error) {
+		dialMtx.Lock()
+		dialedAddrs = append(dialedAddrs, addr)
+		dialMtx.Unlock()
+
+		return net.Dial(network, listener.Addr().String())
+	}
+
+	const (
+		onionRPCHost = "3g2upl4pq6kufc4m.onion:8332"
+		onionZMQHost = "3g2upl4pq6kufc4m.onion:28332"
+		localRPCHost = "127.0.0.1:8332"
+		localZMQAddr = "tcp://127.0.0.1:28333"
+		ipcZMQAddr   = "ipc:///run/bitcoind/zmq.sock"
+	)
+	newBackends := func() []bitcoindBackend {
+		return []bitcoindBackend{
+			{
+				rpcHost:        onionRPCHost,
+				walletRPCHost:  onionRPCHost,
+				zmqPubRawBlock: "tcp://" + onionZMQHost,
+				zmqPubRawTx:    ipcZMQAddr,
+			},
+			{
+				rpcHost:        localRPCHost,
+				zmqPubRawBlock: "tcp://" + onionZMQHost,
+				zmqPubRawTx:    localZMQAddr,
+			},
+		}
+	}
+
+	backends := newBackends()
+	stopTunnels, err := startOnionTunnels(backends, dial, true)
+	if err != nil {
+		t.Fatalf("unable to start tunnels: %v", err)
+	}
+	defer stopTunnels()
+
+	rpcTunnel := backends[0].rpcHost
+	zmqTunnel := strings.TrimPrefix(backends[0].zmqPubRawBlock, "tcp://")
+	switch {
+	case !isLoopbackHost(rpcTunnel) || rpcTunnel == onionRPCHost:
+		t.Fatalf("expected onion rpc host to be tunneled, got %v",
+			rpcTunnel)
+
+	case backends[0].walletRPCHost != rpcTunnel:
+		t.Fatalf("expected wallet rpc host to share the tunnel, got %v",
+			backends[0].walletRPCHost)
+
+	case !isLoopbackHost(zmqTunnel) || zmqTunnel == rpcTunnel:
+		t.Fatalf("expected onion zmq endpoint to be tunneled, got %v",
+			backends[0].zmqPubRawBlock)
+
+	case backends[1].zmqPubRawBlock != backends[0].zmqPubRawBlock:
+		t.Fatalf("expected zmq endpoints to share the tunnel, got %v",
+			backends[1].zmqPubRawBlock)
+
+	case backends[0].zmqPubRawTx != ipcZMQAddr ||
+		backends[1].rpcHost != localRPCHost ||
+		backends[1].zmqPubRawTx != localZMQAddr:
+
+		t.Fatalf("expected other hosts to be left untouched, got %v",
+			backends)
+	}
+
+	// Connections to the tunnels should reach the onion hosts through
+	// the dial function.
+	for _, tunnelAddr := range []string{rpcTunnel, zmqTunnel} {
+		conn, err := net.Dial("tcp", tunnelAddr)
+		if err != nil {
+			t.Fatalf("unable to connect to tunnel: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if _, err := conn.Write([]byte("ping\n")); err != nil {
+			t.Fatalf("unable to write to tunnel: %v", err)
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("unable to read from tunnel: %v", err)
+		}
+		if line != "ping\n" {
+			t.Fatalf("unexpected response %q", line)
+		}
+		conn.Close()
+	}
+
+	dialMtx.Lock()
+	dialed := strings.Join(dialedAddrs, ",")
+	dialMtx.Unlock()
+	expectedAddrs := []string{onionRPCHost, onionZMQHost}
+	if dialed != strings.Join(expectedAddrs, ",") {
+		t.Fatalf("expected %v to be dialed, got %v", expectedAddrs,
+			dialed)
+	}
+
+	// If the RPC hosts are already tunneled over TLS, only the ZMQ
+	// endpoints should be tunneled.
+	backends = newBackends()
+	stopTunnels, err = startOnionTunnels(backends, dial, false)
+	if err != nil {
+		t.Fatalf("unable to start tunnels: %v", err)
+	}
+	defer stopTunnels()
+
+	if backends[0].rpcHost != onionRPCHost ||
+		backends[0].walletRPCHost != onionRPCHost {
+
+		t.Fatalf("expected rpc hosts to be left untouched, got %v",
+			backends[0])
+	}
+	if backends[0].zmqPubRawBlock == "tcp://"+onionZMQHost {
+		t.Fatalf("expected onion zmq endpoint to be tunneled")
+	}
+}
+
+// TestBackendTunnelSetTLSConfig ensures that once the TLS config of a tunnel
+// is replaced, the connections it's forwarding are closed, and new ones are
+// forwarded using the new config.
+func TestBackendTunnelSetTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	// The server presents a certificate issued by a different CA once
+	// it's rotated, which the tunnel's initial config doesn't trust.
+	issueCert := func(ca *testCertAuthority) *tls.Certificate {
+		certPEM, keyPEM := ca.issue(t)
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("unable to load server certificate: %v", err)
+		}
+		return &cert
+	}
+	rootCAs := func(ca *testCertAuthority) *tls.Config {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca.certPEM)
+		return &tls.Config{RootCAs: pool}
+	}
+	oldCA := newTestCertAuthority(t)
+	newCA := newTestCertAuthority(t)
+
+	var serverCert atomic.Value
+	serverCert.Store(issueCert(oldCA))
+
+	// The server echoes each line it receives until the connection is
+	// closed.
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate,
+			error) {
+
+			return serverCert.Load().(*tls.Certificate), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					conn.Write([]byte(line))
+				}
+			}()
+		}
+	}()
+
+	tunnel, err := newBackendTunnel(
+		listener.Addr().String(), rootCAs(oldCA), net.Dial,
+	)
+	if err != nil {
+		t.Fatalf("unable to start tunnel: %v", err)
+	}
+	defer tunnel.Stop()
+
+	connect := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", tunnel.Addr())
+		if err != nil {
+			t.Fatalf("unable to connect to tunnel: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		return conn, bufio.NewReader(conn)
+	}
+	echo := func(conn net.Conn, reader *bufio.Reader) error {
+		if _, err := conn.Write([]byte("ping\n")); err != nil {
+			return err
+		}
+		_, err := reader.ReadString('\n')
+		return err
+	}
+
+	conn, reader := connect()
+	defer conn.Close()
+	if err := echo(conn, reader); err != nil {
+		t.Fatalf("unable to echo through tunnel: %v", err)
+	}
+
+	// Once the certificate is rotated and the tunnel switches to it, the
+	// existing connection should be closed.
+	serverCert.Store(issueCert(newCA))
+	tunnel.SetTLSConfig(rootCAs(newCA))
+
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Fatalf("expected connection to be closed")
+	}
+
+	// New connections should be forwarded using the new certificate.
+	conn, reader = connect()
+	defer conn.Close()
+	if err := echo(conn, reader); err != nil {
+		t.Fatalf("unable to echo through tunnel with new "+
+			"certificate: %v", err)
+	}
+}
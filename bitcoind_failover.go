@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultFailoverCheckInterval is the interval at which the
+	// bitcoindFailover checks whether the active bitcoind node is still
+	// responding to RPC calls.
+	defaultFailoverCheckInterval = 30 * time.Second
+
+	// defaultFailoverMaxFailures is the number of consecutive failed
+	// checks of the active bitcoind node after which the bitcoindFailover
+	// fails over to the next reachable node.
+	defaultFailoverMaxFailures = 3
+)
+
+// connectBitcoindBackends attempts to connect to each of the passed bitcoind
+// nodes in order of preference, until the connection to one of them succeeds.
+// The index of the connected node is returned, or the error of the last node
+// if none of them could be connected to.
+func connectBitcoindBackends(backends []bitcoindBackend,
+	connect func(bitcoindBackend) error) (int, error) {
+
+	var err error
+	for i, backend := range backends {
+		err = connect(backend)
+		if err != nil {
+			if len(backends) > 1 {
+				ltndLog.Warnf("Unable to connect to bitcoind at "+
+					"%v: %v", backend.rpcHost, err)
+			}
+			continue
+		}
+
+		if i > 0 {
+			ltndLog.Infof("Failed over to bitcoind at %v",
+				backend.rpcHost)
+		}
+
+		return i, nil
+	}
+
+	return 0, err
+}
+
+// preflightBitcoindBackends ensures that all endpoints of at least one of the
+// passed bitcoind nodes are reachable. If none of them are, an error listing
+// the unreachable endpoints of each node is returned.
+func preflightBitcoindBackends(ctx context.Context,
+	dial func(string, string) (net.Conn, error),
+	backends []bitcoindBackend, timeout time.Duration) error {
+
+	var errs []string
+	for _, backend := range backends {
+		err := preflightEndpoints(
+			ctx, dial, backend.rpcHost, backend.zmqPubRawBlock,
+			backend.zmqPubRawTx, timeout,
+		)
+		if err == nil {
+			return nil
+		}
+
+		// A single node's error is returned as is, so it reads the
+		// same as without failover.
+		if len(backends) == 1 {
+			return err
+		}
+
+		errs = append(errs, fmt.Sprintf("%v: %v", backend.rpcHost,
+			err))
+	}
+
+	return fmt.Errorf("none of the bitcoind nodes are reachable: %v",
+		strings.Join(errs, "; "))
+}
+
+// bitcoindSwitch routes the connections to bitcoind through a local RPC tunnel
+// and ZMQ relays, which can be pointed at another node while lnd is running.
+// btcwallet's connection, along with the chain notifier, chain view and
+// wallet bound to it, can't be rebound to another node, so they connect to
+// the switch instead, and keep their registrations across a failover.
+type bitcoindSwitch struct {
+	rpcTunnel  *backendTunnel
+	blockRelay *zmqRelay
+	txRelay    *zmqRelay
+
+	// active is the node connections are currently routed to.
+	active    bitcoindBackend
+	activeMtx sync.Mutex
+}
+
+// newBitcoindSwitch starts a switch routing connections to the passed bitcoind
+// node, dialing it with the given dial function.
+func newBitcoindSwitch(backend bitcoindBackend,
+	dial func(string, string) (net.Conn, error)) (*bitcoindSwitch, error) {
+
+	rpcTunnel, err := newBackendTunnel(backend.rpcHost, nil, dial)
+	if err != nil {
+		return nil, err
+	}
+	blockRelay, err := newZMQRelay(
+		backend.zmqPubRawBlock, dial, defaultZMQMinReconnectBackoff,
+		defaultZMQMaxReconnectBackoff,
+	)
+	if err != nil {
+		rpcTunnel.Stop()
+		return nil, err
+	}
+	txRelay, err := newZMQRelay(
+		backend.zmqPubRawTx, dial, defaultZMQMinReconnectBackoff,
+		defaultZMQMaxReconnectBackoff,
+	)
+	if err != nil {
+		rpcTunnel.Stop()
+		blockRelay.Stop()
+		return nil, err
+	}
+
+	return &bitcoindSwitch{
+		rpcTunnel:  rpcTunnel,
+		blockRelay: blockRelay,
+		txRelay:    txRelay,
+		active:     backend,
+	}, nil
+}
+
+// Backend returns the local endpoints clients should connect to in place of
+// the active node's ones.
+func (s *bitcoindSwitch) Backend() bitcoindBackend {
+	return bitcoindBackend{
+		rpcHost:        s.rpcTunnel.Addr(),
+		zmqPubRawBlock: s.blockRelay.Endpoint(),
+		zmqPubRawTx:    s.txRelay.Endpoint(),
+	}
+}
+
+// Active returns the node connections are currently routed to.
+func (s *bitcoindSwitch) Active() bitcoindBackend {
+	s.activeMtx.Lock()
+	defer s.activeMtx.Unlock()
+
+	return s.active
+}
+
+// Relays returns the ZMQ relays of the switch.
+func (s *bitcoindSwitch) Relays() zmqRelays {
+	return zmqRelays{s.blockRelay, s.txRelay}
+}
+
+// Switch routes connections to the passed node. The RPC connections to the
+// previously active node are closed, so clients reconnect to the new node,
+// and the ZMQ subscriptions are replayed to it.
+func (s *bitcoindSwitch) Switch(backend bitcoindBackend) error {
+	s.activeMtx.Lock()
+	defer s.activeMtx.Unlock()
+
+	if err := s.rpcTunnel.SetHost(backend.rpcHost); err != nil {
+		return err
+	}
+	s.blockRelay.SetEndpoint(backend.zmqPubRawBlock)
+	s.txRelay.SetEndpoint(backend.zmqPubRawTx)
+	s.active = backend
+
+	return nil
+}
+
+// Stop stops the RPC tunnel and ZMQ relays of the switch, returning the first
+// error encountered.
+func (s *bitcoindSwitch) Stop() error {
+	err := s.rpcTunnel.Stop()
+	if relaysErr := s.Relays().Stop(); err == nil {
+		err = relaysErr
+	}
+
+	return err
+}
+
+// bitcoindFailoverConfig houses the functions and parameters the
+// bitcoindFailover requires in order to monitor the active bitcoind node.
+type bitcoindFailoverConfig struct {
+	// Backends are the configured bitcoind nodes, in order of
+	// preference.
+	Backends []bitcoindBackend
+
+	// Active is the index of the node lnd is connected to at startup.
+	Active int
+
+	// Check returns an error if the active node doesn't respond to RPC
+	// calls.
+	Check func() error
+
+	// Reachable returns an error if the given node can't be reached.
+	Reachable func(bitcoindBackend) error
+
+	// FailOver is called once the active node failed MaxFailures
+	// consecutive checks, along with the next reachable node, and is
+	// expected to route lnd's connections to the latter.
+	FailOver func(from, to bitcoindBackend) error
+
+	// CheckInterval is the interval at which the active node is checked.
+	CheckInterval time.Duration
+
+	// MaxFailures is the number of consecutive failed checks after which
+	// we fail over to the next reachable node.
+	MaxFailures int
+}
+
+// bitcoindFailover monitors the active bitcoind node when several nodes are
+// configured. Once the active node repeatedly fails to respond to RPC calls,
+// it fails over to the next of the configured nodes that is reachable, which
+// is monitored from then on.
+type bitcoindFailover struct {
+	started int32 // To be used atomically.
+	stopped int32 // To be used atomically.
+
+	cfg *bitcoindFailoverConfig
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// newBitcoindFailover creates a new bitcoindFailover from the given config.
+func newBitcoindFailover(cfg *bitcoindFailoverConfig) *bitcoindFailover {
+	return &bitcoindFailover{
+		cfg:  cfg,
+		quit: make(chan struct{}),
+	}
+}
+
+// Start launches the goroutine which monitors the active node.
+func (f *bitcoindFailover) Start() error {
+	if !atomic.CompareAndSwapInt32(&f.started, 0, 1) {
+		return nil
+	}
+
+	f.wg.Add(1)
+	go f.monitor()
+
+	return nil
+}
+
+// Stop signals the failover to exit, and waits for it to do so.
+func (f *bitcoindFailover) Stop() error {
+	if !atomic.CompareAndSwapInt32(&f.stopped, 0, 1) {
+		return nil
+	}
+
+	close(f.quit)
+	f.wg.Wait()
+
+	return nil
+}
+
+// monitor periodically checks the active node, and fails over to the next
+// reachable node once the active one failed too many consecutive checks.
+//
+// NOTE: This MUST be run as a goroutine.
+func (f *bitcoindFailover) monitor() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	var (
+		active   = f.cfg.Active
+		failures int
+	)
+	for {
+		select {
+		case <-ticker.C:
+		case <-f.quit:
+			return
+		}
+
+		err := f.cfg.Check()
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+		ltndLog.Warnf("bitcoind at %v failed to respond (%d of %d): "+
+			"%v", f.cfg.Backends[active].rpcHost, failures,
+			f.cfg.MaxFailures, err)
+
+		if failures < f.cfg.MaxFailures {
+			continue
+		}
+
+		failures = 0
+		next, ok := f.failOver(active)
+		if !ok {
+			ltndLog.Errorf("Unable to fail over from bitcoind at "+
+				"%v, no other node is reachable",
+				f.cfg.Backends[active].rpcHost)
+			continue
+		}
+		active = next
+	}
+}
+
+// failOver fails over from the active node to the next reachable one, in
+// order of preference after the active one. The index of the node failed over
+// to is returned, along with whether any was reachable.
+func (f *bitcoindFailover) failOver(active int) (int, bool) {
+	from := f.cfg.Backends[active]
+
+	numBackends := len(f.cfg.Backends)
+	for i := 1; i < numBackends; i++ {
+		next := (active + i) % numBackends
+		to := f.cfg.Backends[next]
+		if err := f.cfg.Reachable(to); err != nil {
+			ltndLog.Debugf("bitcoind at %v is unreachable: %v",
+				to.rpcHost, err)
+			continue
+		}
+
+		ltndLog.Warnf("Failing over from bitcoind at %v to %v",
+			from.rpcHost, to.rpcHost)
+		if err := f.cfg.FailOver(from, to); err != nil {
+			ltndLog.Errorf("Unable to fail over to bitcoind at "+
+				"%v: %v", to.rpcHost, err)
+			continue
+		}
+
+		return next, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,385 @@
+// +build !rpctest
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestConnectBitcoindBackends ensures that we connect to the first of the
+// configured bitcoind nodes which accepts the connection.
+func TestConnectBitcoindBackends(t *testing.T) {
+	t.Parallel()
+
+	backends := []bitcoindBackend{
+		{rpcHost: "primary:8332"},
+		{rpcHost: "secondary:8332"},
+		{rpcHost: "tertiary:8332"},
+	}
+
+	var attempted []string
+	active, err := connectBitcoindBackends(
+		backends, func(backend bitcoindBackend) error {
+			attempted = append(attempted, backend.rpcHost)
+			if backend.rpcHost == "primary:8332" {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	if active != 1 {
+		t.Fatalf("expected to connect to backend 1, got %d", active)
+	}
+	if len(attempted) != 2 {
+		t.Fatalf("expected 2 connection attempts, got %v", attempted)
+	}
+
+	// If none of the nodes accept the connection, the last error should be
+	// returned.
+	errLast := errors.New("last node unreachable")
+	_, err = connectBitcoindBackends(
+		backends, func(backend bitcoindBackend) error {
+			if backend.rpcHost == "tertiary:8332" {
+				return errLast
+			}
+			return errors.New("connection refused")
+		},
+	)
+	if err != errLast {
+		t.Fatalf("expected %v, got %v", errLast, err)
+	}
+}
+
+// TestBitcoindFailover ensures that the bitcoindFailover fails over to the
+// next reachable node once the active node fails mid-session, and keeps
+// monitoring the node it failed over to.
+func TestBitcoindFailover(t *testing.T) {
+	t.Parallel()
+
+	const maxFailures = 3
+
+	backends := []bitcoindBackend{
+		{rpcHost: "primary:8332"},
+		{rpcHost: "secondary:8332"},
+		{rpcHost: "tertiary:8332"},
+	}
+
+	// down is the set of nodes that are down, keyed by their RPC host.
+	var down atomic.Value
+	down.Store(map[string]bool{})
+	isDown := func(rpcHost string) bool {
+		return down.Load().(map[string]bool)[rpcHost]
+	}
+
+	var (
+		active    atomic.Value
+		numChecks int32
+	)
+	active.Store(backends[0].rpcHost)
+
+	type failOver struct {
+		from, to bitcoindBackend
+	}
+	failedOver := make(chan failOver, 1)
+	failover := newBitcoindFailover(&bitcoindFailoverConfig{
+		Backends: backends,
+		Active:   0,
+		Check: func() error {
+			if !isDown(active.Load().(string)) {
+				return nil
+			}
+
+			atomic.AddInt32(&numChecks, 1)
+			return errors.New("connection refused")
+		},
+		Reachable: func(backend bitcoindBackend) error {
+			if isDown(backend.rpcHost) {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+		FailOver: func(from, to bitcoindBackend) error {
+			active.Store(to.rpcHost)
+			failedOver <- failOver{from, to}
+			return nil
+		},
+		CheckInterval: 10 * time.Millisecond,
+		MaxFailures:   maxFailures,
+	})
+	if err := failover.Start(); err != nil {
+		t.Fatalf("unable to start failover: %v", err)
+	}
+	defer failover.Stop()
+
+	assertFailOver := func(from, to string) {
+		t.Helper()
+
+		select {
+		case f := <-failedOver:
+			if f.from.rpcHost != from {
+				t.Fatalf("expected to fail over from %v, "+
+					"got %v", from, f.from.rpcHost)
+			}
+			if f.to.rpcHost != to {
+				t.Fatalf("expected to fail over to %v, got "+
+					"%v", to, f.to.rpcHost)
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("failover didn't happen")
+		}
+
+		if atomic.LoadInt32(&numChecks) != maxFailures {
+			t.Fatalf("expected %d failed checks, got %d",
+				maxFailures, atomic.LoadInt32(&numChecks))
+		}
+		atomic.StoreInt32(&numChecks, 0)
+	}
+
+	// While the primary node responds, we shouldn't fail over.
+	select {
+	case <-failedOver:
+		t.Fatalf("unexpected failover")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Now, we'll take the primary node down along with the secondary one,
+	// which should cause us to fail over to the tertiary node after the
+	// maximum number of failed checks.
+	down.Store(map[string]bool{
+		"primary:8332":   true,
+		"secondary:8332": true,
+	})
+	assertFailOver("primary:8332", "tertiary:8332")
+
+	// The tertiary node should be monitored from then on, so once it goes
+	// down as well while the primary node is back, we should fail over to
+	// the latter.
+	down.Store(map[string]bool{
+		"secondary:8332": true,
+		"tertiary:8332":  true,
+	})
+	assertFailOver("tertiary:8332", "primary:8332")
+}
+
+// fakeBitcoind is a bitcoind node serving RPC calls over HTTP, which answer
+// with its name, and publishing messages over ZMQ.
+type fakeBitcoind struct {
+	name string
+	rpc  *httptest.Server
+	zmq  net.Listener
+
+	// subscribers delivers the connections of the node's ZMQ subscribers
+	// once they've subscribed.
+	subscribers chan net.Conn
+}
+
+// newFakeBitcoind starts a fakeBitcoind with the given name.
+func newFakeBitcoind(t *testing.T, name string) *fakeBitcoind {
+	t.Helper()
+
+	zmqListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+
+	node := &fakeBitcoind{
+		name: name,
+		rpc: httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name))
+			},
+		)),
+		zmq:         zmqListener,
+		subscribers: make(chan net.Conn, 10),
+	}
+
+	// Connections which don't complete the handshake, such as the ones
+	// checking whether the node is reachable, are ignored.
+	go func() {
+		for {
+			conn, err := zmqListener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				err := zmqHandshake(conn, "PUB")
+				if err != nil {
+					conn.Close()
+					return
+				}
+				if _, err := readZMQFrame(conn); err != nil {
+					conn.Close()
+					return
+				}
+				node.subscribers <- conn
+			}()
+		}
+	}()
+
+	return node
+}
+
+// backend returns the endpoints of the node.
+func (n *fakeBitcoind) backend() bitcoindBackend {
+	zmqEndpoint := zmqTCPPrefix + n.zmq.Addr().String()
+	return bitcoindBackend{
+		rpcHost:        n.rpc.Listener.Addr().String(),
+		zmqPubRawBlock: zmqEndpoint,
+		zmqPubRawTx:    zmqEndpoint,
+	}
+}
+
+// subscriber returns the connection of the node's next ZMQ subscriber.
+func (n *fakeBitcoind) subscriber(t *testing.T) net.Conn {
+	t.Helper()
+
+	select {
+	case conn := <-n.subscribers:
+		return conn
+	case <-time.After(zmqTestTimeout):
+		t.Fatalf("no subscriber connected to %v", n.name)
+		return nil
+	}
+}
+
+// stop takes the node down, closing all of its connections.
+func (n *fakeBitcoind) stop() {
+	n.rpc.CloseClientConnections()
+	n.rpc.Close()
+	n.zmq.Close()
+
+	for {
+		select {
+		case conn := <-n.subscribers:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// TestBitcoindSwitchFailover ensures that once the primary bitcoind node goes
+// down mid-session, the RPC calls and ZMQ subscriptions made through the
+// bitcoindSwitch fail over to the secondary node, without their clients
+// having to reconnect to another address.
+func TestBitcoindSwitchFailover(t *testing.T) {
+	t.Parallel()
+
+	primary := newFakeBitcoind(t, "primary")
+	defer primary.stop()
+	secondary := newFakeBitcoind(t, "secondary")
+	defer secondary.stop()
+
+	backends := []bitcoindBackend{primary.backend(), secondary.backend()}
+	bitcoindSwitch, err := newBitcoindSwitch(backends[0], net.Dial)
+	if err != nil {
+		t.Fatalf("unable to start switch: %v", err)
+	}
+	defer bitcoindSwitch.Stop()
+
+	// The clients connect to the switch's endpoints, as the RPC client and
+	// ZMQ subscriptions of btcwallet's connection would.
+	local := bitcoindSwitch.Backend()
+	client := &http.Client{Timeout: time.Second}
+	call := func() (string, error) {
+		resp, err := client.Post(
+			"http://"+local.rpcHost, "application/json",
+			strings.NewReader("{}"),
+		)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		name, err := ioutil.ReadAll(resp.Body)
+		return string(name), err
+	}
+
+	sub := dialZMQSubscriber(t, local.zmqPubRawBlock, "rawblock")
+	defer sub.Close()
+
+	pub := primary.subscriber(t)
+	publishZMQ(t, pub, "rawblock", "primary block")
+	receiveZMQ(t, sub, "rawblock", "primary block")
+
+	if name, err := call(); err != nil || name != "primary" {
+		t.Fatalf("expected call to reach primary, got %v: %v", name,
+			err)
+	}
+
+	failedOver := make(chan bitcoindBackend, 1)
+	failover := newBitcoindFailover(&bitcoindFailoverConfig{
+		Backends: backends,
+		Active:   0,
+		Check: func() error {
+			_, err := call()
+			return err
+		},
+		Reachable: func(backend bitcoindBackend) error {
+			return preflightEndpoints(
+				context.Background(), net.Dial,
+				backend.rpcHost, backend.zmqPubRawBlock,
+				backend.zmqPubRawTx, time.Second,
+			)
+		},
+		FailOver: func(_, to bitcoindBackend) error {
+			err := bitcoindSwitch.Switch(to)
+			failedOver <- to
+			return err
+		},
+		CheckInterval: 10 * time.Millisecond,
+		MaxFailures:   3,
+	})
+	if err := failover.Start(); err != nil {
+		t.Fatalf("unable to start failover: %v", err)
+	}
+	defer failover.Stop()
+
+	// Now, we'll take the primary node down mid-session, which should
+	// cause us to fail over to the secondary one.
+	primary.stop()
+
+	select {
+	case to := <-failedOver:
+		if to.rpcHost != backends[1].rpcHost {
+			t.Fatalf("expected to fail over to secondary, got %v",
+				to.rpcHost)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("failover didn't happen")
+	}
+
+	if active := bitcoindSwitch.Active(); active != backends[1] {
+		t.Fatalf("expected secondary to be active, got %v",
+			active.rpcHost)
+	}
+
+	// The ZMQ subscription should be replayed to the secondary node, and
+	// its messages delivered over the subscriber's original connection.
+	pub = secondary.subscriber(t)
+	publishZMQ(t, pub, "rawblock", "secondary block")
+	receiveZMQ(t, sub, "rawblock", "secondary block")
+
+	// The RPC calls should reach the secondary node through the same
+	// address as well.
+	name, err := call()
+	if err != nil || name != "secondary" {
+		t.Fatalf("expected call to reach secondary, got %v: %v", name,
+			err)
+	}
+}
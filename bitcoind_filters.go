@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil/gcs"
+	"github.com/btcsuite/btcutil/gcs/builder"
+	"github.com/lightningnetwork/lnd/routing/chainview"
+)
+
+// bitcoindFilterIndex is the name of bitcoind's index of the BIP 158 basic
+// compact filters of blocks, as reported by getindexinfo.
+const bitcoindFilterIndex = "basic block filter index"
+
+// bitcoindBlockFilterSource obtains the compact filters of blocks through
+// bitcoind's getblockfilter RPC, which requires its block filter index to be
+// enabled through blockfilterindex=1.
+type bitcoindBlockFilterSource struct {
+	client rawRequester
+}
+
+// A compile time check to ensure bitcoindBlockFilterSource implements the
+// chainview.BlockFilterSource interface.
+var _ chainview.BlockFilterSource = (*bitcoindBlockFilterSource)(nil)
+
+// GetBlockFilter returns the basic compact filter of the block with the given
+// hash.
+//
+// NOTE: This is part of the chainview.BlockFilterSource interface.
+func (s *bitcoindBlockFilterSource) GetBlockFilter(
+	blockHash *chainhash.Hash) (*gcs.Filter, error) {
+
+	hashParam, err := json.Marshal(blockHash.String())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.RawRequest(
+		"getblockfilter", []json.RawMessage{hashParam},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Filter string `json:"filter"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+	filterBytes, err := hex.DecodeString(result.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter of block %v: %v",
+			blockHash, err)
+	}
+
+	return gcs.FromNBytes(builder.DefaultP, builder.DefaultM, filterBytes)
+}
+
+// bitcoindCompactFilterSource returns the source of the compact filters the
+// chain view matches blocks against if enabled through usecompactfilters. As
+// they're only complete once bitcoind's block filter index is synced, nil is
+// returned with a warning if getindexinfo doesn't report a synced index, in
+// which case the chain view falls back to fetching each block it filters.
+func bitcoindCompactFilterSource(client rawRequester,
+	useCompactFilters bool) (chainview.BlockFilterSource, error) {
+
+	if !useCompactFilters {
+		return nil, nil
+	}
+
+	var indexes map[string]struct {
+		Synced bool `json:"synced"`
+	}
+	err := rawRequest(client, "getindexinfo", &indexes)
+	rpcErr, ok := err.(*btcjson.RPCError)
+	switch {
+	// getindexinfo is only supported as of bitcoind 0.21, so older
+	// versions can't tell us whether the index is available.
+	case ok && rpcErr.Code == btcjson.ErrRPCMethodNotFound.Code:
+		ltndLog.Warnf("bitcoind doesn't support getindexinfo, which " +
+			"requires version 0.21 or later, so compact filters " +
+			"won't be used")
+		return nil, nil
+
+	case err != nil:
+		return nil, fmt.Errorf("unable to query bitcoind's indexes: %v",
+			err)
+	}
+
+	index, ok := indexes[bitcoindFilterIndex]
+	switch {
+	case !ok:
+		ltndLog.Warnf("bitcoind's block filter index isn't enabled, " +
+			"so compact filters won't be used. Set " +
+			"blockfilterindex=1 in bitcoind's config to enable it")
+		return nil, nil
+
+	case !index.Synced:
+		ltndLog.Warnf("bitcoind's block filter index is still " +
+			"syncing, so compact filters won't be used until lnd " +
+			"is restarted once it's synced")
+		return nil, nil
+	}
+
+	ltndLog.Infof("Using bitcoind's compact filters for the chain view")
+
+	return &bitcoindBlockFilterSource{client: client}, nil
+}
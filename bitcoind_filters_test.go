@@ -0,0 +1,170 @@
+// +build !rpctest
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// failingRawRequester is a rawRequester which fails all RPC calls with the
+// given error.
+type failingRawRequester struct {
+	err error
+}
+
+func (f *failingRawRequester) RawRequest(method string,
+	params []json.RawMessage) (json.RawMessage, error) {
+
+	return nil, f.err
+}
+
+// TestBitcoindCompactFilterSource ensures that bitcoind's compact filters are
+// only used if enabled and its block filter index is synced, falling back to
+// fetching blocks otherwise.
+func TestBitcoindCompactFilterSource(t *testing.T) {
+	t.Parallel()
+
+	const (
+		syncedIndex = `{"basic block filter index": ` +
+			`{"synced": true}}`
+		syncingIndex = `{"basic block filter index": ` +
+			`{"synced": false}}`
+	)
+
+	tests := []struct {
+		name              string
+		client            rawRequester
+		useCompactFilters bool
+		useFilters        bool
+		valid             bool
+	}{
+		{
+			name: "disabled",
+			client: &mockRawRequester{
+				responses: map[string]string{
+					"getindexinfo": syncedIndex,
+				},
+			},
+			useCompactFilters: false,
+			useFilters:        false,
+			valid:             true,
+		},
+		{
+			name: "index synced",
+			client: &mockRawRequester{
+				responses: map[string]string{
+					"getindexinfo": `{"txindex": ` +
+						`{"synced": true}, "basic ` +
+						`block filter index": ` +
+						`{"synced": true}}`,
+				},
+			},
+			useCompactFilters: true,
+			useFilters:        true,
+			valid:             true,
+		},
+		{
+			name: "index syncing",
+			client: &mockRawRequester{
+				responses: map[string]string{
+					"getindexinfo": syncingIndex,
+				},
+			},
+			useCompactFilters: true,
+			useFilters:        false,
+			valid:             true,
+		},
+		{
+			name: "index disabled",
+			client: &mockRawRequester{
+				responses: map[string]string{
+					"getindexinfo": `{"txindex": ` +
+						`{"synced": true}}`,
+				},
+			},
+			useCompactFilters: true,
+			useFilters:        false,
+			valid:             true,
+		},
+		{
+			name: "getindexinfo unsupported",
+			client: &failingRawRequester{
+				err: btcjson.ErrRPCMethodNotFound,
+			},
+			useCompactFilters: true,
+			useFilters:        false,
+			valid:             true,
+		},
+		{
+			name: "getindexinfo failed",
+			client: &failingRawRequester{
+				err: errors.New("connection refused"),
+			},
+			useCompactFilters: true,
+			valid:             false,
+		},
+	}
+
+	for _, test := range tests {
+		filterSource, err := bitcoindCompactFilterSource(
+			test.client, test.useCompactFilters,
+		)
+		if test.valid != (err == nil) {
+			t.Fatalf("%s: expected valid=%v, got err=%v", test.name,
+				test.valid, err)
+		}
+		if !test.valid {
+			continue
+		}
+
+		if test.useFilters != (filterSource != nil) {
+			t.Fatalf("%s: expected compact filters to be used=%v, "+
+				"got %v", test.name, test.useFilters,
+				filterSource != nil)
+		}
+	}
+}
+
+// TestBitcoindBlockFilterSource ensures that the compact filters of blocks are
+// decoded from bitcoind's getblockfilter responses.
+func TestBitcoindBlockFilterSource(t *testing.T) {
+	t.Parallel()
+
+	// The basic filter of testnet's genesis block, matching a single
+	// output script, as listed within BIP 158's test vectors.
+	blockHash, err := chainhash.NewHashFromStr("000000000933ea01ad0ee984" +
+		"209779baaec3ced90fa3f408719526f8d77f4943")
+	if err != nil {
+		t.Fatalf("unable to parse block hash: %v", err)
+	}
+	filterSource := &bitcoindBlockFilterSource{
+		client: &mockRawRequester{
+			responses: map[string]string{
+				"getblockfilter": `{"filter": "019dfca8"}`,
+			},
+		},
+	}
+
+	filter, err := filterSource.GetBlockFilter(blockHash)
+	if err != nil {
+		t.Fatalf("unable to get block filter: %v", err)
+	}
+	if filter.N() != 1 {
+		t.Fatalf("expected filter with 1 element, got %d", filter.N())
+	}
+
+	// A filter that isn't hex encoded should be rejected.
+	filterSource.client = &mockRawRequester{
+		responses: map[string]string{
+			"getblockfilter": `{"filter": "not hex"}`,
+		},
+	}
+	if _, err := filterSource.GetBlockFilter(blockHash); err == nil {
+		t.Fatalf("expected invalid filter to be rejected")
+	}
+}
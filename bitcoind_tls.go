@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+)
+
+// bitcoindTLSConfig returns the TLS config to connect to bitcoind's RPC server
+// over mutual TLS with, e.g. when it's behind a proxy terminating TLS, if a
+// client certificate was set through rpcclientcert and rpcclientkey. The
+// server is verified against the CA certificate set through rpccacert, or the
+// system's root CAs otherwise. If no client certificate was set, nil is
+// returned, so the connection remains plaintext.
+func bitcoindTLSConfig(bitcoindMode *bitcoindConfig) (*tls.Config, error) {
+
+	certPath := bitcoindMode.RPCClientCert
+	keyPath := bitcoindMode.RPCClientKey
+	switch {
+	case certPath == "" && keyPath == "" && bitcoindMode.RPCCACert == "":
+		return nil, nil
+
+	case certPath == "" || keyPath == "":
+		return nil, errors.New("bitcoind.rpcclientcert and " +
+			"bitcoind.rpcclientkey must be set together, and are " +
+			"required by bitcoind.rpccacert")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load RPC client certificate "+
+			"%v and key %v: %v", certPath, keyPath, err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if bitcoindMode.RPCCACert != "" {
+		caCert, err := ioutil.ReadFile(bitcoindMode.RPCCACert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read RPC CA "+
+				"certificate: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no PEM-encoded certificates "+
+				"found in RPC CA certificate %v",
+				bitcoindMode.RPCCACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// startRPCTLSTunnels starts a tunnel to each of the distinct RPC hosts of the
+// passed bitcoind backends, forwarding connections over TLS with the given
+// config, and replaces the hosts with the tunnels' loopback addresses. The
+// returned function stops all of the tunnels.
+func startRPCTLSTunnels(backends []bitcoindBackend, tlsConfig *tls.Config,
+	dial func(string, string) (net.Conn, error)) (func() error, error) {
+
+	tunnels := newBackendTunnels(tlsConfig, dial)
+	tunnelAddr := func(rpcHost string) (string, error) {
+		addr, err := tunnels.Addr(rpcHost)
+		if err != nil {
+			return "", err
+		}
+
+		ltndLog.Infof("Connecting to RPC host %v over TLS through %v",
+			rpcHost, addr)
+
+		return addr, nil
+	}
+
+	for i, backend := range backends {
+		rpcHost, err := tunnelAddr(backend.rpcHost)
+		if err != nil {
+			tunnels.Stop()
+			return nil, err
+		}
+		backends[i].rpcHost = rpcHost
+
+		if backend.walletRPCHost == "" {
+			continue
+		}
+		walletRPCHost, err := tunnelAddr(backend.walletRPCHost)
+		if err != nil {
+			tunnels.Stop()
+			return nil, err
+		}
+		backends[i].walletRPCHost = walletRPCHost
+	}
+
+	return tunnels.Stop, nil
+}
@@ -0,0 +1,348 @@
+// +build !rpctest
+
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertAuthority is a CA issuing certificates for both TLS clients and
+// servers on the loopback interface.
+type testCertAuthority struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	serial  int64
+}
+
+func newTestCertAuthority(t *testing.T) *testCertAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	derBytes, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key,
+	)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(derBytes)
+	if err != nil {
+		t.Fatalf("unable to parse certificate: %v", err)
+	}
+
+	return &testCertAuthority{
+		cert: cert,
+		key:  key,
+		certPEM: pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: derBytes,
+		}),
+		serial: 1,
+	}
+}
+
+// issue returns a PEM-encoded certificate signed by the CA along with its
+// PEM-encoded private key.
+func (ca *testCertAuthority) issue(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth,
+		},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	derBytes, err := x509.CreateCertificate(
+		rand.Reader, template, ca.cert, &key.PublicKey, ca.key,
+	)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: derBytes,
+	})
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: keyBytes,
+	})
+
+	return certPEM, keyPEM
+}
+
+// TestBitcoindTLSConfig ensures that the TLS config for mutual TLS connections
+// to bitcoind is built from the configured client certificate, key and CA
+// certificate, and that incomplete or invalid ones are rejected.
+func TestBitcoindTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bitcoindtls")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name string, contents []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, contents, 0600); err != nil {
+			t.Fatalf("unable to write %v: %v", name, err)
+		}
+		return path
+	}
+
+	ca := newTestCertAuthority(t)
+	certPEM, keyPEM := ca.issue(t)
+	_, otherKeyPEM := ca.issue(t)
+
+	certPath := writeFile("client.cert", certPEM)
+	keyPath := writeFile("client.key", keyPEM)
+	otherKeyPath := writeFile("other.key", otherKeyPEM)
+	caPath := writeFile("ca.cert", ca.certPEM)
+	invalidPath := writeFile("invalid.cert", []byte("not a cert"))
+
+	tests := []struct {
+		name    string
+		cfg     *bitcoindConfig
+		tls     bool
+		rootCAs bool
+		err     string
+	}{
+		{
+			name: "plaintext",
+			cfg:  &bitcoindConfig{},
+		},
+		{
+			name: "client cert",
+			cfg: &bitcoindConfig{
+				RPCClientCert: certPath,
+				RPCClientKey:  keyPath,
+			},
+			tls: true,
+		},
+		{
+			name: "client cert with ca",
+			cfg: &bitcoindConfig{
+				RPCClientCert: certPath,
+				RPCClientKey:  keyPath,
+				RPCCACert:     caPath,
+			},
+			tls:     true,
+			rootCAs: true,
+		},
+		{
+			name: "missing key",
+			cfg: &bitcoindConfig{
+				RPCClientCert: certPath,
+			},
+			err: "must be set together",
+		},
+		{
+			name: "ca without client cert",
+			cfg: &bitcoindConfig{
+				RPCCACert: caPath,
+			},
+			err: "must be set together",
+		},
+		{
+			name: "mismatched key",
+			cfg: &bitcoindConfig{
+				RPCClientCert: certPath,
+				RPCClientKey:  otherKeyPath,
+			},
+			err: "unable to load RPC client certificate",
+		},
+		{
+			name: "invalid ca",
+			cfg: &bitcoindConfig{
+				RPCClientCert: certPath,
+				RPCClientKey:  keyPath,
+				RPCCACert:     invalidPath,
+			},
+			err: "no PEM-encoded certificates",
+		},
+	}
+
+	for _, test := range tests {
+		tlsConfig, err := bitcoindTLSConfig(test.cfg)
+		switch {
+		case test.err == "" && err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+
+		case test.err != "" && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Fatalf("%s: expected error to contain %q, got: %v",
+				test.name, test.err, err)
+		}
+
+		if (tlsConfig != nil) != test.tls {
+			t.Fatalf("%s: expected tls to be %v", test.name,
+				test.tls)
+		}
+		if tlsConfig == nil {
+			continue
+		}
+
+		if len(tlsConfig.Certificates) != 1 {
+			t.Fatalf("%s: expected client certificate to be set",
+				test.name)
+		}
+		if (tlsConfig.RootCAs != nil) != test.rootCAs {
+			t.Fatalf("%s: expected root CAs to be set: %v",
+				test.name, test.rootCAs)
+		}
+	}
+}
+
+// TestRPCTLSTunnel ensures that the plaintext connections accepted by the
+// tunnel are forwarded to a server requiring mutual TLS, presenting the client
+// certificate on their behalf, and that a host shared between backends is
+// served by a single tunnel.
+func TestRPCTLSTunnel(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCertAuthority(t)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.certPEM)
+
+	serverCertPEM, serverKeyPEM := ca.issue(t)
+	serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	if err != nil {
+		t.Fatalf("unable to load server certificate: %v", err)
+	}
+	clientCertPEM, clientKeyPEM := ca.issue(t)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatalf("unable to load client certificate: %v", err)
+	}
+
+	// The server echoes each line it receives, as long as the client
+	// presented a certificate issued by the CA.
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				conn.Write([]byte(line))
+			}()
+		}
+	}()
+	rpcHost := listener.Addr().String()
+
+	backends := []bitcoindBackend{
+		{rpcHost: rpcHost, walletRPCHost: rpcHost},
+		{rpcHost: rpcHost},
+	}
+	stopTunnels, err := startRPCTLSTunnels(backends, &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      pool,
+	}, net.Dial)
+	if err != nil {
+		t.Fatalf("unable to start tunnels: %v", err)
+	}
+	defer stopTunnels()
+
+	tunnelAddr := backends[0].rpcHost
+	if tunnelAddr == rpcHost {
+		t.Fatalf("expected rpc host to be replaced by the tunnel")
+	}
+	if backends[0].walletRPCHost != tunnelAddr ||
+		backends[1].rpcHost != tunnelAddr {
+
+		t.Fatalf("expected a single tunnel for the shared host, got "+
+			"%v", backends)
+	}
+	if _, ok := bitcoindWalletBackend(backends[0]); ok {
+		t.Fatalf("expected wallet to remain served by the same node")
+	}
+
+	conn, err := net.Dial("tcp", tunnelAddr)
+	if err != nil {
+		t.Fatalf("unable to connect to tunnel: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte("getblockchaininfo\n")); err != nil {
+		t.Fatalf("unable to write to tunnel: %v", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("unable to read from tunnel: %v", err)
+	}
+	if line != "getblockchaininfo\n" {
+		t.Fatalf("expected request to be echoed, got %q", line)
+	}
+
+	// Once stopped, the tunnel should close the forwarded connection and
+	// no longer accept new ones.
+	if err := stopTunnels(); err != nil {
+		t.Fatalf("unable to stop tunnels: %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected forwarded connection to be closed")
+	}
+	if conn, err := net.Dial("tcp", tunnelAddr); err == nil {
+		conn.Close()
+		t.Fatalf("expected tunnel to stop accepting connections")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultCertPollInterval is the interval at which the certWatcher
+	// checks whether the RPC certificate file has changed.
+	defaultCertPollInterval = 30 * time.Second
+
+	// defaultCertCheckTimeout is the maximum time to wait for the TLS
+	// handshake with the RPC server when checking whether it presents a
+	// new certificate.
+	defaultCertCheckTimeout = 10 * time.Second
+)
+
+// certWatcherConfig houses the parameters and functions the certWatcher
+// requires in order to watch the certificate file of an RPC server.
+type certWatcherConfig struct {
+	// CertPath is the path to the file containing the PEM-encoded
+	// certificate chain of the RPC server.
+	CertPath string
+
+	// Cert is the certificate chain the RPC connection was initially
+	// established with.
+	Cert []byte
+
+	// Reconnect rebuilds the RPC connection with the passed certificate
+	// chain, which was read from the file after it changed. If it fails,
+	// it's retried once the file is polled next.
+	Reconnect func(cert []byte) error
+
+	// PollInterval is the interval at which the file is checked for
+	// changes.
+	PollInterval time.Duration
+}
+
+// certWatcher watches the certificate file of an RPC server, such as the
+// rpc.cert btcd regenerates on restart, and rebuilds the RPC connection once
+// it changes. This avoids relying on a stale certificate that was only read
+// once at startup if the certificate is rotated.
+type certWatcher struct {
+	started int32 // To be used atomically.
+	stopped int32 // To be used atomically.
+
+	cfg *certWatcherConfig
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// newCertWatcher creates a new certWatcher from the given config.
+func newCertWatcher(cfg *certWatcherConfig) *certWatcher {
+	return &certWatcher{
+		cfg:  cfg,
+		quit: make(chan struct{}),
+	}
+}
+
+// Start launches the goroutine which watches the certificate file.
+func (w *certWatcher) Start() error {
+	if !atomic.CompareAndSwapInt32(&w.started, 0, 1) {
+		return nil
+	}
+
+	w.wg.Add(1)
+	go w.watch()
+
+	return nil
+}
+
+// Stop signals the watcher to exit, and waits for it to do so.
+func (w *certWatcher) Stop() error {
+	if !atomic.CompareAndSwapInt32(&w.stopped, 0, 1) {
+		return nil
+	}
+
+	close(w.quit)
+	w.wg.Wait()
+
+	return nil
+}
+
+// watch periodically reads the certificate file, and reconnects with the
+// certificate chain it contains once it differs from the one in use.
+//
+// NOTE: This MUST be run as a goroutine.
+func (w *certWatcher) watch() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	currentCert := w.cfg.Cert
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.quit:
+			return
+		}
+
+		cert, err := ioutil.ReadFile(w.cfg.CertPath)
+		if err != nil {
+			ltndLog.Warnf("Unable to read RPC certificate %v: %v",
+				w.cfg.CertPath, err)
+			continue
+		}
+		if bytes.Equal(cert, currentCert) {
+			continue
+		}
+
+		// The file may be caught in the middle of being rewritten, so
+		// we'll only use it once it contains a valid chain.
+		if err := checkRPCCertChain(cert); err != nil {
+			ltndLog.Warnf("Ignoring invalid RPC certificate %v: %v",
+				w.cfg.CertPath, err)
+			continue
+		}
+
+		ltndLog.Infof("RPC certificate %v changed, reconnecting",
+			w.cfg.CertPath)
+
+		if err := w.cfg.Reconnect(cert); err != nil {
+			ltndLog.Errorf("Unable to reconnect with new RPC "+
+				"certificate, retrying in %v: %v",
+				w.cfg.PollInterval, err)
+			continue
+		}
+
+		currentCert = cert
+	}
+}
+
+// checkRPCServerCert ensures that the RPC server at the given host presents a
+// certificate trusted by the passed PEM-encoded certificate chain, by carrying
+// out a TLS handshake with it through the passed dial function.
+func checkRPCServerCert(dial func(string, string) (net.Conn, error),
+	rpcHost string, rpcCert []byte, timeout time.Duration) error {
+
+	tlsConfig, err := rpcCertTLSConfig(rpcCert)
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(rpcHost)
+	if err != nil {
+		return err
+	}
+	tlsConfig.ServerName = host
+
+	conn, err := dial("tcp", rpcHost)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	return tls.Client(conn, tlsConfig).Handshake()
+}
+
+// rpcCertTLSConfig returns the TLS config for connections to an RPC server
+// presenting a certificate trusted by the passed PEM-encoded certificate
+// chain.
+func rpcCertTLSConfig(rpcCert []byte) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(rpcCert) {
+		return nil, errors.New("no PEM-encoded certificates found")
+	}
+
+	return &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
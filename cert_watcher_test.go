@@ -0,0 +1,126 @@
+// +build !rpctest
+
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCertWatcherReconnect ensures that the certWatcher reconnects with the
+// new certificate once the watched file changes, ignoring invalid contents
+// and retrying failed reconnection attempts.
+func TestCertWatcherReconnect(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "certwatcher")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certPath := filepath.Join(dir, "rpc.cert")
+	writeCert := func(cert []byte) {
+		if err := ioutil.WriteFile(certPath, cert, 0600); err != nil {
+			t.Fatalf("unable to write cert: %v", err)
+		}
+	}
+
+	oldCert := newTestCertPEM(t)
+	writeCert(oldCert)
+
+	var numFailures int32 = 1
+	reconnected := make(chan []byte, 10)
+	watcher := newCertWatcher(&certWatcherConfig{
+		CertPath: certPath,
+		Cert:     oldCert,
+		Reconnect: func(cert []byte) error {
+			reconnected <- cert
+			if atomic.AddInt32(&numFailures, -1) >= 0 {
+				return errors.New("rpc server unreachable")
+			}
+			return nil
+		},
+		PollInterval: 10 * time.Millisecond,
+	})
+	if err := watcher.Start(); err != nil {
+		t.Fatalf("unable to start watcher: %v", err)
+	}
+	defer watcher.Stop()
+
+	assertNoReconnect := func() {
+		t.Helper()
+
+		select {
+		case <-reconnected:
+			t.Fatalf("unexpected reconnection attempt")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	assertReconnect := func(expectedCert []byte) {
+		t.Helper()
+
+		select {
+		case cert := <-reconnected:
+			if !bytes.Equal(cert, expectedCert) {
+				t.Fatalf("reconnected with unexpected cert")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("watcher didn't reconnect")
+		}
+	}
+
+	// As long as the certificate doesn't change, or the file doesn't
+	// contain a valid one, we shouldn't attempt to reconnect.
+	assertNoReconnect()
+	writeCert([]byte("-----BEGIN CERTIFICATE-----\n"))
+	assertNoReconnect()
+
+	// Once the certificate is rotated, we should reconnect with the new
+	// one. The first attempt fails, so it should be retried.
+	newCert := newTestCertPEM(t)
+	writeCert(newCert)
+	assertReconnect(newCert)
+	assertReconnect(newCert)
+
+	// Having reconnected successfully, the new certificate is the one in
+	// use, so there's no need to reconnect again.
+	assertNoReconnect()
+}
+
+// TestCheckRPCServerCert ensures that an RPC server is only considered to
+// present a trusted certificate if the TLS handshake succeeds with the passed
+// certificate chain.
+func TestCheckRPCServerCert(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+
+	serverCert := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})
+	rpcHost := server.Listener.Addr().String()
+
+	err := checkRPCServerCert(net.Dial, rpcHost, serverCert, time.Second)
+	if err != nil {
+		t.Fatalf("expected server cert to be trusted: %v", err)
+	}
+
+	err = checkRPCServerCert(
+		net.Dial, rpcHost, newTestCertPEM(t), time.Second,
+	)
+	if err == nil {
+		t.Fatalf("expected handshake with other cert to fail")
+	}
+}
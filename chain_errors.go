@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCredentialsNotFound is the kind of error returned if the RPC
+	// credentials of the chain backend can't be obtained, neither from
+	// lnd's config nor from the backend's files.
+	ErrCredentialsNotFound = errors.New("RPC credentials not found")
+
+	// ErrBackendUnreachable is the kind of error returned if a connection
+	// to the chain backend can't be established. As the backend may still
+	// be starting up, such failures may be resolved by retrying.
+	ErrBackendUnreachable = errors.New("chain backend unreachable")
+
+	// ErrInvalidChainConfig is the kind of error returned if the options
+	// configuring the chain backend are invalid or contradict each other.
+	ErrInvalidChainConfig = errors.New("invalid chain config")
+)
+
+// ChainBackendError is returned if the chain backend can't be set up. Its
+// Kind classifies the failure as one of ErrCredentialsNotFound,
+// ErrBackendUnreachable or ErrInvalidChainConfig, so callers can decide
+// whether to retry or to fall back to another backend, while its message is
+// the one of the underlying error.
+type ChainBackendError struct {
+	// Kind is the class of the failure.
+	Kind error
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error.
+//
+// NOTE: This is part of the error interface.
+func (e *ChainBackendError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ChainBackendError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns whether the target is the kind of the error, which allows
+// errors.Is to match the error against its kind.
+func (e *ChainBackendError) Is(target error) bool {
+	return e.Kind == target
+}
+
+// newChainBackendError classifies the passed error as being of the given kind.
+// An error that was already classified keeps its kind, as the most specific
+// classification happens closest to the failure.
+func newChainBackendError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ChainBackendError); ok {
+		return err
+	}
+
+	return &ChainBackendError{
+		Kind: kind,
+		Err:  err,
+	}
+}
+
+// wrapChainBackendError prefixes the message of the passed error with the
+// given context, while preserving its kind if it was classified.
+func wrapChainBackendError(err error, context string) error {
+	wrapped := fmt.Errorf("%v: %v", context, err)
+
+	chainErr, ok := err.(*ChainBackendError)
+	if !ok {
+		return wrapped
+	}
+
+	return &ChainBackendError{
+		Kind: chainErr.Kind,
+		Err:  wrapped,
+	}
+}
+
+// chainErrorKind returns the kind of the passed error if it was classified,
+// and nil otherwise.
+func chainErrorKind(err error) error {
+	chainErr, ok := err.(*ChainBackendError)
+	if !ok {
+		return nil
+	}
+
+	return chainErr.Kind
+}
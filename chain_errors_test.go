@@ -0,0 +1,162 @@
+// +build !rpctest
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChainBackendErrorKind ensures that representative failures to set up
+// the chain backend are classified by their kind, while preserving their
+// messages.
+func TestChainBackendErrorKind(t *testing.T) {
+	t.Parallel()
+
+	// We'll grab a port that nothing listens on, so dialing it fails.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	closedHost := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name string
+		err  func() error
+		kind error
+		msg  string
+	}{
+		{
+			name: "credentials not set on simnet",
+			err: func() error {
+				chainCfg := &chainConfig{
+					Node:   "btcd",
+					SimNet: true,
+				}
+				return parseRPCParams(
+					chainCfg, &btcdConfig{}, bitcoinChain,
+					"test",
+				)
+			},
+			kind: ErrCredentialsNotFound,
+			msg:  "rpcuser and rpcpass must be set",
+		},
+		{
+			name: "credentials not found in btcd.conf",
+			err: func() error {
+				return parseRPCParams(
+					&chainConfig{Node: "btcd"},
+					&btcdConfig{Dir: "/nonexistent"},
+					bitcoinChain, "test",
+				)
+			},
+			kind: ErrCredentialsNotFound,
+			msg:  "unable to extract RPC credentials",
+		},
+		{
+			name: "only rpcuser set",
+			err: func() error {
+				return parseRPCParams(
+					&chainConfig{Node: "btcd"},
+					&btcdConfig{RPCUser: "user"},
+					bitcoinChain, "test",
+				)
+			},
+			kind: ErrInvalidChainConfig,
+			msg:  "please set both or neither",
+		},
+		{
+			name: "rpc host unreachable",
+			err: func() error {
+				return dialRPCHost(
+					context.Background(), net.Dial,
+					closedHost, time.Second,
+				)
+			},
+			kind: ErrBackendUnreachable,
+			msg:  "unable to connect to RPC host",
+		},
+		{
+			name: "onion rpc host without tor",
+			err: func() error {
+				return checkRPCHost(
+					"3g2upl4pq6kufc4m.onion:8334", false,
+				)
+			},
+			kind: ErrInvalidChainConfig,
+			msg:  "requires tor.active",
+		},
+	}
+
+	for _, test := range tests {
+		err := test.err()
+		if err == nil {
+			t.Fatalf("%s: expected error", test.name)
+		}
+		if kind := chainErrorKind(err); kind != test.kind {
+			t.Fatalf("%s: expected error of kind %q, got %q: %v",
+				test.name, test.kind, kind, err)
+		}
+		if !strings.Contains(err.Error(), test.msg) {
+			t.Fatalf("%s: expected message containing %q, got %q",
+				test.name, test.msg, err)
+		}
+
+		// Wrapping the error with more context should preserve its
+		// kind, so it can be told apart by the callers of loadConfig.
+		wrapped := wrapChainBackendError(err, "context")
+		if chainErrorKind(wrapped) != test.kind {
+			t.Fatalf("%s: wrapped error lost its kind", test.name)
+		}
+		if wrapped.Error() != "context: "+err.Error() {
+			t.Fatalf("%s: unexpected wrapped message: %v",
+				test.name, wrapped)
+		}
+	}
+}
+
+// TestChainBackendErrorIs ensures that a ChainBackendError only matches its
+// own kind, and unwraps to its underlying error.
+func TestChainBackendErrorIs(t *testing.T) {
+	t.Parallel()
+
+	cause := errors.New("connection refused")
+	err := newChainBackendError(ErrBackendUnreachable, cause)
+
+	chainErr, ok := err.(*ChainBackendError)
+	if !ok {
+		t.Fatalf("expected ChainBackendError, got %T", err)
+	}
+	if !chainErr.Is(ErrBackendUnreachable) {
+		t.Fatalf("expected error to match its kind")
+	}
+	if chainErr.Is(ErrCredentialsNotFound) ||
+		chainErr.Is(ErrInvalidChainConfig) {
+
+		t.Fatalf("expected error not to match other kinds")
+	}
+	if chainErr.Unwrap() != cause {
+		t.Fatalf("expected error to unwrap to its cause")
+	}
+	if err.Error() != cause.Error() {
+		t.Fatalf("expected message %q, got %q", cause, err)
+	}
+
+	// Classifying an error again shouldn't override its kind.
+	reclassified := newChainBackendError(ErrInvalidChainConfig, err)
+	if chainErrorKind(reclassified) != ErrBackendUnreachable {
+		t.Fatalf("expected error to keep its kind")
+	}
+
+	if newChainBackendError(ErrBackendUnreachable, nil) != nil {
+		t.Fatalf("expected nil error to remain nil")
+	}
+	if chainErrorKind(cause) != nil {
+		t.Fatalf("expected unclassified error to have no kind")
+	}
+}
@@ -1,21 +1,33 @@
 package main
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcwallet/chain"
+	"github.com/btcsuite/btcwallet/waddrmgr"
 	"github.com/btcsuite/btcwallet/wallet"
 	"github.com/btcsuite/btcwallet/walletdb"
 	"github.com/lightninglabs/neutrino"
@@ -30,6 +42,9 @@ import (
 	"github.com/lightningnetwork/lnd/lnwallet/btcwallet"
 	"github.com/lightningnetwork/lnd/lnwire"
 	"github.com/lightningnetwork/lnd/routing/chainview"
+	"github.com/lightningnetwork/lnd/signal"
+	"github.com/lightningnetwork/lnd/tor"
+	"golang.org/x/net/proxy"
 )
 
 const (
@@ -55,6 +70,112 @@ const (
 	// btcToLtcConversionRate is a fixed ratio used in order to scale up
 	// payments when running on the Litecoin chain.
 	btcToLtcConversionRate = 60
+
+	// bitcoindCookieUser is the username of the credentials bitcoind
+	// writes to its auth cookie.
+	bitcoindCookieUser = "__cookie__"
+
+	// redactedSecret is logged in place of secrets, such as the password
+	// of the backend's RPC server.
+	redactedSecret = "<redacted>"
+
+	// defaultFallbackFeeRate is the fee rate in sat/vbyte that the live fee
+	// estimators fall back to when the backend is unable to provide an
+	// estimate, unless configured otherwise.
+	defaultFallbackFeeRate = 25
+
+	// feeEstimatorModeAuto selects live fee estimates from the backend if
+	// it's able to provide them, and static estimates otherwise.
+	feeEstimatorModeAuto = "auto"
+
+	// feeEstimatorModeStatic selects static fee estimates at the
+	// configured fallback fee rate, even if the backend is able to provide
+	// live estimates.
+	feeEstimatorModeStatic = "static"
+
+	// feeEstimatorModeRPC selects live fee estimates from the backend, and
+	// fails if it's unable to provide them.
+	feeEstimatorModeRPC = "rpc"
+
+	// defaultWarmupConfTarget is the confirmation target of the estimate
+	// we wait for while warming up a live fee estimator, unless a target
+	// was configured for all estimates.
+	defaultWarmupConfTarget = 6
+
+	// defaultConfTarget is the default confirmation target of the fee
+	// estimates for each type of on-chain operation, unless a target was
+	// configured for it or for all estimates.
+	defaultConfTarget = 6
+
+	// feeEstimatorWarmupPollInterval is the interval at which a live fee
+	// estimator is queried while waiting for its first live estimate.
+	feeEstimatorWarmupPollInterval = time.Second
+
+	// defaultFeeURLPollInterval is the interval at which the fee
+	// estimation web API configured for neutrino is queried.
+	defaultFeeURLPollInterval = 10 * time.Minute
+
+	// healthCheckTimeout is the maximum time a health check of the chain
+	// backend may take.
+	healthCheckTimeout = 5 * time.Second
+
+	// bestBlockTimeout is the maximum time a query of the chain backend's
+	// best block may take.
+	bestBlockTimeout = 5 * time.Second
+
+	// medianTimePastLag is the allowance for the median time past of the
+	// backend's chain tip lagging behind the actual time. It's the
+	// timestamp of the sixth most recent block, which was mined about an
+	// hour ago on average, though with considerable variance.
+	medianTimePastLag = 2 * time.Hour
+
+	// regtestPortProbeTimeout is the maximum time to wait for the
+	// connection probing which of bitcoind's default regtest RPC ports is
+	// open, so a filtered port doesn't stall the startup.
+	regtestPortProbeTimeout = 2 * time.Second
+
+	// regTestRPCPort is the default RPC port of bitcoind on regtest since
+	// version 0.16.
+	regTestRPCPort = 18443
+
+	// defaultPreflightTimeout is the timeout of each of the connection
+	// attempts made by the pre-flight check of bitcoind's endpoints.
+	defaultPreflightTimeout = 5 * time.Second
+
+	// defaultNeutrinoDBName is the name of neutrino's database file
+	// within its data directory, unless configured otherwise.
+	defaultNeutrinoDBName = "neutrino.db"
+
+	// defaultNeutrinoDBBackend is the walletdb driver used for neutrino's
+	// database, unless configured otherwise.
+	defaultNeutrinoDBBackend = "bdb"
+
+	// minNeutrinoFilterCacheSize is the smallest size in bytes of
+	// neutrino's filter cache that can be configured, so it's still able
+	// to hold the filters of a number of blocks.
+	minNeutrinoFilterCacheSize = 1 << 20
+
+	// defaultConnectRetryDelay is the initial delay between two attempts
+	// to connect to the chain backend at startup, unless configured
+	// otherwise.
+	defaultConnectRetryDelay = time.Second
+
+	// maxConnectRetryDelay is the maximum delay between two attempts to
+	// connect to the chain backend at startup.
+	maxConnectRetryDelay = time.Minute
+
+	// defaultConnectRetryDialTimeout is the timeout used to check whether
+	// the chain backend is reachable when retrying to connect, if no
+	// connect timeout was configured.
+	defaultConnectRetryDialTimeout = 30 * time.Second
+
+	// defaultBtcdWSEndpoint is the default endpoint of btcd's websocket
+	// RPC server.
+	defaultBtcdWSEndpoint = "ws"
+
+	// defaultZMQReadDeadline is the deadline of each read from bitcoind's
+	// ZMQ endpoints, unless configured otherwise.
+	defaultZMQReadDeadline = 100 * time.Millisecond
 )
 
 // defaultBtcChannelConstraints is the default set of channel constraints that are
@@ -97,6 +218,89 @@ func (c chainCode) String() string {
 	}
 }
 
+// ConfTargets houses the default confirmation targets in blocks of the fee
+// estimates for each type of on-chain operation, e.g. such that channels are
+// opened quickly while they're closed patiently.
+type ConfTargets struct {
+	// FundingConfTarget is the confirmation target of the funding
+	// transactions of channels we open.
+	FundingConfTarget uint32
+
+	// CloseConfTarget is the confirmation target of cooperative closes of
+	// our channels.
+	CloseConfTarget uint32
+
+	// SweepConfTarget is the confirmation target of sweeps of our outputs,
+	// e.g. those of force closed channels.
+	SweepConfTarget uint32
+}
+
+// newConfTargets returns the default confirmation targets of the passed chain
+// config. Each target that wasn't configured for its operation falls back to
+// the one configured for all fee estimates, or defaultConfTarget otherwise.
+func newConfTargets(chainCfg *chainConfig) ConfTargets {
+	globalTarget := chainCfg.FeeEstimateConfTarget
+	if globalTarget == 0 {
+		globalTarget = defaultConfTarget
+	}
+
+	confTarget := func(target uint32) uint32 {
+		if target == 0 {
+			return globalTarget
+		}
+		return target
+	}
+
+	return ConfTargets{
+		FundingConfTarget: confTarget(chainCfg.FundingConfTarget),
+		CloseConfTarget:   confTarget(chainCfg.CloseConfTarget),
+		SweepConfTarget:   confTarget(chainCfg.SweepConfTarget),
+	}
+}
+
+// BackendType denotes the type of chain backend lnd is connected to.
+type BackendType uint8
+
+const (
+	// BackendBtcd denotes a btcd or ltcd full node backend.
+	BackendBtcd BackendType = iota
+
+	// BackendBitcoind denotes a bitcoind or litecoind full node backend.
+	BackendBitcoind
+
+	// BackendNeutrino denotes a neutrino light client backend.
+	BackendNeutrino
+)
+
+// String returns a string representation of the target BackendType.
+func (b BackendType) String() string {
+	switch b {
+	case BackendBtcd:
+		return "btcd"
+	case BackendBitcoind:
+		return "bitcoind"
+	case BackendNeutrino:
+		return "neutrino"
+	default:
+		return "unknown"
+	}
+}
+
+// nodeBackendType returns the BackendType of the given node, as set through
+// the chain's node option.
+func nodeBackendType(node string) (BackendType, error) {
+	switch node {
+	case "btcd", "ltcd":
+		return BackendBtcd, nil
+	case "bitcoind", "litecoind":
+		return BackendBitcoind, nil
+	case "neutrino":
+		return BackendNeutrino, nil
+	default:
+		return 0, fmt.Errorf("unknown node type: %s", node)
+	}
+}
+
 // chainControl couples the three primary interfaces lnd utilizes for a
 // particular chain together. A single chainControl instance will exist for all
 // the chains lnd is currently active on.
@@ -105,6 +309,11 @@ type chainControl struct {
 
 	feeEstimator lnwallet.FeeEstimator
 
+	// feeRefresher is the live fee estimator wrapped by feeEstimator
+	// which keeps its estimates around, if any, such that they can be
+	// refreshed on demand through RefreshFeeEstimate.
+	feeRefresher lnwallet.RefreshableFeeEstimator
+
 	signer lnwallet.Signer
 
 	msgSigner lnwallet.MessageSigner
@@ -115,17 +324,208 @@ type chainControl struct {
 
 	wallet *lnwallet.LightningWallet
 
-	routingPolicy htlcswitch.ForwardingPolicy
+	// routingPolicy is the default forwarding policy of our channels. It
+	// may be updated while lnd is running, so it must only be accessed
+	// through RoutingPolicy and UpdateRoutingPolicy.
+	routingPolicy    htlcswitch.ForwardingPolicy
+	routingPolicyMtx sync.RWMutex
+
+	// confTargets are the default confirmation targets of the fee
+	// estimates for each type of on-chain operation.
+	confTargets ConfTargets
+
+	// syncStatus reports whether the chain backend is synced to the tip of
+	// the chain. An error is returned if the backend is unreachable.
+	syncStatus func() (bool, error)
+
+	// bestBlock queries the hash and height of the chain backend's
+	// current tip.
+	bestBlock func() (chainhash.Hash, int32, error)
+
+	// backendType is the type of the chain backend.
+	backendType BackendType
+}
+
+// BackendType returns the type of the chain backend, e.g. to adjust behavior
+// to neutrino's lack of mempool visibility.
+func (cc *chainControl) BackendType() BackendType {
+	return cc.backendType
+}
+
+// ConfTargets returns the default confirmation targets of the fee estimates
+// for each type of on-chain operation, which callers consult unless a target
+// was requested explicitly.
+func (cc *chainControl) ConfTargets() ConfTargets {
+	return cc.confTargets
+}
+
+// RoutingPolicy returns the default forwarding policy of our channels.
+func (cc *chainControl) RoutingPolicy() htlcswitch.ForwardingPolicy {
+	cc.routingPolicyMtx.RLock()
+	defer cc.routingPolicyMtx.RUnlock()
+
+	return cc.routingPolicy
+}
+
+// UpdateRoutingPolicy replaces the default forwarding policy of our channels,
+// such that channels and links set up from now on use the new policy, without
+// restarting lnd. Channels which are already active keep their policy.
+func (cc *chainControl) UpdateRoutingPolicy(
+	policy htlcswitch.ForwardingPolicy) error {
+
+	if policy.TimeLockDelta < minTimeLockDelta {
+		return fmt.Errorf("timelockdelta must be at least %v",
+			minTimeLockDelta)
+	}
+
+	cc.routingPolicyMtx.Lock()
+	cc.routingPolicy = policy
+	cc.routingPolicyMtx.Unlock()
+
+	ltndLog.Infof("Updated default routing policy: base fee %v, fee "+
+		"rate %v, time lock delta %v, min HTLC %v", policy.BaseFee,
+		policy.FeeRate, policy.TimeLockDelta, policy.MinHTLC)
+
+	return nil
+}
+
+// RefreshFeeEstimate refreshes the estimates of the live fee estimator right
+// away, e.g. once fees are known to have spiked, rather than waiting for them
+// to expire or be polled again. An error is returned if the backend couldn't
+// be queried. With static fee estimates, or live ones which are neither cached
+// nor polled, there's nothing to refresh, so it's a no-op.
+func (cc *chainControl) RefreshFeeEstimate() error {
+	if cc.feeRefresher == nil {
+		return nil
+	}
+
+	if err := cc.feeRefresher.RefreshFeeEstimates(); err != nil {
+		return fmt.Errorf("unable to refresh fee estimates: %v", err)
+	}
+
+	ltndLog.Infof("Refreshed fee estimates on demand")
+
+	return nil
+}
+
+// HealthCheck returns nil if the chain backend is reachable and synced to the
+// tip of the chain, allowing orchestrators to determine whether lnd is ready.
+// The check is bounded by the passed context as well as healthCheckTimeout.
+func (cc *chainControl) HealthCheck(ctx context.Context) error {
+	if cc.syncStatus == nil {
+		return errors.New("chain backend doesn't support health checks")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	type syncResult struct {
+		synced bool
+		err    error
+	}
+
+	// The backend may not respect our context, so we'll query it within
+	// a goroutine and bail out early if the context expires.
+	resultChan := make(chan syncResult, 1)
+	go func() {
+		synced, err := cc.syncStatus()
+		resultChan <- syncResult{synced: synced, err: err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			return fmt.Errorf("chain backend is unreachable: %v",
+				result.err)
+		}
+		if !result.synced {
+			return errors.New("chain backend is still syncing")
+		}
+
+		return nil
+
+	case <-ctx.Done():
+		return fmt.Errorf("chain backend health check failed: %v",
+			ctx.Err())
+	}
+}
+
+// BestBlock returns the hash and height of the chain backend's current tip,
+// giving up once bestBlockTimeout expires.
+func (cc *chainControl) BestBlock() (chainhash.Hash, int32, error) {
+	if cc.bestBlock == nil {
+		return chainhash.Hash{}, 0, errors.New("chain backend " +
+			"doesn't support best block queries")
+	}
+
+	return queryBestBlock(cc.bestBlock, bestBlockTimeout)
+}
+
+// queryBestBlock carries out the passed best block query, and returns an error
+// if it doesn't complete within the given timeout.
+func queryBestBlock(query func() (chainhash.Hash, int32, error),
+	timeout time.Duration) (chainhash.Hash, int32, error) {
+
+	type bestBlockResult struct {
+		hash   chainhash.Hash
+		height int32
+		err    error
+	}
+
+	// The backend may not respect our timeout, so we'll query it within
+	// a goroutine and bail out early once the timeout expires.
+	resultChan := make(chan bestBlockResult, 1)
+	go func() {
+		hash, height, err := query()
+		resultChan <- bestBlockResult{
+			hash:   hash,
+			height: height,
+			err:    err,
+		}
+	}()
+
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			return chainhash.Hash{}, 0, fmt.Errorf("unable to "+
+				"query best block: %v", result.err)
+		}
+
+		return result.hash, result.height, nil
+
+	case <-time.After(timeout):
+		return chainhash.Hash{}, 0, fmt.Errorf("best block query "+
+			"timed out after %v", timeout)
+	}
 }
 
 // newChainControlFromConfig attempts to create a chainControl instance
 // according to the parameters in the passed lnd configuration. Currently two
 // branches of chainControl instances exist: one backed by a running btcd
 // full-node, and the other backed by a running neutrino light client instance.
+// If an RPCObserver is passed, the RPC calls made to a btcd or bitcoind backend
+// through the chain control are reported to it.
 func newChainControlFromConfig(cfg *config, chanDB *channeldb.DB,
 	privateWalletPw, publicWalletPw []byte, birthday time.Time,
-	recoveryWindow uint32,
-	wallet *wallet.Wallet) (*chainControl, func(), error) {
+	recoveryWindow uint32, wallet *wallet.Wallet,
+	rpcObserver RPCObserver) (*chainControl, func(), error) {
+
+	return newChainControlFromConfigContext(
+		context.Background(), cfg, chanDB, privateWalletPw,
+		publicWalletPw, birthday, recoveryWindow, wallet, rpcObserver,
+	)
+}
+
+// newChainControlFromConfigContext is a variant of newChainControlFromConfig
+// which aborts as soon as the passed context is canceled, e.g. once a shutdown
+// is requested while the chain backend is still unreachable. The context
+// bounds the connection attempts to the backend along with the start up of
+// the fee estimator and the wallet. If the setup fails or is canceled midway,
+// the subsystems started up to that point are stopped again.
+func newChainControlFromConfigContext(ctx context.Context, cfg *config,
+	chanDB *channeldb.DB, privateWalletPw, publicWalletPw []byte,
+	birthday time.Time, recoveryWindow uint32, wallet *wallet.Wallet,
+	rpcObserver RPCObserver) (*chainControl, func(), error) {
 
 	// Set the RPC config from the "home" chain. Multi-chain isn't yet
 	// active, so we'll restrict usage to a particular chain for now.
@@ -138,49 +538,52 @@ func newChainControlFromConfig(cfg *config, chanDB *channeldb.DB,
 
 	cc := &chainControl{}
 
-	switch registeredChains.PrimaryChain() {
-	case bitcoinChain:
-		cc.routingPolicy = htlcswitch.ForwardingPolicy{
-			MinHTLC:       cfg.Bitcoin.MinHTLC,
-			BaseFee:       cfg.Bitcoin.BaseFee,
-			FeeRate:       cfg.Bitcoin.FeeRate,
-			TimeLockDelta: cfg.Bitcoin.TimeLockDelta,
-		}
-		cc.feeEstimator = lnwallet.StaticFeeEstimator{
-			FeePerKW: defaultBitcoinStaticFeePerKW,
-		}
-	case litecoinChain:
-		cc.routingPolicy = htlcswitch.ForwardingPolicy{
-			MinHTLC:       cfg.Litecoin.MinHTLC,
-			BaseFee:       cfg.Litecoin.BaseFee,
-			FeeRate:       cfg.Litecoin.FeeRate,
-			TimeLockDelta: cfg.Litecoin.TimeLockDelta,
-		}
-		cc.feeEstimator = lnwallet.StaticFeeEstimator{
-			FeePerKW: defaultLitecoinStaticFeePerKW,
-		}
-	default:
-		return nil, nil, fmt.Errorf("Default routing policy for "+
-			"chain %v is unknown", registeredChains.PrimaryChain())
+	routingPolicy, err := defaultRoutingPolicy(
+		cfg, registeredChains.PrimaryChain(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	cc.routingPolicy = routingPolicy
+	cc.confTargets = newConfTargets(homeChainConfig)
+
+	// We'll use a static fee rate unless the backend is able to provide
+	// live fee estimates, which isn't the case on simnet and regtest.
+	cc.feeEstimator = lnwallet.StaticFeeEstimator{
+		FeePerKW: staticFeeRate(
+			homeChainConfig, registeredChains.PrimaryChain(),
+		),
 	}
 
 	walletConfig := &btcwallet.Config{
-		PrivatePass:    privateWalletPw,
-		PublicPass:     publicWalletPw,
-		Birthday:       birthday,
-		RecoveryWindow: recoveryWindow,
-		DataDir:        homeChainConfig.ChainDir,
-		NetParams:      activeNetParams.Params,
-		FeeEstimator:   cc.feeEstimator,
-		CoinType:       activeNetParams.CoinType,
-		Wallet:         wallet,
+		PrivatePass:           privateWalletPw,
+		PublicPass:            publicWalletPw,
+		Birthday:              birthday,
+		RecoveryWindow:        recoveryWindow,
+		RecoveryScanBatchSize: cfg.RecoveryScanBatchSize,
+		DataDir:               homeChainConfig.ChainDir,
+		NetParams:             activeNetParams.Params,
+		FeeEstimator:          cc.feeEstimator,
+		CoinType:              walletCoinType(homeChainConfig),
+		Wallet:                wallet,
+		WatchOnly:             cfg.WatchOnly,
 	}
 
 	var (
-		err     error
-		cleanUp func()
+		cleanUp     func()
+		chainSource chain.Interface
+		feeFloor    *relayFeeFloor
+
+		// headerSource serves the block headers the backend's chain
+		// source can't serve before the wallet is started.
+		headerSource blockHeaderSource
 	)
 
+	// The RPC calls made to a btcd or bitcoind backend on behalf of the
+	// chain control may be limited, so a burst of them doesn't overwhelm
+	// the backend.
+	limiter := newRPCLimiter(homeChainConfig.MaxRPCConcurrency)
+
 	// Initialize disabled height hint cache within the chain directory.
 	hintCache, err := chainntnfs.NewHeightHintCache(chanDB, true)
 	if err != nil {
@@ -188,66 +591,218 @@ func newChainControlFromConfig(cfg *config, chanDB *channeldb.DB,
 			"cache: %v", err)
 	}
 
+	cc.backendType, err = nodeBackendType(homeChainConfig.Node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// We'll keep track of the subsystems we start along the way, so they
+	// can be stopped again if we fail to complete the setup.
+	var started partialCleanUp
+	defer started.run()
+
 	// If spv mode is active, then we'll be using a distinct set of
 	// chainControl interfaces that interface directly with the p2p network
 	// of the selected chain.
 	switch homeChainConfig.Node {
 	case "neutrino":
+		// Neutrino has no access to a fee estimation source through
+		// its backend, so we'll use static estimates unless a fee
+		// estimation web API was configured.
+		_, err = useRPCFeeEstimator(
+			homeChainConfig.FeeEstimatorMode,
+			homeChainConfig.Node, activeNetParams.Name, false,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.NeutrinoMode.FeeURL != "" &&
+			homeChainConfig.FeeEstimatorMode != feeEstimatorModeStatic {
+
+			ltndLog.Infof("Initializing web API backed fee "+
+				"estimator using %v", cfg.NeutrinoMode.FeeURL)
+
+			// We'll reach the web API through cfg.net, so that
+			// it's queried over Tor if it's active.
+			cc.feeEstimator = lnwallet.NewWebAPIFeeEstimator(
+				cfg.NeutrinoMode.FeeURL, cfg.net.Dial,
+				defaultFeeURLPollInterval, staticFeeRate(
+					homeChainConfig,
+					registeredChains.PrimaryChain(),
+				),
+			)
+			err := startFeeEstimator(
+				ctx, cc.feeEstimator,
+				cfg.NeutrinoMode.FeeURL, 0, &started,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// The polled fee rates may be refreshed on demand.
+			cc.feeRefresher = refreshableFeeEstimator(
+				cc.feeEstimator,
+			)
+		}
+
+		// If a persistent peer file was specified, we'll add its peers
+		// to the ones we should connect with at startup.
+		addPeers := cfg.NeutrinoMode.AddPeers
+		if cfg.NeutrinoMode.PersistentPeerFile != "" {
+			addPeers, err = readNeutrinoPeerFile(
+				cfg.NeutrinoMode.PersistentPeerFile, addPeers,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
 		// First we'll open the database file for neutrino, creating
 		// the database if needed. We append the normalized network name
-		// here to match the behavior of btcwallet.
-		neutrinoDbPath := filepath.Join(homeChainConfig.ChainDir,
-			normalizeNetwork(activeNetParams.Name))
+		// here to match the behavior of btcwallet, along with the
+		// profile if one was set.
+		neutrinoDbPath, err := neutrinoDataDir(
+			homeChainConfig.ChainDir,
+			normalizeNetwork(activeNetParams.Name),
+			cfg.NeutrinoMode.Profile,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		// Ensure that the neutrino db path exists.
+		// Ensure that the neutrino db path exists, and that we're able
+		// to write to it, as it may have been created with the wrong
+		// ownership or permissions, which would otherwise only surface
+		// as a cryptic error once the database is created.
 		if err := os.MkdirAll(neutrinoDbPath, 0700); err != nil {
 			return nil, nil, err
 		}
+		if err := checkNeutrinoDirWritable(neutrinoDbPath); err != nil {
+			return nil, nil, err
+		}
+
+		// The location of the database and its backend may have been
+		// overridden, e.g. to place it on a separate volume.
+		dbName, dbBackend, err := neutrinoDatabase(
+			cfg.NeutrinoMode, neutrinoDbPath,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// If requested, we'll make sure the stored filter header chain
+		// wasn't corrupted, e.g. by an unclean shutdown, and matches
+		// the trusted checkpoints, before handing it to neutrino. The
+		// checkpoints can't be handed to neutrino itself, as it only
+		// obtains them from its peers.
+		neutrinoMode := cfg.NeutrinoMode
+		checkpoints, err := parseFilterHeaderCheckpoints(
+			neutrinoMode.FilterHeaderCheckpoints,
+			neutrinoMode.FilterHeaderCheckpointFile,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		if neutrinoMode.ValidateFilterHeaders ||
+			neutrinoMode.RebuildFilterHeaders ||
+			len(checkpoints) > 0 {
+
+			err := checkNeutrinoHeaders(
+				neutrinoDbPath, dbName, checkpoints,
+				neutrinoMode.RebuildFilterHeaders,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// If a chain tip was asserted, it's added to the checkpoints
+		// neutrino verifies the block headers of its peers against.
+		chainTip, err := parseChainTipAssertion(
+			neutrinoMode.AssertChainTip,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		chainParams, err := neutrinoChainParams(
+			activeNetParams.Params, chainTip,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		nodeDatabase, err := walletdb.Create(dbBackend, dbName)
+		if err != nil {
+			return nil, nil, err
+		}
+		started.add(stopFunc(nodeDatabase.Close))
 
-		dbName := filepath.Join(neutrinoDbPath, "neutrino.db")
-		nodeDatabase, err := walletdb.Create("bdb", dbName)
+		// A database synced on another network would leave neutrino
+		// with a corrupted sync state, so we'll make sure it was
+		// created for the active one.
+		err = checkNeutrinoDBNetwork(
+			nodeDatabase, dbName, activeNetParams.Name,
+		)
 		if err != nil {
 			return nil, nil, err
 		}
 
+		// We'll connect to neutrino's peers through cfg.net, so that
+		// they're reached over Tor if it's active, unless a dedicated
+		// SOCKS proxy was configured for neutrino.
+		dialer := func(addr net.Addr) (net.Conn, error) {
+			return cfg.net.Dial(addr.Network(), addr.String())
+		}
+		nameResolver := neutrinoNameResolver(cfg.net.LookupHost)
+		if cfg.NeutrinoMode.SocksProxy != "" {
+			dialer, nameResolver, err = neutrinoProxyDialer(
+				cfg.NeutrinoMode.SocksProxy,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
 		// With the database open, we can now create an instance of the
 		// neutrino light client. We pass in relevant configuration
 		// parameters required.
 		config := neutrino.Config{
 			DataDir:      neutrinoDbPath,
 			Database:     nodeDatabase,
-			ChainParams:  *activeNetParams.Params,
-			AddPeers:     cfg.NeutrinoMode.AddPeers,
+			ChainParams:  chainParams,
+			AddPeers:     addPeers,
 			ConnectPeers: cfg.NeutrinoMode.ConnectPeers,
-			Dialer: func(addr net.Addr) (net.Conn, error) {
-				return cfg.net.Dial(addr.Network(), addr.String())
-			},
-			NameResolver: func(host string) ([]net.IP, error) {
-				addrs, err := cfg.net.LookupHost(host)
-				if err != nil {
-					return nil, err
-				}
-
-				ips := make([]net.IP, 0, len(addrs))
-				for _, strIP := range addrs {
-					ip := net.ParseIP(strIP)
-					if ip == nil {
-						continue
-					}
-
-					ips = append(ips, ip)
-				}
-
-				return ips, nil
-			},
+			Dialer:       dialer,
+			NameResolver: nameResolver,
+		}
+		err = applyNeutrinoFilterCacheSize(&config, cfg.NeutrinoMode)
+		if err != nil {
+			return nil, nil, err
+		}
+		disableDNSSeed, err := neutrinoDisableDNSSeed(
+			cfg.NeutrinoMode, addPeers,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		userAgentName, userAgentVersion, err := neutrinoUserAgent(
+			cfg.NeutrinoMode, neutrino.UserAgentName,
+			neutrino.UserAgentVersion,
+		)
+		if err != nil {
+			return nil, nil, err
 		}
 		neutrino.MaxPeers = 8
 		neutrino.BanDuration = 5 * time.Second
+		neutrino.DisableDNSSeed = disableDNSSeed
+		neutrino.UserAgentName = userAgentName
+		neutrino.UserAgentVersion = userAgentVersion
 		svc, err := neutrino.NewChainService(config)
 		if err != nil {
 			return nil, nil, fmt.Errorf("unable to create neutrino: %v", err)
 		}
 		svc.Start()
+		started.add(stopFunc(svc.Stop))
 
 		// Next we'll create the instances of the ChainNotifier and
 		// FilteredChainView interface which is backed by the neutrino
@@ -264,12 +819,25 @@ func newChainControlFromConfig(cfg *config, chanDB *channeldb.DB,
 		}
 
 		// Finally, we'll set the chain source for btcwallet, and
-		// create our clean up function which simply closes the
-		// database.
-		walletConfig.ChainSource = chain.NewNeutrinoClient(
+		// create our clean up function which stops the fee estimator
+		// and the light client, and closes the database.
+		chainSource = chain.NewNeutrinoClient(
 			activeNetParams.Params, svc,
 		)
+		cc.syncStatus = func() (bool, error) {
+			return svc.IsCurrent(), nil
+		}
+		cc.bestBlock = neutrinoBestBlock(svc)
+
+		// Neutrino has no access to the minimum relay fee of its
+		// peers, so we'll raise fee estimates to a fixed floor, which
+		// doesn't need to be started.
+		feeFloor = newRelayFeeFloor(
+			minRelayFeeFloorConfig(homeChainConfig, nil),
+		)
+
 		cleanUp = func() {
+			cc.feeEstimator.Stop()
 			svc.Stop()
 			nodeDatabase.Close()
 		}
@@ -282,107 +850,590 @@ func newChainControlFromConfig(cfg *config, chanDB *channeldb.DB,
 			bitcoindMode = cfg.LitecoindMode
 		}
 		// Otherwise, we'll be speaking directly via RPC and ZMQ to a
-		// bitcoind node. If the specified host for the btcd/ltcd RPC
-		// server already has a port specified, then we use that
-		// directly. Otherwise, we assume the default port according to
-		// the selected chain parameters.
-		var bitcoindHost string
-		if strings.Contains(bitcoindMode.RPCHost, ":") {
-			bitcoindHost = bitcoindMode.RPCHost
-		} else {
-			// The RPC ports specified in chainparams.go assume
-			// btcd, which picks a different port so that btcwallet
-			// can use the same RPC port as bitcoind. We convert
-			// this back to the btcwallet/bitcoind port.
-			rpcPort, err := strconv.Atoi(activeNetParams.rpcPort)
-			if err != nil {
-				return nil, nil, err
-			}
-			rpcPort -= 2
-			bitcoindHost = fmt.Sprintf("%v:%d",
-				bitcoindMode.RPCHost, rpcPort)
-			if cfg.Bitcoin.Active && cfg.Bitcoin.RegTest {
-				conn, err := net.Dial("tcp", bitcoindHost)
-				if err != nil || conn == nil {
-					rpcPort = 18443
-					bitcoindHost = fmt.Sprintf("%v:%d",
-						bitcoindMode.RPCHost,
-						rpcPort)
-				} else {
-					conn.Close()
-				}
-			}
-		}
-
-		// Establish the connection to bitcoind and create the clients
-		// required for our relevant subsystems.
-		bitcoindConn, err := chain.NewBitcoindConn(
-			activeNetParams.Params, bitcoindHost,
-			bitcoindMode.RPCUser, bitcoindMode.RPCPass,
-			bitcoindMode.ZMQPubRawBlock, bitcoindMode.ZMQPubRawTx,
-			100*time.Millisecond,
+		// bitcoind node. Several nodes may have been configured, in
+		// which case we'll fail over to the next one if a node is
+		// unreachable.
+		backends, err := bitcoindBackends(
+			homeChainConfig.Node, bitcoindMode,
 		)
 		if err != nil {
 			return nil, nil, err
 		}
-
-		if err := bitcoindConn.Start(); err != nil {
-			return nil, nil, fmt.Errorf("unable to connect to "+
-				"bitcoind: %v", err)
+		tlsConfig, err := bitcoindTLSConfig(bitcoindMode)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		cc.chainNotifier = bitcoindnotify.New(
-			bitcoindConn, hintCache, hintCache,
-		)
-		cc.chainView = chainview.NewBitcoindFilteredChainView(bitcoindConn)
-		walletConfig.ChainSource = bitcoindConn.NewBitcoindClient()
+		// Only onion hosts will be dialed through Tor, as it refuses to
+		// connect to local backends.
+		backendDial := backendDialer(cfg.net.Dial)
 
-		// If we're not in regtest mode, then we'll attempt to use a
-		// proper fee estimator for testnet.
-		rpcConfig := &rpcclient.ConnConfig{
-			Host:                 bitcoindHost,
-			User:                 bitcoindMode.RPCUser,
-			Pass:                 bitcoindMode.RPCPass,
-			DisableConnectOnNew:  true,
-			DisableAutoReconnect: false,
-			DisableTLS:           true,
-			HTTPPostMode:         true,
+		// On regtest, we'll probe which of bitcoind's default RPC ports
+		// is open, unless disabled in favor of the derived one.
+		probeDial := backendDial
+		if bitcoindMode.DisableRegtestPortProbe {
+			probeDial = nil
 		}
-		if cfg.Bitcoin.Active && !cfg.Bitcoin.RegTest {
-			ltndLog.Infof("Initializing bitcoind backed fee estimator")
-
-			// Finally, we'll re-initialize the fee estimator, as
-			// if we're using bitcoind as a backend, then we can
-			// use live fee estimates, rather than a statically
-			// coded value.
-			fallBackFeeRate := lnwallet.SatPerKVByte(25 * 1000)
-			cc.feeEstimator, err = lnwallet.NewBitcoindFeeEstimator(
-				*rpcConfig, fallBackFeeRate.FeePerKWeight(),
+		resolveRPCHost := func(host string) (string, error) {
+			rpcHost, err := bitcoindRPCAddress(
+				ctx, host,
+				cfg.Bitcoin.Active && cfg.Bitcoin.RegTest,
+				probeDial, regtestPortProbeTimeout,
 			)
+			if err != nil {
+				return "", err
+			}
+			err = checkRPCHost(rpcHost, cfg.Tor.Active)
+			if err != nil {
+				return "", err
+			}
+
+			return rpcHost, nil
+		}
+		for i, backend := range backends {
+			rpcHost, err := resolveRPCHost(backend.rpcHost)
 			if err != nil {
 				return nil, nil, err
 			}
-			if err := cc.feeEstimator.Start(); err != nil {
+
+			// The wallet is served by the same node, unless a
+			// dedicated one was configured.
+			walletRPCHost := rpcHost
+			if _, ok := bitcoindWalletBackend(backend); ok {
+				walletRPCHost, err = resolveRPCHost(
+					backend.walletRPCHost,
+				)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+
+			backends[i].rpcHost = rpcHost
+			backends[i].walletRPCHost = walletRPCHost
+
+			zmqAddrs := []string{
+				backend.zmqPubRawBlock, backend.zmqPubRawTx,
+			}
+			for _, zmqAddr := range zmqAddrs {
+				err := checkRPCHost(zmqAddr, cfg.Tor.Active)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+
+		// If requested, we'll make sure all of bitcoind's endpoints are
+		// reachable before proceeding.
+		if bitcoindMode.PreflightCheck {
+			err := preflightBitcoindBackends(
+				ctx, backendDial, backends,
+				defaultPreflightTimeout,
+			)
+			if err != nil {
 				return nil, nil, err
 			}
-		} else if cfg.Litecoin.Active {
-			ltndLog.Infof("Initializing litecoind backed fee estimator")
+		}
 
-			// Finally, we'll re-initialize the fee estimator, as
-			// if we're using litecoind as a backend, then we can
-			// use live fee estimates, rather than a statically
-			// coded value.
-			fallBackFeeRate := lnwallet.SatPerKVByte(25 * 1000)
-			cc.feeEstimator, err = lnwallet.NewBitcoindFeeEstimator(
-				*rpcConfig, fallBackFeeRate.FeePerKWeight(),
+		// If a client certificate was configured, we'll connect to
+		// bitcoind over mutual TLS. As neither btcwallet's connection
+		// nor rpcclient's HTTP POST mode support client certificates,
+		// they'll connect through local tunnels presenting it on their
+		// behalf instead.
+		stopTLSTunnels := func() error { return nil }
+		if tlsConfig != nil {
+			stopTLSTunnels, err = startRPCTLSTunnels(
+				backends, tlsConfig, backendDial,
 			)
 			if err != nil {
 				return nil, nil, err
 			}
-			if err := cc.feeEstimator.Start(); err != nil {
+			started.add(stopFunc(stopTLSTunnels))
+		}
+
+		// Neither btcwallet's connection nor the ZMQ subscriptions can
+		// be given a dialer, so if Tor is active, they'll connect to
+		// onion hosts through local tunnels dialing them through Tor
+		// instead. The TLS tunnels already dial the RPC hosts through
+		// Tor themselves.
+		stopOnionTunnels := func() error { return nil }
+		if cfg.Tor.Active {
+			stopOnionTunnels, err = startOnionTunnels(
+				backends, backendDial, tlsConfig == nil,
+			)
+			if err != nil {
 				return nil, nil, err
 			}
+			started.add(stopFunc(stopOnionTunnels))
 		}
+
+		// If several nodes were configured, we'll connect to them
+		// through a switch, which can route our connections to another
+		// node while we're running. Otherwise, if requested, the ZMQ
+		// subscriptions will be made through local relays, which
+		// resubscribe to bitcoind once the connection to it is lost,
+		// as btcwallet's subscriptions never recover from that by
+		// themselves. The switch resubscribes through relays as well.
+		// We'll hold on to the endpoints the relays subscribe to, so
+		// we can tell whether bitcoind is reachable again.
+		upstreamBackends := append([]bitcoindBackend(nil), backends...)
+		var (
+			failoverSwitch *bitcoindSwitch
+			relays         zmqRelays
+			stopRelays     = func() error { return nil }
+		)
+		switch {
+		case len(backends) > 1:
+			failoverSwitch, err = newBitcoindSwitch(
+				backends[0], backendDial,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			relays = failoverSwitch.Relays()
+			stopRelays = failoverSwitch.Stop
+			started.add(stopFunc(stopRelays))
+
+		case bitcoindMode.ZMQReconnect:
+			relays, err = startZMQRelays(backends, backendDial)
+			if err != nil {
+				return nil, nil, err
+			}
+			stopRelays = relays.Stop
+			started.add(stopFunc(stopRelays))
+		}
+
+		// connectBitcoind establishes a connection to the given
+		// bitcoind node.
+		connectBitcoind := func(backend bitcoindBackend) (
+			*chain.BitcoindConn, error) {
+
+			// To aid in diagnosing connection problems, we'll log
+			// the resolved connection parameters before connecting.
+			ltndLog.Infof("Connecting to %v", &backendConnParams{
+				node:           homeChainConfig.Node,
+				rpcHost:        backend.rpcHost,
+				zmqPubRawBlock: backend.zmqPubRawBlock,
+				zmqPubRawTx:    backend.zmqPubRawTx,
+				user:           bitcoindMode.RPCUser,
+				pass:           bitcoindMode.RPCPass,
+			})
+
+			// Before establishing the connection, we'll make sure
+			// the RPC host is reachable, so we can fail fast if it
+			// isn't.
+			err := dialRPCHost(
+				ctx, backendDial, backend.rpcHost,
+				bitcoindMode.RPCConnectTimeout,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			conn, err := newBitcoindConn(
+				chain.NewBitcoindConn, activeNetParams.Params,
+				backend, bitcoindMode,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			err = startWithTimeout(
+				ctx, conn.Start, conn.Stop, backend.rpcHost,
+				bitcoindMode.RPCConnectTimeout,
+			)
+			if err != nil {
+				return nil, newChainBackendError(
+					ErrBackendUnreachable,
+					fmt.Errorf("unable to connect to "+
+						"bitcoind: %v", err),
+				)
+			}
+
+			return conn, nil
+		}
+
+		// Establish the connection to the first reachable bitcoind
+		// node, from which we'll create the clients required for our
+		// relevant subsystems. If configured, we'll retry to connect,
+		// as bitcoind may still be starting up.
+		var (
+			bitcoindConn *chain.BitcoindConn
+			active       int
+		)
+		connect := func(backend bitcoindBackend) error {
+			if failoverSwitch != nil {
+				err := failoverSwitch.Switch(backend)
+				if err != nil {
+					return err
+				}
+				backend = failoverSwitch.Backend()
+			}
+
+			conn, err := connectBitcoind(backend)
+			if err != nil {
+				return err
+			}
+
+			bitcoindConn = conn
+			return nil
+		}
+		err = connectWithRetry(
+			ctx, homeChainConfig.ConnectRetryAttempts,
+			homeChainConfig.ConnectRetryDelay, func() error {
+				var err error
+				active, err = connectBitcoindBackends(
+					backends, connect,
+				)
+				return err
+			},
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		activeBackend := backends[active]
+		if failoverSwitch != nil {
+			activeBackend = failoverSwitch.Backend()
+		}
+		started.add(bitcoindConn.Stop)
+
+		cc.chainNotifier = bitcoindnotify.New(
+			bitcoindConn, hintCache, hintCache,
+		)
+
+		// If a dedicated node serves the wallet, we'll connect to it
+		// separately, while the notifier and chain view remain bound to
+		// the node connected to above.
+		walletConn := bitcoindConn
+		walletBackend, ok := bitcoindWalletBackend(activeBackend)
+		if ok {
+			walletConn, err = connectBitcoind(walletBackend)
+			if err != nil {
+				return nil, nil, err
+			}
+			started.add(walletConn.Stop)
+		}
+		chainSource = walletConn.NewBitcoindClient()
+
+		// If requested, we'll also watch the ZMQ connection, as it may
+		// silently stop delivering notifications without being closed,
+		// e.g. if bitcoind's host went away. Once bitcoind is reachable
+		// again, the relays will resubscribe, while the notifier and
+		// chain view remain connected to them, so their registrations
+		// are preserved.
+		stopZMQWatchdog := func() error { return nil }
+		if bitcoindMode.ZMQReconnect {
+			reachable := func() error {
+				// The node may have changed since we've
+				// connected if we failed over.
+				upstream := upstreamBackends[active]
+				if failoverSwitch != nil {
+					upstream = failoverSwitch.Active()
+				}
+
+				conn, err := newBitcoindConn(
+					chain.NewBitcoindConn,
+					activeNetParams.Params, upstream,
+					bitcoindMode,
+				)
+				if err != nil {
+					return err
+				}
+				if err := conn.Start(); err != nil {
+					return err
+				}
+				conn.Stop()
+
+				return nil
+			}
+
+			var watchdog *zmqWatchdog
+			watchdog, stopZMQWatchdog, err = newBitcoindZMQWatchdog(
+				bitcoindConn, reachable, relays.Reconnect,
+				bitcoindMode.ZMQWatchdogInterval,
+				bitcoindMode.ZMQStaleThreshold,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := watchdog.Start(); err != nil {
+				return nil, nil, err
+			}
+			started.add(stopFunc(stopZMQWatchdog))
+		}
+
+		// If we're not in regtest mode, then we'll attempt to use a
+		// proper fee estimator for testnet.
+		rpcConfig := &rpcclient.ConnConfig{
+			Host:                 activeBackend.rpcHost,
+			User:                 bitcoindMode.RPCUser,
+			Pass:                 bitcoindMode.RPCPass,
+			DisableConnectOnNew:  true,
+			DisableAutoReconnect: false,
+			DisableTLS:           true,
+			HTTPPostMode:         true,
+		}
+
+		// If requested, we'll make sure blocks are actually delivered
+		// over ZMQ before proceeding, rather than finding out once the
+		// next block arrives. If also requested, we'll mine one
+		// ourselves on regtest.
+		err = checkZMQSelfTestGenerate(
+			bitcoindMode, homeChainConfig,
+			registeredChains.PrimaryChain(),
+		)
+		if err != nil {
+			return nil, nil, newChainBackendError(
+				ErrInvalidChainConfig, err,
+			)
+		}
+		if bitcoindMode.ZMQSelfTest {
+			var generate func() error
+			if bitcoindMode.ZMQSelfTestGenerate {
+				generate, err = regtestBlockGenerator(
+					*rpcConfig, activeNetParams.Params,
+				)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+
+			err = bitcoindZMQSelfTest(
+				ctx, bitcoindConn, generate,
+				bitcoindMode.ZMQSelfTestTimeout,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// Live fee estimates are unavailable on bitcoin's regtest, as
+		// bitcoind doesn't have enough data to base them on.
+		liveEstimates := cfg.Litecoin.Active || !cfg.Bitcoin.RegTest
+		useRPC, err := useRPCFeeEstimator(
+			homeChainConfig.FeeEstimatorMode, homeChainConfig.Node,
+			activeNetParams.Name, liveEstimates,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case useRPC:
+			ltndLog.Infof("Initializing %v backed fee estimator",
+				homeChainConfig.Node)
+
+			// Finally, we'll re-initialize the fee estimator, as
+			// if we're using bitcoind as a backend, then we can
+			// use live fee estimates, rather than a statically
+			// coded value.
+			estimateMode, err := bitcoindEstimateMode(
+				bitcoindMode.EstimateMode,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			cc.feeEstimator, err = lnwallet.NewBitcoindFeeEstimator(
+				*rpcConfig,
+				fallbackFeeRate(bitcoindMode.FallbackFeeRate),
+				estimateMode,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = startFeeEstimator(
+				ctx, cc.feeEstimator, activeBackend.rpcHost,
+				bitcoindMode.RPCConnectTimeout, &started,
+			)
+			if err != nil {
+				// If enabled, we'll fall back to static
+				// estimates, skipping the rest of the live
+				// estimator's setup.
+				cc.feeEstimator, err = staticFeeFallback(
+					ctx, homeChainConfig, err,
+					backendStaticFeeRate(
+						homeChainConfig,
+						registeredChains.PrimaryChain(),
+						bitcoindMode.FallbackFeeRate,
+					),
+				)
+				if err != nil {
+					return nil, nil, err
+				}
+				break
+			}
+
+			// If requested, we'll wait for the estimator's first
+			// live estimate, so the fee queries made early on don't
+			// resort to the fallback fee rate needlessly.
+			err = waitForFeeEstimate(
+				ctx, cc.feeEstimator,
+				homeChainConfig.FeeEstimateConfTarget,
+				homeChainConfig.FeeEstimatorWarmup,
+				feeEstimatorWarmupPollInterval,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// If a max age of the estimates is set, we'll fail
+			// rather than resort to the fallback fee rate.
+			// Otherwise, we'll warn whenever the estimator resorts
+			// to it, as our fees are likely to be off.
+			cc.feeEstimator = rejectFeeFallback(
+				cc.feeEstimator, homeChainConfig,
+			)
+			cc.feeEstimator = newFallbackWarningEstimator(
+				cc.feeEstimator, rpcObserver,
+			)
+			if rpcObserver != nil {
+				cc.feeEstimator = &observedFeeEstimator{
+					FeeEstimator: cc.feeEstimator,
+					method:       "estimatesmartfee",
+					observer:     rpcObserver,
+				}
+			}
+			cc.feeEstimator = limitFeeEstimator(
+				cc.feeEstimator, limiter,
+			)
+
+			// We'll cache or poll the live estimates, so
+			// concurrent subsystems don't each issue an RPC to
+			// bitcoind. Either way, they may be refreshed on
+			// demand.
+			cc.feeEstimator, err = refreshFeeEstimates(
+				ctx, cc.feeEstimator, homeChainConfig,
+				activeBackend.rpcHost, &started,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			cc.feeRefresher = refreshableFeeEstimator(
+				cc.feeEstimator,
+			)
+
+		case homeChainConfig.FeeEstimatorMode == feeEstimatorModeStatic:
+			cc.feeEstimator = lnwallet.StaticFeeEstimator{
+				FeePerKW: backendStaticFeeRate(
+					homeChainConfig,
+					registeredChains.PrimaryChain(),
+					bitcoindMode.FallbackFeeRate,
+				),
+			}
+		}
+
+		// We'll use a dedicated client for health checks, as the
+		// clients of the bitcoind connection don't expose
+		// getblockchaininfo.
+		healthConfig := *rpcConfig
+		healthClient, err := rpcclient.New(&healthConfig, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		started.add(healthClient.Shutdown)
+
+		// A pruned node is unable to serve the historical blocks we may
+		// need later on, so we'll warn if it's pruned, or refuse to use
+		// it if configured.
+		err = checkPrunedBackend(
+			healthClient, homeChainConfig.Node,
+			bitcoindMode.RefusePruned,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		cc.syncStatus = blockChainInfoSyncStatus(healthClient)
+
+		// We'll make sure our clock roughly agrees with bitcoind's
+		// chain, as our timeouts are evaluated against it.
+		err = checkClockSkew(healthClient, homeChainConfig, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+		cc.bestBlock = rpcBestBlock(healthClient)
+
+		// If requested, the chain view will match the blocks it filters
+		// against their compact filters from bitcoind's block filter
+		// index, once it's available, rather than fetching each of
+		// them. The chain view is bound to the same node as the
+		// notifier.
+		filterSource, err := bitcoindCompactFilterSource(
+			healthClient, bitcoindMode.UseCompactFilters,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		if filterSource != nil {
+			cc.chainView = chainview.NewBitcoindCfFilteredChainView(
+				bitcoindConn, filterSource,
+			)
+		} else {
+			cc.chainView = chainview.NewBitcoindFilteredChainView(
+				bitcoindConn,
+			)
+		}
+
+		// We'll keep track of bitcoind's minimum relay fee, so fee
+		// estimates below it can be raised before our transactions are
+		// rejected from its mempool.
+		feeFloor = newRelayFeeFloor(minRelayFeeFloorConfig(
+			homeChainConfig, rpcMinRelayFee(healthClient),
+		))
+		if err := feeFloor.Start(); err != nil {
+			return nil, nil, err
+		}
+		started.add(stopFunc(feeFloor.Stop))
+
+		// If several bitcoind nodes were configured, we'll monitor the
+		// active one. Once it repeatedly fails to respond while another
+		// node is reachable, we'll route our connections to the latter
+		// through the switch, and monitor it from then on.
+		stopFailover := func() error { return nil }
+		if failoverSwitch != nil {
+			failover := newBitcoindFailover(&bitcoindFailoverConfig{
+				Backends: upstreamBackends,
+				Active:   active,
+				Check: func() error {
+					_, err := healthClient.
+						GetBlockChainInfo()
+					return err
+				},
+				Reachable: func(backend bitcoindBackend) error {
+					return preflightEndpoints(
+						context.Background(),
+						backendDial, backend.rpcHost,
+						backend.zmqPubRawBlock,
+						backend.zmqPubRawTx,
+						defaultPreflightTimeout,
+					)
+				},
+				FailOver: func(_, to bitcoindBackend) error {
+					return failoverSwitch.Switch(to)
+				},
+				CheckInterval: defaultFailoverCheckInterval,
+				MaxFailures:   defaultFailoverMaxFailures,
+			})
+			if err := failover.Start(); err != nil {
+				return nil, nil, err
+			}
+			stopFailover = failover.Stop
+			started.add(stopFunc(stopFailover))
+		}
+
+		// Finally, we'll create our clean up function which stops the
+		// fee estimator along with the subsystems connected to bitcoind,
+		// and then closes the connection itself.
+		cleanUp = newBackendCleanUp(
+			cc.feeEstimator, feeFloor.Stop, stopFailover,
+			stopZMQWatchdog, cc.chainNotifier.Stop,
+			cc.chainView.Stop, func() error {
+				healthClient.Shutdown()
+				if walletConn != bitcoindConn {
+					walletConn.Stop()
+				}
+				bitcoindConn.Stop()
+				return nil
+			}, stopRelays, stopTLSTunnels, stopOnionTunnels,
+		)
 	case "btcd", "ltcd":
 		// Otherwise, we'll be speaking directly via RPC to a node.
 		//
@@ -397,50 +1448,140 @@ func newChainControlFromConfig(cfg *config, chanDB *channeldb.DB,
 		case cfg.Litecoin.Active:
 			btcdMode = cfg.LtcdMode
 		}
-		var rpcCert []byte
-		if btcdMode.RawRPCCert != "" {
-			rpcCert, err = hex.DecodeString(btcdMode.RawRPCCert)
+		rpcCert, err := loadBtcdRPCCert(btcdMode)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = checkRPCCertValidity(
+			homeChainConfig.Node, rpcCert, time.Now(),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		btcdHost := btcdRPCAddress(btcdMode.RPCHost)
+
+		// Before establishing the connection, we'll make sure the RPC
+		// host is reachable, so we can fail fast if it isn't. If
+		// configured, we'll retry until it is, as btcd may still be
+		// starting up. As the check is disabled without a connect
+		// timeout, we'll use a default one when retrying.
+		if err := checkRPCHost(btcdHost, cfg.Tor.Active); err != nil {
+			return nil, nil, err
+		}
+		if err := checkBtcdNoTLS(btcdMode, btcdHost); err != nil {
+			return nil, nil, err
+		}
+
+		// Only onion hosts will be dialed through Tor, as it refuses to
+		// connect to local backends. As btcwallet's connection can't be
+		// given a dialer, all connections to an onion host are made
+		// through a local tunnel dialing it through Tor instead, so
+		// btcd's certificate must be valid for 127.0.0.1. If reloadcert
+		// is set, the tunnel set up below for btcd's certificate dials
+		// the onion host itself.
+		backendDial := backendDialer(cfg.net.Dial)
+		onionTunnels := newBackendTunnels(nil, backendDial)
+		if cfg.Tor.Active && !btcdMode.ReloadCert {
+			btcdHost, err = onionTunnels.onionAddr(btcdHost)
 			if err != nil {
 				return nil, nil, err
 			}
-		} else {
-			certFile, err := os.Open(btcdMode.RPCCert)
+			started.add(stopFunc(onionTunnels.Stop))
+		}
+
+		rpcConfig, err := newBtcdRPCConfig(btcdMode, btcdHost, rpcCert)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// To aid in diagnosing connection problems, we'll log the
+		// resolved connection parameters before connecting.
+		ltndLog.Infof("Connecting to %v", &backendConnParams{
+			node:     homeChainConfig.Node,
+			rpcHost:  rpcConfig.Host,
+			endpoint: rpcConfig.Endpoint,
+			tls:      !rpcConfig.DisableTLS,
+			user:     rpcConfig.User,
+			pass:     rpcConfig.Pass,
+		})
+
+		dialTimeout := btcdMode.RPCConnectTimeout
+		if dialTimeout == 0 && homeChainConfig.ConnectRetryAttempts > 0 {
+			dialTimeout = defaultConnectRetryDialTimeout
+		}
+		err = connectWithRetry(
+			ctx, homeChainConfig.ConnectRetryAttempts,
+			homeChainConfig.ConnectRetryDelay, func() error {
+				return dialRPCHost(
+					ctx, backendDial, btcdHost,
+					dialTimeout,
+				)
+			},
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// If requested, we'll watch btcd's certificate, as it's
+		// regenerated on restart. As the certificate of our clients
+		// can't be replaced once they're created, they'll connect to
+		// btcd through a local tunnel carrying out the TLS handshake on
+		// their behalf instead. Once btcd presents the new certificate,
+		// the tunnel switches to it and closes the connections it's
+		// forwarding, which the clients then re-establish through their
+		// automatic reconnection.
+		stopCertWatcher := func() error { return nil }
+		stopCertTunnel := func() error { return nil }
+		if btcdMode.ReloadCert {
+			tlsConfig, err := rpcCertTLSConfig(rpcCert)
 			if err != nil {
 				return nil, nil, err
 			}
-			rpcCert, err = ioutil.ReadAll(certFile)
+			certTunnel, err := newBackendTunnel(
+				btcdHost, tlsConfig, backendDial,
+			)
 			if err != nil {
 				return nil, nil, err
 			}
-			if err := certFile.Close(); err != nil {
+			stopCertTunnel = certTunnel.Stop
+			started.add(stopFunc(stopCertTunnel))
+
+			rpcConfig.Host = certTunnel.Addr()
+			rpcConfig.Certificates = nil
+			rpcConfig.DisableTLS = true
+
+			watcher := newCertWatcher(&certWatcherConfig{
+				CertPath: btcdMode.RPCCert,
+				Cert:     rpcCert,
+				Reconnect: func(cert []byte) error {
+					err := checkRPCServerCert(
+						backendDial, btcdHost, cert,
+						defaultCertCheckTimeout,
+					)
+					if err != nil {
+						return err
+					}
+
+					tlsConfig, err := rpcCertTLSConfig(cert)
+					if err != nil {
+						return err
+					}
+					certTunnel.SetTLSConfig(tlsConfig)
+
+					return nil
+				},
+				PollInterval: defaultCertPollInterval,
+			})
+			if err := watcher.Start(); err != nil {
 				return nil, nil, err
 			}
-		}
-
-		// If the specified host for the btcd/ltcd RPC server already
-		// has a port specified, then we use that directly. Otherwise,
-		// we assume the default port according to the selected chain
-		// parameters.
-		var btcdHost string
-		if strings.Contains(btcdMode.RPCHost, ":") {
-			btcdHost = btcdMode.RPCHost
-		} else {
-			btcdHost = fmt.Sprintf("%v:%v", btcdMode.RPCHost,
-				activeNetParams.rpcPort)
+			stopCertWatcher = watcher.Stop
+			started.add(stopFunc(stopCertWatcher))
 		}
 
 		btcdUser := btcdMode.RPCUser
 		btcdPass := btcdMode.RPCPass
-		rpcConfig := &rpcclient.ConnConfig{
-			Host:                 btcdHost,
-			Endpoint:             "ws",
-			User:                 btcdUser,
-			Pass:                 btcdPass,
-			Certificates:         rpcCert,
-			DisableTLS:           false,
-			DisableConnectOnNew:  true,
-			DisableAutoReconnect: false,
-		}
+
 		cc.chainNotifier, err = btcdnotify.New(
 			rpcConfig, hintCache, hintCache,
 		)
@@ -458,64 +1599,464 @@ func newChainControlFromConfig(cfg *config, chanDB *channeldb.DB,
 
 		// Create a special websockets rpc client for btcd which will be used
 		// by the wallet for notifications, calls, etc.
-		chainRPC, err := chain.NewRPCClient(activeNetParams.Params, btcdHost,
-			btcdUser, btcdPass, rpcCert, false, 20)
+		chainRPC, err := chain.NewRPCClient(activeNetParams.Params,
+			btcdWalletHost(rpcConfig.Host, rpcConfig.Endpoint),
+			btcdUser, btcdPass, rpcConfig.Certificates,
+			rpcConfig.DisableTLS, 20)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		walletConfig.ChainSource = chainRPC
+		chainSource = chainRPC
+		cc.syncStatus = blockChainInfoSyncStatus(chainRPC)
+		cc.bestBlock = rpcBestBlock(chainRPC)
 
 		// If we're not in simnet or regtest mode, then we'll attempt
 		// to use a proper fee estimator for testnet.
-		if !cfg.Bitcoin.SimNet && !cfg.Litecoin.SimNet &&
-			!cfg.Bitcoin.RegTest && !cfg.Litecoin.RegTest {
+		useRPC, err := useRPCFeeEstimator(
+			homeChainConfig.FeeEstimatorMode, homeChainConfig.Node,
+			activeNetParams.Name, liveFeeEstimates(homeChainConfig),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
 
-			ltndLog.Infof("Initializing btcd backed fee estimator")
+		switch {
+		case useRPC:
+			ltndLog.Infof("Initializing %v backed fee estimator",
+				homeChainConfig.Node)
 
 			// Finally, we'll re-initialize the fee estimator, as
 			// if we're using btcd as a backend, then we can use
 			// live fee estimates, rather than a statically coded
 			// value.
-			fallBackFeeRate := lnwallet.SatPerKVByte(25 * 1000)
 			cc.feeEstimator, err = lnwallet.NewBtcdFeeEstimator(
-				*rpcConfig, fallBackFeeRate.FeePerKWeight(),
+				*rpcConfig, fallbackFeeRate(btcdMode.FallbackFeeRate),
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = startFeeEstimator(
+				ctx, cc.feeEstimator, btcdHost,
+				btcdMode.RPCConnectTimeout, &started,
+			)
+			if err != nil {
+				// If enabled, we'll fall back to static
+				// estimates, skipping the rest of the live
+				// estimator's setup.
+				cc.feeEstimator, err = staticFeeFallback(
+					ctx, homeChainConfig, err,
+					backendStaticFeeRate(
+						homeChainConfig,
+						registeredChains.PrimaryChain(),
+						btcdMode.FallbackFeeRate,
+					),
+				)
+				if err != nil {
+					return nil, nil, err
+				}
+				break
+			}
+
+			// If requested, we'll wait for the estimator's first
+			// live estimate, so the fee queries made early on don't
+			// resort to the fallback fee rate needlessly.
+			err = waitForFeeEstimate(
+				ctx, cc.feeEstimator,
+				homeChainConfig.FeeEstimateConfTarget,
+				homeChainConfig.FeeEstimatorWarmup,
+				feeEstimatorWarmupPollInterval,
 			)
 			if err != nil {
 				return nil, nil, err
 			}
-			if err := cc.feeEstimator.Start(); err != nil {
+
+			// If a max age of the estimates is set, we'll fail
+			// rather than resort to the fallback fee rate.
+			// Otherwise, we'll warn whenever the estimator resorts
+			// to it, as our fees are likely to be off.
+			cc.feeEstimator = rejectFeeFallback(
+				cc.feeEstimator, homeChainConfig,
+			)
+			cc.feeEstimator = newFallbackWarningEstimator(
+				cc.feeEstimator, rpcObserver,
+			)
+			if rpcObserver != nil {
+				cc.feeEstimator = &observedFeeEstimator{
+					FeeEstimator: cc.feeEstimator,
+					method:       "estimatefee",
+					observer:     rpcObserver,
+				}
+			}
+			cc.feeEstimator = limitFeeEstimator(
+				cc.feeEstimator, limiter,
+			)
+
+			// We'll cache or poll the live estimates, so
+			// concurrent subsystems don't each issue an RPC to
+			// btcd. Either way, they may be refreshed on demand.
+			cc.feeEstimator, err = refreshFeeEstimates(
+				ctx, cc.feeEstimator, homeChainConfig, btcdHost,
+				&started,
+			)
+			if err != nil {
 				return nil, nil, err
 			}
+			cc.feeRefresher = refreshableFeeEstimator(
+				cc.feeEstimator,
+			)
+
+		case homeChainConfig.FeeEstimatorMode == feeEstimatorModeStatic:
+			cc.feeEstimator = lnwallet.StaticFeeEstimator{
+				FeePerKW: backendStaticFeeRate(
+					homeChainConfig,
+					registeredChains.PrimaryChain(),
+					btcdMode.FallbackFeeRate,
+				),
+			}
+		}
+
+		// We'll keep track of btcd's minimum relay fee, so fee
+		// estimates below it can be raised before our transactions are
+		// rejected from its mempool. As the wallet's websockets client
+		// only connects once the wallet is started, we'll query btcd
+		// through a dedicated client.
+		feeConfig := *rpcConfig
+		feeConfig.HTTPPostMode = true
+		feeClient, err := rpcclient.New(&feeConfig, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		started.add(feeClient.Shutdown)
+
+		feeFloor = newRelayFeeFloor(minRelayFeeFloorConfig(
+			homeChainConfig, rpcMinRelayFee(feeClient),
+		))
+		if err := feeFloor.Start(); err != nil {
+			return nil, nil, err
+		}
+		started.add(stopFunc(feeFloor.Stop))
+
+		// We'll make sure our clock roughly agrees with btcd's chain,
+		// as our timeouts are evaluated against it.
+		err = checkClockSkew(feeClient, homeChainConfig, time.Now())
+		if err != nil {
+			return nil, nil, err
 		}
+
+		// The wallet's websockets client can't serve any block headers
+		// until it's connected, so we'll use the dedicated client.
+		headerSource = feeClient
+
+		// Finally, we'll create our clean up function which stops the
+		// fee estimator along with the subsystems connected to btcd,
+		// and then disconnects the wallet's RPC client.
+		cleanUp = newBackendCleanUp(
+			cc.feeEstimator, feeFloor.Stop, stopCertWatcher,
+			cc.chainNotifier.Stop, cc.chainView.Stop, func() error {
+				feeClient.Shutdown()
+				chainRPC.Stop()
+				return nil
+			}, stopCertTunnel, onionTunnels.Stop,
+		)
 	default:
-		return nil, nil, fmt.Errorf("unknown node type: %s",
-			homeChainConfig.Node)
+		return nil, nil, newChainBackendError(
+			ErrInvalidChainConfig, fmt.Errorf("unknown node "+
+				"type: %s", homeChainConfig.Node),
+		)
 	}
 
-	wc, err := btcwallet.New(*walletConfig)
+	// We'll log the depth of the chain reorganizations the notifier
+	// handles, and once one exceeds maxreorgdepth, we'll request a
+	// shutdown. The reorganization was already dispatched to the
+	// notifier's clients by then, so this only stops lnd from running on
+	// top of the backend any longer.
+	cc.chainNotifier = newReorgMonitor(
+		cc.chainNotifier, &reorgMonitorConfig{
+			MaxReorgDepth: homeChainConfig.MaxReorgDepth,
+			Shutdown: func(uint32) {
+				go signal.RequestShutdown()
+			},
+		},
+	)
+
+	// If the wallet's birthday was configured as a block height, we'll
+	// resolve it to the block's timestamp now that the backend is set up.
+	if headerSource == nil {
+		headerSource = chainSource
+	}
+	walletConfig.Birthday, err = walletBirthday(
+		headerSource, homeChainConfig.BirthdayBlock,
+		walletConfig.Birthday,
+	)
 	if err != nil {
-		fmt.Printf("unable to create wallet controller: %v\n", err)
 		return nil, nil, err
 	}
 
-	cc.msgSigner = wc
-	cc.signer = wc
+	// With the backend set up, we'll create the wallet on top of it, which
+	// completes the chain control.
+	err = finalizeChainControl(
+		ctx, cc, homeChainConfig, walletConfig, chainSource, chanDB,
+		rpcObserver, limiter, feeFloor,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// With the setup complete, the subsystems we started are now stopped
+	// by the returned clean up function instead.
+	started.disarm()
+
+	return cc, cleanUp, nil
+}
+
+// defaultRoutingPolicy returns the default forwarding policy of our channels
+// on the passed primary chain, as set through its config. It's reported by the
+// chain control through RoutingPolicy until it's updated.
+func defaultRoutingPolicy(cfg *config,
+	primaryChain chainCode) (htlcswitch.ForwardingPolicy, error) {
+
+	switch primaryChain {
+	case bitcoinChain:
+		return htlcswitch.ForwardingPolicy{
+			MinHTLC:       cfg.Bitcoin.MinHTLC,
+			BaseFee:       cfg.Bitcoin.BaseFee,
+			FeeRate:       cfg.Bitcoin.FeeRate,
+			TimeLockDelta: cfg.Bitcoin.TimeLockDelta,
+		}, nil
+
+	case litecoinChain:
+		return htlcswitch.ForwardingPolicy{
+			MinHTLC:       cfg.Litecoin.MinHTLC,
+			BaseFee:       cfg.Litecoin.BaseFee,
+			FeeRate:       cfg.Litecoin.FeeRate,
+			TimeLockDelta: cfg.Litecoin.TimeLockDelta,
+		}, nil
+
+	default:
+		return htlcswitch.ForwardingPolicy{}, fmt.Errorf("Default "+
+			"routing policy for chain %v is unknown", primaryChain)
+	}
+}
+
+// blockHeaderSource is a chain backend which is able to serve the headers of
+// the blocks within its chain, such as an rpcclient.Client or the chain
+// sources of btcwallet.
+type blockHeaderSource interface {
+	// GetBlockHash returns the hash of the block at the given height.
+	GetBlockHash(height int64) (*chainhash.Hash, error)
+
+	// GetBlockHeader returns the header of the block with the given hash.
+	GetBlockHeader(hash *chainhash.Hash) (*wire.BlockHeader, error)
+}
+
+// walletBirthday returns the birthday of the wallet, which bounds the rescans
+// for its addresses. If a birthday block was configured, the timestamp of the
+// block at that height is queried from the passed source, as users usually
+// know the height their wallet was first used at rather than the time.
+// Otherwise, the passed birthday is returned. The birthday only applies to
+// wallets created at startup, as those created from a seed carry the seed's
+// birthday instead.
+func walletBirthday(source blockHeaderSource, birthdayBlock uint32,
+	birthday time.Time) (time.Time, error) {
+
+	if birthdayBlock == 0 {
+		return birthday, nil
+	}
+
+	hash, err := source.GetBlockHash(int64(birthdayBlock))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to resolve birthday "+
+			"block %d: %v", birthdayBlock, err)
+	}
+	header, err := source.GetBlockHeader(hash)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to resolve birthday "+
+			"block %d: %v", birthdayBlock, err)
+	}
+
+	ltndLog.Infof("Using timestamp %v of block %d as wallet birthday",
+		header.Timestamp, birthdayBlock)
+
+	return header.Timestamp, nil
+}
+
+// finalizeChainControl completes the passed chainControl, once the chain
+// notifier, chain view and fee estimator of the selected backend have been set
+// up. It creates the wallet on top of the passed chain source of the backend,
+// and wires it into the LightningWallet along with the rest of the chain
+// control. This is shared by all backends, so each of them only has to supply
+// its unique connection setup. The wallet's start up is abandoned once the
+// passed context is canceled or the configured wallet start up timeout
+// expires. The calls made to the backend through the chain control are
+// reported to the passed observer and limited by the passed limiter, if set,
+// while its fee estimates are raised to the passed minimum relay fee floor.
+func finalizeChainControl(ctx context.Context, cc *chainControl,
+	homeChainConfig *chainConfig, walletConfig *btcwallet.Config,
+	chainSource chain.Interface, chanDB *channeldb.DB,
+	rpcObserver RPCObserver, limiter *rpcLimiter,
+	feeFloor *relayFeeFloor) error {
+
+	// If a maximum fee rate was configured, then we'll clamp all estimates
+	// to it, so that fee spikes don't lead to excessive on-chain fees.
+	if homeChainConfig.MaxFeeRate != 0 {
+		maxFeePerKW := lnwallet.SatPerKVByte(
+			homeChainConfig.MaxFeeRate * 1000,
+		).FeePerKWeight()
+		cc.feeEstimator = lnwallet.NewMaxFeeRateEstimator(
+			cc.feeEstimator, maxFeePerKW,
+		)
+	}
+
+	// We'll raise all estimates to the minimum relay fee, as our
+	// transactions would be rejected from the mempool otherwise. This takes
+	// precedence over the maximum fee rate, as such transactions would be
+	// of no use.
+	cc.feeEstimator = lnwallet.NewMinFeeRateEstimator(
+		cc.feeEstimator, feeFloor.FeePerKW,
+	)
+
+	// If a confirmation target was configured for fee estimates, then
+	// we'll request all estimates for that target, rather than the one
+	// chosen by each subsystem.
+	if homeChainConfig.FeeEstimateConfTarget != 0 {
+		cc.feeEstimator = lnwallet.NewFixedTargetFeeEstimator(
+			cc.feeEstimator, homeChainConfig.FeeEstimateConfTarget,
+		)
+	}
+
+	walletConfig.ChainSource = chainSource
+	wc, err := btcwallet.New(*walletConfig)
+	if err != nil {
+		fmt.Printf("unable to create wallet controller: %v\n", err)
+		return err
+	}
+
+	cc.msgSigner = wc
+	cc.signer = wc
 	cc.chainIO = wc
 
-	// Select the default channel constraints for the primary chain.
-	channelConstraints := defaultBtcChannelConstraints
-	if registeredChains.PrimaryChain() == litecoinChain {
-		channelConstraints = defaultLtcChannelConstraints
+	// In watch-only mode, the wallet doesn't hold any private key
+	// material, so we'll refuse to sign anything.
+	if walletConfig.WatchOnly {
+		cc.msgSigner = &watchOnlySigner{}
+		cc.signer = &watchOnlySigner{}
+	}
+
+	// If an observer was supplied, we'll report the calls made to the
+	// backend through the chain control to it. Neutrino isn't backed by
+	// RPC, so there's nothing to observe in that case.
+	if rpcObserver != nil && homeChainConfig.Node != "neutrino" {
+		cc.chainIO = &observedChainIO{
+			BlockChainIO: cc.chainIO,
+			observer:     rpcObserver,
+		}
+		cc.syncStatus = observedSyncStatus(cc.syncStatus, rpcObserver)
 	}
 
-	keyRing := keychain.NewBtcWalletKeyRing(
-		wc.InternalWallet(), activeNetParams.CoinType,
+	// Likewise, we'll cap the number of concurrent calls made through the
+	// chain control if requested. The limit is applied on top of the
+	// observer, so the observed durations don't include the time spent
+	// waiting for a slot. The wallet's own chain client isn't limited, as
+	// the wallet inspects its concrete type.
+	if homeChainConfig.Node != "neutrino" {
+		cc.chainIO = limitChainIO(cc.chainIO, limiter)
+		cc.syncStatus = limitSyncStatus(cc.syncStatus, limiter)
+		cc.bestBlock = limitBestBlock(cc.bestBlock, limiter)
+	}
+
+	keyRing := walletKeyRing(
+		homeChainConfig, wc.InternalWallet(), walletConfig.CoinType,
 	)
 
 	// Create, and start the lnwallet, which handles the core payment
 	// channel logic, and exposes control via proxy state machines.
-	walletCfg := lnwallet.Config{
+	addrType, err := walletAddressType(homeChainConfig.AddressType)
+	if err != nil {
+		return err
+	}
+	walletCfg := newLightningWalletConfig(
+		cc, chanDB, wc, keyRing, registeredChains.PrimaryChain(),
+		addrType,
+	)
+	lnWallet, err := lnwallet.NewLightningWallet(walletCfg)
+	if err != nil {
+		fmt.Printf("unable to create wallet: %v\n", err)
+		return err
+	}
+	err = startLightningWallet(
+		ctx, lnWallet.Startup, stopFunc(lnWallet.Shutdown),
+		homeChainConfig.WalletStartupTimeout,
+	)
+	if err != nil {
+		fmt.Printf("unable to start wallet: %v\n", err)
+		return err
+	}
+
+	ltndLog.Info("LightningWallet opened")
+
+	cc.wallet = lnWallet
+
+	return nil
+}
+
+// startLightningWallet executes the passed start up function of the
+// LightningWallet, which may block for a long time while the wallet rescans
+// against a slow backend. The start up is abandoned once the context is
+// canceled or the timeout expires, in which case the passed shutdown function
+// is executed if it completes after all. A zero timeout leaves the start up
+// unbounded.
+func startLightningWallet(ctx context.Context, startup func() error,
+	shutdown func(), timeout time.Duration) error {
+
+	startCtx := ctx
+	if timeout != 0 {
+		var cancel func()
+		startCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := runWithContext(startCtx, startup, shutdown)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return fmt.Errorf("wallet didn't start up within %v, it may "+
+			"still be rescanning against a slow backend, consider "+
+			"raising walletstartuptimeout", timeout)
+	}
+
+	return err
+}
+
+// walletKeyRing returns the key ring the LightningWallet derives its keys
+// with. If an alternative one was set through the chain config, e.g. an
+// HSM-backed one, it's used as is. Otherwise, the default key ring backed by
+// the passed btcwallet is returned, which must derive its keys with the same
+// coin type as the wallet.
+func walletKeyRing(chainCfg *chainConfig, w *wallet.Wallet,
+	coinType uint32) keychain.SecretKeyRing {
+
+	if chainCfg.SecretKeyRing != nil {
+		ltndLog.Infof("Using the externally provided key ring")
+		return chainCfg.SecretKeyRing
+	}
+
+	return keychain.NewBtcWalletKeyRing(w, coinType)
+}
+
+// newLightningWalletConfig returns the config of the LightningWallet, which
+// is backed by the passed wallet controller and key ring along with the
+// subsystems of the chain control. The default channel constraints are
+// selected according to the primary chain, and the wallet generates addresses
+// of the passed type for its own funds.
+func newLightningWalletConfig(cc *chainControl, chanDB *channeldb.DB,
+	wc lnwallet.WalletController, keyRing keychain.SecretKeyRing,
+	primaryChain chainCode, addrType lnwallet.AddressType) lnwallet.Config {
+
+	channelConstraints := defaultBtcChannelConstraints
+	if primaryChain == litecoinChain {
+		channelConstraints = defaultLtcChannelConstraints
+	}
+
+	return lnwallet.Config{
 		Database:           chanDB,
 		Notifier:           cc.chainNotifier,
 		WalletController:   wc,
@@ -525,22 +2066,1750 @@ func newChainControlFromConfig(cfg *config, chanDB *channeldb.DB,
 		ChainIO:            cc.chainIO,
 		DefaultConstraints: channelConstraints,
 		NetParams:          *activeNetParams.Params,
+		AddressType:        addrType,
 	}
-	lnWallet, err := lnwallet.NewLightningWallet(walletCfg)
+}
+
+// newBackendCleanUp returns a clean up function for a chain backend, which
+// stops the passed fee estimator followed by each of the passed subsystems in
+// order. The returned function is safe to call multiple times, though the
+// clean up will only be carried out once.
+func newBackendCleanUp(feeEstimator lnwallet.FeeEstimator,
+	stopFuncs ...func() error) func() {
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := feeEstimator.Stop(); err != nil {
+				ltndLog.Errorf("unable to stop fee estimator: "+
+					"%v", err)
+			}
+
+			for _, stop := range stopFuncs {
+				if err := stop(); err != nil {
+					ltndLog.Errorf("unable to stop chain "+
+						"backend: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// blockChainInfoSource is an RPC backend which is able to serve
+// getblockchaininfo requests, such as an rpcclient.Client.
+type blockChainInfoSource interface {
+	// GetBlockChainInfo returns information about the current state of
+	// the backend's chain.
+	GetBlockChainInfo() (*btcjson.GetBlockChainInfoResult, error)
+}
+
+// checkPrunedBackend queries the given RPC backend for whether it's pruned.
+// lnd relies on fetching historical blocks for some channel operations, which
+// fails for the blocks a pruned node has discarded, so a warning is logged for
+// a pruned node, unless refusepruned is set, in which case an error is
+// returned instead.
+func checkPrunedBackend(source blockChainInfoSource, node string,
+	refusePruned bool) error {
+
+	info, err := source.GetBlockChainInfo()
 	if err != nil {
-		fmt.Printf("unable to create wallet: %v\n", err)
-		return nil, nil, err
+		return newChainBackendError(
+			ErrBackendUnreachable, fmt.Errorf("unable to "+
+				"determine whether %v is pruned: %v", node,
+				err),
+		)
 	}
-	if err := lnWallet.Startup(); err != nil {
-		fmt.Printf("unable to start wallet: %v\n", err)
-		return nil, nil, err
+
+	if !info.Pruned {
+		return nil
 	}
 
-	ltndLog.Info("LightningWallet opened")
+	if refusePruned {
+		return newChainBackendError(
+			ErrInvalidChainConfig, fmt.Errorf("%v is pruned "+
+				"below height %d, so lnd may be unable to "+
+				"retrieve the historical blocks required for "+
+				"channel operations. Unset %v.refusepruned to "+
+				"proceed anyway", node, info.PruneHeight,
+				node),
+		)
+	}
 
-	cc.wallet = lnWallet
+	ltndLog.Warnf("%v is pruned below height %d! Channel operations "+
+		"relying on historical blocks, such as rescans or resolving "+
+		"old channels, may fail", node, info.PruneHeight)
 
-	return cc, cleanUp, nil
+	return nil
+}
+
+// checkZMQSelfTestGenerate ensures that zmqselftestgenerate is only set along
+// with zmqselftest, on bitcoin's regtest network, as that's the only network
+// on which lnd generates a block for the self-test.
+func checkZMQSelfTestGenerate(bitcoindMode *bitcoindConfig,
+	chainCfg *chainConfig, primaryChain chainCode) error {
+
+	switch {
+	case !bitcoindMode.ZMQSelfTestGenerate:
+		return nil
+
+	case !bitcoindMode.ZMQSelfTest:
+		return fmt.Errorf("%[1]v.zmqselftestgenerate requires "+
+			"%[1]v.zmqselftest", chainCfg.Node)
+
+	case primaryChain != bitcoinChain || !chainCfg.RegTest:
+		return fmt.Errorf("%v.zmqselftestgenerate is only supported "+
+			"on bitcoin's regtest network", chainCfg.Node)
+	}
+
+	return nil
+}
+
+// checkClockSkew compares the local clock against the median time past of the
+// given RPC backend's chain tip, as HTLC timeouts and CLTV deadlines are
+// evaluated against the chain's timestamps. As the median time past lags
+// behind the actual time, our clock is considered skewed if it's behind the
+// median time past by more than maxclockskew, or, once the backend is synced,
+// ahead of it by more than maxclockskew plus medianTimePastLag. A warning is
+// logged for excessive skew, unless strictclockskew is set, in which case an
+// error is returned. The check is skipped on regtest and simnet, whose chains
+// aren't tied to the actual time, as well as if maxclockskew is zero.
+func checkClockSkew(source blockChainInfoSource, chainCfg *chainConfig,
+	now time.Time) error {
+
+	maxSkew := chainCfg.MaxClockSkew
+	if maxSkew == 0 || chainCfg.SimNet || chainCfg.RegTest {
+		return nil
+	}
+
+	info, err := source.GetBlockChainInfo()
+	if err != nil {
+		err = fmt.Errorf("unable to determine clock skew with %v: %v",
+			chainCfg.Node, err)
+		if chainCfg.StrictClockSkew {
+			return err
+		}
+
+		ltndLog.Warn(err)
+		return nil
+	}
+
+	medianTime := time.Unix(info.MedianTime, 0)
+	synced := info.Blocks >= info.Headers
+
+	var skewErr error
+	switch {
+	case now.Before(medianTime.Add(-maxSkew)):
+		skewErr = fmt.Errorf("local clock is %v behind the median "+
+			"time of %v's chain tip (%v)", medianTime.Sub(now),
+			chainCfg.Node, medianTime.UTC())
+
+	case synced && now.After(medianTime.Add(maxSkew+medianTimePastLag)):
+		skewErr = fmt.Errorf("local clock is %v ahead of the median "+
+			"time of %v's chain tip (%v)", now.Sub(medianTime),
+			chainCfg.Node, medianTime.UTC())
+
+	default:
+		return nil
+	}
+
+	if chainCfg.StrictClockSkew {
+		return fmt.Errorf("%v, exceeding maxclockskew of %v", skewErr,
+			maxSkew)
+	}
+
+	ltndLog.Warnf("%v, HTLC timeouts and CLTV deadlines may be acted "+
+		"upon prematurely or late", skewErr)
+
+	return nil
+}
+
+// blockChainInfoSyncStatus returns a function which reports whether the given
+// RPC backend is synced. The backend is considered synced once it has
+// validated the blocks of all headers it knows of.
+func blockChainInfoSyncStatus(source blockChainInfoSource) func() (bool,
+	error) {
+
+	return func() (bool, error) {
+		info, err := source.GetBlockChainInfo()
+		if err != nil {
+			return false, err
+		}
+
+		return info.Blocks >= info.Headers, nil
+	}
+}
+
+// bestBlockSource is an RPC backend which is able to serve getbestblockhash
+// and getblockheader requests, such as an rpcclient.Client.
+type bestBlockSource interface {
+	// GetBestBlockHash returns the hash of the best block in the
+	// backend's chain.
+	GetBestBlockHash() (*chainhash.Hash, error)
+
+	// GetBlockHeaderVerbose returns the header of the block with the
+	// given hash, along with its height.
+	GetBlockHeaderVerbose(hash *chainhash.Hash) (
+		*btcjson.GetBlockHeaderVerboseResult, error)
+}
+
+// rpcBestBlock returns a function which queries the tip of the given RPC
+// backend. The height is taken from the header of the best block, so it
+// matches the returned hash even if a new block arrives in between both
+// calls.
+func rpcBestBlock(source bestBlockSource) func() (chainhash.Hash, int32,
+	error) {
+
+	return func() (chainhash.Hash, int32, error) {
+		hash, err := source.GetBestBlockHash()
+		if err != nil {
+			return chainhash.Hash{}, 0, err
+		}
+
+		header, err := source.GetBlockHeaderVerbose(hash)
+		if err != nil {
+			return chainhash.Hash{}, 0, err
+		}
+
+		return *hash, header.Height, nil
+	}
+}
+
+// neutrinoBestBlockSource is a light client which is able to report the best
+// block of its header chain, such as a neutrino.ChainService.
+type neutrinoBestBlockSource interface {
+	// BestBlock returns the hash and height of the best block in the
+	// light client's header chain.
+	BestBlock() (*waddrmgr.BlockStamp, error)
+}
+
+// neutrinoBestBlock returns a function which queries the tip of the given
+// light client.
+func neutrinoBestBlock(source neutrinoBestBlockSource) func() (chainhash.Hash,
+	int32, error) {
+
+	return func() (chainhash.Hash, int32, error) {
+		bestBlock, err := source.BestBlock()
+		if err != nil {
+			return chainhash.Hash{}, 0, err
+		}
+
+		return bestBlock.Hash, bestBlock.Height, nil
+	}
+}
+
+// liveFeeEstimates returns whether the btcd backend of the given chain is able
+// to provide live fee estimates on the active network. This isn't the case on
+// regtest and simnet, as the backend doesn't have enough data to base them on.
+func liveFeeEstimates(chainCfg *chainConfig) bool {
+	return !chainCfg.SimNet && !chainCfg.RegTest
+}
+
+// useRPCFeeEstimator determines whether live fee estimates should be requested
+// from the given backend node, based on the configured fee estimator mode and
+// whether the backend is able to provide live estimates on the active network.
+// An error is returned if live estimates were requested explicitly, but are
+// unavailable.
+func useRPCFeeEstimator(mode, node, netName string,
+	liveEstimates bool) (bool, error) {
+
+	switch mode {
+	case feeEstimatorModeAuto, "":
+		return liveEstimates, nil
+
+	case feeEstimatorModeStatic:
+		return false, nil
+
+	case feeEstimatorModeRPC:
+		if !liveEstimates {
+			return false, newChainBackendError(
+				ErrInvalidChainConfig, fmt.Errorf(
+					"feeestimatormode=%v is unsupported, "+
+						"as %v is unable to provide "+
+						"fee estimates on %v",
+					feeEstimatorModeRPC, node, netName,
+				),
+			)
+		}
+
+		return true, nil
+
+	default:
+		return false, newChainBackendError(
+			ErrInvalidChainConfig, fmt.Errorf("unknown fee "+
+				"estimator mode: %v", mode),
+		)
+	}
+}
+
+// staticFeeRate returns the fee rate of the static fee estimator used if no
+// live estimates are available, which is the rate in sat/vbyte configured for
+// the chain if set, or the default rate of the given chain otherwise. On
+// simnet, the rate configured specifically for it takes precedence.
+func staticFeeRate(chainCfg *chainConfig,
+	primaryChain chainCode) lnwallet.SatPerKWeight {
+
+	feeRate := chainCfg.StaticFeeRate
+	if chainCfg.SimNet && chainCfg.SimNetFeeRate != 0 {
+		feeRate = chainCfg.SimNetFeeRate
+	}
+	if feeRate != 0 {
+		return lnwallet.SatPerKVByte(feeRate * 1000).FeePerKWeight()
+	}
+
+	if primaryChain == litecoinChain {
+		return defaultLitecoinStaticFeePerKW
+	}
+
+	return defaultBitcoinStaticFeePerKW
+}
+
+// backendStaticFeeRate returns the fee rate of the static fee estimator used
+// by the btcd/bitcoind backends if feeestimatormode=static is set, or their
+// live estimator falls back to static estimates. The rate configured through
+// staticfeerate, or simnetfeerate on simnet, takes precedence, while the
+// backend's fallback fee rate in sat/vbyte is used otherwise.
+func backendStaticFeeRate(chainCfg *chainConfig, primaryChain chainCode,
+	fallbackRate int64) lnwallet.SatPerKWeight {
+
+	if chainCfg.StaticFeeRate != 0 ||
+		(chainCfg.SimNet && chainCfg.SimNetFeeRate != 0) {
+
+		return staticFeeRate(chainCfg, primaryChain)
+	}
+
+	return fallbackFeeRate(fallbackRate)
+}
+
+// walletCoinType returns the BIP44 coin type the wallet should derive its keys
+// with, which is the one configured for the chain if set, or the coin type of
+// the active network otherwise.
+func walletCoinType(chainCfg *chainConfig) uint32 {
+	if chainCfg.CoinType != 0 {
+		return chainCfg.CoinType
+	}
+
+	return activeNetParams.CoinType
+}
+
+// walletAddressType returns the type of address the wallet should generate for
+// its own funds, given the one configured for the chain. If none was
+// configured, p2wkh addresses are used.
+func walletAddressType(addrType string) (lnwallet.AddressType, error) {
+	switch addrType {
+	case "", "p2wkh":
+		return lnwallet.WitnessPubKey, nil
+
+	case "np2wkh":
+		return lnwallet.NestedWitnessPubKey, nil
+
+	default:
+		return 0, fmt.Errorf("invalid addresstype %q, must be one of "+
+			"p2wkh, np2wkh", addrType)
+	}
+}
+
+// bitcoindEstimateMode returns the estimation mode bitcoind's live fee
+// estimator should request its estimates with, given the configured one. If
+// none was configured, bitcoind's default mode is used.
+func bitcoindEstimateMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return "", nil
+
+	case "conservative":
+		return lnwallet.EstimateModeConservative, nil
+
+	case "economical":
+		return lnwallet.EstimateModeEconomical, nil
+
+	default:
+		return "", newChainBackendError(
+			ErrInvalidChainConfig, fmt.Errorf("invalid "+
+				"estimatemode %q, must be one of "+
+				"conservative, economical", mode),
+		)
+	}
+}
+
+// fallbackFeeRate returns the fee rate the live fee estimators should fall back
+// to when the backend is unable to provide an estimate, given the configured
+// rate in sat/vbyte. A zero rate selects defaultFallbackFeeRate.
+func fallbackFeeRate(satPerVByte int64) lnwallet.SatPerKWeight {
+	if satPerVByte == 0 {
+		satPerVByte = defaultFallbackFeeRate
+	}
+
+	return lnwallet.SatPerKVByte(satPerVByte * 1000).FeePerKWeight()
+}
+
+// neutrinoNameResolver returns a name resolver for neutrino which resolves
+// hosts through the given lookup function, skipping any addresses that aren't
+// valid IPs.
+func neutrinoNameResolver(lookupHost func(string) ([]string,
+	error)) func(string) ([]net.IP, error) {
+
+	return func(host string) ([]net.IP, error) {
+		addrs, err := lookupHost(host)
+		if err != nil {
+			return nil, err
+		}
+
+		ips := make([]net.IP, 0, len(addrs))
+		for _, strIP := range addrs {
+			ip := net.ParseIP(strIP)
+			if ip == nil {
+				continue
+			}
+
+			ips = append(ips, ip)
+		}
+
+		return ips, nil
+	}
+}
+
+// parseSocksProxy parses the address of a SOCKS5 proxy given as host:port,
+// optionally preceded by user:password@ to authenticate with the proxy. The
+// credentials are returned as nil if none were given.
+func parseSocksProxy(socksProxy string) (string, *proxy.Auth, error) {
+	var auth *proxy.Auth
+	proxyAddr := socksProxy
+	if at := strings.LastIndex(socksProxy, "@"); at != -1 {
+		credentials := strings.SplitN(socksProxy[:at], ":", 2)
+		if len(credentials) != 2 || credentials[0] == "" ||
+			credentials[1] == "" {
+
+			return "", nil, errors.New("invalid SOCKS proxy " +
+				"credentials, expected user:password@host:port")
+		}
+
+		auth = &proxy.Auth{
+			User:     credentials[0],
+			Password: credentials[1],
+		}
+		proxyAddr = socksProxy[at+1:]
+	}
+
+	host, port, err := net.SplitHostPort(proxyAddr)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid SOCKS proxy address %q: "+
+			"%v", proxyAddr, err)
+	}
+	if host == "" {
+		return "", nil, fmt.Errorf("invalid SOCKS proxy address %q: "+
+			"missing host", proxyAddr)
+	}
+	if portNum, err := strconv.Atoi(port); err != nil || portNum <= 0 ||
+		portNum > 65535 {
+
+		return "", nil, fmt.Errorf("invalid SOCKS proxy address %q: "+
+			"invalid port %q", proxyAddr, port)
+	}
+
+	return proxyAddr, auth, nil
+}
+
+// applyNeutrinoFilterCacheSize caps the size of the filter cache within the
+// passed config of neutrino's chain service, if configured. The least recently
+// used filters are evicted once the cap is reached, and need to be fetched
+// from peers again once they're needed. Without a cap, neutrino's default
+// size is used.
+func applyNeutrinoFilterCacheSize(config *neutrino.Config,
+	neutrinoMode *neutrinoConfig) error {
+
+	cacheSize := neutrinoMode.MaxFilterCacheSize
+	switch {
+	case cacheSize == 0:
+		return nil
+
+	case cacheSize < minNeutrinoFilterCacheSize:
+		return fmt.Errorf("neutrino.maxfiltercachesize must be at "+
+			"least %d bytes, got %d", minNeutrinoFilterCacheSize,
+			cacheSize)
+	}
+
+	config.FilterCacheSize = cacheSize
+
+	return nil
+}
+
+// neutrinoDisableDNSSeed returns whether neutrino should skip its DNS seed
+// lookups, relying solely on the configured peers to discover others, along
+// with the peers of the persistent peer file given as addPeers. As neutrino
+// would be unable to find any peers otherwise, an error is returned if DNS
+// seeding is disabled without any peers configured.
+func neutrinoDisableDNSSeed(neutrinoMode *neutrinoConfig,
+	addPeers []string) (bool, error) {
+
+	if !neutrinoMode.DisableDNSSeed {
+		return false, nil
+	}
+
+	if len(addPeers) == 0 && len(neutrinoMode.ConnectPeers) == 0 {
+		return false, fmt.Errorf("neutrino.nodnsseed requires at " +
+			"least one peer to be configured through " +
+			"neutrino.addpeer, neutrino.connect or " +
+			"neutrino.persistentpeerfile")
+	}
+
+	return true, nil
+}
+
+// neutrinoUserAgent returns the user agent name and version neutrino should
+// advertise to its peers, overriding the given defaults of the library with
+// the configured ones. As neutrino has no notion of user agent comments, the
+// configured ones are appended to the version, which results in the same user
+// agent per BIP 14, e.g. /btcwire:0.5.0/name:version(comment1; comment2)/. An
+// error is returned if any part contains characters reserved by BIP 14, or if
+// the user agent exceeds the maximum length peers accept.
+func neutrinoUserAgent(neutrinoMode *neutrinoConfig, defaultName,
+	defaultVersion string) (string, string, error) {
+
+	name := defaultName
+	if neutrinoMode.UserAgentName != "" {
+		name = neutrinoMode.UserAgentName
+	}
+	version := defaultVersion
+	if neutrinoMode.UserAgentVersion != "" {
+		version = neutrinoMode.UserAgentVersion
+	}
+
+	if strings.ContainsAny(name, "/:()") {
+		return "", "", fmt.Errorf("neutrino.useragentname must not "+
+			"contain any of the characters /:(), got %q", name)
+	}
+	if strings.ContainsAny(version, "/:()") {
+		return "", "", fmt.Errorf("neutrino.useragentversion must "+
+			"not contain any of the characters /:(), got %q",
+			version)
+	}
+	for _, comment := range neutrinoMode.UserAgentComments {
+		if strings.ContainsAny(comment, "/();") {
+			return "", "", fmt.Errorf("neutrino.useragentcomment "+
+				"must not contain any of the characters /();, "+
+				"got %q", comment)
+		}
+	}
+
+	if len(neutrinoMode.UserAgentComments) > 0 {
+		version = fmt.Sprintf("%s(%s)", version, strings.Join(
+			neutrinoMode.UserAgentComments, "; ",
+		))
+	}
+
+	userAgent := fmt.Sprintf("%s%s:%s/", wire.DefaultUserAgent, name,
+		version)
+	if len(userAgent) > wire.MaxUserAgentLen {
+		return "", "", fmt.Errorf("neutrino's user agent %v exceeds "+
+			"the maximum length of %d", userAgent,
+			wire.MaxUserAgentLen)
+	}
+
+	return name, version, nil
+}
+
+// neutrinoProxyDialer returns the dialer and name resolver neutrino should use
+// to reach its peers exclusively through the given SOCKS5 proxy, independent
+// of cfg.net. As SOCKS5 lacks a way to resolve hosts on its own, they're
+// resolved through the proxy using Tor's extension for this purpose, so only
+// IP addresses can be reached if the proxy isn't Tor.
+func neutrinoProxyDialer(socksProxy string) (func(net.Addr) (net.Conn, error),
+	func(string) ([]net.IP, error), error) {
+
+	proxyAddr, auth, err := parseSocksProxy(socksProxy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	socksDialer, err := proxy.SOCKS5("tcp", proxyAddr, auth, proxy.Direct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ltndLog.Infof("Connecting to neutrino peers through SOCKS proxy %v",
+		proxyAddr)
+
+	dialer := func(addr net.Addr) (net.Conn, error) {
+		return socksDialer.Dial("tcp", addr.String())
+	}
+	nameResolver := neutrinoNameResolver(func(host string) ([]string,
+		error) {
+
+		return tor.LookupHost(host, proxyAddr)
+	})
+
+	return dialer, nameResolver, nil
+}
+
+// neutrinoProfileRE matches the names of neutrino profiles, which are used as
+// a component of the path of neutrino's data directory.
+var neutrinoProfileRE = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// neutrinoDataDir returns the directory neutrino stores its headers and, unless
+// overridden, its database in, which is specific to the given network. If a
+// profile is set, a separate directory is used for it, so that several lnd
+// instances sharing the chain's data directory don't clobber each other's
+// headers and database.
+func neutrinoDataDir(chainDir, network, profile string) (string, error) {
+	dataDir := filepath.Join(chainDir, network)
+	if profile == "" {
+		return dataDir, nil
+	}
+
+	if !neutrinoProfileRE.MatchString(profile) {
+		return "", fmt.Errorf("invalid neutrino profile %q, only "+
+			"letters, digits, - and _ are allowed", profile)
+	}
+
+	return filepath.Join(dataDir, "neutrino-"+profile), nil
+}
+
+// checkNeutrinoDirWritable ensures that neutrino is able to write to the given
+// directory by creating and removing a temporary file within it. If it fails,
+// an error naming the directory and its permissions is returned.
+func checkNeutrinoDirWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".write-check-")
+	if err != nil {
+		perms := "unknown"
+		if info, statErr := os.Stat(dir); statErr == nil {
+			perms = info.Mode().Perm().String()
+		}
+
+		return fmt.Errorf("neutrino data directory %v isn't "+
+			"writable (permissions %v), make sure it's owned by "+
+			"and writable for the user lnd runs as: %v", dir,
+			perms, err)
+	}
+
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return err
+	}
+
+	return os.Remove(name)
+}
+
+// neutrinoDatabase returns the path and the walletdb driver of the database
+// neutrino should use, falling back to a database within the given data
+// directory and the default driver if they weren't overridden. The directory
+// of the database is created if it doesn't exist yet.
+func neutrinoDatabase(neutrinoMode *neutrinoConfig, dataDir string) (string,
+	string, error) {
+
+	dbBackend := defaultNeutrinoDBBackend
+	if neutrinoMode.DatabaseBackend != "" {
+		dbBackend = neutrinoMode.DatabaseBackend
+
+		drivers := walletdb.SupportedDrivers()
+		supported := false
+		for _, driver := range drivers {
+			if driver == dbBackend {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return "", "", fmt.Errorf("unknown neutrino database "+
+				"backend %q, supported backends: %v", dbBackend,
+				strings.Join(drivers, ", "))
+		}
+	}
+
+	dbPath := filepath.Join(dataDir, defaultNeutrinoDBName)
+	if neutrinoMode.DatabasePath != "" {
+		dbPath = neutrinoMode.DatabasePath
+		if !filepath.IsAbs(dbPath) {
+			return "", "", fmt.Errorf("neutrino database path %v "+
+				"must be absolute", dbPath)
+		}
+
+		err := os.MkdirAll(filepath.Dir(dbPath), 0700)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to create neutrino "+
+				"database directory: %v", err)
+		}
+	}
+
+	return dbPath, dbBackend, nil
+}
+
+var (
+	// neutrinoMetaBucket is the top-level bucket within neutrino's
+	// database in which lnd stores its metadata about the database.
+	neutrinoMetaBucket = []byte("lnd-neutrino-meta")
+
+	// neutrinoNetworkKey is the key within the neutrinoMetaBucket which
+	// stores the name of the network the database was created for.
+	neutrinoNetworkKey = []byte("network")
+)
+
+// checkNeutrinoDBNetwork ensures that the neutrino database at the given path
+// was created for the given network, as neutrino would otherwise continue from
+// the sync state of another network. The network is recorded within the
+// database when it's first opened by lnd, including databases created before
+// the network was recorded.
+func checkNeutrinoDBNetwork(db walletdb.DB, dbPath, network string) error {
+	return walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		meta, err := tx.CreateTopLevelBucket(neutrinoMetaBucket)
+		if err != nil {
+			return err
+		}
+
+		dbNetwork := meta.Get(neutrinoNetworkKey)
+		switch {
+		case dbNetwork == nil:
+			return meta.Put(neutrinoNetworkKey, []byte(network))
+
+		case string(dbNetwork) != network:
+			return fmt.Errorf("neutrino database %v was created "+
+				"for %v, but lnd is running on %v. Point "+
+				"neutrino.dbpath to a database for %v, or "+
+				"remove it to sync from scratch", dbPath,
+				string(dbNetwork), network, network)
+		}
+
+		return nil
+	})
+}
+
+// readNeutrinoPeerFile reads the newline-separated host:port entries of the
+// given peer file, and appends them to the passed peers, skipping blank lines,
+// comments and duplicates.
+func readNeutrinoPeerFile(peerFile string, peers []string) ([]string, error) {
+	contents, err := ioutil.ReadFile(peerFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read neutrino persistent "+
+			"peer file: %v", err)
+	}
+
+	known := make(map[string]struct{}, len(peers))
+	allPeers := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if _, ok := known[peer]; ok {
+			continue
+		}
+		known[peer] = struct{}{}
+		allPeers = append(allPeers, peer)
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		peer := strings.TrimSpace(line)
+		if peer == "" || strings.HasPrefix(peer, "#") {
+			continue
+		}
+
+		if _, ok := known[peer]; ok {
+			continue
+		}
+		known[peer] = struct{}{}
+		allPeers = append(allPeers, peer)
+	}
+
+	return allPeers, nil
+}
+
+// backendConnParams holds the resolved parameters of the connection to a btcd
+// or bitcoind backend, in order to log them.
+type backendConnParams struct {
+	// node is the name of the backend's node, e.g. bitcoind.
+	node string
+
+	// rpcHost is the host:port of the backend's RPC server.
+	rpcHost string
+
+	// endpoint is the path of btcd's websocket endpoint.
+	endpoint string
+
+	// zmqPubRawBlock and zmqPubRawTx are the addresses of bitcoind's ZMQ
+	// publishers.
+	zmqPubRawBlock string
+	zmqPubRawTx    string
+
+	// tls signals whether the RPC connection is secured using TLS.
+	tls bool
+
+	// user and pass are the RPC credentials.
+	user string
+	pass string
+}
+
+// String returns a single line summary of the connection parameters, with the
+// password redacted, such that it's safe to log.
+func (p *backendConnParams) String() string {
+	host, port, err := net.SplitHostPort(p.rpcHost)
+	if err != nil {
+		host, port = p.rpcHost, ""
+	}
+
+	params := []string{"host=" + host}
+	if port != "" {
+		params = append(params, "port="+port)
+	}
+	if p.endpoint != "" {
+		params = append(params, "endpoint="+p.endpoint)
+	}
+	if p.zmqPubRawBlock != "" {
+		params = append(params, "zmqpubrawblock="+p.zmqPubRawBlock)
+	}
+	if p.zmqPubRawTx != "" {
+		params = append(params, "zmqpubrawtx="+p.zmqPubRawTx)
+	}
+	params = append(params, fmt.Sprintf("tls=%v", p.tls))
+
+	// bitcoind's auth cookie always holds the same username, so we can
+	// tell whether its credentials were read from the cookie.
+	auth := "password"
+	if p.user == bitcoindCookieUser {
+		auth = "cookie"
+	}
+	params = append(params, "auth="+auth, "user="+p.user)
+	if p.pass != "" {
+		params = append(params, "pass="+redactedSecret)
+	}
+
+	return fmt.Sprintf("%v: %v", p.node, strings.Join(params, " "))
+}
+
+// backendDialer returns the function the hosts of the btcd and bitcoind
+// backends are dialed with. Only onion hosts are dialed through the passed
+// dial function of cfg.net, which routes them through Tor if it's active, as
+// Tor refuses to connect to the loopback and private addresses local backends
+// commonly listen on. Other hosts are dialed directly.
+func backendDialer(
+	netDial func(string, string) (net.Conn, error)) func(string,
+	string) (net.Conn, error) {
+
+	return func(network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err == nil && tor.IsOnionHost(host) {
+			return netDial(network, addr)
+		}
+
+		return net.Dial(network, addr)
+	}
+}
+
+// checkRPCHost ensures that the given RPC host, or ZMQ endpoint, can be used
+// as a chain backend. Onion hosts can only be reached through Tor, so they're
+// rejected unless it's active.
+func checkRPCHost(host string, torActive bool) error {
+	rpcHost := strings.TrimPrefix(host, zmqTCPPrefix)
+	if hostname, _, err := net.SplitHostPort(rpcHost); err == nil {
+		rpcHost = hostname
+	}
+
+	if tor.IsOnionHost(rpcHost) && !torActive {
+		return newChainBackendError(
+			ErrInvalidChainConfig, fmt.Errorf("onion host %v can "+
+				"only be reached through Tor, which requires "+
+				"tor.active", host),
+		)
+	}
+
+	return nil
+}
+
+// bitcoindRPCAddress returns the address of bitcoind's RPC server set
+// through rpchost. If it already has a port specified, either explicitly or
+// derived from bitcoin.conf, then we use it directly. Otherwise, we assume the
+// default port according to the selected chain parameters. On regtest, where
+// the default port depends on bitcoind's version, the derived port is probed
+// through the passed dial function within the given timeout, and bitcoind's
+// current regtest port is used if it's unreachable. A nil dial function skips
+// the probe, using the derived port.
+func bitcoindRPCAddress(ctx context.Context, rpcHost string, regTest bool,
+	dial func(string, string) (net.Conn, error),
+	probeTimeout time.Duration) (string, error) {
+
+	if rpcHostHasPort(rpcHost) {
+		return rpcHost, nil
+	}
+
+	// The RPC ports specified in chainparams.go assume btcd, which picks a
+	// different port so that btcwallet can use the same RPC port as
+	// bitcoind. We convert this back to the btcwallet/bitcoind port.
+	rpcPort, err := strconv.Atoi(activeNetParams.rpcPort)
+	if err != nil {
+		return "", err
+	}
+	rpcPort -= 2
+	bitcoindHost := joinRPCHostPort(rpcHost, strconv.Itoa(rpcPort))
+	if regTest && dial != nil {
+		err := dialHost(
+			ctx, dial, "RPC host", bitcoindHost, probeTimeout,
+		)
+		if err != nil {
+			ltndLog.Debugf("Regtest RPC port probe failed, using "+
+				"port %d: %v", regTestRPCPort, err)
+
+			bitcoindHost = joinRPCHostPort(
+				rpcHost, strconv.Itoa(regTestRPCPort),
+			)
+		}
+	}
+
+	return bitcoindHost, nil
+}
+
+// bitcoindConnFunc creates a connection to bitcoind's RPC server along with
+// its ZMQ endpoints, such as chain.NewBitcoindConn. Each read from the ZMQ
+// endpoints is bounded by the passed deadline.
+type bitcoindConnFunc func(chainParams *chaincfg.Params, host, user, pass,
+	zmqBlockHost, zmqTxHost string,
+	zmqReadDeadline time.Duration) (*chain.BitcoindConn, error)
+
+// newBitcoindConn creates the connection to the passed bitcoind node through
+// the given function, which the chain notifier, the chain view and the wallet
+// receive their notifications from. The ZMQ endpoints are read with the
+// deadline set through zmqreaddeadline, or the default one if it isn't set.
+//
+// NOTE: There's no option for the high-water mark of the ZMQ subscriptions,
+// as gozmq reads each notification directly from the TCP connection, without
+// queueing them on our side. The only queue that may overflow is bitcoind's,
+// whose high-water mark is set through its zmqpubrawblockhwm and
+// zmqpubrawtxhwm options.
+func newBitcoindConn(newConn bitcoindConnFunc, chainParams *chaincfg.Params,
+	backend bitcoindBackend,
+	bitcoindMode *bitcoindConfig) (*chain.BitcoindConn, error) {
+
+	zmqReadDeadline := bitcoindMode.ZMQReadDeadline
+	if zmqReadDeadline == 0 {
+		zmqReadDeadline = defaultZMQReadDeadline
+	}
+
+	return newConn(
+		chainParams, backend.rpcHost, bitcoindMode.RPCUser,
+		bitcoindMode.RPCPass, backend.zmqPubRawBlock,
+		backend.zmqPubRawTx, zmqReadDeadline,
+	)
+}
+
+// bitcoindWalletBackend returns the bitcoind node serving the wallet of the
+// passed backend, along with whether it's a dedicated node. The wallet's node
+// shares the ZMQ addresses of the backend, over which it learns of new blocks
+// and transactions. If it isn't a dedicated node, the wallet shares the
+// connection of the chain notifier and chain view instead.
+func bitcoindWalletBackend(backend bitcoindBackend) (bitcoindBackend, bool) {
+	if backend.walletRPCHost == "" ||
+		backend.walletRPCHost == backend.rpcHost {
+
+		return backend, false
+	}
+
+	walletBackend := backend
+	walletBackend.rpcHost = backend.walletRPCHost
+	return walletBackend, true
+}
+
+// rpcHostHasPort returns whether the given RPC host includes a port. Unlike
+// checking for a colon, this correctly treats IPv6 addresses without a port,
+// such as ::1 and [::1], as lacking one.
+func rpcHostHasPort(rpcHost string) bool {
+	_, _, err := net.SplitHostPort(rpcHost)
+	return err == nil
+}
+
+// joinRPCHostPort combines the given RPC host, which may be a bracketed or
+// bare IPv6 address, with the given port. IPv6 addresses are bracketed within
+// the resulting address.
+func joinRPCHostPort(rpcHost, port string) string {
+	return net.JoinHostPort(strings.Trim(rpcHost, "[]"), port)
+}
+
+// validateChainConfig validates the configuration of the active chain's
+// backend, without connecting to it or opening the wallet. Besides parsing
+// the RPC parameters, the btcd RPC certificate is loaded and the addresses of
+// the backend's RPC servers are constructed. All problems found are returned
+// as a single error.
+func validateChainConfig(cfg *config) error {
+	homeChainConfig, chain := cfg.Bitcoin, bitcoinChain
+	btcdMode, bitcoindMode := cfg.BtcdMode, cfg.BitcoindMode
+	if cfg.Litecoin.Active {
+		homeChainConfig, chain = cfg.Litecoin, litecoinChain
+		btcdMode, bitcoindMode = cfg.LtcdMode, cfg.LitecoindMode
+	}
+
+	// As some of the checks overlap, we'll only report each distinct
+	// problem once.
+	var errs []string
+	addErr := func(err error) {
+		if err == nil {
+			return
+		}
+		for _, e := range errs {
+			if e == err.Error() {
+				return
+			}
+		}
+		errs = append(errs, err.Error())
+	}
+
+	switch homeChainConfig.Node {
+	case "btcd", "ltcd":
+		addErr(parseRPCParams(
+			homeChainConfig, btcdMode, chain, "validateChainConfig",
+		))
+
+		rpcCert, err := loadBtcdRPCCert(btcdMode)
+		if err != nil {
+			addErr(fmt.Errorf("unable to load RPC certificate: %v",
+				err))
+		} else {
+			addErr(checkRPCCertValidity(
+				homeChainConfig.Node, rpcCert, time.Now(),
+			))
+		}
+
+		btcdHost := btcdRPCAddress(btcdMode.RPCHost)
+		addErr(checkRPCHost(btcdHost, cfg.Tor.Active))
+		addErr(checkBtcdNoTLS(btcdMode, btcdHost))
+
+		_, err = btcdWSEndpoint(btcdMode.RPCWSEndpoint)
+		addErr(err)
+
+	case "bitcoind", "litecoind":
+		addErr(parseRPCParams(
+			homeChainConfig, bitcoindMode, chain,
+			"validateChainConfig",
+		))
+
+		backends, err := bitcoindBackends(
+			homeChainConfig.Node, bitcoindMode,
+		)
+		addErr(err)
+
+		// We won't probe for bitcoind's alternative regtest port, as
+		// that requires connecting to it.
+		for _, backend := range backends {
+			hosts := []string{backend.rpcHost}
+			if _, ok := bitcoindWalletBackend(backend); ok {
+				hosts = append(hosts, backend.walletRPCHost)
+			}
+			for _, host := range hosts {
+				rpcHost, err := bitcoindRPCAddress(
+					context.Background(), host, false,
+					nil, 0,
+				)
+				if err != nil {
+					addErr(err)
+					continue
+				}
+				addErr(checkRPCHost(rpcHost, cfg.Tor.Active))
+			}
+
+			zmqAddrs := []string{
+				backend.zmqPubRawBlock, backend.zmqPubRawTx,
+			}
+			for _, zmqAddr := range zmqAddrs {
+				addErr(checkRPCHost(zmqAddr, cfg.Tor.Active))
+			}
+		}
+
+		_, err = bitcoindTLSConfig(bitcoindMode)
+		addErr(err)
+
+		addErr(checkZMQSelfTestGenerate(
+			bitcoindMode, homeChainConfig, chain,
+		))
+
+	case "neutrino":
+		// The peers of the persistent peer file count towards the ones
+		// neutrino relies on without DNS seeding.
+		addPeers := cfg.NeutrinoMode.AddPeers
+		if cfg.NeutrinoMode.PersistentPeerFile != "" {
+			peers, err := readNeutrinoPeerFile(
+				cfg.NeutrinoMode.PersistentPeerFile, addPeers,
+			)
+			if err != nil {
+				addErr(err)
+			} else {
+				addPeers = peers
+			}
+		}
+		_, err := neutrinoDisableDNSSeed(cfg.NeutrinoMode, addPeers)
+		addErr(err)
+
+		_, err = neutrinoDataDir(
+			homeChainConfig.ChainDir, "", cfg.NeutrinoMode.Profile,
+		)
+		addErr(err)
+
+		if cfg.NeutrinoMode.SocksProxy != "" {
+			socksProxy := cfg.NeutrinoMode.SocksProxy
+			_, _, err := parseSocksProxy(socksProxy)
+			addErr(err)
+		}
+
+		addErr(applyNeutrinoFilterCacheSize(
+			&neutrino.Config{}, cfg.NeutrinoMode,
+		))
+
+		_, _, err = neutrinoUserAgent(
+			cfg.NeutrinoMode, neutrino.UserAgentName,
+			neutrino.UserAgentVersion,
+		)
+		addErr(err)
+
+	default:
+		addErr(fmt.Errorf("unknown node type: %s",
+			homeChainConfig.Node))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid %v backend config: %v",
+			homeChainConfig.Node, strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// loadBtcdRPCCert returns the certificate chain of btcd's RPC server, which is
+// either set directly through rawrpccert, or read from the rpccert file. No
+// certificate is loaded if TLS is disabled.
+func loadBtcdRPCCert(btcdMode *btcdConfig) ([]byte, error) {
+	// The certificate can only be reloaded if it's read from a file.
+	if btcdMode.ReloadCert &&
+		(btcdMode.DisableTLS || btcdMode.RawRPCCert != "") {
+
+		return nil, errors.New("reloadcert requires the certificate " +
+			"to be read from rpccert, rather than rawrpccert or " +
+			"notls being set")
+	}
+
+	if btcdMode.DisableTLS {
+		return nil, nil
+	}
+
+	if btcdMode.RawRPCCert != "" {
+		return decodeRawRPCCert(btcdMode.RawRPCCert)
+	}
+
+	certFile, err := os.Open(btcdMode.RPCCert)
+	if err != nil {
+		return nil, err
+	}
+	rpcCert, err := ioutil.ReadAll(certFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := certFile.Close(); err != nil {
+		return nil, err
+	}
+
+	return rpcCert, nil
+}
+
+// checkBtcdNoTLS ensures that TLS is only disabled for connections to btcd's
+// RPC server at the given host if the host is a loopback address, as the RPC
+// credentials and traffic would be exposed in plaintext otherwise. This can
+// be overridden through allowremotenotls, in which case a warning is logged.
+func checkBtcdNoTLS(btcdMode *btcdConfig, btcdHost string) error {
+	if !btcdMode.DisableTLS || isLoopbackHost(btcdHost) {
+		return nil
+	}
+
+	if !btcdMode.AllowRemoteNoTLS {
+		return fmt.Errorf("notls is only allowed for loopback RPC "+
+			"hosts, but %v isn't one. Set allowremotenotls to "+
+			"connect to it without TLS anyway", btcdHost)
+	}
+
+	ltndLog.Warnf("Connecting to RPC host %v without TLS, RPC "+
+		"credentials and traffic are sent in plaintext", btcdHost)
+
+	return nil
+}
+
+// isLoopbackHost returns whether the given host, which may include a port, is
+// localhost or a loopback IP address.
+func isLoopbackHost(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.Trim(host, "[]")
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// decodeRawRPCCert decodes the PEM-encoded certificate chain set through
+// rawrpccert, which may be given as is, or hex or base64 encoded. An error is
+// returned unless it consists of one or more valid certificates.
+func decodeRawRPCCert(rawCert string) ([]byte, error) {
+	trimmed := strings.TrimSpace(rawCert)
+
+	var (
+		rpcCert []byte
+		err     error
+	)
+	switch {
+	case strings.HasPrefix(trimmed, "-----BEGIN"):
+		rpcCert = []byte(rawCert)
+
+	default:
+		// Hex encoding is attempted first, as it was the only
+		// supported encoding previously.
+		rpcCert, err = hex.DecodeString(trimmed)
+		if err != nil {
+			rpcCert, err = base64.StdEncoding.DecodeString(trimmed)
+		}
+		if err != nil {
+			return nil, errors.New("invalid rawrpccert: " +
+				"expected a PEM-encoded certificate chain, " +
+				"either as is or hex or base64 encoded")
+		}
+	}
+
+	// We'll make sure the chain is valid, as otherwise we'd only learn
+	// about it once the TLS handshake fails.
+	if err := checkRPCCertChain(rpcCert); err != nil {
+		return nil, fmt.Errorf("invalid rawrpccert: %v", err)
+	}
+
+	return rpcCert, nil
+}
+
+// checkRPCCertChain ensures that the passed PEM-encoded certificate chain of an
+// RPC server contains at least one certificate, and that each of its PEM
+// blocks is a valid certificate.
+func checkRPCCertChain(rpcCert []byte) error {
+	var numCerts int
+	for rest := rpcCert; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("unexpected PEM block of type %v",
+				block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("unable to parse certificate %d: %v",
+				numCerts+1, err)
+		}
+
+		numCerts++
+	}
+	if numCerts == 0 {
+		return errors.New("no PEM-encoded certificates found")
+	}
+
+	return nil
+}
+
+// checkRPCCertValidity ensures that each certificate within the passed
+// PEM-encoded certificate chain of the given node's RPC server is valid at the
+// given time, as an expired or not yet valid certificate would only result in
+// a confusing TLS handshake failure otherwise. Blocks that can't be parsed as
+// certificates are left for the TLS handshake to reject.
+func checkRPCCertValidity(node string, rpcCert []byte, now time.Time) error {
+	for rest := rpcCert; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case now.After(cert.NotAfter):
+			return fmt.Errorf("%v RPC cert expired on %v, renew "+
+				"it and restart lnd", node, cert.NotAfter.UTC())
+
+		case now.Before(cert.NotBefore):
+			return fmt.Errorf("%v RPC cert isn't valid until %v, "+
+				"check that the local clock is correct", node,
+				cert.NotBefore.UTC())
+		}
+	}
+}
+
+// btcdRPCAddress returns the address of btcd's RPC server set through rpchost.
+// If it already has a port specified, then we use it directly. Otherwise, we
+// assume the default port according to the selected chain parameters.
+func btcdRPCAddress(rpcHost string) string {
+	if rpcHostHasPort(rpcHost) {
+		return rpcHost
+	}
+
+	return joinRPCHostPort(rpcHost, activeNetParams.rpcPort)
+}
+
+// newBtcdRPCConfig returns the config of the websocket RPC clients connecting
+// to the btcd instance at the given host, which is authenticated through the
+// given certificate chain.
+func newBtcdRPCConfig(btcdMode *btcdConfig, btcdHost string,
+	rpcCert []byte) (*rpcclient.ConnConfig, error) {
+
+	endpoint, err := btcdWSEndpoint(btcdMode.RPCWSEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpcclient.ConnConfig{
+		Host:                 btcdHost,
+		Endpoint:             endpoint,
+		User:                 btcdMode.RPCUser,
+		Pass:                 btcdMode.RPCPass,
+		Certificates:         rpcCert,
+		DisableTLS:           btcdMode.DisableTLS,
+		DisableConnectOnNew:  true,
+		DisableAutoReconnect: false,
+	}, nil
+}
+
+// btcdWSEndpoint validates the path of btcd's websocket endpoint set through
+// rpcwsendpoint, returning it without its surrounding slashes. If it isn't set,
+// the default ws endpoint is returned.
+func btcdWSEndpoint(endpoint string) (string, error) {
+	if endpoint == "" {
+		return defaultBtcdWSEndpoint, nil
+	}
+
+	trimmed := strings.Trim(endpoint, "/")
+	endpointURL, err := url.Parse(trimmed)
+	if err != nil || trimmed == "" || endpointURL.Path != trimmed {
+		return "", fmt.Errorf("invalid rpcwsendpoint %q: "+
+			"expected a non-empty path", endpoint)
+	}
+
+	// The wallet's client always connects to an endpoint named ws, so
+	// only the path leading to it can be customized.
+	if path.Base(trimmed) != defaultBtcdWSEndpoint {
+		return "", fmt.Errorf("invalid rpcwsendpoint %q: last "+
+			"element of the path must be %v", endpoint,
+			defaultBtcdWSEndpoint)
+	}
+
+	return trimmed, nil
+}
+
+// btcdWalletHost returns the host to pass to the wallet's btcd client, such
+// that it connects to the given websocket endpoint. As the client always
+// appends the default ws endpoint to the host, the path leading to a custom
+// endpoint is appended to the host instead.
+func btcdWalletHost(btcdHost, endpoint string) string {
+	prefix := path.Dir(endpoint)
+	if prefix == "." {
+		return btcdHost
+	}
+
+	return btcdHost + "/" + prefix
+}
+
+// dialRPCHost attempts to establish a TCP connection to the given RPC host
+// using the passed dial function within the passed timeout, in order to detect
+// an unreachable host early on. A zero timeout disables the check, as the
+// connection would otherwise be allowed to block indefinitely.
+func dialRPCHost(ctx context.Context, dial func(string, string) (net.Conn,
+	error), host string, timeout time.Duration) error {
+
+	return dialHost(ctx, dial, "RPC host", host, timeout)
+}
+
+// dialHost attempts to establish a TCP connection to the given host using the
+// passed dial function within the passed timeout, giving up early if the
+// context is canceled. The description of the host is included in the
+// returned error. A zero timeout disables the check.
+func dialHost(ctx context.Context, dial func(string, string) (net.Conn, error),
+	hostDesc, host string, timeout time.Duration) error {
+
+	if timeout == 0 {
+		return nil
+	}
+
+	// As the dial function may not support timeouts, e.g. when dialing
+	// through Tor, we'll dial within a goroutine and give up once the
+	// timeout fires.
+	resultChan := make(chan dialResult, 1)
+	go func() {
+		conn, err := dial("tcp", host)
+		resultChan <- dialResult{conn: conn, err: err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			return newChainBackendError(
+				ErrBackendUnreachable, fmt.Errorf("unable to "+
+					"connect to %v %v: %v", hostDesc, host,
+					result.err),
+			)
+		}
+
+		return result.conn.Close()
+
+	case <-time.After(timeout):
+		closeLateConn(resultChan)
+
+		return newChainBackendError(
+			ErrBackendUnreachable, fmt.Errorf("unable to connect "+
+				"to %v %v within %v, check that the host is "+
+				"reachable and the port isn't firewalled",
+				hostDesc, host, timeout),
+		)
+
+	case <-ctx.Done():
+		closeLateConn(resultChan)
+
+		return fmt.Errorf("unable to connect to %v %v: %v", hostDesc,
+			host, ctx.Err())
+	}
+}
+
+// dialResult is the result of dialing a host within a goroutine.
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// closeLateConn makes sure a connection established after we gave up on
+// dialing it doesn't leak, by closing it once the dial completes.
+func closeLateConn(resultChan <-chan dialResult) {
+	go func() {
+		result := <-resultChan
+		if result.conn != nil {
+			result.conn.Close()
+		}
+	}()
+}
+
+// preflightEndpoints attempts to connect to the RPC host and both ZMQ
+// endpoints of bitcoind within the passed timeout, in order to detect a
+// misconfigured or firewalled endpoint before it surfaces as a cryptic error
+// further down the line. An error listing each of the unreachable endpoints is
+// returned. Only TCP endpoints are checked, as there's nothing to dial for IPC
+// endpoints.
+func preflightEndpoints(ctx context.Context,
+	dial func(string, string) (net.Conn, error),
+	rpcHost, zmqPubRawBlock, zmqPubRawTx string,
+	timeout time.Duration) error {
+
+	var unreachable []string
+	err := dialHost(ctx, dial, "RPC host", rpcHost, timeout)
+	if err != nil {
+		unreachable = append(unreachable, err.Error())
+	}
+
+	zmqEndpoints := []struct {
+		option string
+		addr   string
+	}{
+		{"zmqpubrawblock", zmqPubRawBlock},
+		{"zmqpubrawtx", zmqPubRawTx},
+	}
+	for _, endpoint := range zmqEndpoints {
+		if !strings.HasPrefix(endpoint.addr, "tcp://") {
+			continue
+		}
+
+		err := dialHost(
+			ctx, dial, endpoint.option+" endpoint",
+			strings.TrimPrefix(endpoint.addr, "tcp://"), timeout,
+		)
+		if err != nil {
+			unreachable = append(unreachable, err.Error())
+		}
+	}
+
+	if len(unreachable) > 0 {
+		return newChainBackendError(
+			ErrBackendUnreachable, fmt.Errorf("pre-flight check "+
+				"failed: %v", strings.Join(unreachable, "; ")),
+		)
+	}
+
+	return nil
+}
+
+// connectWithRetry executes the passed function, which is expected to
+// establish the initial connection to the chain backend. If it fails, it's
+// retried up to retryAttempts times, backing off exponentially starting at the
+// given delay. The error of the last attempt is returned once all retries are
+// exhausted, or as soon as the context is canceled while backing off.
+func connectWithRetry(ctx context.Context, retryAttempts uint32,
+	retryDelay time.Duration, connect func() error) error {
+
+	if retryDelay == 0 {
+		retryDelay = defaultConnectRetryDelay
+	}
+
+	for attempt := uint32(0); ; attempt++ {
+		err := connect()
+		if err == nil || attempt == retryAttempts {
+			return err
+		}
+
+		ltndLog.Warnf("Unable to connect to chain backend (attempt %d "+
+			"of %d), retrying in %v: %v", attempt+1,
+			retryAttempts+1, retryDelay, err)
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return fmt.Errorf("unable to connect to chain "+
+				"backend: %v, last error: %v", ctx.Err(), err)
+		}
+
+		retryDelay *= 2
+		if retryDelay > maxConnectRetryDelay {
+			retryDelay = maxConnectRetryDelay
+		}
+	}
+}
+
+// runWithContext executes the passed function, which is expected to start a
+// subsystem, and returns its error. If the context is canceled first, the
+// context's error is returned right away instead. As the function can't be
+// interrupted, the passed abort function is executed once it completes after
+// all, in order to release whatever it started.
+func runWithContext(ctx context.Context, run func() error, abort func()) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- run()
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+
+	case <-ctx.Done():
+		go func() {
+			if err := <-errChan; err == nil && abort != nil {
+				abort()
+			}
+		}()
+
+		return ctx.Err()
+	}
+}
+
+// startWithTimeout starts a subsystem connected to the given RPC host through
+// runWithContext, giving up once the context is canceled or the timeout
+// expires, in which case the error names the host and the timeout. A zero
+// timeout leaves the start up unbounded. A subsystem whose start up only
+// completes after we gave up on it is stopped through the passed function.
+func startWithTimeout(ctx context.Context, start func() error, stop func(),
+	host string, timeout time.Duration) error {
+
+	startCtx := ctx
+	if timeout != 0 {
+		var cancel func()
+		startCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := runWithContext(startCtx, start, stop)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return connectTimeoutError(host, timeout)
+	}
+
+	return err
+}
+
+// startFeeEstimator starts the passed fee estimator, which obtains its
+// estimates from the given host, giving up once the context is canceled or the
+// timeout expires. A zero timeout leaves the start up unbounded. Once started,
+// the estimator is registered with the passed partial clean up, so it's stopped
+// again if a later step of the chain control's setup fails. An estimator whose
+// start up only completes after we gave up on it is stopped right away.
+func startFeeEstimator(ctx context.Context, estimator lnwallet.FeeEstimator,
+	host string, timeout time.Duration, started *partialCleanUp) error {
+
+	stop := stopFunc(estimator.Stop)
+	err := startWithTimeout(ctx, estimator.Start, stop, host, timeout)
+	if err != nil {
+		return err
+	}
+
+	started.add(stop)
+
+	return nil
+}
+
+// staticFeeFallback handles the failure of a live fee estimator to start, e.g.
+// because the backend is too old to provide estimates. If falling back to
+// static estimates was enabled through feeestimatorfallbacktostatic, a warning
+// is logged and a static estimator using the passed fee rate is returned in
+// its place. Otherwise, as well as if the start up was abandoned because the
+// context was canceled, the passed error is returned.
+func staticFeeFallback(ctx context.Context, chainCfg *chainConfig,
+	startErr error, feePerKW lnwallet.SatPerKWeight) (lnwallet.FeeEstimator,
+	error) {
+
+	if !chainCfg.FeeEstimatorFallbackToStatic || ctx.Err() != nil {
+		return nil, startErr
+	}
+
+	ltndLog.Warnf("Unable to start %v backed fee estimator, falling "+
+		"back to static fee rate of %v sat/kw: %v", chainCfg.Node,
+		int64(feePerKW), startErr)
+
+	return lnwallet.StaticFeeEstimator{FeePerKW: feePerKW}, nil
+}
+
+// refreshFeeEstimates wraps the passed live fee estimator, so its estimates
+// aren't queried from the backend for every single request. If feepollinterval
+// is set, the estimates are refreshed in the background at that interval, and
+// the polling estimator is started. Otherwise, they're cached for the
+// duration of feecachettl, if set. Either way, estimates older than
+// maxfeeestimateage, if set, aren't returned.
+func refreshFeeEstimates(ctx context.Context, estimator lnwallet.FeeEstimator,
+	chainCfg *chainConfig, host string,
+	started *partialCleanUp) (lnwallet.FeeEstimator, error) {
+
+	switch {
+	case chainCfg.FeePollInterval > 0:
+		pollingEstimator := lnwallet.NewPollingFeeEstimator(
+			estimator, chainCfg.FeePollInterval,
+			chainCfg.MaxFeeEstimateAge,
+		)
+		err := startFeeEstimator(
+			ctx, pollingEstimator, host, 0, started,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return pollingEstimator, nil
+
+	case chainCfg.FeeCacheTTL > 0:
+		// Cached estimates are refreshed once they expire, so they
+		// won't exceed their max age if it bounds their TTL.
+		ttl := chainCfg.FeeCacheTTL
+		maxAge := chainCfg.MaxFeeEstimateAge
+		if maxAge > 0 && maxAge < ttl {
+			ttl = maxAge
+		}
+
+		return lnwallet.NewCachedFeeEstimator(estimator, ttl), nil
+
+	default:
+		return estimator, nil
+	}
+}
+
+// refreshableFeeEstimator returns the passed fee estimator if its estimates
+// can be refreshed on demand, and nil otherwise.
+func refreshableFeeEstimator(
+	estimator lnwallet.FeeEstimator) lnwallet.RefreshableFeeEstimator {
+
+	refresher, ok := estimator.(lnwallet.RefreshableFeeEstimator)
+	if !ok {
+		return nil
+	}
+
+	return refresher
+}
+
+// waitForFeeEstimate waits for the passed live fee estimator to produce its
+// first live estimate for the given confirmation target, polling it at the
+// given interval, as it may only resort to its fallback fee rate right after
+// being started, e.g. while the backend is still gathering fee data. A zero
+// target selects defaultWarmupConfTarget. If no live estimate is produced
+// within the timeout, a warning is logged and we proceed with the fallback fee
+// rate. Estimators unable to report whether they fell back, as well as a zero
+// timeout, skip the wait.
+func waitForFeeEstimate(ctx context.Context, estimator lnwallet.FeeEstimator,
+	confTarget uint32, timeout, pollInterval time.Duration) error {
+
+	fallbackEstimator, ok := estimator.(lnwallet.FallbackFeeEstimator)
+	if !ok || timeout <= 0 {
+		return nil
+	}
+	if confTarget == 0 {
+		confTarget = defaultWarmupConfTarget
+	}
+
+	deadline := time.After(timeout)
+	for {
+		feeRate, fallback, err := fallbackEstimator.
+			EstimateFeePerKWFallback(confTarget)
+		if err == nil && !fallback {
+			ltndLog.Debugf("Fee estimator warmed up with %v "+
+				"sat/kw for conf target %v", int64(feeRate),
+				confTarget)
+			return nil
+		}
+
+		select {
+		case <-time.After(pollInterval):
+
+		case <-deadline:
+			ltndLog.Warnf("Fee estimator didn't produce a live "+
+				"estimate within %v, using the fallback fee "+
+				"rate until it does", timeout)
+			return nil
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// stopFunc adapts the passed stop function of a subsystem for use as a clean
+// up function, which has no way to report the error, so it's logged instead.
+func stopFunc(stop func() error) func() {
+	return func() {
+		if err := stop(); err != nil {
+			ltndLog.Errorf("unable to stop chain backend: %v", err)
+		}
+	}
+}
+
+// partialCleanUp collects the clean up functions of the subsystems started
+// while setting up the chain control, in order to release them in reverse
+// order if the setup fails midway, e.g. because it was canceled.
+type partialCleanUp struct {
+	cleanUps []func()
+	disarmed bool
+}
+
+// add registers the clean up function of a subsystem that was started.
+func (p *partialCleanUp) add(cleanUp func()) {
+	p.cleanUps = append(p.cleanUps, cleanUp)
+}
+
+// disarm prevents the registered clean up functions from being executed,
+// once the setup has completed successfully.
+func (p *partialCleanUp) disarm() {
+	p.disarmed = true
+}
+
+// run executes the registered clean up functions in reverse order, unless
+// the setup completed successfully.
+func (p *partialCleanUp) run() {
+	if p.disarmed {
+		return
+	}
+
+	for i := len(p.cleanUps) - 1; i >= 0; i-- {
+		p.cleanUps[i]()
+	}
+}
+
+// connectTimeoutError returns the error for a connection to the given RPC host
+// that couldn't be established within the passed timeout.
+func connectTimeoutError(host string, timeout time.Duration) error {
+	return newChainBackendError(
+		ErrBackendUnreachable, fmt.Errorf("unable to connect to RPC "+
+			"host %v within %v, check that the host is reachable "+
+			"and the port isn't firewalled", host, timeout),
+	)
 }
 
 var (
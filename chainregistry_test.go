@@ -0,0 +1,4099 @@
+// +build !rpctest
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcwallet/chain"
+	"github.com/btcsuite/btcwallet/waddrmgr"
+	"github.com/btcsuite/btcwallet/walletdb"
+	_ "github.com/btcsuite/btcwallet/walletdb/bdb"
+	"github.com/lightninglabs/neutrino"
+	"github.com/lightningnetwork/lnd/channeldb"
+	"github.com/lightningnetwork/lnd/htlcswitch"
+	"github.com/lightningnetwork/lnd/keychain"
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// TestStartWithTimeout ensures that the initial connection to an RPC host is
+// bounded by the configured timeout, using a listener that never accepts, and
+// that a connection only started after the timeout fired is stopped.
+func TestStartWithTimeout(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	defer listener.Close()
+	host := listener.Addr().String()
+
+	// The listener is reachable, so the initial dial should succeed.
+	err = dialRPCHost(context.Background(), net.Dial, host, time.Second)
+	if err != nil {
+		t.Fatalf("unable to dial listener: %v", err)
+	}
+
+	// As the listener never accepts our connection, waiting for a response
+	// will block until it's closed, so the timeout should fire.
+	const timeout = 100 * time.Millisecond
+	connect := func() error {
+		conn, err := net.Dial("tcp", host)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		var b [1]byte
+		_, err = conn.Read(b[:])
+		return err
+	}
+
+	start := time.Now()
+	err = startWithTimeout(
+		context.Background(), connect, nil, host, timeout,
+	)
+	if err == nil {
+		t.Fatalf("expected connection to time out")
+	}
+	if time.Since(start) > 10*timeout {
+		t.Fatalf("timeout took too long to fire")
+	}
+	if !strings.Contains(err.Error(), host) ||
+		!strings.Contains(err.Error(), timeout.String()) {
+
+		t.Fatalf("expected error to name host and timeout, got: %v",
+			err)
+	}
+
+	// A connection whose start up completes after the timeout fired, such
+	// as a BitcoindConn whose RPC client and ZMQ sockets are connected by
+	// then, should be stopped rather than leaked.
+	unblock := make(chan struct{})
+	stopped := make(chan struct{})
+	err = startWithTimeout(context.Background(), func() error {
+		<-unblock
+		return nil
+	}, func() {
+		close(stopped)
+	}, host, timeout)
+	if err == nil {
+		t.Fatalf("expected slow start up to time out")
+	}
+
+	close(unblock)
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("connection wasn't stopped after late start up")
+	}
+
+	// A start up that completes in time should have its result passed
+	// through, without the connection being stopped.
+	startErr := errors.New("connection refused")
+	err = startWithTimeout(context.Background(), func() error {
+		return startErr
+	}, func() {
+		t.Fatalf("connection stopped although it never started")
+	}, host, timeout)
+	if err != startErr {
+		t.Fatalf("expected start error, got: %v", err)
+	}
+	err = startWithTimeout(context.Background(), func() error {
+		return nil
+	}, nil, host, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestDialRPCHostCustomDialer ensures that the reachability of an RPC host is
+// checked using the passed dial function, as is the case when dialing through
+// Tor, and that dial functions without a timeout are bounded.
+func TestDialRPCHostCustomDialer(t *testing.T) {
+	t.Parallel()
+
+	const host = "rpchost:8332"
+
+	var dialedAddr string
+	dial := func(network, addr string) (net.Conn, error) {
+		dialedAddr = addr
+		local, remote := net.Pipe()
+		remote.Close()
+		return local, nil
+	}
+	err := dialRPCHost(context.Background(), dial, host, time.Second)
+	if err != nil {
+		t.Fatalf("unable to dial host: %v", err)
+	}
+	if dialedAddr != host {
+		t.Fatalf("expected custom dialer to dial %v, got %v", host,
+			dialedAddr)
+	}
+
+	// A dial function that never returns should be bounded by the
+	// timeout.
+	block := make(chan struct{})
+	defer close(block)
+	dial = func(network, addr string) (net.Conn, error) {
+		<-block
+		return nil, errors.New("dial aborted")
+	}
+	err = dialRPCHost(
+		context.Background(), dial, host, 100*time.Millisecond,
+	)
+	if err == nil {
+		t.Fatalf("expected dial to time out")
+	}
+	if !strings.Contains(err.Error(), host) {
+		t.Fatalf("expected error to name host, got: %v", err)
+	}
+}
+
+// TestDialRPCHostCanceled ensures that dialing an RPC host is abandoned as
+// soon as the context is canceled, even if the timeout hasn't fired yet.
+func TestDialRPCHostCanceled(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan struct{})
+	defer close(block)
+	dial := func(network, addr string) (net.Conn, error) {
+		<-block
+		return nil, errors.New("dial aborted")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := dialRPCHost(ctx, dial, "rpchost:8332", time.Minute)
+	if err == nil {
+		t.Fatalf("expected dial to be canceled")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatalf("dial wasn't abandoned once canceled")
+	}
+	if !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatalf("expected error to mention cancellation, got: %v",
+			err)
+	}
+}
+
+// TestPreflightEndpoints ensures that the pre-flight check succeeds if all of
+// bitcoind's endpoints accept connections, and lists each of the unreachable
+// endpoints otherwise.
+func TestPreflightEndpoints(t *testing.T) {
+	t.Parallel()
+
+	listen := func() net.Listener {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unable to listen: %v", err)
+		}
+		return l
+	}
+
+	rpcListener := listen()
+	defer rpcListener.Close()
+	zmqBlockListener := listen()
+	defer zmqBlockListener.Close()
+
+	// We'll obtain an address that refuses connections by closing a
+	// listener right away.
+	closedListener := listen()
+	refusedAddr := closedListener.Addr().String()
+	closedListener.Close()
+
+	rpcHost := rpcListener.Addr().String()
+	zmqBlock := "tcp://" + zmqBlockListener.Addr().String()
+
+	err := preflightEndpoints(
+		context.Background(), net.Dial, rpcHost, zmqBlock,
+		"ipc:///tmp/bitcoind.tx", time.Second,
+	)
+	if err != nil {
+		t.Fatalf("expected reachable endpoints to pass: %v", err)
+	}
+
+	err = preflightEndpoints(
+		context.Background(), net.Dial, refusedAddr, zmqBlock,
+		"tcp://"+refusedAddr, time.Second,
+	)
+	if err == nil {
+		t.Fatalf("expected unreachable endpoints to fail")
+	}
+	if !strings.Contains(err.Error(), "RPC host "+refusedAddr) ||
+		!strings.Contains(err.Error(), "zmqpubrawtx endpoint") {
+
+		t.Fatalf("expected error to list unreachable endpoints, "+
+			"got: %v", err)
+	}
+	if strings.Contains(err.Error(), "zmqpubrawblock") {
+		t.Fatalf("expected reachable endpoint not to be listed, "+
+			"got: %v", err)
+	}
+}
+
+// TestCheckRPCHost ensures that onion RPC hosts and ZMQ endpoints are only
+// accepted if Tor is active, as they can't be reached otherwise.
+func TestCheckRPCHost(t *testing.T) {
+	t.Parallel()
+
+	const onionV3Host = "vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7" +
+		"ngmcopnpyyd.onion:8332"
+
+	tests := []struct {
+		host      string
+		torActive bool
+		valid     bool
+	}{
+		{host: "localhost", valid: true},
+		{host: "127.0.0.1:8332", valid: true},
+		{host: "[::1]:8332", valid: true},
+		{host: "tcp://127.0.0.1:28332", valid: true},
+		{host: "ipc:///run/bitcoind/zmq.sock", valid: true},
+		{host: "127.0.0.1:8332", torActive: true, valid: true},
+		{host: "3g2upl4pq6kufc4m.onion:8332", valid: false},
+		{host: "3g2upl4pq6kufc4m.onion", valid: false},
+		{host: onionV3Host, valid: false},
+		{host: "tcp://3g2upl4pq6kufc4m.onion:28332", valid: false},
+		{
+			host:      "3g2upl4pq6kufc4m.onion:8332",
+			torActive: true,
+			valid:     true,
+		},
+		{host: onionV3Host, torActive: true, valid: true},
+		{
+			host:      "tcp://3g2upl4pq6kufc4m.onion:28332",
+			torActive: true,
+			valid:     true,
+		},
+	}
+
+	for _, test := range tests {
+		err := checkRPCHost(test.host, test.torActive)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("expected %v to be valid with tor active=%v, "+
+				"got: %v", test.host, test.torActive, err)
+		case !test.valid && err == nil:
+			t.Fatalf("expected %v to be rejected with tor "+
+				"active=%v", test.host, test.torActive)
+		}
+	}
+}
+
+// TestRPCAddressDefaultPort ensures that the default port is appended to the
+// RPC hosts of btcd and bitcoind only if they don't include one, taking IPv6
+// addresses with and without brackets into account.
+func TestRPCAddressDefaultPort(t *testing.T) {
+	defer func(params bitcoinNetParams) {
+		activeNetParams = params
+	}(activeNetParams)
+	activeNetParams = bitcoinTestNetParams
+
+	tests := []struct {
+		rpcHost      string
+		btcdHost     string
+		bitcoindHost string
+	}{
+		{
+			rpcHost:      "127.0.0.1",
+			btcdHost:     "127.0.0.1:18334",
+			bitcoindHost: "127.0.0.1:18332",
+		},
+		{
+			rpcHost:      "127.0.0.1:8332",
+			btcdHost:     "127.0.0.1:8332",
+			bitcoindHost: "127.0.0.1:8332",
+		},
+		{
+			rpcHost:      "[::1]",
+			btcdHost:     "[::1]:18334",
+			bitcoindHost: "[::1]:18332",
+		},
+		{
+			rpcHost:      "[::1]:8332",
+			btcdHost:     "[::1]:8332",
+			bitcoindHost: "[::1]:8332",
+		},
+		{
+			rpcHost:      "::1",
+			btcdHost:     "[::1]:18334",
+			bitcoindHost: "[::1]:18332",
+		},
+	}
+
+	for _, test := range tests {
+		btcdHost := btcdRPCAddress(test.rpcHost)
+		if btcdHost != test.btcdHost {
+			t.Fatalf("expected btcd host %v for %v, got %v",
+				test.btcdHost, test.rpcHost, btcdHost)
+		}
+
+		bitcoindHost, err := bitcoindRPCAddress(
+			context.Background(), test.rpcHost, false, nil, 0,
+		)
+		if err != nil {
+			t.Fatalf("unable to get bitcoind host for %v: %v",
+				test.rpcHost, err)
+		}
+		if bitcoindHost != test.bitcoindHost {
+			t.Fatalf("expected bitcoind host %v for %v, got %v",
+				test.bitcoindHost, test.rpcHost, bitcoindHost)
+		}
+	}
+}
+
+// TestBitcoindRPCAddressRegtestProbe ensures that bitcoind's RPC port is only
+// probed on regtest if enabled, falling back to bitcoind's current regtest port
+// if the derived one is unreachable, and that a filtered port doesn't stall the
+// probe beyond its timeout.
+func TestBitcoindRPCAddressRegtestProbe(t *testing.T) {
+	defer func(params bitcoinNetParams) {
+		activeNetParams = params
+	}(activeNetParams)
+	activeNetParams = regTestNetParams
+
+	const probeTimeout = 50 * time.Millisecond
+
+	// A filtered port never responds, so the dial blocks until the test
+	// completes.
+	filtered := make(chan struct{})
+	defer close(filtered)
+
+	tests := []struct {
+		name         string
+		regTest      bool
+		dial         func(string, string) (net.Conn, error)
+		bitcoindHost string
+	}{
+		{
+			name:         "probe disabled",
+			regTest:      true,
+			bitcoindHost: "127.0.0.1:18332",
+		},
+		{
+			name:    "not regtest",
+			regTest: false,
+			dial: func(string, string) (net.Conn, error) {
+				return nil, errors.New("unexpected probe")
+			},
+			bitcoindHost: "127.0.0.1:18332",
+		},
+		{
+			name:    "probe success",
+			regTest: true,
+			dial: func(network, addr string) (net.Conn, error) {
+				if addr != "127.0.0.1:18332" {
+					return nil, fmt.Errorf("unexpected "+
+						"address %v", addr)
+				}
+
+				conn, _ := net.Pipe()
+				return conn, nil
+			},
+			bitcoindHost: "127.0.0.1:18332",
+		},
+		{
+			name:    "probe refused",
+			regTest: true,
+			dial: func(string, string) (net.Conn, error) {
+				return nil, errors.New("connection refused")
+			},
+			bitcoindHost: "127.0.0.1:18443",
+		},
+		{
+			name:    "probe timeout",
+			regTest: true,
+			dial: func(string, string) (net.Conn, error) {
+				<-filtered
+				return nil, errors.New("connection timed out")
+			},
+			bitcoindHost: "127.0.0.1:18443",
+		},
+	}
+
+	for _, test := range tests {
+		start := time.Now()
+		bitcoindHost, err := bitcoindRPCAddress(
+			context.Background(), "127.0.0.1", test.regTest,
+			test.dial, probeTimeout,
+		)
+		if err != nil {
+			t.Fatalf("%s: unable to get bitcoind host: %v",
+				test.name, err)
+		}
+		if bitcoindHost != test.bitcoindHost {
+			t.Fatalf("%s: expected bitcoind host %v, got %v",
+				test.name, test.bitcoindHost, bitcoindHost)
+		}
+		if elapsed := time.Since(start); elapsed > 10*probeTimeout {
+			t.Fatalf("%s: probe took %v despite timeout of %v",
+				test.name, elapsed, probeTimeout)
+		}
+	}
+}
+
+// TestBackendDialer ensures that only onion hosts are dialed through the
+// custom dial function of cfg.net, i.e. through Tor, while other hosts,
+// including local backends Tor refuses to connect to, are dialed directly.
+func TestBackendDialer(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	var dialedAddrs []string
+	torDial := func(network, addr string) (net.Conn, error) {
+		dialedAddrs = append(dialedAddrs, addr)
+		local, remote := net.Pipe()
+		remote.Close()
+		return local, nil
+	}
+	dial := backendDialer(torDial)
+
+	const onionHost = "3g2upl4pq6kufc4m.onion:8332"
+	conn, err := dial("tcp", onionHost)
+	if err != nil {
+		t.Fatalf("unable to dial onion host: %v", err)
+	}
+	conn.Close()
+
+	conn, err = dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial local host: %v", err)
+	}
+	conn.Close()
+
+	if len(dialedAddrs) != 1 || dialedAddrs[0] != onionHost {
+		t.Fatalf("expected only %v to be dialed through tor, got %v",
+			onionHost, dialedAddrs)
+	}
+}
+
+// TestFallbackFeeRate ensures that the configured fallback fee rate is
+// converted to sat/kw, and that the default is used if it isn't set.
+func TestFallbackFeeRate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		satPerVByte int64
+		expected    lnwallet.SatPerKWeight
+	}{
+		{
+			satPerVByte: 0,
+			expected:    lnwallet.SatPerKWeight(6250),
+		},
+		{
+			satPerVByte: 1,
+			expected:    lnwallet.SatPerKWeight(250),
+		},
+		{
+			satPerVByte: 100,
+			expected:    lnwallet.SatPerKWeight(25000),
+		},
+	}
+
+	for _, test := range tests {
+		feeRate := fallbackFeeRate(test.satPerVByte)
+		if feeRate != test.expected {
+			t.Fatalf("expected fallback fee rate of %v sat/kw for "+
+				"%v sat/vbyte, got %v", test.expected,
+				test.satPerVByte, feeRate)
+		}
+	}
+}
+
+// stopCountingFeeEstimator is a static fee estimator which counts the number
+// of times it has been stopped.
+type stopCountingFeeEstimator struct {
+	lnwallet.StaticFeeEstimator
+
+	numStops int
+}
+
+func (s *stopCountingFeeEstimator) Stop() error {
+	s.numStops++
+	return nil
+}
+
+// TestBackendCleanUp ensures that the clean up function of a chain backend
+// stops the fee estimator and all subsystems exactly once, even if it's
+// invoked multiple times.
+func TestBackendCleanUp(t *testing.T) {
+	t.Parallel()
+
+	feeEstimator := &stopCountingFeeEstimator{}
+
+	var stopped []int
+	stopFunc := func(i int) func() error {
+		return func() error {
+			stopped = append(stopped, i)
+			return nil
+		}
+	}
+	cleanUp := newBackendCleanUp(
+		feeEstimator, stopFunc(0), stopFunc(1), stopFunc(2),
+	)
+
+	cleanUp()
+	cleanUp()
+
+	if feeEstimator.numStops != 1 {
+		t.Fatalf("expected fee estimator to be stopped once, was "+
+			"stopped %d times", feeEstimator.numStops)
+	}
+	if len(stopped) != 3 {
+		t.Fatalf("expected 3 subsystems to be stopped, got %d",
+			len(stopped))
+	}
+	for i, stoppedIndex := range stopped {
+		if stoppedIndex != i {
+			t.Fatalf("expected subsystem %d to be stopped at "+
+				"index %d, got %d", i, i, stoppedIndex)
+		}
+	}
+}
+
+// startStopFeeEstimator is a static fee estimator which starts using the passed
+// function, and signals each time it's stopped.
+type startStopFeeEstimator struct {
+	lnwallet.StaticFeeEstimator
+
+	start   func() error
+	stopped chan struct{}
+}
+
+func (s *startStopFeeEstimator) Start() error {
+	return s.start()
+}
+
+func (s *startStopFeeEstimator) Stop() error {
+	s.stopped <- struct{}{}
+	return nil
+}
+
+// TestStartFeeEstimator ensures that a started fee estimator is stopped again
+// if a later step of the chain control's setup fails, while one that failed to
+// start isn't stopped, and one that started too late is stopped right away.
+func TestStartFeeEstimator(t *testing.T) {
+	t.Parallel()
+
+	const host = "rpchost:8332"
+
+	// Once the estimator was started successfully, a failure of a later
+	// step, such as starting the wallet, should stop it.
+	estimator := &startStopFeeEstimator{
+		start:   func() error { return nil },
+		stopped: make(chan struct{}, 1),
+	}
+	var started partialCleanUp
+	err := startFeeEstimator(
+		context.Background(), estimator, host, time.Second, &started,
+	)
+	if err != nil {
+		t.Fatalf("unable to start fee estimator: %v", err)
+	}
+	select {
+	case <-estimator.stopped:
+		t.Fatalf("fee estimator stopped before setup failed")
+	default:
+	}
+
+	started.run()
+	select {
+	case <-estimator.stopped:
+	default:
+		t.Fatalf("fee estimator wasn't stopped after setup failed")
+	}
+
+	// An estimator that failed to start shouldn't be stopped.
+	startErr := errors.New("start failed")
+	estimator.start = func() error { return startErr }
+	started = partialCleanUp{}
+	err = startFeeEstimator(
+		context.Background(), estimator, host, time.Second, &started,
+	)
+	if err != startErr {
+		t.Fatalf("expected start error, got: %v", err)
+	}
+	started.run()
+	select {
+	case <-estimator.stopped:
+		t.Fatalf("fee estimator stopped although it never started")
+	default:
+	}
+
+	// An estimator that doesn't start within the timeout should result in
+	// an error naming the host, and be stopped once it starts after all.
+	unblock := make(chan struct{})
+	estimator.start = func() error {
+		<-unblock
+		return nil
+	}
+	started = partialCleanUp{}
+	err = startFeeEstimator(
+		context.Background(), estimator, host, 50*time.Millisecond,
+		&started,
+	)
+	if err == nil || !strings.Contains(err.Error(), host) {
+		t.Fatalf("expected error naming host, got: %v", err)
+	}
+
+	close(unblock)
+	select {
+	case <-estimator.stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("fee estimator wasn't stopped after late start up")
+	}
+}
+
+// TestStaticFeeFallback ensures that a live fee estimator which fails to start
+// is replaced by a static one only if falling back was enabled, and that the
+// start up error is returned otherwise.
+func TestStaticFeeFallback(t *testing.T) {
+	t.Parallel()
+
+	const feePerKW = lnwallet.SatPerKWeight(6250)
+
+	startErr := errors.New("method not found")
+	estimator := &startStopFeeEstimator{
+		start:   func() error { return startErr },
+		stopped: make(chan struct{}, 1),
+	}
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		fallback bool
+	}{
+		{
+			name: "fallback disabled",
+			ctx:  context.Background(),
+		},
+		{
+			name:     "fallback enabled",
+			ctx:      context.Background(),
+			fallback: true,
+		},
+		{
+			name:     "start up abandoned",
+			ctx:      canceledCtx,
+			fallback: true,
+		},
+	}
+
+	for _, test := range tests {
+		var started partialCleanUp
+		err := startFeeEstimator(
+			context.Background(), estimator, "rpchost:8332",
+			time.Second, &started,
+		)
+		if err != startErr {
+			t.Fatalf("%s: expected start error, got: %v",
+				test.name, err)
+		}
+
+		chainCfg := &chainConfig{
+			Node:                         "bitcoind",
+			FeeEstimatorFallbackToStatic: test.fallback,
+		}
+		fallback, err := staticFeeFallback(
+			test.ctx, chainCfg, err, feePerKW,
+		)
+
+		// We should only fall back if enabled, and as long as the
+		// start up wasn't abandoned.
+		shouldFallBack := test.fallback && test.ctx.Err() == nil
+		if !shouldFallBack {
+			if err != startErr {
+				t.Fatalf("%s: expected start error, got: %v",
+					test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unable to fall back: %v", test.name, err)
+		}
+
+		feeRate, err := fallback.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("%s: unable to estimate fee: %v", test.name,
+				err)
+		}
+		if feeRate != feePerKW {
+			t.Fatalf("%s: expected static fee rate %v, got %v",
+				test.name, feePerKW, feeRate)
+		}
+	}
+}
+
+// queryCountingFeeEstimator is a live fee estimator which counts the number of
+// estimates it has been queried for.
+type queryCountingFeeEstimator struct {
+	lnwallet.StaticFeeEstimator
+
+	numQueries int32 // To be used atomically.
+}
+
+func (q *queryCountingFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	atomic.AddInt32(&q.numQueries, 1)
+	return q.StaticFeeEstimator.EstimateFeePerKW(numBlocks)
+}
+
+// TestRefreshFeeEstimates ensures that live fee estimates are refreshed in the
+// background at the configured feepollinterval, and only on demand once
+// cached for feecachettl otherwise.
+func TestRefreshFeeEstimates(t *testing.T) {
+	t.Parallel()
+
+	const window = 500 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		chainCfg     *chainConfig
+		minRefreshes int32
+		maxRefreshes int32
+	}{
+		{
+			name: "short poll interval",
+			chainCfg: &chainConfig{
+				FeePollInterval: 50 * time.Millisecond,
+				FeeCacheTTL:     time.Hour,
+			},
+			minRefreshes: 8,
+			maxRefreshes: 11,
+		},
+		{
+			name: "long poll interval",
+			chainCfg: &chainConfig{
+				FeePollInterval: 200 * time.Millisecond,
+			},
+			minRefreshes: 1,
+			maxRefreshes: 3,
+		},
+		{
+			name: "cached",
+			chainCfg: &chainConfig{
+				FeeCacheTTL: time.Hour,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			live := &queryCountingFeeEstimator{
+				StaticFeeEstimator: lnwallet.StaticFeeEstimator{
+					FeePerKW: 2500,
+				},
+			}
+
+			var started partialCleanUp
+			defer started.run()
+			estimator, err := refreshFeeEstimates(
+				context.Background(), live, test.chainCfg,
+				"rpchost:8332", &started,
+			)
+			if err != nil {
+				t.Fatalf("unable to wrap fee estimator: %v",
+					err)
+			}
+
+			// Only the first estimate should be queried on
+			// demand, while the rest are either served from the
+			// cache or refreshed in the background.
+			for i := 0; i < 10; i++ {
+				_, err := estimator.EstimateFeePerKW(6)
+				if err != nil {
+					t.Fatalf("unable to estimate fee: %v",
+						err)
+				}
+			}
+			time.Sleep(window)
+
+			refreshes := atomic.LoadInt32(&live.numQueries) - 1
+			if refreshes < test.minRefreshes ||
+				refreshes > test.maxRefreshes {
+
+				t.Fatalf("expected between %d and %d "+
+					"refreshes, got %d", test.minRefreshes,
+					test.maxRefreshes, refreshes)
+			}
+		})
+	}
+}
+
+// TestRefreshFeeEstimatesMaxAge ensures that live fee estimates which couldn't
+// be refreshed within maxfeeestimateage fail rather than being returned,
+// whether they're polled or cached, while they're returned regardless of their
+// age if it isn't set.
+func TestRefreshFeeEstimatesMaxAge(t *testing.T) {
+	t.Parallel()
+
+	const maxAge = 100 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		chainCfg *chainConfig
+		stale    bool
+	}{
+		{
+			name: "polled",
+			chainCfg: &chainConfig{
+				FeePollInterval: time.Hour,
+			},
+			stale: false,
+		},
+		{
+			name: "polled past max age",
+			chainCfg: &chainConfig{
+				FeePollInterval:   time.Hour,
+				MaxFeeEstimateAge: maxAge,
+			},
+			stale: true,
+		},
+		{
+			name: "cached",
+			chainCfg: &chainConfig{
+				FeeCacheTTL: time.Hour,
+			},
+			stale: false,
+		},
+		{
+			name: "cached past max age",
+			chainCfg: &chainConfig{
+				FeeCacheTTL:       time.Hour,
+				MaxFeeEstimateAge: maxAge,
+			},
+			stale: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			live := &spikingFeeEstimator{
+				StaticFeeEstimator: lnwallet.StaticFeeEstimator{
+					FeePerKW: 2500,
+				},
+			}
+
+			var started partialCleanUp
+			defer started.run()
+			estimator, err := refreshFeeEstimates(
+				context.Background(), live, test.chainCfg,
+				"rpchost:8332", &started,
+			)
+			if err != nil {
+				t.Fatalf("unable to wrap fee estimator: %v",
+					err)
+			}
+			if _, err := estimator.EstimateFeePerKW(6); err != nil {
+				t.Fatalf("unable to estimate fee: %v", err)
+			}
+
+			// Once the backend becomes unreachable for longer
+			// than the max age, the estimate should only be
+			// returned if no max age is set.
+			live.err = errors.New("backend unreachable")
+			time.Sleep(2 * maxAge)
+
+			feeRate, err := estimator.EstimateFeePerKW(6)
+			if test.stale != (err != nil) {
+				t.Fatalf("expected stale estimate to "+
+					"fail=%v, got err=%v", test.stale, err)
+			}
+			if !test.stale && feeRate != 2500 {
+				t.Fatalf("expected fee rate of 2500, got %v",
+					feeRate)
+			}
+		})
+	}
+}
+
+// warmingUpFeeEstimator is a live fee estimator which resorts to its fallback
+// fee rate until the given time, and returns a live estimate afterwards.
+type warmingUpFeeEstimator struct {
+	lnwallet.StaticFeeEstimator
+
+	liveAt  time.Time
+	liveFee lnwallet.SatPerKWeight
+
+	mu          sync.Mutex
+	numQueries  int
+	confTargets []uint32
+}
+
+func (w *warmingUpFeeEstimator) EstimateFeePerKWFallback(
+	numBlocks uint32) (lnwallet.SatPerKWeight, bool, error) {
+
+	w.mu.Lock()
+	w.numQueries++
+	w.confTargets = append(w.confTargets, numBlocks)
+	w.mu.Unlock()
+
+	if time.Now().Before(w.liveAt) {
+		return w.FeePerKW, true, nil
+	}
+
+	return w.liveFee, false, nil
+}
+
+// TestWaitForFeeEstimate ensures that we wait for a live fee estimator to
+// produce its first live estimate, giving up once the warm-up timeout expires,
+// and that no wait occurs if the warm-up is disabled.
+func TestWaitForFeeEstimate(t *testing.T) {
+	t.Parallel()
+
+	const (
+		pollInterval = 10 * time.Millisecond
+		timeout      = 5 * time.Second
+	)
+
+	newEstimator := func(delay time.Duration) *warmingUpFeeEstimator {
+		return &warmingUpFeeEstimator{
+			StaticFeeEstimator: lnwallet.StaticFeeEstimator{
+				FeePerKW: 12500,
+			},
+			liveAt:  time.Now().Add(delay),
+			liveFee: 2500,
+		}
+	}
+
+	// An estimator producing a live estimate after a delay should be
+	// waited for, with the configured target being queried.
+	estimator := newEstimator(100 * time.Millisecond)
+	start := time.Now()
+	err := waitForFeeEstimate(
+		context.Background(), estimator, 3, timeout, pollInterval,
+	)
+	if err != nil {
+		t.Fatalf("unable to wait for fee estimate: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond ||
+		elapsed >= timeout {
+
+		t.Fatalf("expected to wait for the live estimate, waited %v",
+			elapsed)
+	}
+	if estimator.numQueries < 2 {
+		t.Fatalf("expected estimator to be polled, got %d queries",
+			estimator.numQueries)
+	}
+	for _, confTarget := range estimator.confTargets {
+		if confTarget != 3 {
+			t.Fatalf("expected conf target 3, got %d", confTarget)
+		}
+	}
+
+	// Without a configured target, the default one should be queried.
+	estimator = newEstimator(0)
+	err = waitForFeeEstimate(
+		context.Background(), estimator, 0, timeout, pollInterval,
+	)
+	if err != nil {
+		t.Fatalf("unable to wait for fee estimate: %v", err)
+	}
+	if len(estimator.confTargets) != 1 ||
+		estimator.confTargets[0] != defaultWarmupConfTarget {
+
+		t.Fatalf("expected a single query for the default conf "+
+			"target, got %v", estimator.confTargets)
+	}
+
+	// An estimator that doesn't produce a live estimate in time shouldn't
+	// prevent us from proceeding once the timeout expires.
+	estimator = newEstimator(time.Hour)
+	err = waitForFeeEstimate(
+		context.Background(), estimator, 3, 50*time.Millisecond,
+		pollInterval,
+	)
+	if err != nil {
+		t.Fatalf("expected to proceed after timeout, got: %v", err)
+	}
+
+	// The wait should be abandoned if the context is canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = waitForFeeEstimate(ctx, estimator, 3, timeout, pollInterval)
+	if err != context.Canceled {
+		t.Fatalf("expected context to be canceled, got: %v", err)
+	}
+
+	// Without a timeout, the estimator shouldn't be queried at all.
+	estimator = newEstimator(time.Hour)
+	err = waitForFeeEstimate(
+		context.Background(), estimator, 3, 0, pollInterval,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if estimator.numQueries != 0 {
+		t.Fatalf("expected no queries without warm-up, got %d",
+			estimator.numQueries)
+	}
+
+	// Estimators unable to report whether they fell back aren't waited
+	// for either.
+	err = waitForFeeEstimate(
+		context.Background(), lnwallet.StaticFeeEstimator{}, 3,
+		timeout, pollInterval,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestReadNeutrinoPeerFile ensures that the peers within a neutrino persistent
+// peer file are appended to the inline peers, ignoring comments, blank lines
+// and duplicates.
+func TestReadNeutrinoPeerFile(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "neutrino")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	const peerFileContents = `
+# Our own nodes.
+10.0.0.1:8333
+  10.0.0.2:8333
+
+# Duplicates of the inline peers and of each other.
+10.0.0.3:8333
+10.0.0.1:8333
+`
+	peerFile := filepath.Join(tempDir, "peers.txt")
+	err = ioutil.WriteFile(peerFile, []byte(peerFileContents), 0600)
+	if err != nil {
+		t.Fatalf("unable to write peer file: %v", err)
+	}
+
+	peers, err := readNeutrinoPeerFile(
+		peerFile, []string{"10.0.0.3:8333", "10.0.0.4:8333"},
+	)
+	if err != nil {
+		t.Fatalf("unable to read peer file: %v", err)
+	}
+
+	expectedPeers := []string{
+		"10.0.0.3:8333", "10.0.0.4:8333", "10.0.0.1:8333",
+		"10.0.0.2:8333",
+	}
+	if !reflect.DeepEqual(peers, expectedPeers) {
+		t.Fatalf("expected peers %v, got %v", expectedPeers, peers)
+	}
+
+	// A missing peer file should result in an error naming the file.
+	missingFile := filepath.Join(tempDir, "missing.txt")
+	_, err = readNeutrinoPeerFile(missingFile, nil)
+	if err == nil {
+		t.Fatalf("expected error for missing peer file")
+	}
+	if !strings.Contains(err.Error(), missingFile) {
+		t.Fatalf("expected error to name the peer file, got: %v", err)
+	}
+}
+
+// TestNeutrinoDatabase ensures that the location and backend of neutrino's
+// database can be overridden, and that unknown backends are rejected.
+func TestNeutrinoDatabase(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "neutrino")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Without any overrides, the database should be placed within the
+	// data directory using the default backend.
+	dbPath, dbBackend, err := neutrinoDatabase(&neutrinoConfig{}, tempDir)
+	if err != nil {
+		t.Fatalf("unable to determine database: %v", err)
+	}
+	expectedPath := filepath.Join(tempDir, defaultNeutrinoDBName)
+	if dbPath != expectedPath {
+		t.Fatalf("expected path %v, got %v", expectedPath, dbPath)
+	}
+	if dbBackend != defaultNeutrinoDBBackend {
+		t.Fatalf("expected backend %v, got %v",
+			defaultNeutrinoDBBackend, dbBackend)
+	}
+
+	// A custom path should be used as is, with its directory created.
+	customPath := filepath.Join(tempDir, "custom", "neutrino.db")
+	dbPath, _, err = neutrinoDatabase(
+		&neutrinoConfig{DatabasePath: customPath}, tempDir,
+	)
+	if err != nil {
+		t.Fatalf("unable to determine database: %v", err)
+	}
+	if dbPath != customPath {
+		t.Fatalf("expected path %v, got %v", customPath, dbPath)
+	}
+	if _, err := os.Stat(filepath.Dir(customPath)); err != nil {
+		t.Fatalf("expected database directory to be created: %v", err)
+	}
+
+	// Relative paths and unknown backends should be rejected.
+	_, _, err = neutrinoDatabase(
+		&neutrinoConfig{DatabasePath: "neutrino.db"}, tempDir,
+	)
+	if err == nil {
+		t.Fatalf("expected error for relative database path")
+	}
+	_, _, err = neutrinoDatabase(
+		&neutrinoConfig{DatabaseBackend: "unknown"}, tempDir,
+	)
+	if err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Fatalf("expected error for unknown backend, got: %v", err)
+	}
+}
+
+// TestNeutrinoDataDir ensures that each neutrino profile is assigned a
+// distinct data directory, separate from the one used without a profile, and
+// that profiles which aren't safe path components are rejected.
+func TestNeutrinoDataDir(t *testing.T) {
+	t.Parallel()
+
+	chainDir := filepath.Join("data", "chain", "bitcoin")
+
+	// Without a profile, the data directory should only be keyed by the
+	// network, while each profile and network should be assigned a
+	// directory of its own.
+	dirs := make(map[string]string)
+	for _, network := range []string{"testnet", "regtest"} {
+		for _, profile := range []string{"", "alice", "bob", "bob_2"} {
+			dataDir, err := neutrinoDataDir(
+				chainDir, network, profile,
+			)
+			if err != nil {
+				t.Fatalf("unable to get data dir for profile "+
+					"%q: %v", profile, err)
+			}
+
+			if profile == "" {
+				expectedDir := filepath.Join(chainDir, network)
+				if dataDir != expectedDir {
+					t.Fatalf("expected data dir %v, got %v",
+						expectedDir, dataDir)
+				}
+			}
+
+			key := network + "/" + profile
+			for otherKey, otherDir := range dirs {
+				if dataDir == otherDir {
+					t.Fatalf("%v and %v share data dir %v",
+						key, otherKey, dataDir)
+				}
+			}
+			dirs[key] = dataDir
+		}
+	}
+
+	invalidProfiles := []string{
+		".", "..", "../alice", "alice/bob", `alice\bob`, "alice bob",
+		"alice:bob",
+	}
+	for _, profile := range invalidProfiles {
+		_, err := neutrinoDataDir(chainDir, "testnet", profile)
+		if err == nil {
+			t.Fatalf("expected error for profile %q", profile)
+		}
+	}
+}
+
+// TestNeutrinoDisableDNSSeed ensures that neutrino's DNS seeding is only
+// disabled if requested, and that it's refused without any peers to rely on
+// instead.
+func TestNeutrinoDisableDNSSeed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		cfg      *neutrinoConfig
+		addPeers []string
+		disabled bool
+		valid    bool
+	}{
+		{
+			name:  "dns seeding",
+			cfg:   &neutrinoConfig{},
+			valid: true,
+		},
+		{
+			name:     "added peers",
+			cfg:      &neutrinoConfig{DisableDNSSeed: true},
+			addPeers: []string{"10.0.0.1:8333"},
+			disabled: true,
+			valid:    true,
+		},
+		{
+			name: "connect peers",
+			cfg: &neutrinoConfig{
+				ConnectPeers:   []string{"10.0.0.1:8333"},
+				DisableDNSSeed: true,
+			},
+			disabled: true,
+			valid:    true,
+		},
+		{
+			name: "no peers",
+			cfg:  &neutrinoConfig{DisableDNSSeed: true},
+		},
+	}
+
+	for _, test := range tests {
+		disabled, err := neutrinoDisableDNSSeed(test.cfg, test.addPeers)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+		}
+
+		if disabled != test.disabled {
+			t.Fatalf("%s: expected dns seeding disabled to be %v, "+
+				"got %v", test.name, test.disabled, disabled)
+		}
+	}
+}
+
+// TestNeutrinoUserAgent ensures that the configured user agent is advertised
+// by neutrino, falling back to its defaults, and that user agents violating
+// BIP 14 are rejected.
+func TestNeutrinoUserAgent(t *testing.T) {
+	t.Parallel()
+
+	const (
+		defaultName    = "neutrino"
+		defaultVersion = "0.0.4-beta"
+	)
+
+	tests := []struct {
+		name    string
+		cfg     *neutrinoConfig
+		agent   string
+		version string
+		valid   bool
+	}{
+		{
+			name:    "default",
+			cfg:     &neutrinoConfig{},
+			agent:   defaultName,
+			version: defaultVersion,
+			valid:   true,
+		},
+		{
+			name: "name and version",
+			cfg: &neutrinoConfig{
+				UserAgentName:    "wallet",
+				UserAgentVersion: "1.0",
+			},
+			agent:   "wallet",
+			version: "1.0",
+			valid:   true,
+		},
+		{
+			name: "comments",
+			cfg: &neutrinoConfig{
+				UserAgentName: "wallet",
+				UserAgentComments: []string{
+					"mobile", "build:42",
+				},
+			},
+			agent:   "wallet",
+			version: defaultVersion + "(mobile; build:42)",
+			valid:   true,
+		},
+		{
+			name: "reserved character in name",
+			cfg: &neutrinoConfig{
+				UserAgentName: "wallet/1.0",
+			},
+		},
+		{
+			name: "reserved character in version",
+			cfg: &neutrinoConfig{
+				UserAgentVersion: "1.0:beta",
+			},
+		},
+		{
+			name: "reserved character in comment",
+			cfg: &neutrinoConfig{
+				UserAgentComments: []string{"mobile; desktop"},
+			},
+		},
+		{
+			name: "too long",
+			cfg: &neutrinoConfig{
+				UserAgentName: strings.Repeat(
+					"a", wire.MaxUserAgentLen,
+				),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		agent, version, err := neutrinoUserAgent(
+			test.cfg, defaultName, defaultVersion,
+		)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+		}
+
+		if agent != test.agent || version != test.version {
+			t.Fatalf("%s: expected user agent %v:%v, got %v:%v",
+				test.name, test.agent, test.version, agent,
+				version)
+		}
+	}
+}
+
+// TestParseSocksProxy ensures that the address of neutrino's SOCKS proxy is
+// parsed along with its optional credentials, and that malformed addresses are
+// TestCheckNeutrinoDirWritable ensures that a writable neutrino data
+// directory passes the check without leaving any files behind, while a
+// read-only one is rejected with an error naming it.
+func TestCheckNeutrinoDirWritable(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "neutrino")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	writableDir := filepath.Join(tempDir, "writable")
+	if err := os.Mkdir(writableDir, 0700); err != nil {
+		t.Fatalf("unable to create dir: %v", err)
+	}
+	if err := checkNeutrinoDirWritable(writableDir); err != nil {
+		t.Fatalf("unexpected error for writable dir: %v", err)
+	}
+	files, err := ioutil.ReadDir(writableDir)
+	if err != nil {
+		t.Fatalf("unable to read dir: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected no files to be left behind, got %d",
+			len(files))
+	}
+
+	// Permissions aren't enforced for root, so the read-only directory
+	// would still be writable.
+	if os.Geteuid() == 0 {
+		t.Skip("skipping read-only dir check when running as root")
+	}
+
+	readOnlyDir := filepath.Join(tempDir, "readonly")
+	if err := os.Mkdir(readOnlyDir, 0500); err != nil {
+		t.Fatalf("unable to create dir: %v", err)
+	}
+	err = checkNeutrinoDirWritable(readOnlyDir)
+	if err == nil {
+		t.Fatalf("expected error for read-only dir")
+	}
+	if !strings.Contains(err.Error(), readOnlyDir) ||
+		!strings.Contains(err.Error(), "r-x------") {
+
+		t.Fatalf("expected error to name the dir and its "+
+			"permissions, got: %v", err)
+	}
+}
+
+// TestApplyNeutrinoFilterCacheSize ensures that a configured cap on the size
+// of neutrino's filter cache propagates to the config of its chain service,
+// while caps too small to be of use are rejected.
+func TestApplyNeutrinoFilterCacheSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cacheSize uint64
+		expected  uint64
+		valid     bool
+	}{
+		{
+			name:  "default",
+			valid: true,
+		},
+		{
+			name:      "capped",
+			cacheSize: 2 * minNeutrinoFilterCacheSize,
+			expected:  2 * minNeutrinoFilterCacheSize,
+			valid:     true,
+		},
+		{
+			name:      "minimum",
+			cacheSize: minNeutrinoFilterCacheSize,
+			expected:  minNeutrinoFilterCacheSize,
+			valid:     true,
+		},
+		{
+			name:      "too small",
+			cacheSize: minNeutrinoFilterCacheSize - 1,
+		},
+	}
+
+	for _, test := range tests {
+		var config neutrino.Config
+		err := applyNeutrinoFilterCacheSize(&config, &neutrinoConfig{
+			MaxFilterCacheSize: test.cacheSize,
+		})
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+		}
+
+		if config.FilterCacheSize != test.expected {
+			t.Fatalf("%s: expected filter cache size %d, got %d",
+				test.name, test.expected,
+				config.FilterCacheSize)
+		}
+	}
+}
+
+// rejected.
+func TestParseSocksProxy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		socksProxy string
+		addr       string
+		user       string
+		pass       string
+		valid      bool
+	}{
+		{
+			name:       "without credentials",
+			socksProxy: "127.0.0.1:1080",
+			addr:       "127.0.0.1:1080",
+			valid:      true,
+		},
+		{
+			name:       "with credentials",
+			socksProxy: "user:p@ss:word@proxy.local:1080",
+			addr:       "proxy.local:1080",
+			user:       "user",
+			pass:       "p@ss:word",
+			valid:      true,
+		},
+		{
+			name:       "missing port",
+			socksProxy: "127.0.0.1",
+		},
+		{
+			name:       "invalid port",
+			socksProxy: "127.0.0.1:socks",
+		},
+		{
+			name:       "port out of range",
+			socksProxy: "127.0.0.1:65536",
+		},
+		{
+			name:       "missing host",
+			socksProxy: ":1080",
+		},
+		{
+			name:       "missing password",
+			socksProxy: "user@127.0.0.1:1080",
+		},
+		{
+			name:       "empty password",
+			socksProxy: "user:@127.0.0.1:1080",
+		},
+	}
+
+	for _, test := range tests {
+		addr, auth, err := parseSocksProxy(test.socksProxy)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unable to parse proxy: %v", test.name,
+				err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+
+		case !test.valid:
+			continue
+		}
+
+		if addr != test.addr {
+			t.Fatalf("%s: expected address %v, got %v", test.name,
+				test.addr, addr)
+		}
+
+		var user, pass string
+		if auth != nil {
+			user, pass = auth.User, auth.Password
+		}
+		if user != test.user || pass != test.pass {
+			t.Fatalf("%s: expected credentials %v:%v, got %v:%v",
+				test.name, test.user, test.pass, user, pass)
+		}
+	}
+}
+
+// socksRequest is a connection request received by the mock SOCKS5 proxy.
+type socksRequest struct {
+	user   string
+	pass   string
+	target string
+}
+
+// serveSocks5 handles a single SOCKS5 connection, authenticating the client
+// with a username and password, and reports the requested target once the
+// connection was granted.
+func serveSocks5(conn net.Conn) (*socksRequest, error) {
+	readBytes := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(conn, b)
+		return b, err
+	}
+
+	// The client greets us with the authentication methods it supports,
+	// of which we'll select username and password authentication.
+	greeting, err := readBytes(2)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readBytes(int(greeting[1])); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{0x05, 0x02}); err != nil {
+		return nil, err
+	}
+
+	var req socksRequest
+	authHeader, err := readBytes(2)
+	if err != nil {
+		return nil, err
+	}
+	user, err := readBytes(int(authHeader[1]))
+	if err != nil {
+		return nil, err
+	}
+	passLen, err := readBytes(1)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := readBytes(int(passLen[0]))
+	if err != nil {
+		return nil, err
+	}
+	req.user, req.pass = string(user), string(pass)
+	if _, err := conn.Write([]byte{0x01, 0x00}); err != nil {
+		return nil, err
+	}
+
+	// Next, we'll read the connection request for an IPv4 target.
+	request, err := readBytes(4)
+	if err != nil {
+		return nil, err
+	}
+	if request[3] != 0x01 {
+		return nil, fmt.Errorf("unexpected address type %d",
+			request[3])
+	}
+	target, err := readBytes(6)
+	if err != nil {
+		return nil, err
+	}
+	req.target = net.JoinHostPort(
+		net.IP(target[:4]).String(),
+		fmt.Sprintf("%d", int(target[4])<<8|int(target[5])),
+	)
+
+	_, err = conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	return &req, err
+}
+
+// TestNeutrinoProxyDialer ensures that neutrino's dialer connects to its peers
+// through the configured SOCKS5 proxy, authenticating with its credentials.
+func TestNeutrinoProxyDialer(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	requests := make(chan *socksRequest, 1)
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+
+		req, err := serveSocks5(conn)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		requests <- req
+
+		// Keep the connection open until the client is done.
+		ioutil.ReadAll(conn)
+	}()
+
+	dialer, _, err := neutrinoProxyDialer(
+		"alice:secret@" + listener.Addr().String(),
+	)
+	if err != nil {
+		t.Fatalf("unable to create dialer: %v", err)
+	}
+
+	peerAddr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 18333}
+	conn, err := dialer(peerAddr)
+	if err != nil {
+		t.Fatalf("unable to dial peer through proxy: %v", err)
+	}
+	defer conn.Close()
+
+	select {
+	case req := <-requests:
+		if req.user != "alice" || req.pass != "secret" {
+			t.Fatalf("expected credentials alice:secret, got "+
+				"%v:%v", req.user, req.pass)
+		}
+		if req.target != peerAddr.String() {
+			t.Fatalf("expected connection to %v, got %v",
+				peerAddr, req.target)
+		}
+
+	case err := <-errChan:
+		t.Fatalf("proxy failed: %v", err)
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("proxy didn't receive the connection")
+	}
+}
+
+// TestCheckNeutrinoDBNetwork ensures that a neutrino database is tagged with
+// the network it was first opened for, including databases that weren't tagged
+// yet, and that opening it for another network is refused.
+func TestCheckNeutrinoDBNetwork(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "neutrino")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dbPath := filepath.Join(tempDir, defaultNeutrinoDBName)
+	db, err := walletdb.Create("bdb", dbPath)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+
+	// The database isn't tagged yet, so it should be tagged with the
+	// network it's opened for, and accepted for it from then on.
+	network := bitcoinTestNetParams.Name
+	for i := 0; i < 2; i++ {
+		err := checkNeutrinoDBNetwork(db, dbPath, network)
+		if err != nil {
+			t.Fatalf("unable to open database for %v: %v", network,
+				err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("unable to close database: %v", err)
+	}
+
+	// Once reopened, the database should be refused for regtest, with the
+	// error naming both networks.
+	db, err = walletdb.Open("bdb", dbPath)
+	if err != nil {
+		t.Fatalf("unable to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = checkNeutrinoDBNetwork(db, dbPath, regTestNetParams.Name)
+	if err == nil {
+		t.Fatalf("expected database of %v to be refused for %v",
+			network, regTestNetParams.Name)
+	}
+	if !strings.Contains(err.Error(), network) ||
+		!strings.Contains(err.Error(), regTestNetParams.Name) {
+
+		t.Fatalf("expected error to name both networks, got: %v", err)
+	}
+
+	if err := checkNeutrinoDBNetwork(db, dbPath, network); err != nil {
+		t.Fatalf("unable to open database for %v: %v", network, err)
+	}
+}
+
+// TestNewLightningWalletConfig ensures that the LightningWallet is wired to the
+// subsystems of the chain control in the same way regardless of the backend
+// they were set up by, and that the channel constraints of the primary chain
+// are selected.
+func TestNewLightningWalletConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		backend      string
+		feeEstimator lnwallet.FeeEstimator
+		primaryChain chainCode
+		constraints  channeldb.ChannelConstraints
+	}{
+		{
+			backend: "neutrino",
+			feeEstimator: lnwallet.StaticFeeEstimator{
+				FeePerKW: 1000,
+			},
+			primaryChain: bitcoinChain,
+			constraints:  defaultBtcChannelConstraints,
+		},
+		{
+			backend: "bitcoind",
+			feeEstimator: lnwallet.NewCachedFeeEstimator(
+				lnwallet.StaticFeeEstimator{FeePerKW: 2000},
+				time.Minute,
+			),
+			primaryChain: bitcoinChain,
+			constraints:  defaultBtcChannelConstraints,
+		},
+		{
+			backend: "btcd",
+			feeEstimator: lnwallet.NewFixedTargetFeeEstimator(
+				lnwallet.StaticFeeEstimator{FeePerKW: 3000}, 6,
+			),
+			primaryChain: litecoinChain,
+			constraints:  defaultLtcChannelConstraints,
+		},
+	}
+
+	for _, test := range tests {
+		wc := &mockWalletController{}
+		cc := &chainControl{
+			chainNotifier: &mockNotfier{},
+			feeEstimator:  test.feeEstimator,
+			signer:        &mockSigner{},
+			chainIO:       &mockChainIO{},
+		}
+		keyRing := &mockSecretKeyRing{}
+
+		walletCfg := newLightningWalletConfig(
+			cc, nil, wc, keyRing, test.primaryChain,
+			lnwallet.NestedWitnessPubKey,
+		)
+
+		switch {
+		case walletCfg.Notifier != cc.chainNotifier:
+			t.Fatalf("%s: notifier not wired", test.backend)
+		case walletCfg.FeeEstimator != cc.feeEstimator:
+			t.Fatalf("%s: fee estimator not wired", test.backend)
+		case walletCfg.Signer != cc.signer:
+			t.Fatalf("%s: signer not wired", test.backend)
+		case walletCfg.ChainIO != cc.chainIO:
+			t.Fatalf("%s: chain IO not wired", test.backend)
+		case walletCfg.WalletController != wc:
+			t.Fatalf("%s: wallet controller not wired",
+				test.backend)
+		case walletCfg.SecretKeyRing != keyRing:
+			t.Fatalf("%s: key ring not wired", test.backend)
+		case walletCfg.AddressType != lnwallet.NestedWitnessPubKey:
+			t.Fatalf("%s: address type not wired", test.backend)
+		}
+
+		if walletCfg.DefaultConstraints != test.constraints {
+			t.Fatalf("%s: expected constraints %v, got %v",
+				test.backend, test.constraints,
+				walletCfg.DefaultConstraints)
+		}
+		if walletCfg.NetParams.Name != activeNetParams.Name {
+			t.Fatalf("%s: expected net params of %v, got %v",
+				test.backend, activeNetParams.Name,
+				walletCfg.NetParams.Name)
+		}
+	}
+}
+
+// TestWalletKeyRing ensures that an alternative key ring set through the
+// chain config is used by the wallet in place of the default one backed by
+// btcwallet.
+func TestWalletKeyRing(t *testing.T) {
+	t.Parallel()
+
+	keyRing := walletKeyRing(&chainConfig{}, nil, keychain.CoinTypeBitcoin)
+	if _, ok := keyRing.(*keychain.BtcWalletKeyRing); !ok {
+		t.Fatalf("expected default key ring, got %T", keyRing)
+	}
+
+	fakeKeyRing := &mockSecretKeyRing{}
+	chainCfg := &chainConfig{SecretKeyRing: fakeKeyRing}
+	keyRing = walletKeyRing(chainCfg, nil, keychain.CoinTypeBitcoin)
+	if keyRing != fakeKeyRing {
+		t.Fatalf("expected provided key ring to be used, got %T",
+			keyRing)
+	}
+
+	walletCfg := newLightningWalletConfig(
+		&chainControl{}, nil, &mockWalletController{}, keyRing,
+		bitcoinChain, lnwallet.WitnessPubKey,
+	)
+	if walletCfg.SecretKeyRing != fakeKeyRing {
+		t.Fatalf("expected provided key ring to be assigned to the "+
+			"wallet config, got %T", walletCfg.SecretKeyRing)
+	}
+}
+
+// TestUseRPCFeeEstimator ensures that the configured fee estimator mode is
+// honored depending on whether the backend is able to provide live fee
+// estimates.
+func TestUseRPCFeeEstimator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode          string
+		node          string
+		liveEstimates bool
+		useRPC        bool
+		valid         bool
+	}{
+		{
+			mode:          feeEstimatorModeAuto,
+			node:          "bitcoind",
+			liveEstimates: true,
+			useRPC:        true,
+			valid:         true,
+		},
+		{
+			mode:          feeEstimatorModeAuto,
+			node:          "btcd",
+			liveEstimates: false,
+			useRPC:        false,
+			valid:         true,
+		},
+		{
+			mode:          "",
+			node:          "btcd",
+			liveEstimates: true,
+			useRPC:        true,
+			valid:         true,
+		},
+		{
+			mode:          feeEstimatorModeStatic,
+			node:          "bitcoind",
+			liveEstimates: true,
+			useRPC:        false,
+			valid:         true,
+		},
+		{
+			mode:          feeEstimatorModeStatic,
+			node:          "neutrino",
+			liveEstimates: false,
+			useRPC:        false,
+			valid:         true,
+		},
+		{
+			mode:          feeEstimatorModeRPC,
+			node:          "btcd",
+			liveEstimates: true,
+			useRPC:        true,
+			valid:         true,
+		},
+		{
+			mode:          feeEstimatorModeRPC,
+			node:          "bitcoind",
+			liveEstimates: false,
+			valid:         false,
+		},
+		{
+			mode:          feeEstimatorModeRPC,
+			node:          "neutrino",
+			liveEstimates: false,
+			valid:         false,
+		},
+		{
+			mode:          "unknown",
+			node:          "btcd",
+			liveEstimates: true,
+			valid:         false,
+		},
+	}
+
+	for _, test := range tests {
+		useRPC, err := useRPCFeeEstimator(
+			test.mode, test.node, "regtest", test.liveEstimates,
+		)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("mode %q with %v: unexpected error: %v",
+				test.mode, test.node, err)
+		case !test.valid && err == nil:
+			t.Fatalf("mode %q with %v: expected error", test.mode,
+				test.node)
+		case useRPC != test.useRPC:
+			t.Fatalf("mode %q with %v: expected useRPC=%v, got %v",
+				test.mode, test.node, test.useRPC, useRPC)
+		}
+	}
+}
+
+// TestBackendConnParamsString ensures that the logged summary of the
+// connection parameters of a backend includes its resolved host and port,
+// while never revealing the password.
+func TestBackendConnParamsString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		params   *backendConnParams
+		expected []string
+		secret   string
+	}{
+		{
+			name: "bitcoind cookie",
+			params: &backendConnParams{
+				node:           "bitcoind",
+				rpcHost:        "127.0.0.1:18443",
+				zmqPubRawBlock: "tcp://127.0.0.1:28332",
+				zmqPubRawTx:    "ipc:///tmp/bitcoind.tx",
+				user:           bitcoindCookieUser,
+				pass:           "cookiesecret",
+			},
+			expected: []string{
+				"bitcoind:", "host=127.0.0.1", "port=18443",
+				"zmqpubrawblock=tcp://127.0.0.1:28332",
+				"zmqpubrawtx=ipc:///tmp/bitcoind.tx",
+				"tls=false", "auth=cookie",
+				"pass=" + redactedSecret,
+			},
+			secret: "cookiesecret",
+		},
+		{
+			name: "btcd password",
+			params: &backendConnParams{
+				node:     "btcd",
+				rpcHost:  "[::1]:18334",
+				endpoint: "ws",
+				tls:      true,
+				user:     "user",
+				pass:     "hunter2",
+			},
+			expected: []string{
+				"btcd:", "host=::1", "port=18334",
+				"endpoint=ws", "tls=true", "auth=password", "user=user",
+				"pass=" + redactedSecret,
+			},
+			secret: "hunter2",
+		},
+	}
+
+	for _, test := range tests {
+		summary := test.params.String()
+		for _, expected := range test.expected {
+			if !strings.Contains(summary, expected) {
+				t.Fatalf("%s: expected %q within summary: %v",
+					test.name, expected, summary)
+			}
+		}
+		if strings.Contains(summary, test.secret) {
+			t.Fatalf("%s: password revealed within summary: %v",
+				test.name, summary)
+		}
+	}
+}
+
+// mockBlockChainInfoSource is a blockChainInfoSource which returns a static
+// set of chain information.
+type mockBlockChainInfoSource struct {
+	info *btcjson.GetBlockChainInfoResult
+	err  error
+}
+
+func (m *mockBlockChainInfoSource) GetBlockChainInfo() (
+	*btcjson.GetBlockChainInfoResult, error) {
+
+	return m.info, m.err
+}
+
+// TestCheckPrunedBackend ensures that a pruned backend is only rejected if
+// refusepruned is set, while an unpruned backend is always accepted, and that
+// the errors are classified.
+func TestCheckPrunedBackend(t *testing.T) {
+	t.Parallel()
+
+	unpruned := &mockBlockChainInfoSource{
+		info: &btcjson.GetBlockChainInfoResult{
+			Blocks:  1000,
+			Headers: 1000,
+		},
+	}
+	pruned := &mockBlockChainInfoSource{
+		info: &btcjson.GetBlockChainInfoResult{
+			Blocks:      1000,
+			Headers:     1000,
+			Pruned:      true,
+			PruneHeight: 600,
+		},
+	}
+	unreachable := &mockBlockChainInfoSource{
+		err: errors.New("connection refused"),
+	}
+
+	tests := []struct {
+		name         string
+		source       *mockBlockChainInfoSource
+		refusePruned bool
+		kind         error
+	}{
+		{
+			name:   "unpruned",
+			source: unpruned,
+		},
+		{
+			name:         "unpruned refuse pruned",
+			source:       unpruned,
+			refusePruned: true,
+		},
+		{
+			name:   "pruned",
+			source: pruned,
+		},
+		{
+			name:         "pruned refuse pruned",
+			source:       pruned,
+			refusePruned: true,
+			kind:         ErrInvalidChainConfig,
+		},
+		{
+			name:   "unreachable",
+			source: unreachable,
+			kind:   ErrBackendUnreachable,
+		},
+	}
+
+	for _, test := range tests {
+		err := checkPrunedBackend(
+			test.source, "bitcoind", test.refusePruned,
+		)
+		switch {
+		case test.kind == nil && err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+
+		case test.kind != nil && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+
+		case chainErrorKind(err) != test.kind:
+			t.Fatalf("%s: expected error of kind %v, got %v",
+				test.name, test.kind, chainErrorKind(err))
+		}
+	}
+
+	// The error for a pruned backend should name the prune height along
+	// with the option to unset in order to proceed anyway.
+	err := checkPrunedBackend(pruned, "litecoind", true)
+	if err == nil || !strings.Contains(err.Error(), "600") ||
+		!strings.Contains(err.Error(), "litecoind.refusepruned") {
+
+		t.Fatalf("expected error to name prune height and option, "+
+			"got: %v", err)
+	}
+}
+
+// TestCheckZMQSelfTestGenerate ensures that zmqselftestgenerate is only
+// accepted along with zmqselftest on bitcoin's regtest network.
+func TestCheckZMQSelfTestGenerate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		bitcoindMode *bitcoindConfig
+		chainCfg     *chainConfig
+		primaryChain chainCode
+		err          string
+	}{
+		{
+			name:         "unset",
+			bitcoindMode: &bitcoindConfig{ZMQSelfTest: true},
+			chainCfg:     &chainConfig{Node: "bitcoind"},
+			primaryChain: bitcoinChain,
+		},
+		{
+			name: "regtest",
+			bitcoindMode: &bitcoindConfig{
+				ZMQSelfTest:         true,
+				ZMQSelfTestGenerate: true,
+			},
+			chainCfg: &chainConfig{
+				Node: "bitcoind", RegTest: true,
+			},
+			primaryChain: bitcoinChain,
+		},
+		{
+			name: "without self-test",
+			bitcoindMode: &bitcoindConfig{
+				ZMQSelfTestGenerate: true,
+			},
+			chainCfg: &chainConfig{
+				Node: "bitcoind", RegTest: true,
+			},
+			primaryChain: bitcoinChain,
+			err:          "bitcoind.zmqselftest",
+		},
+		{
+			name: "testnet",
+			bitcoindMode: &bitcoindConfig{
+				ZMQSelfTest:         true,
+				ZMQSelfTestGenerate: true,
+			},
+			chainCfg: &chainConfig{
+				Node: "bitcoind", TestNet3: true,
+			},
+			primaryChain: bitcoinChain,
+			err:          "regtest",
+		},
+		{
+			name: "litecoin regtest",
+			bitcoindMode: &bitcoindConfig{
+				ZMQSelfTest:         true,
+				ZMQSelfTestGenerate: true,
+			},
+			chainCfg: &chainConfig{
+				Node: "litecoind", RegTest: true,
+			},
+			primaryChain: litecoinChain,
+			err:          "litecoind.zmqselftestgenerate",
+		},
+	}
+
+	for _, test := range tests {
+		err := checkZMQSelfTestGenerate(
+			test.bitcoindMode, test.chainCfg, test.primaryChain,
+		)
+		switch {
+		case test.err == "" && err != nil:
+			t.Fatalf("%v: unexpected error: %v", test.name, err)
+
+		case test.err != "" && (err == nil ||
+			!strings.Contains(err.Error(), test.err)):
+
+			t.Fatalf("%v: expected error containing %q, got: %v",
+				test.name, test.err, err)
+		}
+	}
+}
+
+// TestCheckClockSkew ensures that a local clock skewed against the median time
+// of the backend's chain tip is reported as an error only if strict checking
+// is enabled, while acceptable skew is tolerated.
+func TestCheckClockSkew(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1540000000, 0)
+	backendAt := func(medianTime time.Time,
+		synced bool) *mockBlockChainInfoSource {
+
+		info := &btcjson.GetBlockChainInfoResult{
+			Blocks:     100,
+			Headers:    100,
+			MedianTime: medianTime.Unix(),
+		}
+		if !synced {
+			info.Headers = 200
+		}
+		return &mockBlockChainInfoSource{info: info}
+	}
+
+	tests := []struct {
+		name     string
+		source   *mockBlockChainInfoSource
+		chainCfg *chainConfig
+		valid    bool
+	}{
+		{
+			name:   "median time an hour ago",
+			source: backendAt(now.Add(-time.Hour), true),
+			valid:  true,
+		},
+		{
+			name:   "median time slightly ahead",
+			source: backendAt(now.Add(5*time.Minute), true),
+			valid:  true,
+		},
+		{
+			name:   "local clock behind",
+			source: backendAt(now.Add(time.Hour), true),
+			valid:  false,
+		},
+		{
+			name:   "local clock ahead",
+			source: backendAt(now.Add(-3*time.Hour), true),
+			valid:  false,
+		},
+		{
+			name:   "local clock ahead while syncing",
+			source: backendAt(now.Add(-3*time.Hour), false),
+			valid:  true,
+		},
+		{
+			name:   "local clock behind with larger max skew",
+			source: backendAt(now.Add(time.Hour), true),
+			chainCfg: &chainConfig{
+				MaxClockSkew: 2 * time.Hour,
+			},
+			valid: true,
+		},
+		{
+			name:     "check disabled",
+			source:   backendAt(now.Add(time.Hour), true),
+			chainCfg: &chainConfig{},
+			valid:    true,
+		},
+		{
+			name:   "regtest",
+			source: backendAt(now.Add(-24*time.Hour), true),
+			chainCfg: &chainConfig{
+				RegTest:      true,
+				MaxClockSkew: defaultMaxClockSkew,
+			},
+			valid: true,
+		},
+		{
+			name: "unreachable",
+			source: &mockBlockChainInfoSource{
+				err: errors.New("connection refused"),
+			},
+			valid: false,
+		},
+	}
+
+	for _, test := range tests {
+		chainCfg := test.chainCfg
+		if chainCfg == nil {
+			chainCfg = &chainConfig{
+				MaxClockSkew: defaultMaxClockSkew,
+			}
+		}
+		chainCfg.Node = "bitcoind"
+
+		// Without strict checking, excessive skew should merely be
+		// logged.
+		chainCfg.StrictClockSkew = false
+		err := checkClockSkew(test.source, chainCfg, now)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+
+		chainCfg.StrictClockSkew = true
+		err = checkClockSkew(test.source, chainCfg, now)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+		}
+	}
+}
+
+// mockBlockHeaderSource is a blockHeaderSource serving the headers of a chain
+// whose blocks are identified by their height.
+type mockBlockHeaderSource struct {
+	headers []*wire.BlockHeader
+}
+
+func (m *mockBlockHeaderSource) GetBlockHash(height int64) (*chainhash.Hash,
+	error) {
+
+	if height >= int64(len(m.headers)) {
+		return nil, errors.New("block number out of range")
+	}
+
+	hash := m.headers[height].BlockHash()
+	return &hash, nil
+}
+
+func (m *mockBlockHeaderSource) GetBlockHeader(
+	hash *chainhash.Hash) (*wire.BlockHeader, error) {
+
+	for _, header := range m.headers {
+		if header.BlockHash() == *hash {
+			return header, nil
+		}
+	}
+
+	return nil, errors.New("block not found")
+}
+
+// TestWalletBirthday ensures that a configured birthday block is resolved to
+// the timestamp of the block at that height, while the passed birthday is used
+// if none was configured.
+func TestWalletBirthday(t *testing.T) {
+	t.Parallel()
+
+	genesis := time.Unix(1231006505, 0)
+	source := &mockBlockHeaderSource{}
+	for i := 0; i < 10; i++ {
+		source.headers = append(source.headers, &wire.BlockHeader{
+			Timestamp: genesis.Add(time.Duration(i) * 10 *
+				time.Minute),
+		})
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		birthdayBlock uint32
+		birthday      time.Time
+		valid         bool
+	}{
+		{
+			name:     "no birthday block",
+			birthday: now,
+			valid:    true,
+		},
+		{
+			name:          "birthday block",
+			birthdayBlock: 6,
+			birthday:      genesis.Add(time.Hour),
+			valid:         true,
+		},
+		{
+			name:          "unknown birthday block",
+			birthdayBlock: 10,
+		},
+	}
+
+	for _, test := range tests {
+		birthday, err := walletBirthday(
+			source, test.birthdayBlock, now,
+		)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unable to resolve birthday: %v",
+				test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+		}
+
+		if !birthday.Equal(test.birthday) {
+			t.Fatalf("%s: expected birthday %v, got %v", test.name,
+				test.birthday, birthday)
+		}
+	}
+}
+
+// TestChainControlHealthCheck ensures that the health check of the chain
+// control only succeeds once the backend is reachable and synced.
+func TestChainControlHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		source  *mockBlockChainInfoSource
+		healthy bool
+	}{
+		{
+			name: "synced",
+			source: &mockBlockChainInfoSource{
+				info: &btcjson.GetBlockChainInfoResult{
+					Blocks:  1000,
+					Headers: 1000,
+				},
+			},
+			healthy: true,
+		},
+		{
+			name: "syncing",
+			source: &mockBlockChainInfoSource{
+				info: &btcjson.GetBlockChainInfoResult{
+					Blocks:  500,
+					Headers: 1000,
+				},
+			},
+			healthy: false,
+		},
+		{
+			name: "unreachable",
+			source: &mockBlockChainInfoSource{
+				err: errors.New("connection refused"),
+			},
+			healthy: false,
+		},
+	}
+
+	for _, test := range tests {
+		cc := &chainControl{
+			syncStatus: blockChainInfoSyncStatus(test.source),
+		}
+
+		err := cc.HealthCheck(context.Background())
+		switch {
+		case test.healthy && err != nil:
+			t.Fatalf("%s: expected backend to be healthy, got: %v",
+				test.name, err)
+		case !test.healthy && err == nil:
+			t.Fatalf("%s: expected backend to be unhealthy",
+				test.name)
+		}
+	}
+
+	// A backend that doesn't respond should fail the health check once
+	// the context is cancelled.
+	block := make(chan struct{})
+	defer close(block)
+	cc := &chainControl{
+		syncStatus: func() (bool, error) {
+			<-block
+			return true, nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 50*time.Millisecond,
+	)
+	defer cancel()
+
+	if err := cc.HealthCheck(ctx); err == nil {
+		t.Fatalf("expected health check to fail once the context " +
+			"expired")
+	}
+}
+
+// mockBestBlockSource is a bestBlockSource which serves a static tip.
+type mockBestBlockSource struct {
+	hash   chainhash.Hash
+	height int32
+	err    error
+}
+
+func (m *mockBestBlockSource) GetBestBlockHash() (*chainhash.Hash, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &m.hash, nil
+}
+
+func (m *mockBestBlockSource) GetBlockHeaderVerbose(hash *chainhash.Hash) (
+	*btcjson.GetBlockHeaderVerboseResult, error) {
+
+	if *hash != m.hash {
+		return nil, fmt.Errorf("block %v not found", hash)
+	}
+
+	return &btcjson.GetBlockHeaderVerboseResult{
+		Hash:   hash.String(),
+		Height: m.height,
+	}, nil
+}
+
+// mockNeutrinoBestBlockSource is a neutrinoBestBlockSource which serves a
+// static tip.
+type mockNeutrinoBestBlockSource struct {
+	bestBlock *waddrmgr.BlockStamp
+	err       error
+}
+
+func (m *mockNeutrinoBestBlockSource) BestBlock() (*waddrmgr.BlockStamp,
+	error) {
+
+	return m.bestBlock, m.err
+}
+
+// TestChainControlBestBlock ensures that the chain control reports the tip of
+// each type of backend, and fails if the backend is unable to serve it.
+func TestChainControlBestBlock(t *testing.T) {
+	t.Parallel()
+
+	tipHash := chainhash.Hash{0x01, 0x02, 0x03}
+	const tipHeight = 543210
+
+	tests := []struct {
+		name      string
+		bestBlock func() (chainhash.Hash, int32, error)
+		valid     bool
+	}{
+		{
+			name: "rpc",
+			bestBlock: rpcBestBlock(&mockBestBlockSource{
+				hash:   tipHash,
+				height: tipHeight,
+			}),
+			valid: true,
+		},
+		{
+			name: "rpc unreachable",
+			bestBlock: rpcBestBlock(&mockBestBlockSource{
+				err: errors.New("connection refused"),
+			}),
+			valid: false,
+		},
+		{
+			name: "neutrino",
+			bestBlock: neutrinoBestBlock(
+				&mockNeutrinoBestBlockSource{
+					bestBlock: &waddrmgr.BlockStamp{
+						Hash:   tipHash,
+						Height: tipHeight,
+					},
+				},
+			),
+			valid: true,
+		},
+		{
+			name: "neutrino failure",
+			bestBlock: neutrinoBestBlock(
+				&mockNeutrinoBestBlockSource{
+					err: errors.New("db closed"),
+				},
+			),
+			valid: false,
+		},
+		{
+			name:  "unsupported",
+			valid: false,
+		},
+	}
+
+	for _, test := range tests {
+		cc := &chainControl{
+			bestBlock: test.bestBlock,
+		}
+
+		hash, height, err := cc.BestBlock()
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unable to query best block: %v",
+				test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+
+		case !test.valid:
+			continue
+		}
+
+		if hash != tipHash || height != tipHeight {
+			t.Fatalf("%s: expected tip %v at height %d, got %v at "+
+				"height %d", test.name, tipHash, tipHeight,
+				hash, height)
+		}
+	}
+}
+
+// TestQueryBestBlockTimeout ensures that a best block query is abandoned if
+// the backend doesn't respond in time.
+func TestQueryBestBlockTimeout(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	_, _, err := queryBestBlock(func() (chainhash.Hash, int32, error) {
+		<-block
+		return chainhash.Hash{}, 0, nil
+	}, 50*time.Millisecond)
+	if err == nil {
+		t.Fatalf("expected best block query to time out")
+	}
+}
+
+// spikingFeeEstimator is a live fee estimator whose fee rate may be raised,
+// and whose backend may become unreachable. It counts the number of estimates
+// it has been queried for.
+type spikingFeeEstimator struct {
+	lnwallet.StaticFeeEstimator
+
+	numQueries int
+	err        error
+}
+
+func (s *spikingFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	s.numQueries++
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	return s.FeePerKW, nil
+}
+
+// TestChainControlRefreshFeeEstimate ensures that a forced refresh queries the
+// backend of the live fee estimator right away, replacing its cached estimate,
+// while it's a no-op for static fee estimates.
+func TestChainControlRefreshFeeEstimate(t *testing.T) {
+	t.Parallel()
+
+	// Without a live fee estimator, there's nothing to refresh.
+	static := lnwallet.StaticFeeEstimator{FeePerKW: 2500}
+	cc := &chainControl{
+		feeEstimator: static,
+		feeRefresher: refreshableFeeEstimator(static),
+	}
+	if err := cc.RefreshFeeEstimate(); err != nil {
+		t.Fatalf("unable to refresh static fee estimate: %v", err)
+	}
+
+	backend := &spikingFeeEstimator{
+		StaticFeeEstimator: lnwallet.StaticFeeEstimator{
+			FeePerKW: 2500,
+		},
+	}
+	cache := lnwallet.NewCachedFeeEstimator(backend, time.Hour)
+	cc = &chainControl{
+		feeEstimator: cache,
+		feeRefresher: refreshableFeeEstimator(cache),
+	}
+
+	assertFeeRate := func(expected lnwallet.SatPerKWeight,
+		expectedQueries int) {
+
+		t.Helper()
+
+		feeRate, err := cc.feeEstimator.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("unable to estimate fee rate: %v", err)
+		}
+		if feeRate != expected {
+			t.Fatalf("expected fee rate %v, got %v", expected,
+				feeRate)
+		}
+		if backend.numQueries != expectedQueries {
+			t.Fatalf("expected %d queries, got %d",
+				expectedQueries, backend.numQueries)
+		}
+	}
+
+	// Once fees spike, the cached estimate should be served until it's
+	// refreshed.
+	assertFeeRate(2500, 1)
+	backend.FeePerKW = 10000
+	assertFeeRate(2500, 1)
+
+	// A forced refresh should query the backend right away, and replace
+	// the cached estimate.
+	if err := cc.RefreshFeeEstimate(); err != nil {
+		t.Fatalf("unable to refresh fee estimate: %v", err)
+	}
+	assertFeeRate(10000, 2)
+
+	// If the backend can't be queried, its error should be returned.
+	backend.err = errors.New("backend unreachable")
+	err := cc.RefreshFeeEstimate()
+	if err == nil || !strings.Contains(err.Error(), "backend unreachable") {
+		t.Fatalf("expected backend error, got: %v", err)
+	}
+}
+
+// TestNewConfTargets ensures that the chain control reports the confirmation
+// target configured for each type of on-chain operation, while those that
+// weren't configured fall back to a single global target.
+func TestNewConfTargets(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		chainCfg *chainConfig
+		expected ConfTargets
+	}{
+		{
+			name:     "default targets",
+			chainCfg: &chainConfig{},
+			expected: ConfTargets{
+				FundingConfTarget: defaultConfTarget,
+				CloseConfTarget:   defaultConfTarget,
+				SweepConfTarget:   defaultConfTarget,
+			},
+		},
+		{
+			name: "global target",
+			chainCfg: &chainConfig{
+				FeeEstimateConfTarget: 3,
+			},
+			expected: ConfTargets{
+				FundingConfTarget: 3,
+				CloseConfTarget:   3,
+				SweepConfTarget:   3,
+			},
+		},
+		{
+			name: "operation targets",
+			chainCfg: &chainConfig{
+				FundingConfTarget: 2,
+				CloseConfTarget:   144,
+			},
+			expected: ConfTargets{
+				FundingConfTarget: 2,
+				CloseConfTarget:   144,
+				SweepConfTarget:   defaultConfTarget,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		cc := &chainControl{
+			confTargets: newConfTargets(test.chainCfg),
+		}
+		confTargets := cc.ConfTargets()
+		if confTargets != test.expected {
+			t.Fatalf("%s: expected conf targets %+v, got %+v",
+				test.name, test.expected, confTargets)
+		}
+	}
+}
+
+// TestDefaultRoutingPolicy ensures that the chain control reports the routing
+// policy set through the config of the primary chain, while an unknown chain
+// is rejected.
+func TestDefaultRoutingPolicy(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config{
+		Bitcoin: &chainConfig{
+			MinHTLC:       1000,
+			BaseFee:       1000,
+			FeeRate:       1,
+			TimeLockDelta: 144,
+		},
+		Litecoin: &chainConfig{
+			MinHTLC:       2000,
+			BaseFee:       500,
+			FeeRate:       10,
+			TimeLockDelta: 576,
+		},
+	}
+
+	tests := []struct {
+		name         string
+		primaryChain chainCode
+		expected     htlcswitch.ForwardingPolicy
+		valid        bool
+	}{
+		{
+			name:         "bitcoin",
+			primaryChain: bitcoinChain,
+			expected: htlcswitch.ForwardingPolicy{
+				MinHTLC:       1000,
+				BaseFee:       1000,
+				FeeRate:       1,
+				TimeLockDelta: 144,
+			},
+			valid: true,
+		},
+		{
+			name:         "litecoin",
+			primaryChain: litecoinChain,
+			expected: htlcswitch.ForwardingPolicy{
+				MinHTLC:       2000,
+				BaseFee:       500,
+				FeeRate:       10,
+				TimeLockDelta: 576,
+			},
+			valid: true,
+		},
+		{
+			name:         "unknown chain",
+			primaryChain: chainCode(99),
+		},
+	}
+
+	for _, test := range tests {
+		policy, err := defaultRoutingPolicy(cfg, test.primaryChain)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unable to obtain routing policy: %v",
+				test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected unknown chain to be rejected",
+				test.name)
+
+		case !test.valid:
+			continue
+		}
+
+		cc := &chainControl{routingPolicy: policy}
+		if policy := cc.RoutingPolicy(); policy != test.expected {
+			t.Fatalf("%s: expected policy %v, got %v", test.name,
+				test.expected, policy)
+		}
+	}
+}
+
+// TestChainControlUpdateRoutingPolicy ensures that an updated routing policy
+// is reflected by the chain control, while an invalid one is rejected without
+// replacing the current policy.
+func TestChainControlUpdateRoutingPolicy(t *testing.T) {
+	t.Parallel()
+
+	initialPolicy := htlcswitch.ForwardingPolicy{
+		MinHTLC:       1000,
+		BaseFee:       1000,
+		FeeRate:       1,
+		TimeLockDelta: 144,
+	}
+	cc := &chainControl{
+		routingPolicy: initialPolicy,
+	}
+
+	// Links may be set up concurrently to the update, so we'll read the
+	// policy while updating it to detect any races.
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+				cc.RoutingPolicy()
+			}
+		}
+	}()
+
+	newPolicy := htlcswitch.ForwardingPolicy{
+		MinHTLC:       2000,
+		BaseFee:       500,
+		FeeRate:       10,
+		TimeLockDelta: 40,
+	}
+	err := cc.UpdateRoutingPolicy(newPolicy)
+	close(quit)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("unable to update routing policy: %v", err)
+	}
+	if policy := cc.RoutingPolicy(); policy != newPolicy {
+		t.Fatalf("expected policy %v, got %v", newPolicy, policy)
+	}
+
+	invalidPolicy := newPolicy
+	invalidPolicy.TimeLockDelta = minTimeLockDelta - 1
+	if err := cc.UpdateRoutingPolicy(invalidPolicy); err == nil {
+		t.Fatalf("expected policy with time lock delta %d to be "+
+			"rejected", invalidPolicy.TimeLockDelta)
+	}
+	if policy := cc.RoutingPolicy(); policy != newPolicy {
+		t.Fatalf("expected policy %v to be retained, got %v",
+			newPolicy, policy)
+	}
+}
+
+// TestConnectWithRetry ensures that connecting to the chain backend is retried
+// up to the configured number of times, and that the error of the last attempt
+// is returned once all retries are exhausted.
+func TestConnectWithRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		retryAttempts uint32
+		numFailures   int
+		numAttempts   int
+		success       bool
+	}{
+		{
+			name:          "no retries",
+			retryAttempts: 0,
+			numFailures:   1,
+			numAttempts:   1,
+			success:       false,
+		},
+		{
+			name:          "success after retries",
+			retryAttempts: 3,
+			numFailures:   2,
+			numAttempts:   3,
+			success:       true,
+		},
+		{
+			name:          "retries exhausted",
+			retryAttempts: 2,
+			numFailures:   5,
+			numAttempts:   3,
+			success:       false,
+		},
+	}
+
+	for _, test := range tests {
+		var numAttempts int
+		connect := func() error {
+			numAttempts++
+			if numAttempts <= test.numFailures {
+				return fmt.Errorf("attempt %d failed",
+					numAttempts)
+			}
+
+			return nil
+		}
+
+		err := connectWithRetry(
+			context.Background(), test.retryAttempts,
+			time.Millisecond, connect,
+		)
+		switch {
+		case test.success && err != nil:
+			t.Fatalf("%s: unable to connect: %v", test.name, err)
+
+		case !test.success && err == nil:
+			t.Fatalf("%s: expected connection to fail", test.name)
+
+		case !test.success:
+			lastErr := fmt.Sprintf("attempt %d failed",
+				test.numAttempts)
+			if err.Error() != lastErr {
+				t.Fatalf("%s: expected error of last attempt, "+
+					"got: %v", test.name, err)
+			}
+		}
+
+		if numAttempts != test.numAttempts {
+			t.Fatalf("%s: expected %d attempts, got %d", test.name,
+				test.numAttempts, numAttempts)
+		}
+	}
+}
+
+// TestConnectWithRetryCanceled ensures that no further connection attempts
+// are made once the context is canceled while backing off.
+func TestConnectWithRetryCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var numAttempts int
+	connect := func() error {
+		numAttempts++
+		cancel()
+		return errors.New("backend unreachable")
+	}
+
+	start := time.Now()
+	err := connectWithRetry(ctx, 10, time.Minute, connect)
+	if err == nil {
+		t.Fatalf("expected connection to be canceled")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatalf("back off wasn't abandoned once canceled")
+	}
+	if numAttempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", numAttempts)
+	}
+	if !strings.Contains(err.Error(), "backend unreachable") {
+		t.Fatalf("expected error of last attempt, got: %v", err)
+	}
+}
+
+// TestRunWithContext ensures that starting a subsystem is abandoned once the
+// context is canceled, and that the subsystem is stopped again once its start
+// up completes after all.
+func TestRunWithContext(t *testing.T) {
+	t.Parallel()
+
+	// A subsystem that starts up in time should have its result passed
+	// through.
+	startErr := errors.New("start failed")
+	err := runWithContext(context.Background(), func() error {
+		return startErr
+	}, nil)
+	if err != startErr {
+		t.Fatalf("expected start error, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	run := func() error {
+		cancel()
+		<-started
+		return nil
+	}
+	abort := func() {
+		close(aborted)
+	}
+
+	err = runWithContext(ctx, run, abort)
+	if err != context.Canceled {
+		t.Fatalf("expected start up to be canceled, got: %v", err)
+	}
+
+	// Once the start up completes, the subsystem should be stopped.
+	close(started)
+	select {
+	case <-aborted:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("subsystem wasn't stopped after late start up")
+	}
+}
+
+// blockingWallet is a stub of the LightningWallet whose start up blocks until
+// it's unblocked, such as during a rescan against a slow backend.
+type blockingWallet struct {
+	unblock  chan struct{}
+	shutdown chan struct{}
+}
+
+func (w *blockingWallet) Startup() error {
+	<-w.unblock
+	return nil
+}
+
+func (w *blockingWallet) Shutdown() error {
+	close(w.shutdown)
+	return nil
+}
+
+// TestStartLightningWallet ensures that the wallet's start up is abandoned
+// with a descriptive error once the configured timeout expires, and that the
+// wallet is shut down once it starts up after all, while the start up remains
+// unbounded without a timeout.
+func TestStartLightningWallet(t *testing.T) {
+	t.Parallel()
+
+	newWallet := func() *blockingWallet {
+		return &blockingWallet{
+			unblock:  make(chan struct{}),
+			shutdown: make(chan struct{}),
+		}
+	}
+
+	// A wallet that starts up within the timeout should be left running.
+	lnWallet := newWallet()
+	close(lnWallet.unblock)
+	err := startLightningWallet(
+		context.Background(), lnWallet.Startup,
+		stopFunc(lnWallet.Shutdown), time.Second,
+	)
+	if err != nil {
+		t.Fatalf("unable to start wallet: %v", err)
+	}
+	select {
+	case <-lnWallet.shutdown:
+		t.Fatalf("wallet shut down after starting up in time")
+	default:
+	}
+
+	// A wallet that blocks past the timeout should result in a timeout
+	// error, and be shut down once it starts up after all.
+	lnWallet = newWallet()
+	err = startLightningWallet(
+		context.Background(), lnWallet.Startup,
+		stopFunc(lnWallet.Shutdown), 50*time.Millisecond,
+	)
+	if err == nil ||
+		!strings.Contains(err.Error(), "walletstartuptimeout") {
+
+		t.Fatalf("expected start up timeout error, got: %v", err)
+	}
+	close(lnWallet.unblock)
+	select {
+	case <-lnWallet.shutdown:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("wallet wasn't shut down after late start up")
+	}
+
+	// Canceling the context should be reported as is rather than as a
+	// timeout.
+	lnWallet = newWallet()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = startLightningWallet(
+		ctx, lnWallet.Startup, stopFunc(lnWallet.Shutdown), time.Minute,
+	)
+	if err != context.Canceled {
+		t.Fatalf("expected start up to be canceled, got: %v", err)
+	}
+	close(lnWallet.unblock)
+
+	// Without a timeout, the wallet should be waited for however long its
+	// start up takes.
+	lnWallet = newWallet()
+	time.AfterFunc(100*time.Millisecond, func() {
+		close(lnWallet.unblock)
+	})
+	err = startLightningWallet(
+		context.Background(), lnWallet.Startup,
+		stopFunc(lnWallet.Shutdown), 0,
+	)
+	if err != nil {
+		t.Fatalf("unable to start wallet: %v", err)
+	}
+	select {
+	case <-lnWallet.shutdown:
+		t.Fatalf("wallet shut down without a timeout")
+	default:
+	}
+}
+
+// TestPartialCleanUp ensures that the subsystems started while setting up the
+// chain control are stopped in reverse order, unless the setup completed.
+func TestPartialCleanUp(t *testing.T) {
+	t.Parallel()
+
+	var (
+		stopped []int
+		started partialCleanUp
+	)
+	for i := 0; i < 3; i++ {
+		i := i
+		started.add(func() {
+			stopped = append(stopped, i)
+		})
+	}
+
+	started.run()
+	if !reflect.DeepEqual(stopped, []int{2, 1, 0}) {
+		t.Fatalf("expected subsystems to be stopped in reverse "+
+			"order, got %v", stopped)
+	}
+
+	stopped = nil
+	started.disarm()
+	started.run()
+	if len(stopped) != 0 {
+		t.Fatalf("expected no subsystems to be stopped once "+
+			"disarmed, got %v", stopped)
+	}
+}
+
+// TestNodeBackendType ensures that each of the supported nodes maps to the
+// correct BackendType, which is exposed through the chain control.
+func TestNodeBackendType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		node        string
+		backendType BackendType
+	}{
+		{node: "btcd", backendType: BackendBtcd},
+		{node: "ltcd", backendType: BackendBtcd},
+		{node: "bitcoind", backendType: BackendBitcoind},
+		{node: "litecoind", backendType: BackendBitcoind},
+		{node: "neutrino", backendType: BackendNeutrino},
+	}
+
+	for _, test := range tests {
+		backendType, err := nodeBackendType(test.node)
+		if err != nil {
+			t.Fatalf("%v: unable to get backend type: %v",
+				test.node, err)
+		}
+
+		cc := &chainControl{backendType: backendType}
+		if cc.BackendType() != test.backendType {
+			t.Fatalf("%v: expected backend type %v, got %v",
+				test.node, test.backendType, cc.BackendType())
+		}
+	}
+
+	if _, err := nodeBackendType("kekcoind"); err == nil {
+		t.Fatalf("expected error for unknown node")
+	}
+}
+
+// TestBtcdRPCWSEndpoint ensures that a custom websocket endpoint of btcd is
+// passed to the RPC clients, and that the default endpoint is used otherwise.
+func TestBtcdRPCWSEndpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		endpoint   string
+		expected   string
+		walletHost string
+		valid      bool
+	}{
+		{
+			endpoint:   "",
+			expected:   "ws",
+			walletHost: "btcd:8334",
+			valid:      true,
+		},
+		{
+			endpoint:   "ws",
+			expected:   "ws",
+			walletHost: "btcd:8334",
+			valid:      true,
+		},
+		{
+			endpoint:   "/btcd/ws",
+			expected:   "btcd/ws",
+			walletHost: "btcd:8334/btcd",
+			valid:      true,
+		},
+		{
+			endpoint: "/",
+			valid:    false,
+		},
+		{
+			endpoint: "btcd/websocket",
+			valid:    false,
+		},
+		{
+			endpoint: "btcd/ws?user=lnd",
+			valid:    false,
+		},
+	}
+
+	for _, test := range tests {
+		btcdMode := &btcdConfig{
+			RPCUser:       "user",
+			RPCPass:       "pass",
+			RPCWSEndpoint: test.endpoint,
+		}
+		rpcConfig, err := newBtcdRPCConfig(
+			btcdMode, "btcd:8334", []byte("cert"),
+		)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%q: unexpected error: %v", test.endpoint, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%q: expected error", test.endpoint)
+
+		case !test.valid:
+			continue
+		}
+
+		if rpcConfig.Endpoint != test.expected {
+			t.Fatalf("%q: expected endpoint %v, got %v",
+				test.endpoint, test.expected,
+				rpcConfig.Endpoint)
+		}
+		if rpcConfig.Host != "btcd:8334" || rpcConfig.User != "user" ||
+			rpcConfig.Pass != "pass" {
+
+			t.Fatalf("%q: unexpected rpc config: %+v",
+				test.endpoint, rpcConfig)
+		}
+
+		walletHost := btcdWalletHost("btcd:8334", rpcConfig.Endpoint)
+		if walletHost != test.walletHost {
+			t.Fatalf("%q: expected wallet host %v, got %v",
+				test.endpoint, test.walletHost, walletHost)
+		}
+	}
+}
+
+// TestValidateChainConfig ensures that the configuration of each of the chain
+// backends is validated without connecting to it, and that all of the problems
+// found are reported.
+func TestValidateChainConfig(t *testing.T) {
+	defer func(params bitcoinNetParams) {
+		activeNetParams = params
+	}(activeNetParams)
+	activeNetParams = bitcoinTestNetParams
+
+	const onionHost = "3g2upl4pq6kufc4m.onion"
+
+	tests := []struct {
+		name      string
+		node      string
+		btcd      *btcdConfig
+		bitcoind  *bitcoindConfig
+		neutrino  *neutrinoConfig
+		torActive bool
+		errs      []string
+	}{
+		{
+			name: "valid btcd",
+			node: "btcd",
+			btcd: &btcdConfig{
+				RPCHost:    "localhost",
+				RPCUser:    "user",
+				RPCPass:    "pass",
+				RawRPCCert: string(newTestCertPEM(t)),
+			},
+		},
+		{
+			name: "invalid btcd",
+			node: "btcd",
+			btcd: &btcdConfig{
+				RPCHost:       "3g2upl4pq6kufc4m.onion",
+				RPCUser:       "user",
+				RPCPass:       "pass",
+				RPCCert:       "/nonexistent/rpc.cert",
+				RPCWSEndpoint: "btcd/websocket",
+			},
+			errs: []string{
+				"unable to load RPC certificate",
+				"requires tor.active",
+				"rpcwsendpoint",
+			},
+		},
+		{
+			name: "btcd on onion host through tor",
+			node: "btcd",
+			btcd: &btcdConfig{
+				RPCHost:    "3g2upl4pq6kufc4m.onion",
+				RPCUser:    "user",
+				RPCPass:    "pass",
+				RawRPCCert: string(newTestCertPEM(t)),
+			},
+			torActive: true,
+		},
+		{
+			name: "btcd without tls on loopback",
+			node: "btcd",
+			btcd: &btcdConfig{
+				RPCHost:    "127.0.0.1",
+				RPCUser:    "user",
+				RPCPass:    "pass",
+				RPCCert:    "/nonexistent/rpc.cert",
+				DisableTLS: true,
+			},
+		},
+		{
+			name: "btcd without tls on remote host",
+			node: "btcd",
+			btcd: &btcdConfig{
+				RPCHost:    "10.0.0.1",
+				RPCUser:    "user",
+				RPCPass:    "pass",
+				DisableTLS: true,
+			},
+			errs: []string{"allowremotenotls"},
+		},
+		{
+			name: "valid bitcoind",
+			node: "bitcoind",
+			bitcoind: &bitcoindConfig{
+				RPCHost:        "localhost",
+				RPCUser:        "user",
+				RPCPass:        "pass",
+				ZMQPubRawBlock: "tcp://127.0.0.1:28332",
+				ZMQPubRawTx:    "tcp://127.0.0.1:28333",
+			},
+		},
+		{
+			name: "invalid bitcoind",
+			node: "bitcoind",
+			bitcoind: &bitcoindConfig{
+				RPCHost:        "primary,3g2upl4pq6kufc4m.onion",
+				RPCUser:        "user",
+				RPCPass:        "pass",
+				ZMQPubRawBlock: "tcp://primary:28332",
+				ZMQPubRawTx:    "tcp://primary:28333",
+			},
+			errs: []string{"bitcoind.zmqpubrawblock"},
+		},
+		{
+			name: "bitcoind on onion host without tor",
+			node: "bitcoind",
+			bitcoind: &bitcoindConfig{
+				RPCHost:        onionHost,
+				RPCUser:        "user",
+				RPCPass:        "pass",
+				ZMQPubRawBlock: "tcp://" + onionHost + ":28332",
+				ZMQPubRawTx:    "tcp://127.0.0.1:28333",
+			},
+			errs: []string{
+				onionHost + ":18332",
+				"tcp://" + onionHost + ":28332",
+			},
+		},
+		{
+			name: "bitcoind on onion host through tor",
+			node: "bitcoind",
+			bitcoind: &bitcoindConfig{
+				RPCHost:        onionHost,
+				RPCUser:        "user",
+				RPCPass:        "pass",
+				ZMQPubRawBlock: "tcp://" + onionHost + ":28332",
+				ZMQPubRawTx:    "tcp://" + onionHost + ":28333",
+			},
+			torActive: true,
+		},
+		{
+			name:     "valid neutrino",
+			node:     "neutrino",
+			neutrino: &neutrinoConfig{},
+		},
+		{
+			name: "invalid neutrino",
+			node: "neutrino",
+			neutrino: &neutrinoConfig{
+				PersistentPeerFile: "/nonexistent/peers",
+			},
+			errs: []string{"/nonexistent/peers"},
+		},
+		{
+			name: "neutrino without dns seeding or peers",
+			node: "neutrino",
+			neutrino: &neutrinoConfig{
+				DisableDNSSeed: true,
+			},
+			errs: []string{"neutrino.nodnsseed"},
+		},
+	}
+
+	for _, test := range tests {
+		cfg := &config{
+			Bitcoin:      &chainConfig{Active: true, Node: test.node},
+			Litecoin:     &chainConfig{},
+			BtcdMode:     test.btcd,
+			BitcoindMode: test.bitcoind,
+			NeutrinoMode: test.neutrino,
+			Tor:          &torConfig{Active: test.torActive},
+		}
+
+		err := validateChainConfig(cfg)
+		switch {
+		case len(test.errs) == 0 && err != nil:
+			t.Fatalf("%v: unexpected error: %v", test.name, err)
+
+		case len(test.errs) != 0 && err == nil:
+			t.Fatalf("%v: expected error", test.name)
+		}
+
+		for _, expected := range test.errs {
+			if !strings.Contains(err.Error(), expected) {
+				t.Fatalf("%v: expected error to contain %q, "+
+					"got: %v", test.name, expected, err)
+			}
+		}
+	}
+}
+
+// newTestCertPEM returns a PEM-encoded self-signed certificate.
+func newTestCertPEM(t *testing.T) []byte {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "btcd"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	derBytes, err := x509.CreateCertificate(
+		rand.Reader, template, template, &priv.PublicKey, priv,
+	)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: derBytes,
+	})
+}
+
+// TestDecodeRawRPCCert ensures that a certificate chain set through
+// rawrpccert is accepted as is, or hex or base64 encoded, and that malformed
+// chains are rejected.
+func TestDecodeRawRPCCert(t *testing.T) {
+	t.Parallel()
+
+	// We'll use a chain of two certificates, as is the case with an
+	// intermediate CA.
+	certChain := append(newTestCertPEM(t), newTestCertPEM(t)...)
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: []byte("key"),
+	})
+	invalidCert := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: []byte("not a certificate"),
+	})
+
+	tests := []struct {
+		name    string
+		rawCert string
+		valid   bool
+	}{
+		{
+			name:    "pem",
+			rawCert: string(certChain),
+			valid:   true,
+		},
+		{
+			name:    "hex",
+			rawCert: hex.EncodeToString(certChain),
+			valid:   true,
+		},
+		{
+			name:    "base64",
+			rawCert: base64.StdEncoding.EncodeToString(certChain),
+			valid:   true,
+		},
+		{
+			name:    "not encoded",
+			rawCert: "not a certificate!",
+			valid:   false,
+		},
+		{
+			name:    "no pem blocks",
+			rawCert: hex.EncodeToString([]byte("not pem")),
+			valid:   false,
+		},
+		{
+			name:    "private key",
+			rawCert: string(keyPEM),
+			valid:   false,
+		},
+		{
+			name:    "malformed certificate",
+			rawCert: string(append(certChain, invalidCert...)),
+			valid:   false,
+		},
+	}
+
+	for _, test := range tests {
+		rpcCert, err := decodeRawRPCCert(test.rawCert)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%v: unable to decode cert: %v", test.name,
+				err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%v: expected error", test.name)
+
+		case test.valid && !bytes.Equal(rpcCert, certChain):
+			t.Fatalf("%v: expected decoded cert chain to match",
+				test.name)
+		}
+	}
+}
+
+// TestCheckRPCCertValidity ensures that an expired or not yet valid RPC
+// certificate is rejected with an error stating when it's valid, while a valid
+// one is accepted.
+func TestCheckRPCCertValidity(t *testing.T) {
+	t.Parallel()
+
+	// The certificate is valid for an hour from now, so we'll check it at
+	// different times to cover its validity window.
+	rpcCert := newTestCertPEM(t)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected string
+	}{
+		{
+			name: "valid",
+			now:  now.Add(30 * time.Minute),
+		},
+		{
+			name:     "expired",
+			now:      now.Add(2 * time.Hour),
+			expected: "btcd RPC cert expired on",
+		},
+		{
+			name:     "not yet valid",
+			now:      now.Add(-time.Hour),
+			expected: "btcd RPC cert isn't valid until",
+		},
+	}
+
+	for _, test := range tests {
+		err := checkRPCCertValidity("btcd", rpcCert, test.now)
+		switch {
+		case test.expected == "" && err != nil:
+			t.Fatalf("%s: expected cert to be valid, got: %v",
+				test.name, err)
+
+		case test.expected != "" && (err == nil ||
+			!strings.Contains(err.Error(), test.expected)):
+
+			t.Fatalf("%s: expected error containing %q, got: %v",
+				test.name, test.expected, err)
+		}
+	}
+
+	// Without TLS, no certificate is loaded, which is always valid.
+	if err := checkRPCCertValidity("btcd", nil, now); err != nil {
+		t.Fatalf("expected missing cert to be accepted, got: %v", err)
+	}
+}
+
+// TestWalletCoinType ensures that the coin type configured for a chain
+// overrides the one of the active network, which is used otherwise.
+func TestWalletCoinType(t *testing.T) {
+	defer func(params bitcoinNetParams) {
+		activeNetParams = params
+	}(activeNetParams)
+
+	for _, params := range []bitcoinNetParams{
+		bitcoinMainNetParams, bitcoinTestNetParams,
+	} {
+		activeNetParams = params
+
+		coinType := walletCoinType(&chainConfig{})
+		if coinType != params.CoinType {
+			t.Fatalf("%v: expected network coin type %v, got %v",
+				params.Name, params.CoinType, coinType)
+		}
+
+		coinType = walletCoinType(&chainConfig{CoinType: 1337})
+		if coinType != 1337 {
+			t.Fatalf("%v: expected configured coin type 1337, "+
+				"got %v", params.Name, coinType)
+		}
+	}
+}
+
+// TestWalletAddressType ensures that the configured address type is mapped to
+// the one of the wallet, defaulting to p2wkh, and that unsupported types,
+// including p2tr, are rejected.
+func TestWalletAddressType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		addrType string
+		expected lnwallet.AddressType
+		valid    bool
+	}{
+		{
+			addrType: "",
+			expected: lnwallet.WitnessPubKey,
+			valid:    true,
+		},
+		{
+			addrType: "p2wkh",
+			expected: lnwallet.WitnessPubKey,
+			valid:    true,
+		},
+		{
+			addrType: "np2wkh",
+			expected: lnwallet.NestedWitnessPubKey,
+			valid:    true,
+		},
+		{
+			addrType: "p2tr",
+			valid:    false,
+		},
+		{
+			addrType: "p2pkh",
+			valid:    false,
+		},
+	}
+
+	for _, test := range tests {
+		addrType, err := walletAddressType(test.addrType)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%q: unable to select address type: %v",
+				test.addrType, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%q: expected address type to be rejected",
+				test.addrType)
+
+		case test.valid && addrType != test.expected:
+			t.Fatalf("%q: expected address type %v, got %v",
+				test.addrType, test.expected, addrType)
+		}
+	}
+}
+
+// TestNewBitcoindConn ensures that the connection the chain notifier and the
+// chain view are created from reads from bitcoind's ZMQ endpoints with the
+// configured deadline, or the default one if none was configured.
+func TestNewBitcoindConn(t *testing.T) {
+	t.Parallel()
+
+	backend := bitcoindBackend{
+		rpcHost:        "127.0.0.1:8332",
+		zmqPubRawBlock: "tcp://127.0.0.1:28332",
+		zmqPubRawTx:    "tcp://127.0.0.1:28333",
+	}
+
+	tests := []struct {
+		name             string
+		zmqReadDeadline  time.Duration
+		expectedDeadline time.Duration
+	}{
+		{
+			name:             "default deadline",
+			expectedDeadline: defaultZMQReadDeadline,
+		},
+		{
+			name:             "configured deadline",
+			zmqReadDeadline:  2 * time.Second,
+			expectedDeadline: 2 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		bitcoindMode := &bitcoindConfig{
+			RPCUser:         "user",
+			RPCPass:         "pass",
+			ZMQReadDeadline: test.zmqReadDeadline,
+		}
+
+		var (
+			params   []string
+			deadline time.Duration
+		)
+		newConn := func(_ *chaincfg.Params, host, user, pass,
+			zmqBlockHost, zmqTxHost string,
+			zmqReadDeadline time.Duration) (*chain.BitcoindConn,
+			error) {
+
+			params = []string{
+				host, user, pass, zmqBlockHost, zmqTxHost,
+			}
+			deadline = zmqReadDeadline
+			return &chain.BitcoindConn{}, nil
+		}
+
+		_, err := newBitcoindConn(
+			newConn, &chaincfg.RegressionNetParams, backend,
+			bitcoindMode,
+		)
+		if err != nil {
+			t.Fatalf("%s: unable to create connection: %v",
+				test.name, err)
+		}
+
+		if deadline != test.expectedDeadline {
+			t.Fatalf("%s: expected ZMQ read deadline %v, got %v",
+				test.name, test.expectedDeadline, deadline)
+		}
+		expectedParams := []string{
+			backend.rpcHost, bitcoindMode.RPCUser,
+			bitcoindMode.RPCPass, backend.zmqPubRawBlock,
+			backend.zmqPubRawTx,
+		}
+		if !reflect.DeepEqual(params, expectedParams) {
+			t.Fatalf("%s: expected connection parameters %v, "+
+				"got %v", test.name, expectedParams, params)
+		}
+	}
+}
+
+// TestBitcoindEstimateMode ensures that the configured estimation mode is
+// mapped onto the one requested from bitcoind, with bitcoind's default mode
+// being used if none was configured, and that unknown modes are rejected.
+func TestBitcoindEstimateMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode         string
+		estimateMode string
+		valid        bool
+	}{
+		{
+			mode:         "",
+			estimateMode: "",
+			valid:        true,
+		},
+		{
+			mode:         "conservative",
+			estimateMode: lnwallet.EstimateModeConservative,
+			valid:        true,
+		},
+		{
+			mode:         "economical",
+			estimateMode: lnwallet.EstimateModeEconomical,
+			valid:        true,
+		},
+		{
+			mode:  "ECONOMICAL",
+			valid: false,
+		},
+		{
+			mode:  "unset",
+			valid: false,
+		},
+	}
+
+	for _, test := range tests {
+		estimateMode, err := bitcoindEstimateMode(test.mode)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("unexpected error for mode %q: %v", test.mode,
+				err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("expected error for mode %q", test.mode)
+		}
+
+		if estimateMode != test.estimateMode {
+			t.Fatalf("expected estimation mode %q for %q, got %q",
+				test.estimateMode, test.mode, estimateMode)
+		}
+	}
+}
+
+// TestStaticFeeRate ensures that the static fee rate configured for a chain
+// overrides the chain's default, and is used by the static fee estimator on
+// simnet and regtest, which don't provide live fee estimates. On simnet, the
+// rate configured for it takes precedence.
+func TestStaticFeeRate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		chainCfg     *chainConfig
+		primaryChain chainCode
+		feePerKW     lnwallet.SatPerKWeight
+	}{
+		{
+			name:         "bitcoin default",
+			chainCfg:     &chainConfig{RegTest: true},
+			primaryChain: bitcoinChain,
+			feePerKW:     defaultBitcoinStaticFeePerKW,
+		},
+		{
+			name:         "litecoin default",
+			chainCfg:     &chainConfig{RegTest: true},
+			primaryChain: litecoinChain,
+			feePerKW:     defaultLitecoinStaticFeePerKW,
+		},
+		{
+			name: "bitcoin override",
+			chainCfg: &chainConfig{
+				RegTest: true, StaticFeeRate: 10,
+			},
+			primaryChain: bitcoinChain,
+			feePerKW:     2500,
+		},
+		{
+			name: "litecoin override",
+			chainCfg: &chainConfig{
+				RegTest: true, StaticFeeRate: 2,
+			},
+			primaryChain: litecoinChain,
+			feePerKW:     500,
+		},
+		{
+			name: "simnet override",
+			chainCfg: &chainConfig{
+				SimNet: true, StaticFeeRate: 10,
+				SimNetFeeRate: 4,
+			},
+			primaryChain: bitcoinChain,
+			feePerKW:     1000,
+		},
+		{
+			name: "simnet without override",
+			chainCfg: &chainConfig{
+				SimNet: true, StaticFeeRate: 10,
+			},
+			primaryChain: bitcoinChain,
+			feePerKW:     2500,
+		},
+		{
+			name: "simnet override on regtest",
+			chainCfg: &chainConfig{
+				RegTest: true, StaticFeeRate: 10,
+				SimNetFeeRate: 4,
+			},
+			primaryChain: bitcoinChain,
+			feePerKW:     2500,
+		},
+	}
+
+	for _, test := range tests {
+		if liveFeeEstimates(test.chainCfg) {
+			t.Fatalf("%v: expected no live fee estimates on "+
+				"simnet or regtest", test.name)
+		}
+
+		feeEstimator := lnwallet.StaticFeeEstimator{
+			FeePerKW: staticFeeRate(
+				test.chainCfg, test.primaryChain,
+			),
+		}
+		feePerKW, err := feeEstimator.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("%v: unable to estimate fee: %v", test.name,
+				err)
+		}
+		if feePerKW != test.feePerKW {
+			t.Fatalf("%v: expected fee rate %v, got %v", test.name,
+				test.feePerKW, feePerKW)
+		}
+	}
+}
+
+// TestBackendStaticFeeRate ensures that the static estimates of the btcd and
+// bitcoind backends use the configured static fee rate if set, and the
+// backend's fallback fee rate otherwise.
+func TestBackendStaticFeeRate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		chainCfg     *chainConfig
+		fallbackRate int64
+		feePerKW     lnwallet.SatPerKWeight
+	}{
+		{
+			name:     "default fallback",
+			chainCfg: &chainConfig{},
+			feePerKW: 6250,
+		},
+		{
+			name:         "fallback",
+			chainCfg:     &chainConfig{},
+			fallbackRate: 2,
+			feePerKW:     500,
+		},
+		{
+			name:         "static fee rate",
+			chainCfg:     &chainConfig{StaticFeeRate: 10},
+			fallbackRate: 2,
+			feePerKW:     2500,
+		},
+		{
+			name: "simnet fee rate",
+			chainCfg: &chainConfig{
+				SimNet: true, SimNetFeeRate: 4,
+			},
+			fallbackRate: 2,
+			feePerKW:     1000,
+		},
+		{
+			name: "simnet fee rate on testnet",
+			chainCfg: &chainConfig{
+				TestNet3: true, SimNetFeeRate: 4,
+			},
+			fallbackRate: 2,
+			feePerKW:     500,
+		},
+	}
+
+	for _, test := range tests {
+		feePerKW := backendStaticFeeRate(
+			test.chainCfg, bitcoinChain, test.fallbackRate,
+		)
+		if feePerKW != test.feePerKW {
+			t.Fatalf("%v: expected fee rate %v, got %v", test.name,
+				test.feePerKW, feePerKW)
+		}
+	}
+}
+
+// TestBtcdNoTLS ensures that no certificate is required to connect to btcd
+// without TLS, and that TLS can only be disabled for remote hosts if
+// explicitly allowed.
+func TestBtcdNoTLS(t *testing.T) {
+	t.Parallel()
+
+	// With TLS disabled, no certificate should be loaded, even if the
+	// certificate file doesn't exist.
+	btcdMode := &btcdConfig{
+		RPCUser:    "user",
+		RPCPass:    "pass",
+		RPCCert:    "/nonexistent/rpc.cert",
+		DisableTLS: true,
+	}
+	rpcCert, err := loadBtcdRPCCert(btcdMode)
+	if err != nil {
+		t.Fatalf("unable to load rpc cert: %v", err)
+	}
+	if rpcCert != nil {
+		t.Fatalf("expected no rpc cert, got %x", rpcCert)
+	}
+
+	rpcConfig, err := newBtcdRPCConfig(btcdMode, "127.0.0.1:18334", rpcCert)
+	if err != nil {
+		t.Fatalf("unable to create rpc config: %v", err)
+	}
+	if !rpcConfig.DisableTLS || rpcConfig.Certificates != nil {
+		t.Fatalf("expected rpc config without tls, got %+v",
+			rpcConfig)
+	}
+
+	tests := []struct {
+		host        string
+		allowRemote bool
+		valid       bool
+	}{
+		{host: "127.0.0.1:18334", valid: true},
+		{host: "127.0.0.2:18334", valid: true},
+		{host: "localhost:18334", valid: true},
+		{host: "[::1]:18334", valid: true},
+		{host: "10.0.0.1:18334", valid: false},
+		{host: "127.0.0.1.example.com:18334", valid: false},
+		{host: "10.0.0.1:18334", allowRemote: true, valid: true},
+	}
+	for _, test := range tests {
+		btcdMode.AllowRemoteNoTLS = test.allowRemote
+
+		err := checkBtcdNoTLS(btcdMode, test.host)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("expected %v to be allowed without tls, "+
+				"got: %v", test.host, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("expected %v to be rejected without tls",
+				test.host)
+		}
+	}
+
+	// Remote hosts are always allowed with TLS enabled.
+	btcdMode.DisableTLS = false
+	btcdMode.AllowRemoteNoTLS = false
+	if err := checkBtcdNoTLS(btcdMode, "10.0.0.1:18334"); err != nil {
+		t.Fatalf("expected remote host to be allowed with tls: %v",
+			err)
+	}
+}
@@ -5,23 +5,28 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
 	flags "github.com/jessevdk/go-flags"
 	"github.com/lightningnetwork/lnd/htlcswitch/hodl"
+	"github.com/lightningnetwork/lnd/keychain"
 	"github.com/lightningnetwork/lnd/lncfg"
 	"github.com/lightningnetwork/lnd/lnwire"
 	"github.com/lightningnetwork/lnd/routing"
@@ -61,6 +66,44 @@ const (
 
 	defaultBroadcastDelta = 10
 
+	// minFeeEstimateConfTarget and maxFeeEstimateConfTarget are the
+	// bounds of the confirmation target that can be configured for fee
+	// estimates. The upper bound matches the largest target supported by
+	// bitcoind's estimatesmartfee.
+	minFeeEstimateConfTarget = 1
+	maxFeeEstimateConfTarget = 1008
+
+	// defaultFeeCacheTTL is the default duration for which live fee
+	// estimates are cached.
+	defaultFeeCacheTTL = 30 * time.Second
+
+	// minFeePollInterval and maxFeePollInterval are the bounds of the
+	// interval at which live fee estimates can be polled. Polling more
+	// often than the lower bound would merely load the backend, while
+	// estimates older than the upper bound are likely stale.
+	minFeePollInterval = 5 * time.Second
+	maxFeePollInterval = time.Hour
+
+	// defaultMaxClockSkew is the default maximum skew between the local
+	// clock and the chain of the btcd/bitcoind backend.
+	defaultMaxClockSkew = 10 * time.Minute
+
+	// maxBitcoindIncludeDepth is the maximum depth of nested includeconf
+	// options we'll follow when reading bitcoind's configuration file.
+	maxBitcoindIncludeDepth = 8
+
+	// zmqIPCPrefix is the scheme prefix of ZMQ endpoints which are Unix
+	// domain sockets, rather than TCP endpoints.
+	zmqIPCPrefix = "ipc://"
+
+	// zmqTCPPrefix is the scheme prefix of ZMQ endpoints which are TCP
+	// endpoints.
+	zmqTCPPrefix = "tcp://"
+
+	// cookieRetryInterval is the interval at which we'll retry to read
+	// bitcoind's auth cookie while waiting for it to be written.
+	cookieRetryInterval = 250 * time.Millisecond
+
 	// minTimeLockDelta is the minimum timelock we require for incoming
 	// HTLCs on our channels.
 	minTimeLockDelta = 4
@@ -109,6 +152,55 @@ type chainConfig struct {
 	BaseFee             lnwire.MilliSatoshi `long:"basefee" description:"The base fee in millisatoshi we will charge for forwarding payments on our channels"`
 	FeeRate             lnwire.MilliSatoshi `long:"feerate" description:"The fee rate used when forwarding payments on our channels. The total fee charged is basefee + (amount * feerate / 1000000), where amount is the forwarded amount."`
 	TimeLockDelta       uint32              `long:"timelockdelta" description:"The CLTV delta we will subtract from a forwarded HTLC's timelock value"`
+
+	FeeEstimatorMode      string        `long:"feeestimatormode" description:"The source of on-chain fee estimates. auto uses live estimates from the backend if available and static estimates otherwise, static always uses static estimates at staticfeerate if set, or the backend's fallback fee rate otherwise, and rpc always uses live estimates, failing if the backend can't provide them." choice:"auto" choice:"static" choice:"rpc"`
+	FeeCacheTTL           time.Duration `long:"feecachettl" description:"The duration for which live fee estimates from the btcd/bitcoind backend are cached, to reduce the number of RPCs issued under load. Set to 0 to disable caching. Valid time units are {s, m, h}."`
+	FeeEstimateConfTarget uint32        `long:"feeestimateconftarget" description:"The confirmation target in blocks that all on-chain fee estimates will be requested for. Lower values result in more aggressive fee estimates. If not set, the target is chosen by each subsystem. Must be between 1 and 1008."`
+	MaxFeeRate            int64         `long:"maxfeerate" description:"The maximum fee rate in sat/vbyte that on-chain fee estimates are clamped to, to avoid paying excessive fees during fee spikes. If not set, no maximum is imposed."`
+	StaticFeeRate         int64         `long:"staticfeerate" description:"The fee rate in sat/vbyte used for on-chain fee estimates if no live estimates are available, e.g. on simnet and regtest, as well as for the static estimates of btcd/bitcoind if set. If not set, 50 sat/vbyte is used for bitcoin and 200 sat/vbyte for litecoin."`
+	FeeEstimatorWarmup    time.Duration `long:"feeestimatorwarmup" description:"The maximum time to wait at startup for the btcd/bitcoind backend to provide its first live fee estimate, as it may lack the data to do so right after starting, in which case the fallback fee rate is used. If no live estimate is provided in time, lnd proceeds with a warning. If not set, lnd doesn't wait. Valid time units are {s, m, h}."`
+	SimNetFeeRate         int64         `long:"simnetfeerate" description:"The fee rate in sat/vbyte used for on-chain fee estimates on simnet, taking precedence over staticfeerate there, e.g. for test harnesses to control the fees deterministically. If not set, staticfeerate or its default is used."`
+	MinRelayFeeFloor      int64         `long:"minrelayfeefloor" description:"The minimum fee rate in sat/vbyte that on-chain fee estimates are raised to, so our transactions are relayed. If not set, the minimum relay fee of the btcd/bitcoind backend is used, which is queried periodically, while neutrino uses 1 sat/vbyte. Takes precedence over maxfeerate."`
+
+	FeePollInterval time.Duration `long:"feepollinterval" description:"The interval at which live fee estimates from the btcd/bitcoind backend are refreshed in the background, for all confirmation targets requested so far. Takes precedence over feecachettl. Longer intervals reduce the load on the backend, while shorter ones keep the estimates fresh. If not set, estimates are queried on demand. Must be between 5s and 1h. Valid time units are {s, m, h}."`
+
+	MaxFeeEstimateAge time.Duration `long:"maxfeeestimateage" description:"The maximum age of the live fee estimates from the btcd/bitcoind backend. Once an estimate couldn't be refreshed for longer, fee queries fail loudly rather than returning it, and they also fail rather than resorting to the backend's fallback fee rate, so fee dependent operations don't proceed with fees that are likely to be off. Must exceed feepollinterval if set, and bounds feecachettl otherwise. Can't be combined with feeestimatormode=static or feeestimatorfallbacktostatic. If not set, stale and fallback estimates are used. Valid time units are {s, m, h}."`
+
+	FundingConfTarget uint32 `long:"fundingconftarget" description:"The default confirmation target in blocks of the fee estimates for the funding transactions of channels we open, e.g. a low one for fast confirmation. If not set, feeestimateconftarget or 6 blocks is used. Must be between 1 and 1008, and can't be combined with feeestimateconftarget."`
+	CloseConfTarget   uint32 `long:"closeconftarget" description:"The default confirmation target in blocks of the fee estimates for cooperative closes of our channels, e.g. a high one as they can be patient. If not set, feeestimateconftarget or 6 blocks is used. Must be between 1 and 1008, and can't be combined with feeestimateconftarget."`
+	SweepConfTarget   uint32 `long:"sweepconftarget" description:"The default confirmation target in blocks of the fee estimates for sweeps of our outputs, e.g. those of force closed channels. If not set, feeestimateconftarget or 6 blocks is used. Must be between 1 and 1008, and can't be combined with feeestimateconftarget."`
+
+	BirthdayBlock uint32 `long:"birthdayblock" description:"The height of the block at which the wallet was first used, whose timestamp is queried from the backend and used as the birthday of a wallet created at startup, e.g. with noseedbackup, to bound the rescan for its addresses. Wallets created from a seed use the seed's birthday instead. If not set, the wallet's creation time is used."`
+
+	MaxClockSkew    time.Duration `long:"maxclockskew" description:"The maximum skew tolerated at startup between the local clock and the chain of the btcd/bitcoind backend, based on the median time of its chain tip, as HTLC timeouts and CLTV deadlines depend on it. A warning is logged for excessive skew. Set to 0 to disable the check. Valid time units are {s, m, h}."`
+	StrictClockSkew bool          `long:"strictclockskew" description:"Fail to start, instead of logging a warning, if the local clock is skewed by more than maxclockskew."`
+
+	MaxReorgDepth uint32 `long:"maxreorgdepth" description:"The maximum number of blocks a chain reorganization may disconnect. The depth of each reorganization is logged, and once one exceeds the maximum, which is a sign of a misconfigured or attacked backend, lnd logs a critical error and shuts down. The limit is checked after the reorganization was already handled, so lnd may have acted on it before shutting down. If not set, reorganizations of any depth are processed."`
+
+	FeeEstimatorFallbackToStatic bool `long:"feeestimatorfallbacktostatic" description:"If the live fee estimator of the btcd/bitcoind backend fails to start, e.g. because the backend is too old to provide estimates, fall back to static estimates using the backend's fallback fee rate with a warning, instead of failing to start. Can't be combined with feeestimatormode=rpc."`
+
+	ConnectRetryAttempts uint32        `long:"connectretryattempts" description:"The number of times to retry to connect to the btcd/bitcoind backend at startup if it's unavailable, e.g. because it's still starting up. Retries back off exponentially. If not set, lnd exits if the first attempt fails."`
+	ConnectRetryDelay    time.Duration `long:"connectretrydelay" description:"The initial delay between two attempts to connect to the backend at startup, which is doubled after each attempt. Valid time units are {s, m, h}."`
+
+	MaxRPCConcurrency uint32 `long:"maxrpcconcurrency" description:"The maximum number of concurrent RPC calls lnd makes to the btcd/bitcoind backend on behalf of its subsystems, such as the chain queries and fee estimates of the wallet and channel operations. Calls beyond the limit wait until another one completes. If not set, the calls aren't limited."`
+
+	DisableAutoRPCConfig bool `long:"disableautorpcconfig" description:"Never read the btcd/bitcoind backend's configuration or auth cookie to obtain its RPC parameters, requiring them to be set explicitly instead."`
+
+	CoinType uint32 `long:"cointype" description:"The BIP44 coin type to derive the wallet's keys with, overriding the one of the selected network, e.g. for custom networks. Changing it for an existing wallet results in different keys being derived. If not set, the network's coin type is used."`
+
+	AddressType string `long:"addresstype" description:"The type of address the wallet generates for its own funds, such as the change of funding transactions and the delivery addresses of cooperative closes, either p2wkh or np2wkh. If not set, p2wkh is used." choice:"p2wkh" choice:"np2wkh"`
+
+	WalletStartupTimeout time.Duration `long:"walletstartuptimeout" description:"The maximum time to wait for the wallet to start up, which may take long while it rescans against a slow backend, before giving up and exiting with an error. If not set, lnd waits indefinitely. Valid time units are {s, m, h}."`
+
+	// CredentialProvider, if set, supplies the RPC credentials of the
+	// btcd/bitcoind backend in place of the config and the backend's
+	// files. It can only be set programmatically.
+	CredentialProvider CredentialProvider
+
+	// SecretKeyRing, if set, is used by the wallet to derive its keys in
+	// place of the default key ring backed by btcwallet, e.g. to keep them
+	// within an HSM. It can only be set programmatically.
+	SecretKeyRing keychain.SecretKeyRing
 }
 
 type neutrinoConfig struct {
@@ -117,24 +209,87 @@ type neutrinoConfig struct {
 	MaxPeers     int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
 	BanDuration  time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
+
+	DatabasePath       string `long:"dbpath" description:"Optional absolute path to neutrino's database file, e.g. to place it on a separate volume. If not set, it's stored within the chain's data directory."`
+	DatabaseBackend    string `long:"dbbackend" description:"Optional walletdb driver to use for neutrino's database. Defaults to bdb."`
+	FeeURL             string `long:"feeurl" description:"Optional URL of a mempool.space-style recommended fees endpoint, e.g. https://mempool.space/api/v1/fees/recommended, to obtain live fee estimates from. If not set, a static fee rate is used."`
+	Profile            string `long:"profile" description:"Optional name of a profile to keep neutrino's headers and database separate for, e.g. when several lnd instances share the data directory. Only letters, digits, - and _ are allowed. If not set, they're stored directly within the chain's data directory. Doesn't apply to a database placed through dbpath."`
+	SocksProxy         string `long:"socksproxy" description:"Optional SOCKS5 proxy as host:port to connect to neutrino's peers through exclusively, independent of the rest of lnd's networking. Credentials may be given as user:password@host:port. Hosts are resolved through the proxy using Tor's extension for this purpose, so peers must be given as IP addresses unless the proxy is Tor."`
+	PersistentPeerFile string `long:"persistentpeerfile" description:"Path to a file containing additional peers to connect with at startup, one host:port per line. Lines starting with # are ignored."`
+
+	DisableDNSSeed bool `long:"nodnsseed" description:"Disable the DNS seed lookups neutrino uses to discover peers, e.g. for air-gapped or privacy-sensitive deployments, such that it relies solely on the peers given through addpeer, connect and persistentpeerfile. At least one peer must be configured."`
+
+	ValidateFilterHeaders bool `long:"validatefilterheaders" description:"Validate at startup that the stored filter header chain is contiguous, as it may be corrupted by an unclean shutdown. If corruption is detected, lnd exits with instructions on how to recover."`
+	RebuildFilterHeaders  bool `long:"rebuildfilterheaders" description:"Validate the stored filter header chain at startup like validatefilterheaders, but remove neutrino's headers and database if corruption is detected, such that the headers are synced from scratch."`
+
+	FilterHeaderCheckpoints    []string `long:"filterheadercheckpoint" description:"A trusted filter header checkpoint as height:hash that the stored filter header chain must match at startup, to guard against headers obtained from malicious peers. May be specified multiple times, in ascending order of height."`
+	FilterHeaderCheckpointFile string   `long:"filterheadercheckpointfile" description:"Path to a file of trusted filter header checkpoints, one height:hash per line in ascending order of height, as an alternative to filterheadercheckpoint. Lines starting with # are ignored."`
+
+	MaxFilterCacheSize uint64 `long:"maxfiltercachesize" description:"The maximum size in bytes of the compact filters neutrino keeps in memory. Once reached, the least recently used filters are evicted, and need to be fetched from peers again when they're needed, e.g. for rescans, trading bandwidth and latency for memory on low-resource devices. Must be at least 1 MiB. If not set, neutrino's default of about 4 MB is used."`
+
+	AssertChainTip string `long:"assertchaintip" description:"A trusted block as height:hash that the chain must contain, e.g. for private or regtest networks. It's added to the network's checkpoints, such that peers advertising a divergent chain are disconnected while syncing the block headers, and overrides a checkpoint at the same height."`
+
+	UserAgentName     string   `long:"useragentname" description:"The user agent name neutrino advertises to its peers, e.g. to avoid being fingerprinted as neutrino. If not set, neutrino's default is used."`
+	UserAgentVersion  string   `long:"useragentversion" description:"The user agent version neutrino advertises to its peers. If not set, neutrino's default is used."`
+	UserAgentComments []string `long:"useragentcomment" description:"A comment appended to the user agent neutrino advertises to its peers, per BIP 14. May be specified multiple times. The user agent, including the name and version, may be at most 256 bytes long, and mustn't contain any of the characters reserved by BIP 14."`
 }
 
 type btcdConfig struct {
 	Dir        string `long:"dir" description:"The base directory that contains the node's data, logs, configuration file, etc."`
-	RPCHost    string `long:"rpchost" description:"The daemon's rpc listening address. If a port is omitted, then the default port for the selected chain parameters will be used."`
-	RPCUser    string `long:"rpcuser" description:"Username for RPC connections"`
-	RPCPass    string `long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
+	RPCHost    string `long:"rpchost" description:"The daemon's rpc listening address. If a port is omitted, then the default port for the selected chain parameters will be used. An onion address is connected to through Tor if tor.active is set, via a local tunnel, so the daemon's certificate must be valid for 127.0.0.1."`
+	RPCUser    string `long:"rpcuser" description:"Username for RPC connections. May reference an environment variable as $VARNAME or ${VARNAME}, with $$ escaping a literal $."`
+	RPCPass    string `long:"rpcpass" default-mask:"-" description:"Password for RPC connections. May reference an environment variable as $VARNAME or ${VARNAME}, with $$ escaping a literal $."`
 	RPCCert    string `long:"rpccert" description:"File containing the daemon's certificate file"`
-	RawRPCCert string `long:"rawrpccert" description:"The raw bytes of the daemon's PEM-encoded certificate chain which will be used to authenticate the RPC connection."`
+	RawRPCCert string `long:"rawrpccert" description:"The daemon's PEM-encoded certificate chain which will be used to authenticate the RPC connection, either as is, or hex or base64 encoded."`
+
+	ConfigFilePath string `long:"configfile" description:"The path of the daemon's configuration file to obtain the RPC credentials from, if it isn't the one within dir, e.g. because the daemon was started with a custom -C flag."`
+
+	RPCConnectTimeout time.Duration `long:"rpcconnecttimeout" description:"The maximum time to wait for the initial connection to the daemon's RPC server before giving up. If not set, lnd will wait indefinitely. Valid time units are {s, m, h}."`
+	FallbackFeeRate   int64         `long:"fallbackfeerate" description:"The fee rate in sat/vbyte to fall back to when the daemon is unable to provide a fee estimate. If not set, 25 sat/vbyte will be used."`
+	RPCWSEndpoint     string        `long:"rpcwsendpoint" description:"The path of the daemon's websocket endpoint, e.g. btcd/ws if it's mounted there by a reverse proxy. The last element of the path must be ws. Defaults to ws."`
+
+	DisableTLS       bool `long:"notls" description:"Connect to the daemon's RPC server without TLS, in which case no certificate is required. Only allowed for loopback hosts, unless allowremotenotls is set."`
+	AllowRemoteNoTLS bool `long:"allowremotenotls" description:"Allow notls to be set for a daemon that isn't reached through a loopback host, which exposes the RPC credentials and traffic in plaintext."`
+
+	ReloadCert bool `long:"reloadcert" description:"Watch the rpccert file for changes, as the daemon regenerates its certificate on restart, e.g. when rotating it. lnd then connects to the daemon through a local tunnel, which reconnects with the new certificate once the daemon presents it. Requires the certificate to be read from rpccert."`
 }
 
 type bitcoindConfig struct {
 	Dir            string `long:"dir" description:"The base directory that contains the node's data, logs, configuration file, etc."`
-	RPCHost        string `long:"rpchost" description:"The daemon's rpc listening address. If a port is omitted, then the default port for the selected chain parameters will be used."`
-	RPCUser        string `long:"rpcuser" description:"Username for RPC connections"`
-	RPCPass        string `long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
-	ZMQPubRawBlock string `long:"zmqpubrawblock" description:"The address listening for ZMQ connections to deliver raw block notifications"`
-	ZMQPubRawTx    string `long:"zmqpubrawtx" description:"The address listening for ZMQ connections to deliver raw transaction notifications"`
+	RPCHost        string `long:"rpchost" description:"The daemon's rpc listening address. If a port is omitted, then the default port for the selected chain parameters will be used. A comma-separated list of addresses may be set to fail over to the next node if one is unreachable, either at startup or once the active node repeatedly fails to respond, in which case rpcuser, rpcpass, zmqpubrawblock and zmqpubrawtx must be set explicitly, with a comma-separated ZMQ address for each of the nodes, in the same order. Onion addresses, including those of the ZMQ endpoints, are connected to through Tor if tor.active is set, via local tunnels."`
+	RPCUser        string `long:"rpcuser" description:"Username for RPC connections. May reference an environment variable as $VARNAME or ${VARNAME}, with $$ escaping a literal $."`
+	RPCPass        string `long:"rpcpass" default-mask:"-" description:"Password for RPC connections. May reference an environment variable as $VARNAME or ${VARNAME}, with $$ escaping a literal $."`
+	ZMQPubRawBlock string `long:"zmqpubrawblock" description:"The address listening for ZMQ connections to deliver raw block notifications, either tcp://host:port or ipc://path to connect through a Unix domain socket of a node running on the same host"`
+	ZMQPubRawTx    string `long:"zmqpubrawtx" description:"The address listening for ZMQ connections to deliver raw transaction notifications, either tcp://host:port or ipc://path to connect through a Unix domain socket of a node running on the same host"`
+
+	RPCConnectTimeout  time.Duration `long:"rpcconnecttimeout" description:"The maximum time to wait for the initial connection to the daemon's RPC server before giving up. If not set, lnd will wait indefinitely. Valid time units are {s, m, h}."`
+	CookieRetryTimeout time.Duration `long:"cookieretrytimeout" description:"How long to keep retrying to read the daemon's auth cookie at startup if it hasn't been written yet, e.g. when both daemons are started together. Valid time units are {s, m, h}."`
+	FallbackFeeRate    int64         `long:"fallbackfeerate" description:"The fee rate in sat/vbyte to fall back to when the daemon is unable to provide a fee estimate. If not set, 25 sat/vbyte will be used."`
+	EstimateMode       string        `long:"estimatemode" description:"The estimation mode live fee estimates are requested from the daemon's estimatesmartfee with. conservative is less responsive to short-term drops in fees, while economical may return lower estimates. If not set, the daemon's default mode is used." choice:"conservative" choice:"economical"`
+	ZMQReconnect       bool          `long:"zmqreconnect" description:"Resubscribe to the daemon's ZMQ endpoints with an exponential backoff once the connection to them is lost, e.g. as the daemon is restarted, and monitor them for stalled block notifications, resubscribing once the daemon is reachable again. Blocks missed in the meantime are caught up on once the next one is delivered."`
+	StrictCookiePerms  bool          `long:"strictcookieperms" description:"Refuse to use an auth cookie that is readable by users other than its owner, rather than only warning about it."`
+	PreflightCheck     bool          `long:"preflightcheck" description:"Make sure the daemon's RPC and ZMQ endpoints are reachable at startup, failing with a list of the unreachable endpoints otherwise."`
+	RefusePruned       bool          `long:"refusepruned" description:"Refuse to start if the daemon is pruned, rather than proceeding with a warning. Pruned blocks can't be retrieved, which may break channel operations that rely on historical blocks."`
+
+	DisableRegtestPortProbe bool `long:"disableregtestportprobe" description:"On regtest, don't probe which of the daemon's default RPC ports is open if rpchost lacks a port, using the port derived from the chain parameters instead. The probe gives up after 2s, but skipping it avoids the delay when the port is filtered."`
+
+	ZMQWatchdogInterval time.Duration `long:"zmqwatchdoginterval" description:"The interval at which the ZMQ connection is checked for stalled block notifications if zmqreconnect is set, by comparing the latest block delivered over ZMQ with the daemon's best block reported over RPC. Defaults to 1m. Valid time units are {s, m, h}."`
+	ZMQStaleThreshold   time.Duration `long:"zmqstalethreshold" description:"How long the blocks delivered over ZMQ may lag behind the daemon's best block without a new one being delivered, before the ZMQ connection is considered stalled and zmqreconnect resubscribes. Defaults to 2m. Valid time units are {s, m, h}."`
+
+	ZMQSelfTest         bool          `long:"zmqselftest" description:"Make sure a block is delivered over ZMQ at startup, failing otherwise. lnd waits for the next block to be mined, unless zmqselftestgenerate is set."`
+	ZMQSelfTestTimeout  time.Duration `long:"zmqselftesttimeout" description:"The maximum time zmqselftest waits for a block to be delivered over ZMQ. As blocks may take longer to be mined, it needs to be raised for the self-test to pass reliably on networks other than regtest with zmqselftestgenerate. Defaults to 2m. Valid time units are {s, m, h}."`
+	ZMQSelfTestGenerate bool          `long:"zmqselftestgenerate" description:"On bitcoin's regtest network, generate a block for zmqselftest rather than waiting for one to be mined. The block's reward is paid to an anyone-can-spend address. Requires zmqselftest."`
+
+	ZMQReadDeadline time.Duration `long:"zmqreaddeadline" description:"The deadline of each read from the daemon's ZMQ endpoints, after which lnd checks whether it's shutting down before reading again. Notifications that can't be read within it, e.g. large blocks during bursts over a slow link, may be dropped, so raising it improves their reliability at the cost of a slower shutdown. The high-water mark of the queue of notifications is set on the daemon's side through its zmqpubrawblockhwm and zmqpubrawtxhwm options. Defaults to 100ms. Valid time units are {ms, s, m, h}."`
+
+	UseCompactFilters bool `long:"usecompactfilters" description:"Match the blocks the chain view filters, e.g. while rescanning for the spends of channel outputs, against their BIP 158 compact filters obtained through the daemon's getblockfilter RPC, such that only blocks which may be relevant are fetched, reducing bandwidth. Requires the daemon to run with blockfilterindex=1 and to support getindexinfo. If the index isn't available or still syncing, lnd falls back to fetching each block with a warning."`
+
+	NotifierRPCHost string `long:"notifierrpchost" description:"The RPC address of the daemon used for chain notifications and the chain view, e.g. a dedicated node for block relay and validation, taking precedence over rpchost. Its ZMQ addresses are set through zmqpubrawblock and zmqpubrawtx. If only walletrpchost is set, it's used for both."`
+	WalletRPCHost   string `long:"walletrpchost" description:"The RPC address of the daemon serving the wallet, taking precedence over rpchost. Blocks and transactions are received over the ZMQ addresses set through zmqpubrawblock and zmqpubrawtx. If only notifierrpchost is set, it's used for both. The daemons must share their RPC credentials."`
+
+	RPCClientCert string `long:"rpcclientcert" description:"Path to a PEM-encoded TLS client certificate to present to the daemon's RPC server, e.g. when it's behind a proxy requiring mutual TLS. If set, RPC connections are made over TLS rather than plaintext, through a local tunnel for each RPC host. Requires rpcclientkey."`
+	RPCClientKey  string `long:"rpcclientkey" description:"Path to the PEM-encoded private key of the TLS client certificate set through rpcclientcert."`
+	RPCCACert     string `long:"rpccacert" description:"Path to the PEM-encoded CA certificate to verify the daemon's RPC server against when rpcclientcert is set. If not set, the system's root CAs are used."`
 }
 
 type autoPilotConfig struct {
@@ -225,6 +380,12 @@ type config struct {
 
 	NoSeedBackup bool `long:"noseedbackup" description:"If true, NO SEED WILL BE EXPOSED AND THE WALLET WILL BE ENCRYPTED USING THE DEFAULT PASSPHRASE -- EVER. THIS FLAG IS ONLY FOR TESTING AND IS BEING DEPRECATED."`
 
+	RecoveryScanBatchSize uint32 `long:"recoveryscanbatchsize" description:"The maximum number of addresses the wallet scans the chain for at once while recovering from a seed, to throttle the load on the backend with a large recovery window. If not set, all addresses of the recovery window are scanned for at once."`
+
+	WatchOnly bool `long:"watchonly" description:"Operate the wallet without unlocking it with its private passphrase, e.g. to only monitor the chain. All signing is disabled in this mode, so channels can't be opened and funds can't be spent. Requires an existing wallet."`
+
+	CheckConfig bool `long:"checkconfig" description:"Validate the configuration, including the RPC parameters, certificate and hosts of the chain backend, and exit without connecting to the backend or opening the wallet."`
+
 	TrickleDelay        int           `long:"trickledelay" description:"Time in milliseconds between each release of announcements to the network"`
 	InactiveChanTimeout time.Duration `long:"inactivechantimeout" description:"If a channel has been inactive for the set time, send a ChannelUpdate disabling it."`
 
@@ -259,11 +420,14 @@ func loadConfig() (*config, error) {
 		MaxLogFiles:    defaultMaxLogFiles,
 		MaxLogFileSize: defaultMaxLogFileSize,
 		Bitcoin: &chainConfig{
-			MinHTLC:       defaultBitcoinMinHTLCMSat,
-			BaseFee:       defaultBitcoinBaseFeeMSat,
-			FeeRate:       defaultBitcoinFeeRate,
-			TimeLockDelta: defaultBitcoinTimeLockDelta,
-			Node:          "btcd",
+			MinHTLC:          defaultBitcoinMinHTLCMSat,
+			BaseFee:          defaultBitcoinBaseFeeMSat,
+			FeeRate:          defaultBitcoinFeeRate,
+			TimeLockDelta:    defaultBitcoinTimeLockDelta,
+			Node:             "btcd",
+			FeeEstimatorMode: feeEstimatorModeAuto,
+			FeeCacheTTL:      defaultFeeCacheTTL,
+			MaxClockSkew:     defaultMaxClockSkew,
 		},
 		BtcdMode: &btcdConfig{
 			Dir:     defaultBtcdDir,
@@ -275,11 +439,14 @@ func loadConfig() (*config, error) {
 			RPCHost: defaultRPCHost,
 		},
 		Litecoin: &chainConfig{
-			MinHTLC:       defaultLitecoinMinHTLCMSat,
-			BaseFee:       defaultLitecoinBaseFeeMSat,
-			FeeRate:       defaultLitecoinFeeRate,
-			TimeLockDelta: defaultLitecoinTimeLockDelta,
-			Node:          "ltcd",
+			MinHTLC:          defaultLitecoinMinHTLCMSat,
+			BaseFee:          defaultLitecoinBaseFeeMSat,
+			FeeRate:          defaultLitecoinFeeRate,
+			TimeLockDelta:    defaultLitecoinTimeLockDelta,
+			Node:             "ltcd",
+			FeeEstimatorMode: feeEstimatorModeAuto,
+			FeeCacheTTL:      defaultFeeCacheTTL,
+			MaxClockSkew:     defaultMaxClockSkew,
 		},
 		LtcdMode: &btcdConfig{
 			Dir:     defaultLtcdDir,
@@ -402,9 +569,34 @@ func loadConfig() (*config, error) {
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
 	cfg.BtcdMode.Dir = cleanAndExpandPath(cfg.BtcdMode.Dir)
 	cfg.LtcdMode.Dir = cleanAndExpandPath(cfg.LtcdMode.Dir)
+	cfg.BtcdMode.ConfigFilePath = cleanAndExpandPath(
+		cfg.BtcdMode.ConfigFilePath,
+	)
+	cfg.LtcdMode.ConfigFilePath = cleanAndExpandPath(
+		cfg.LtcdMode.ConfigFilePath,
+	)
 	cfg.BitcoindMode.Dir = cleanAndExpandPath(cfg.BitcoindMode.Dir)
 	cfg.LitecoindMode.Dir = cleanAndExpandPath(cfg.LitecoindMode.Dir)
 	cfg.Tor.PrivateKeyPath = cleanAndExpandPath(cfg.Tor.PrivateKeyPath)
+	for _, bitcoindMode := range []*bitcoindConfig{
+		cfg.BitcoindMode, cfg.LitecoindMode,
+	} {
+		bitcoindMode.RPCClientCert = cleanAndExpandPath(
+			bitcoindMode.RPCClientCert,
+		)
+		bitcoindMode.RPCClientKey = cleanAndExpandPath(
+			bitcoindMode.RPCClientKey,
+		)
+		bitcoindMode.RPCCACert = cleanAndExpandPath(
+			bitcoindMode.RPCCACert,
+		)
+	}
+	cfg.NeutrinoMode.PersistentPeerFile = cleanAndExpandPath(
+		cfg.NeutrinoMode.PersistentPeerFile,
+	)
+	cfg.NeutrinoMode.DatabasePath = cleanAndExpandPath(
+		cfg.NeutrinoMode.DatabasePath,
+	)
 
 	// Ensure that the user didn't attempt to specify negative values for
 	// any of the autopilot params.
@@ -448,6 +640,23 @@ func loadConfig() (*config, error) {
 		cfg.Autopilot.MaxChannelSize = int64(maxFundingAmount)
 	}
 
+	// Ensure that the user didn't attempt to specify a negative fallback
+	// fee rate for any of the chain backends.
+	fallbackFeeRates := map[string]int64{
+		"btcd":      cfg.BtcdMode.FallbackFeeRate,
+		"ltcd":      cfg.LtcdMode.FallbackFeeRate,
+		"bitcoind":  cfg.BitcoindMode.FallbackFeeRate,
+		"litecoind": cfg.LitecoindMode.FallbackFeeRate,
+	}
+	for daemonName, feeRate := range fallbackFeeRates {
+		if feeRate < 0 {
+			str := "%s: %s.fallbackfeerate must be positive"
+			err := fmt.Errorf(str, funcName, daemonName)
+			fmt.Fprintln(os.Stderr, err)
+			return nil, err
+		}
+	}
+
 	// Validate the Tor config parameters.
 	socks, err := lncfg.ParseAddressString(
 		cfg.Tor.SOCKS, strconv.Itoa(defaultTorSOCKSPort),
@@ -555,6 +764,71 @@ func loadConfig() (*config, error) {
 				minTimeLockDelta)
 		}
 
+		err := validateFeeEstimateConfTarget(
+			cfg.Litecoin.FeeEstimateConfTarget,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: litecoin.%v", funcName, err)
+		}
+		err = validateOperationConfTargets(cfg.Litecoin)
+		if err != nil {
+			return nil, fmt.Errorf("%s: litecoin.%v", funcName, err)
+		}
+
+		if cfg.Litecoin.MaxFeeRate < 0 {
+			return nil, fmt.Errorf("%s: litecoin.maxfeerate must "+
+				"be positive", funcName)
+		}
+		if cfg.Litecoin.StaticFeeRate < 0 {
+			return nil, fmt.Errorf("%s: litecoin.staticfeerate "+
+				"must be positive", funcName)
+		}
+		if cfg.Litecoin.SimNetFeeRate < 0 {
+			return nil, fmt.Errorf("%s: litecoin.simnetfeerate "+
+				"must be positive", funcName)
+		}
+		if cfg.Litecoin.MinRelayFeeFloor < 0 {
+			return nil, fmt.Errorf("%s: litecoin.minrelayfeefloor "+
+				"must be positive", funcName)
+		}
+		err = validateFeePollInterval(cfg.Litecoin.FeePollInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%s: litecoin.%v", funcName, err)
+		}
+		err = validateMaxFeeEstimateAge(cfg.Litecoin)
+		if err != nil {
+			return nil, fmt.Errorf("%s: litecoin.%v", funcName, err)
+		}
+		if cfg.Litecoin.MaxClockSkew < 0 {
+			return nil, fmt.Errorf("%s: litecoin.maxclockskew "+
+				"must be positive", funcName)
+		}
+		if cfg.Litecoin.FeeEstimatorFallbackToStatic &&
+			cfg.Litecoin.FeeEstimatorMode == feeEstimatorModeRPC {
+
+			return nil, fmt.Errorf("%s: litecoin."+
+				"feeestimatorfallbacktostatic can't be used "+
+				"with feeestimatormode=%v", funcName,
+				feeEstimatorModeRPC)
+		}
+
+		if cfg.Litecoin.CoinType >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("%s: litecoin.cointype must be "+
+				"below %d", funcName,
+				hdkeychain.HardenedKeyStart)
+		}
+
+		_, err = walletAddressType(cfg.Litecoin.AddressType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: litecoin.%v", funcName, err)
+		}
+
+		_, err = bitcoindEstimateMode(cfg.LitecoindMode.EstimateMode)
+		if err != nil {
+			return nil, fmt.Errorf("%s: litecoind.%v", funcName,
+				err)
+		}
+
 		// Multiple networks can't be selected simultaneously.  Count
 		// number of network flags passed; assign active network params
 		// while we're at it.
@@ -598,13 +872,23 @@ func loadConfig() (*config, error) {
 		// bitcoin with the litecoin specific information.
 		applyLitecoinParams(&activeNetParams, &ltcParams)
 
+		err = checkBackendConflicts(
+			"litecoin", cfg.Litecoin.Node, "ltcd", cfg.LtcdMode,
+			"litecoind", cfg.LitecoindMode, cfg.NeutrinoMode,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", funcName, err)
+		}
+
 		switch cfg.Litecoin.Node {
 		case "ltcd":
 			err := parseRPCParams(cfg.Litecoin, cfg.LtcdMode,
 				litecoinChain, funcName)
 			if err != nil {
-				err := fmt.Errorf("unable to load RPC "+
-					"credentials for ltcd: %v", err)
+				err := wrapChainBackendError(
+					err, "unable to load RPC credentials "+
+						"for ltcd",
+				)
 				return nil, err
 			}
 		case "litecoind":
@@ -615,8 +899,10 @@ func loadConfig() (*config, error) {
 			err := parseRPCParams(cfg.Litecoin, cfg.LitecoindMode,
 				litecoinChain, funcName)
 			if err != nil {
-				err := fmt.Errorf("unable to load RPC "+
-					"credentials for litecoind: %v", err)
+				err := wrapChainBackendError(
+					err, "unable to load RPC credentials "+
+						"for litecoind",
+				)
 				return nil, err
 			}
 		default:
@@ -693,14 +979,88 @@ func loadConfig() (*config, error) {
 				minTimeLockDelta)
 		}
 
+		err := validateFeeEstimateConfTarget(
+			cfg.Bitcoin.FeeEstimateConfTarget,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bitcoin.%v", funcName, err)
+		}
+		err = validateOperationConfTargets(cfg.Bitcoin)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bitcoin.%v", funcName, err)
+		}
+
+		if cfg.Bitcoin.MaxFeeRate < 0 {
+			return nil, fmt.Errorf("%s: bitcoin.maxfeerate must "+
+				"be positive", funcName)
+		}
+		if cfg.Bitcoin.StaticFeeRate < 0 {
+			return nil, fmt.Errorf("%s: bitcoin.staticfeerate "+
+				"must be positive", funcName)
+		}
+		if cfg.Bitcoin.SimNetFeeRate < 0 {
+			return nil, fmt.Errorf("%s: bitcoin.simnetfeerate "+
+				"must be positive", funcName)
+		}
+		if cfg.Bitcoin.MinRelayFeeFloor < 0 {
+			return nil, fmt.Errorf("%s: bitcoin.minrelayfeefloor "+
+				"must be positive", funcName)
+		}
+		err = validateFeePollInterval(cfg.Bitcoin.FeePollInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bitcoin.%v", funcName, err)
+		}
+		err = validateMaxFeeEstimateAge(cfg.Bitcoin)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bitcoin.%v", funcName, err)
+		}
+		if cfg.Bitcoin.MaxClockSkew < 0 {
+			return nil, fmt.Errorf("%s: bitcoin.maxclockskew must "+
+				"be positive", funcName)
+		}
+		if cfg.Bitcoin.FeeEstimatorFallbackToStatic &&
+			cfg.Bitcoin.FeeEstimatorMode == feeEstimatorModeRPC {
+
+			return nil, fmt.Errorf("%s: bitcoin."+
+				"feeestimatorfallbacktostatic can't be used "+
+				"with feeestimatormode=%v", funcName,
+				feeEstimatorModeRPC)
+		}
+
+		if cfg.Bitcoin.CoinType >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("%s: bitcoin.cointype must be "+
+				"below %d", funcName,
+				hdkeychain.HardenedKeyStart)
+		}
+
+		_, err = walletAddressType(cfg.Bitcoin.AddressType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bitcoin.%v", funcName, err)
+		}
+
+		_, err = bitcoindEstimateMode(cfg.BitcoindMode.EstimateMode)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bitcoind.%v", funcName, err)
+		}
+
+		err = checkBackendConflicts(
+			"bitcoin", cfg.Bitcoin.Node, "btcd", cfg.BtcdMode,
+			"bitcoind", cfg.BitcoindMode, cfg.NeutrinoMode,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", funcName, err)
+		}
+
 		switch cfg.Bitcoin.Node {
 		case "btcd":
 			err := parseRPCParams(
 				cfg.Bitcoin, cfg.BtcdMode, bitcoinChain, funcName,
 			)
 			if err != nil {
-				err := fmt.Errorf("unable to load RPC "+
-					"credentials for btcd: %v", err)
+				err := wrapChainBackendError(
+					err, "unable to load RPC credentials "+
+						"for btcd",
+				)
 				return nil, err
 			}
 		case "bitcoind":
@@ -713,8 +1073,10 @@ func loadConfig() (*config, error) {
 				cfg.Bitcoin, cfg.BitcoindMode, bitcoinChain, funcName,
 			)
 			if err != nil {
-				err := fmt.Errorf("unable to load RPC "+
-					"credentials for bitcoind: %v", err)
+				err := wrapChainBackendError(
+					err, "unable to load RPC credentials "+
+						"for bitcoind",
+				)
 				return nil, err
 			}
 		case "neutrino":
@@ -1070,7 +1432,13 @@ func supportedSubsystems() []string {
 }
 
 func parseRPCParams(cConfig *chainConfig, nodeConfig interface{}, net chainCode,
-	funcName string) error {
+	funcName string) (err error) {
+
+	// Failures to obtain the credentials are classified as such below,
+	// while any other failure stems from an invalid config.
+	defer func() {
+		err = newChainBackendError(ErrInvalidChainConfig, err)
+	}()
 
 	// First, we'll check our node config to make sure the RPC parameters
 	// were set correctly. We'll also determine the path to the conf file
@@ -1078,12 +1446,6 @@ func parseRPCParams(cConfig *chainConfig, nodeConfig interface{}, net chainCode,
 	var daemonName, confDir, confFile string
 	switch conf := nodeConfig.(type) {
 	case *btcdConfig:
-		// If both RPCUser and RPCPass are set, we assume those
-		// credentials are good to use.
-		if conf.RPCUser != "" && conf.RPCPass != "" {
-			return nil
-		}
-
 		// Get the daemon name for displaying proper errors.
 		switch net {
 		case bitcoinChain:
@@ -1096,6 +1458,44 @@ func parseRPCParams(cConfig *chainConfig, nodeConfig interface{}, net chainCode,
 			confFile = "ltcd"
 		}
 
+		if conf.RPCHost != "" {
+			rpcHost, err := normalizeRPCHost(
+				daemonName+".rpchost", conf.RPCHost,
+			)
+			if err != nil {
+				return err
+			}
+			conf.RPCHost = rpcHost
+		}
+
+		rpcUser, rpcPass, err := resolveRPCCredentials(
+			daemonName, conf.RPCUser, conf.RPCPass,
+		)
+		if err != nil {
+			return err
+		}
+		conf.RPCUser, conf.RPCPass = rpcUser, rpcPass
+
+		// If a credential provider was supplied, it takes the place of
+		// both the config and btcd's files.
+		if cConfig.CredentialProvider != nil {
+			rpcUser, rpcPass, err := fetchRPCCredentials(
+				cConfig.CredentialProvider, net, daemonName,
+			)
+			if err != nil {
+				return err
+			}
+			conf.RPCUser, conf.RPCPass = rpcUser, rpcPass
+
+			return nil
+		}
+
+		// If both RPCUser and RPCPass are set, we assume those
+		// credentials are good to use.
+		if conf.RPCUser != "" && conf.RPCPass != "" {
+			return nil
+		}
+
 		// If only ONE of RPCUser or RPCPass is set, we assume the
 		// user did that unintentionally.
 		if conf.RPCUser != "" || conf.RPCPass != "" {
@@ -1104,6 +1504,93 @@ func parseRPCParams(cConfig *chainConfig, nodeConfig interface{}, net chainCode,
 		}
 
 	case *bitcoindConfig:
+		// Get the daemon name for displaying proper errors.
+		switch net {
+		case bitcoinChain:
+			daemonName = "bitcoind"
+			confDir = conf.Dir
+			confFile = "bitcoin"
+		case litecoinChain:
+			daemonName = "litecoind"
+			confDir = conf.Dir
+			confFile = "litecoin"
+		}
+
+		rpcHosts := splitCommaList(conf.RPCHost)
+		for i, rpcHost := range rpcHosts {
+			rpcHost, err := normalizeRPCHost(
+				daemonName+".rpchost", rpcHost,
+			)
+			if err != nil {
+				return err
+			}
+			rpcHosts[i] = rpcHost
+		}
+		conf.RPCHost = strings.Join(rpcHosts, ",")
+
+		// The nodes dedicated to chain notifications and the wallet
+		// are normalized just like the one set in rpchost.
+		if conf.NotifierRPCHost != "" {
+			conf.NotifierRPCHost, err = normalizeRPCHost(
+				daemonName+".notifierrpchost",
+				conf.NotifierRPCHost,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if conf.WalletRPCHost != "" {
+			conf.WalletRPCHost, err = normalizeRPCHost(
+				daemonName+".walletrpchost", conf.WalletRPCHost,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		rpcUser, rpcPass, err := resolveRPCCredentials(
+			daemonName, conf.RPCUser, conf.RPCPass,
+		)
+		if err != nil {
+			return err
+		}
+		conf.RPCUser, conf.RPCPass = rpcUser, rpcPass
+
+		// If a credential provider was supplied, it takes the place of
+		// both the config and bitcoind's files. As we won't read
+		// bitcoin.conf, the ZMQ options then need to be set explicitly.
+		if cConfig.CredentialProvider != nil {
+			if conf.ZMQPubRawBlock == "" || conf.ZMQPubRawTx == "" {
+				return fmt.Errorf("%[1]v.zmqpubrawblock and "+
+					"%[1]v.zmqpubrawtx must be set when "+
+					"using a credential provider",
+					daemonName)
+			}
+
+			rpcUser, rpcPass, err := fetchRPCCredentials(
+				cConfig.CredentialProvider, net, daemonName,
+			)
+			if err != nil {
+				return err
+			}
+			conf.RPCUser, conf.RPCPass = rpcUser, rpcPass
+		}
+
+		// Several nodes may be configured to fail over between, in
+		// which case the parameters can't be obtained automatically, as
+		// the local config only describes a single node.
+		if strings.Contains(conf.RPCHost, ",") {
+			if conf.RPCUser == "" || conf.RPCPass == "" {
+				return fmt.Errorf("%[1]v.rpcuser and "+
+					"%[1]v.rpcpass must be set when "+
+					"several %[1]v.rpchost are configured",
+					daemonName)
+			}
+
+			_, err := bitcoindBackends(daemonName, conf)
+			return err
+		}
+
 		// Ensure that if the ZMQ options are set, that they are not
 		// equal.
 		if conf.ZMQPubRawBlock != "" && conf.ZMQPubRawTx != "" {
@@ -1122,22 +1609,31 @@ func parseRPCParams(cConfig *chainConfig, nodeConfig interface{}, net chainCode,
 			return nil
 		}
 
-		// Get the daemon name for displaying proper errors.
-		switch net {
-		case bitcoinChain:
-			daemonName = "bitcoind"
-			confDir = conf.Dir
-			confFile = "bitcoin"
-		case litecoinChain:
-			daemonName = "litecoind"
-			confDir = conf.Dir
-			confFile = "litecoin"
+		// Ensure that any ZMQ options that were set are well formed,
+		// rather than having the notifier fail to connect much later.
+		if conf.ZMQPubRawBlock != "" {
+			err := checkZMQAddress(
+				daemonName+".zmqpubrawblock", conf.ZMQPubRawBlock,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if conf.ZMQPubRawTx != "" {
+			err := checkZMQAddress(
+				daemonName+".zmqpubrawtx", conf.ZMQPubRawTx,
+			)
+			if err != nil {
+				return err
+			}
 		}
 
 		// If not all of the parameters are set, we'll assume the user
-		// did this unintentionally.
-		if conf.RPCUser != "" || conf.RPCPass != "" ||
-			conf.ZMQPubRawBlock != "" || conf.ZMQPubRawTx != "" {
+		// did this unintentionally. The only exception is RPCPass,
+		// which needs to be set on its own if bitcoind is configured
+		// with hashed credentials through rpcauth.
+		if conf.RPCUser != "" || conf.ZMQPubRawBlock != "" ||
+			conf.ZMQPubRawTx != "" {
 
 			return fmt.Errorf("please set all or none of "+
 				"%[1]v.rpcuser, %[1]v.rpcpass, "+
@@ -1146,13 +1642,31 @@ func parseRPCParams(cConfig *chainConfig, nodeConfig interface{}, net chainCode,
 		}
 	}
 
+	// If automatic RPC configuration was disabled, we mustn't read any of
+	// the backend's files, so the parameters need to have been set
+	// explicitly.
+	if cConfig.DisableAutoRPCConfig {
+		opts := "%[2]v.rpcuser and %[2]v.rpcpass"
+		if _, ok := nodeConfig.(*bitcoindConfig); ok {
+			opts = "%[2]v.rpcuser, %[2]v.rpcpass, " +
+				"%[2]v.zmqpubrawblock and %[2]v.zmqpubrawtx"
+		}
+
+		return newChainBackendError(ErrCredentialsNotFound, fmt.Errorf(
+			"%[1]v: automatic RPC configuration is disabled, "+
+				"please set "+opts, funcName, daemonName,
+		))
+	}
+
 	// If we're in simnet mode, then the running btcd instance won't read
 	// the RPC credentials from the configuration. So if lnd wasn't
 	// specified the parameters, then we won't be able to start.
 	if cConfig.SimNet {
 		str := "%v: rpcuser and rpcpass must be set to your btcd " +
 			"node's RPC parameters for simnet mode"
-		return fmt.Errorf(str, funcName)
+		return newChainBackendError(
+			ErrCredentialsNotFound, fmt.Errorf(str, funcName),
+		)
 	}
 
 	fmt.Println("Attempting automatic RPC configuration to " + daemonName)
@@ -1161,30 +1675,142 @@ func parseRPCParams(cConfig *chainConfig, nodeConfig interface{}, net chainCode,
 	switch cConfig.Node {
 	case "btcd", "ltcd":
 		nConf := nodeConfig.(*btcdConfig)
-		rpcUser, rpcPass, err := extractBtcdRPCParams(confFile)
+
+		// The config file may live outside of the daemon's directory,
+		// in which case it must have been pointed to explicitly.
+		if nConf.ConfigFilePath != "" {
+			confFile = nConf.ConfigFilePath
+		}
+		provider := newBtcdCredentialProvider(confFile)
+		rpcUser, rpcPass, err := provider.Fetch(net)
 		if err != nil {
-			return fmt.Errorf("unable to extract RPC credentials:"+
-				" %v, cannot start w/o RPC connection",
-				err)
+			return newChainBackendError(
+				ErrCredentialsNotFound, fmt.Errorf("unable "+
+					"to extract RPC credentials: %v, "+
+					"cannot start w/o RPC connection", err),
+			)
 		}
 		nConf.RPCUser, nConf.RPCPass = rpcUser, rpcPass
 	case "bitcoind", "litecoind":
 		nConf := nodeConfig.(*bitcoindConfig)
 		rpcUser, rpcPass, zmqBlockHost, zmqTxHost, err :=
-			extractBitcoindRPCParams(confFile)
+			extractBitcoindRPCParams(
+				confFile, nConf.CookieRetryTimeout,
+				nConf.StrictCookiePerms, net,
+			)
 		if err != nil {
-			return fmt.Errorf("unable to extract RPC credentials:"+
-				" %v, cannot start w/o RPC connection",
-				err)
+			return newChainBackendError(
+				ErrCredentialsNotFound, fmt.Errorf("unable "+
+					"to extract RPC credentials: %v, "+
+					"cannot start w/o RPC connection", err),
+			)
+		}
+
+		// An empty password signals that bitcoind is configured with
+		// hashed credentials through rpcauth, in which case the
+		// password must have been set explicitly. Otherwise, it
+		// mustn't have been set on its own.
+		switch {
+		case rpcPass == "" && nConf.RPCPass == "":
+			return newChainBackendError(
+				ErrCredentialsNotFound, fmt.Errorf("%[1]v is "+
+					"configured with rpcauth, which only "+
+					"stores a hash of the RPC password, "+
+					"please set %[1]v.rpcpass to the "+
+					"password for rpc user %[2]v",
+					daemonName, rpcUser),
+			)
+
+		case rpcPass == "":
+			rpcPass = nConf.RPCPass
+
+		case nConf.RPCPass != "":
+			return fmt.Errorf("please set all or none of "+
+				"%[1]v.rpcuser, %[1]v.rpcpass, "+
+				"%[1]v.zmqpubrawblock, %[1]v.zmqpubrawtx",
+				daemonName)
 		}
+
 		nConf.RPCUser, nConf.RPCPass = rpcUser, rpcPass
 		nConf.ZMQPubRawBlock, nConf.ZMQPubRawTx = zmqBlockHost, zmqTxHost
+
+		// We'll also derive the address of the RPC server from the
+		// config, so we don't need to guess its port.
+		rpcHost, err := extractBitcoindRPCHost(confFile, nConf.RPCHost)
+		if err != nil {
+			return fmt.Errorf("unable to extract RPC host: %v", err)
+		}
+		nConf.RPCHost = rpcHost
 	}
 
 	fmt.Printf("Automatically obtained %v's RPC credentials\n", daemonName)
 	return nil
 }
 
+// checkBackendConflicts ensures that no options were set for any of the chain
+// backends other than the selected node, as this likely means that the user
+// intended to use a different backend. The names of the btcd-like and
+// bitcoind-like backends of the chain are used to name the conflicting
+// options.
+func checkBackendConflicts(chainName, node, btcdName string,
+	btcdMode *btcdConfig, bitcoindName string, bitcoindMode *bitcoindConfig,
+	neutrinoMode *neutrinoConfig) error {
+
+	// We'll gather the options that were set for each of the backends,
+	// keyed by the name of the node.
+	setOptions := make(map[string][]string)
+	addIfSet := func(nodeName, option, value string) {
+		if value != "" {
+			setOptions[nodeName] = append(
+				setOptions[nodeName], nodeName+"."+option,
+			)
+		}
+	}
+
+	addIfSet(btcdName, "rpcuser", btcdMode.RPCUser)
+	addIfSet(btcdName, "rpcpass", btcdMode.RPCPass)
+	addIfSet(btcdName, "configfile", btcdMode.ConfigFilePath)
+
+	addIfSet(bitcoindName, "rpcuser", bitcoindMode.RPCUser)
+	addIfSet(bitcoindName, "rpcpass", bitcoindMode.RPCPass)
+	addIfSet(bitcoindName, "zmqpubrawblock", bitcoindMode.ZMQPubRawBlock)
+	addIfSet(bitcoindName, "zmqpubrawtx", bitcoindMode.ZMQPubRawTx)
+	addIfSet(bitcoindName, "notifierrpchost", bitcoindMode.NotifierRPCHost)
+	addIfSet(bitcoindName, "walletrpchost", bitcoindMode.WalletRPCHost)
+	addIfSet(bitcoindName, "rpcclientcert", bitcoindMode.RPCClientCert)
+	addIfSet(bitcoindName, "rpcclientkey", bitcoindMode.RPCClientKey)
+	addIfSet(bitcoindName, "rpccacert", bitcoindMode.RPCCACert)
+
+	connectPeers := strings.Join(neutrinoMode.ConnectPeers, " ")
+	addPeers := strings.Join(neutrinoMode.AddPeers, " ")
+	addIfSet("neutrino", "connect", connectPeers)
+	addIfSet("neutrino", "addpeer", addPeers)
+	addIfSet("neutrino", "persistentpeerfile", neutrinoMode.PersistentPeerFile)
+	addIfSet("neutrino", "feeurl", neutrinoMode.FeeURL)
+	addIfSet("neutrino", "dbpath", neutrinoMode.DatabasePath)
+	addIfSet("neutrino", "dbbackend", neutrinoMode.DatabaseBackend)
+
+	// Any options that were set for a node other than the selected one
+	// conflict with the selection.
+	var conflicts []string
+	for _, nodeName := range []string{btcdName, bitcoindName, "neutrino"} {
+		if nodeName == node {
+			continue
+		}
+
+		conflicts = append(conflicts, setOptions[nodeName]...)
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%v.node=%v conflicts with %v, either "+
+			"remove them or select the matching %v.node",
+			chainName, node, strings.Join(conflicts, ", "),
+			chainName)
+	}
+
+	return nil
+}
+
 // extractBtcdRPCParams attempts to extract the RPC credentials for an existing
 // btcd instance. The passed path is expected to be the location of btcd's
 // application data directory on the target system.
@@ -1204,31 +1830,54 @@ func extractBtcdRPCParams(btcdConfigPath string) (string, string, error) {
 		return "", "", err
 	}
 
-	// Attempt to locate the RPC user using a regular expression. If we
-	// don't have a match for our regular expression then we'll exit with
-	// an error.
-	rpcUserRegexp, err := regexp.Compile(`(?m)^\s*rpcuser\s*=\s*([^\s]+)`)
-	if err != nil {
-		return "", "", err
-	}
-	userSubmatches := rpcUserRegexp.FindSubmatch(configContents)
-	if userSubmatches == nil {
-		return "", "", fmt.Errorf("unable to find rpcuser in config")
+	// We'll prefer the full-privilege credentials set through rpcuser and
+	// rpcpass. If they aren't set, we'll fall back to the limited-privilege
+	// credentials set through rpclimituser and rpclimitpass, which suffice
+	// for lnd's workload.
+	credentialOpts := [][2]string{
+		{"rpcuser", "rpcpass"},
+		{"rpclimituser", "rpclimitpass"},
 	}
-
-	// Similarly, we'll use another regular expression to find the set
-	// rpcpass (if any). If we can't find the pass, then we'll exit with an
-	// error.
-	rpcPassRegexp, err := regexp.Compile(`(?m)^\s*rpcpass\s*=\s*([^\s]+)`)
-	if err != nil {
-		return "", "", err
+	for _, opts := range credentialOpts {
+		rpcUser, rpcPass, userFound, passFound, err :=
+			findConfigCredentials(configContents, opts[0], opts[1])
+		if err != nil {
+			return "", "", err
+		}
+		if userFound && passFound {
+			return rpcUser, rpcPass, nil
+		}
 	}
-	passSubmatches := rpcPassRegexp.FindSubmatch(configContents)
-	if passSubmatches == nil {
-		return "", "", fmt.Errorf("unable to find rpcuser in config")
+
+	return "", "", fmt.Errorf("unable to find rpcuser and rpcpass, or " +
+		"rpclimituser and rpclimitpass in config")
+}
+
+// bitcoindChainDir returns the subdirectory of the data directory of bitcoind,
+// or litecoind if the litecoin chain is passed, in which the files of the
+// given network are stored, surrounded by slashes. Networks other than
+// mainnet are stored in a subdirectory named after the network, though the
+// names differ between the two daemons.
+func bitcoindChainDir(chain chainCode, netName string) string {
+	switch chain {
+	case litecoinChain:
+		switch netName {
+		case "testnet4":
+			return "/testnet4/"
+		}
+
+	default:
+		switch netName {
+		case "testnet3":
+			return "/testnet3/"
+		case "testnet4":
+			return "/testnet4/"
+		case "regtest":
+			return "/regtest/"
+		}
 	}
 
-	return string(userSubmatches[1]), string(passSubmatches[1]), nil
+	return "/"
 }
 
 // extractBitcoindParams attempts to extract the RPC credentials for an
@@ -1236,46 +1885,68 @@ func extractBtcdRPCParams(btcdConfigPath string) (string, string, error) {
 // location of bitcoind's bitcoin.conf on the target system. The routine looks
 // for a cookie first, optionally following the datadir configuration option in
 // the bitcoin.conf. If it doesn't find one, it looks for rpcuser/rpcpassword.
-func extractBitcoindRPCParams(bitcoindConfigPath string) (string, string, string, string, error) {
-	// First, we'll open up the bitcoind configuration file found at the
-	// target destination.
-	bitcoindConfigFile, err := os.Open(bitcoindConfigPath)
+// If neither is found, it keeps retrying to read the cookie until the passed
+// retry timeout elapses. If strictCookiePerms is set, cookies readable by users
+// other than their owner are rejected. As a last resort, it looks for an
+// rpcauth option, in which case only the username is returned along with an
+// empty password, as the password can't be recovered from its hash. The passed
+// chain determines the layout of the data directory the cookie is located in.
+func extractBitcoindRPCParams(bitcoindConfigPath string,
+	cookieRetryTimeout time.Duration, strictCookiePerms bool,
+	chain chainCode) (string, string, string, string, error) {
+
+	// First, we'll read the bitcoind configuration file found at the
+	// target destination, along with any other files it includes.
+	configFiles, err := readBitcoindConfig(bitcoindConfigPath)
 	if err != nil {
 		return "", "", "", "", err
 	}
-	defer bitcoindConfigFile.Close()
 
-	// With the file open extract the contents of the configuration file so
-	// we can attempt to locate the RPC credentials.
-	configContents, err := ioutil.ReadAll(bitcoindConfigFile)
-	if err != nil {
-		return "", "", "", "", err
-	}
+	// The network of bitcoind may be selected within the global options
+	// of its configuration file. If it contradicts the one of lnd, the
+	// options and cookie of the wrong network would be picked up,
+	// resulting in confusing authentication failures later on, so we'll
+	// bail out early.
+	confNetwork, toggle := bitcoindConfigNetwork(
+		scopeBitcoindConfig("", configFiles...),
+	)
+	lndNetwork := bitcoindConfigSection(activeNetParams.Params.Name)
+	if toggle != "" && confNetwork != lndNetwork {
+		return "", "", "", "", fmt.Errorf("lnd is running on %v, but "+
+			"%v selects bitcoind's %v network through %v, make "+
+			"sure both daemons use the same network",
+			activeNetParams.Params.Name, bitcoindConfigPath,
+			confNetwork, toggle)
+	}
+
+	// Newer versions of bitcoind allow options to be scoped to a
+	// particular network through sections such as [main] or [test]. We'll
+	// narrow the contents down to the global options and those within the
+	// section of the active network, so we don't pick up the values of a
+	// different network.
+	configContents := scopeBitcoindConfig(
+		bitcoindConfigSection(activeNetParams.Params.Name),
+		configFiles...,
+	)
 
 	// First, we'll look for the ZMQ hosts providing raw block and raw
 	// transaction notifications.
-	zmqBlockHostRE, err := regexp.Compile(
-		`(?m)^\s*zmqpubrawblock\s*=\s*([^\s]+)`,
-	)
-	if err != nil {
-		return "", "", "", "", err
-	}
-	zmqBlockHostSubmatches := zmqBlockHostRE.FindSubmatch(configContents)
-	if len(zmqBlockHostSubmatches) < 2 {
+	zmqBlockHost, ok := findConfigValue(configContents, "zmqpubrawblock")
+	if !ok {
 		return "", "", "", "", fmt.Errorf("unable to find " +
 			"zmqpubrawblock in config")
 	}
-	zmqTxHostRE, err := regexp.Compile(`(?m)^\s*zmqpubrawtx\s*=\s*([^\s]+)`)
-	if err != nil {
-		return "", "", "", "", err
-	}
-	zmqTxHostSubmatches := zmqTxHostRE.FindSubmatch(configContents)
-	if len(zmqTxHostSubmatches) < 2 {
+	zmqTxHost, ok := findConfigValue(configContents, "zmqpubrawtx")
+	if !ok {
 		return "", "", "", "", errors.New("unable to find zmqpubrawtx " +
 			"in config")
 	}
-	zmqBlockHost := string(zmqBlockHostSubmatches[1])
-	zmqTxHost := string(zmqTxHostSubmatches[1])
+	if err := checkZMQAddress("zmqpubrawblock", zmqBlockHost); err != nil {
+		return "", "", "", "", err
+	}
+	if err := checkZMQAddress("zmqpubrawtx", zmqTxHost); err != nil {
+		return "", "", "", "", err
+	}
 	if err := checkZMQOptions(zmqBlockHost, zmqTxHost); err != nil {
 		return "", "", "", "", err
 	}
@@ -1283,75 +1954,889 @@ func extractBitcoindRPCParams(bitcoindConfigPath string) (string, string, string
 	// Next, we'll try to find an auth cookie. We need to detect the chain
 	// by seeing if one is specified in the configuration file.
 	dataDir := path.Dir(bitcoindConfigPath)
-	dataDirRE, err := regexp.Compile(`(?m)^\s*datadir\s*=\s*([^\s]+)`)
+	if configDataDir, ok := findConfigValue(configContents, "datadir"); ok {
+		dataDir = configDataDir
+	}
+
+	chainDir := bitcoindChainDir(chain, activeNetParams.Params.Name)
+
+	// If the cookie has been relocated through the rpccookiefile option,
+	// we'll look for it there first, resolving relative paths against the
+	// data directory. We'll still fall back to the default location
+	// afterwards.
+	cookiePaths := []string{dataDir + chainDir + ".cookie"}
+	cookieFile, ok := findConfigValue(configContents, "rpccookiefile")
+	if ok {
+		if !filepath.IsAbs(cookieFile) {
+			cookieFile = filepath.Join(dataDir, cookieFile)
+		}
+		cookiePaths = append([]string{cookieFile}, cookiePaths...)
+	}
+
+	rpcUser, rpcPass, ok, err := readBitcoindCookie(
+		cookiePaths, strictCookiePerms,
+	)
 	if err != nil {
 		return "", "", "", "", err
 	}
-	dataDirSubmatches := dataDirRE.FindSubmatch(configContents)
-	if dataDirSubmatches != nil {
-		dataDir = string(dataDirSubmatches[1])
+	if ok {
+		return rpcUser, rpcPass, zmqBlockHost, zmqTxHost, nil
 	}
 
-	chainDir := "/"
-	switch activeNetParams.Params.Name {
-	case "testnet3":
-		chainDir = "/testnet3/"
-	case "testnet4":
-		chainDir = "/testnet4/"
-	case "regtest":
-		chainDir = "/regtest/"
+	// We didn't find a cookie, so we attempt to locate the RPC user and
+	// password within the config.
+	rpcUser, rpcPass, userFound, passFound, err := findBitcoindCredentials(
+		bitcoindConfigSection(activeNetParams.Params.Name),
+		configFiles...,
+	)
+	if err != nil {
+		return "", "", "", "", err
 	}
 
-	cookie, err := ioutil.ReadFile(dataDir + chainDir + ".cookie")
-	if err == nil {
-		splitCookie := strings.Split(string(cookie), ":")
-		if len(splitCookie) == 2 {
-			return splitCookie[0], splitCookie[1], zmqBlockHost,
-				zmqTxHost, nil
+	// If the credentials aren't within the config either, then bitcoind
+	// may not have written its cookie yet as it's still starting up. In
+	// this case, we'll keep trying to read the cookie until the retry
+	// timeout elapses.
+	if !userFound || !passFound {
+		if cookieRetryTimeout > 0 {
+			fmt.Printf("Waiting up to %v for the auth cookie to be "+
+				"written\n", cookieRetryTimeout)
+		}
+
+		deadline := time.Now().Add(cookieRetryTimeout)
+		for time.Now().Before(deadline) {
+			time.Sleep(cookieRetryInterval)
+
+			rpcUser, rpcPass, ok, err := readBitcoindCookie(
+				cookiePaths, strictCookiePerms,
+			)
+			if err != nil {
+				return "", "", "", "", err
+			}
+			if ok {
+				return rpcUser, rpcPass, zmqBlockHost,
+					zmqTxHost, nil
+			}
 		}
 	}
 
-	// We didn't find a cookie, so we attempt to locate the RPC user using
-	// a regular expression. If we  don't have a match for our regular
-	// expression then we'll exit with an error.
-	rpcUserRegexp, err := regexp.Compile(`(?m)^\s*rpcuser\s*=\s*([^\s]+)`)
-	if err != nil {
-		return "", "", "", "", err
+	// bitcoind may instead be configured with hashed credentials through
+	// the rpcauth option. As the password can't be recovered from its
+	// hash, we'll only return the username, and leave it up to the caller
+	// to obtain the password.
+	if !userFound && !passFound {
+		rpcAuth, _ := findConfigValue(configContents, "rpcauth")
+		authUser := strings.SplitN(rpcAuth, ":", 2)
+		if len(authUser) == 2 && authUser[0] != "" {
+			return authUser[0], "", zmqBlockHost, zmqTxHost, nil
+		}
 	}
-	userSubmatches := rpcUserRegexp.FindSubmatch(configContents)
-	if userSubmatches == nil {
+
+	// If we don't have a match for either of the options, then we'll exit
+	// with an error.
+	if !userFound {
 		return "", "", "", "", fmt.Errorf("unable to find rpcuser in " +
 			"config")
 	}
+	if !passFound {
+		return "", "", "", "", fmt.Errorf("unable to find rpcpassword " +
+			"in config")
+	}
+
+	return rpcUser, rpcPass, zmqBlockHost, zmqTxHost, nil
+}
 
-	// Similarly, we'll use another regular expression to find the set
-	// rpcpass (if any). If we can't find the pass, then we'll exit with an
-	// error.
-	rpcPassRegexp, err := regexp.Compile(`(?m)^\s*rpcpassword\s*=\s*([^\s]+)`)
+// extractBitcoindRPCHost derives the address of bitcoind's RPC server from the
+// rpcconnect, rpcbind and rpcport options within the bitcoin.conf found at the
+// given path. The passed RPC host is returned unchanged if it already specifies
+// a port, or if no port is configured within bitcoin.conf, in which case the
+// port will be guessed from the active chain parameters. The hosts of the
+// rpcconnect and rpcbind options are only used if the RPC host wasn't changed
+// from its default, with rpcconnect taking precedence.
+func extractBitcoindRPCHost(bitcoindConfigPath, rpcHost string) (string,
+	error) {
+
+	// An explicitly configured port always takes precedence.
+	if rpcHostHasPort(rpcHost) {
+		return rpcHost, nil
+	}
+
+	configFiles, err := readBitcoindConfig(bitcoindConfigPath)
 	if err != nil {
-		return "", "", "", "", err
+		return "", err
 	}
-	passSubmatches := rpcPassRegexp.FindSubmatch(configContents)
-	if passSubmatches == nil {
-		return "", "", "", "", fmt.Errorf("unable to find rpcpassword " +
-			"in config")
+	configContents := scopeBitcoindConfig(
+		bitcoindConfigSection(activeNetParams.Params.Name),
+		configFiles...,
+	)
+
+	// The rpcconnect option points bitcoin-cli to the node to connect to,
+	// which may well be a remote one, so we'll connect to it as well
+	// unless the user pointed us elsewhere.
+	var connectHost, port string
+	rpcConnect, ok := findConfigValue(configContents, "rpcconnect")
+	if ok && rpcHost == defaultRPCHost {
+		connectHost, port = splitConfigHostPort(rpcConnect)
+	}
+
+	// Both the rpcconnect and rpcbind options may or may not include a
+	// port. If they do, then it takes precedence over the rpcport option,
+	// as is the case within bitcoin-cli and bitcoind respectively.
+	var bindHost, bindPort string
+	if rpcBind, ok := findConfigValue(configContents, "rpcbind"); ok {
+		bindHost, bindPort = splitConfigHostPort(rpcBind)
+	}
+	if port == "" {
+		port = bindPort
+	}
+
+	rpcPort, ok := findConfigValue(configContents, "rpcport")
+	if port == "" && ok {
+		if _, err := strconv.Atoi(rpcPort); err == nil {
+			port = rpcPort
+		}
+	}
+
+	// Otherwise, we'll only connect to the address bitcoind is bound to if
+	// the user didn't point us elsewhere, and if it's an address we can
+	// connect to.
+	host := rpcHost
+	switch {
+	case connectHost != "":
+		host = connectHost
+
+	case rpcHost == defaultRPCHost && bindHost != "":
+		bindIP := net.ParseIP(bindHost)
+		if bindIP == nil || !bindIP.IsUnspecified() {
+			host = bindHost
+		}
+	}
+
+	// Without a configured port, we'll leave it up to the caller to guess
+	// it. We'll still point it to the node of the rpcconnect option, but
+	// not to the address bitcoind is bound to, as that's unlikely to be
+	// useful without the matching port.
+	if port == "" {
+		if connectHost != "" {
+			return connectHost, nil
+		}
+
+		return rpcHost, nil
 	}
 
-	return string(userSubmatches[1]), string(passSubmatches[1]),
-		zmqBlockHost, zmqTxHost, nil
+	return joinRPCHostPort(host, port), nil
+}
+
+// splitConfigHostPort splits the value of an address option within
+// bitcoin.conf into its host and port. The port is empty if the value doesn't
+// include one.
+func splitConfigHostPort(addr string) (string, string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return strings.Trim(addr, "[]"), ""
+	}
+
+	return host, port
+}
+
+// readBitcoindCookie attempts to read the RPC credentials from the first valid
+// auth cookie found at the given paths. The third return value reports whether
+// such a cookie was found. If the cookie is readable by users other than its
+// owner, a warning is printed, or an error is returned if strictPerms is set.
+func readBitcoindCookie(cookiePaths []string, strictPerms bool) (string,
+	string, bool, error) {
+
+	for _, cookiePath := range cookiePaths {
+		cookie, err := ioutil.ReadFile(cookiePath)
+		if err != nil {
+			continue
+		}
+
+		splitCookie := strings.Split(string(cookie), ":")
+		if len(splitCookie) != 2 {
+			continue
+		}
+
+		err = checkBitcoindCookiePerms(cookiePath)
+		switch {
+		case err != nil && strictPerms:
+			return "", "", false, err
+		case err != nil:
+			fmt.Printf("WARNING: %v\n", err)
+		}
+
+		return splitCookie[0], splitCookie[1], true, nil
+	}
+
+	return "", "", false, nil
+}
+
+// checkBitcoindCookiePerms returns an error if the auth cookie at the given
+// path is readable by users other than its owner, as they'd be able to control
+// the backend through its RPC interface. The check is skipped on Windows, where
+// the permission bits aren't meaningful.
+func checkBitcoindCookiePerms(cookiePath string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := os.Stat(cookiePath)
+	if err != nil {
+		return err
+	}
+
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("auth cookie %v is accessible by users other "+
+			"than its owner (mode %v), restrict its permissions to "+
+			"0600", cookiePath, perm)
+	}
+
+	return nil
+}
+
+// bitcoindConfigSection returns the name of the network-scoped section within
+// bitcoind's configuration file which applies to the network with the given
+// name.
+func bitcoindConfigSection(netName string) string {
+	switch netName {
+	case "testnet3", "testnet4":
+		return "test"
+	case "regtest":
+		return "regtest"
+	case "signet":
+		return "signet"
+	default:
+		return "main"
+	}
+}
+
+// readBitcoindConfig reads the bitcoind configuration file found at the given
+// path, along with any files it includes through the includeconf option. The
+// contents of each file are returned in the order they were read, starting
+// with the file at the given path.
+func readBitcoindConfig(configPath string) ([][]byte, error) {
+	return readBitcoindConfigFile(configPath, 0, make(map[string]struct{}))
+}
+
+// readBitcoindConfigFile reads the bitcoind configuration file found at the
+// given path and recursively follows its includeconf options. Relative include
+// paths are resolved against the directory of the including file. The passed
+// set tracks the files currently being read, in order to detect include loops.
+func readBitcoindConfigFile(configPath string, depth int,
+	including map[string]struct{}) ([][]byte, error) {
+
+	if depth > maxBitcoindIncludeDepth {
+		return nil, fmt.Errorf("unable to include %v: maximum "+
+			"includeconf depth of %d exceeded", configPath,
+			maxBitcoindIncludeDepth)
+	}
+
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := including[absPath]; ok {
+		return nil, fmt.Errorf("unable to include %v: includeconf "+
+			"loop detected", configPath)
+	}
+	including[absPath] = struct{}{}
+	defer delete(including, absPath)
+
+	configContents, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	configFiles := [][]byte{configContents}
+	includePaths := findAllConfigValues(configContents, "includeconf")
+	for _, includePath := range includePaths {
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(
+				filepath.Dir(configPath), includePath,
+			)
+		}
+
+		includedFiles, err := readBitcoindConfigFile(
+			includePath, depth+1, including,
+		)
+		if err != nil {
+			return nil, err
+		}
+		configFiles = append(configFiles, includedFiles...)
+	}
+
+	return configFiles, nil
+}
+
+// configOptionRE returns a regular expression matching the lines of a bitcoind
+// or btcd configuration file which set the given option, capturing the raw
+// value.
+func configOptionRE(option string) *regexp.Regexp {
+	return regexp.MustCompile(
+		`(?m)^[ \t]*` + regexp.QuoteMeta(option) + `[ \t]*=(.*)$`,
+	)
+}
+
+// findConfigValue returns the value of the first occurrence of the given
+// option within the contents of a bitcoind or btcd configuration file, as
+// parsed by parseConfigValue. The second return value reports whether the
+// option was set to a non-empty value.
+func findConfigValue(configContents []byte, option string) (string, bool) {
+	submatches := configOptionRE(option).FindSubmatch(configContents)
+	if submatches == nil {
+		return "", false
+	}
+
+	value := parseConfigValue(string(submatches[1]))
+	return value, value != ""
+}
+
+// findAllConfigValues returns the non-empty values of all occurrences of the
+// given option within the contents of a bitcoind or btcd configuration file,
+// as parsed by parseConfigValue.
+func findAllConfigValues(configContents []byte, option string) []string {
+	var values []string
+	matches := configOptionRE(option).FindAllSubmatch(configContents, -1)
+	for _, submatches := range matches {
+		value := parseConfigValue(string(submatches[1]))
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// findConfigCredentials returns the first pair of credentials set through the
+// given user and password options within the contents of a bitcoind or btcd
+// configuration file, along with whether each of the options was found. If
+// several credentials are set, the users and passwords are paired in document
+// order, which is only unambiguous if both options occur equally often, so an
+// error is returned otherwise.
+func findConfigCredentials(configContents []byte, userOption,
+	passOption string) (string, string, bool, bool, error) {
+
+	users := findAllConfigValues(configContents, userOption)
+	passwords := findAllConfigValues(configContents, passOption)
+	if len(users) > 0 && len(passwords) > 0 &&
+		len(users) != len(passwords) {
+
+		return "", "", false, false, fmt.Errorf("unable to pair the "+
+			"%d %v options in config with its %d %v options "+
+			"unambiguously, keep a single pair or set the RPC "+
+			"credentials explicitly", len(users), userOption,
+			len(passwords), passOption)
+	}
+
+	var user, password string
+	if len(users) > 0 {
+		user = users[0]
+	}
+	if len(passwords) > 0 {
+		password = passwords[0]
+	}
+
+	return user, password, len(users) > 0, len(passwords) > 0, nil
+}
+
+// findBitcoindCredentials returns the RPC credentials set through rpcuser and
+// rpcpassword within the given bitcoind configuration files, along with
+// whether each of the options was found. The credentials are paired within the
+// given section and the global options separately, so that a section may
+// override either option of the global credentials on its own.
+func findBitcoindCredentials(section string, configFiles ...[]byte) (string,
+	string, bool, bool, error) {
+
+	sectionOpts, globalOpts := splitBitcoindConfig(section, configFiles...)
+	user, pass, userFound, passFound, err := findConfigCredentials(
+		sectionOpts, "rpcuser", "rpcpassword",
+	)
+	if err != nil {
+		return "", "", false, false, err
+	}
+	globalUser, globalPass, globalUserFound, globalPassFound, err :=
+		findConfigCredentials(globalOpts, "rpcuser", "rpcpassword")
+	if err != nil {
+		return "", "", false, false, err
+	}
+
+	if !userFound {
+		user, userFound = globalUser, globalUserFound
+	}
+	if !passFound {
+		pass, passFound = globalPass, globalPassFound
+	}
+
+	return user, pass, userFound, passFound, nil
+}
+
+// parseConfigValue parses the raw value of an option within a configuration
+// file. A value surrounded by single or double quotes is returned without
+// them, preserving any whitespace or # within. Otherwise, an inline comment
+// starting with # is removed, along with the surrounding whitespace.
+func parseConfigValue(rawValue string) string {
+	value := strings.TrimSpace(rawValue)
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		end := strings.IndexByte(value[1:], value[0])
+		if end != -1 {
+			return value[1 : end+1]
+		}
+	}
+
+	if commentStart := strings.IndexByte(value, '#'); commentStart != -1 {
+		value = value[:commentStart]
+	}
+
+	return strings.TrimSpace(value)
+}
+
+// bitcoindConfigNetwork returns the network selected through the testnet,
+// regtest and signet toggles or the chain option within the global options of
+// a bitcoind configuration file, named after its network-scoped section, along
+// with the option that selected it. If none of them are set, mainnet is
+// selected and no option is returned.
+func bitcoindConfigNetwork(configContents []byte) (string, string) {
+	if chain, ok := findConfigValue(configContents, "chain"); ok {
+		network := chain
+		if chain == "testnet4" {
+			network = "test"
+		}
+		return network, "chain=" + chain
+	}
+
+	toggles := []struct {
+		option  string
+		network string
+	}{
+		{option: "testnet", network: "test"},
+		{option: "regtest", network: "regtest"},
+		{option: "signet", network: "signet"},
+	}
+	for _, toggle := range toggles {
+		value, ok := findConfigValue(configContents, toggle.option)
+		if ok && value != "0" {
+			return toggle.network, toggle.option + "=" + value
+		}
+	}
+
+	return "main", ""
+}
+
+// scopeBitcoindConfig filters the contents of the given bitcoind configuration
+// files down to the options that apply to the given section. Options that
+// appear before any section header within a file are global and always apply,
+// while options within other sections are dropped. The options of the target
+// section are placed before the global ones, so a regular expression searching
+// for the first match of an option will prefer the section's value over the
+// global one.
+func scopeBitcoindConfig(section string, configFiles ...[]byte) []byte {
+	sectionOpts, globalOpts := splitBitcoindConfig(section, configFiles...)
+	return append(sectionOpts, globalOpts...)
+}
+
+// splitBitcoindConfig returns the options within the given section of the
+// given bitcoind configuration files, along with the global options that
+// appear before any section header. Options within other sections are dropped.
+func splitBitcoindConfig(section string, configFiles ...[]byte) ([]byte,
+	[]byte) {
+
+	var globalOpts, sectionOpts bytes.Buffer
+	for _, configContents := range configFiles {
+		var currentSection string
+		for _, line := range bytes.Split(configContents, []byte("\n")) {
+			trimmed := bytes.TrimSpace(line)
+			if len(trimmed) > 1 && trimmed[0] == '[' &&
+				trimmed[len(trimmed)-1] == ']' {
+
+				currentSection = string(
+					bytes.TrimSpace(trimmed[1 : len(trimmed)-1]),
+				)
+				continue
+			}
+
+			switch currentSection {
+			case "":
+				globalOpts.Write(line)
+				globalOpts.WriteByte('\n')
+			case section:
+				sectionOpts.Write(line)
+				sectionOpts.WriteByte('\n')
+			}
+		}
+	}
+
+	return sectionOpts.Bytes(), globalOpts.Bytes()
+}
+
+// bitcoindBackend houses the RPC host and ZMQ addresses of one of the
+// configured bitcoind nodes.
+type bitcoindBackend struct {
+	rpcHost        string
+	zmqPubRawBlock string
+	zmqPubRawTx    string
+
+	// walletRPCHost is the RPC host of the node serving the wallet. It
+	// only differs from rpcHost, which serves the chain notifier and the
+	// chain view, if a dedicated node was configured for either of them.
+	walletRPCHost string
+}
+
+// bitcoindBackends returns the bitcoind nodes configured through the
+// comma-separated lists of RPC hosts and ZMQ addresses, in order of
+// preference. If several RPC hosts are configured, a ZMQ address of each kind
+// must be set for each of them, in the same order. Dedicated nodes for chain
+// notifications and the wallet, set through notifierrpchost and walletrpchost,
+// take precedence over the RPC hosts, and can only be set for a single node.
+func bitcoindBackends(daemonName string,
+	conf *bitcoindConfig) ([]bitcoindBackend, error) {
+
+	rpcHosts := splitCommaList(conf.RPCHost)
+
+	// If only one of the dedicated nodes was set, it serves both chain
+	// notifications and the wallet.
+	notifierHost, walletHost := conf.NotifierRPCHost, conf.WalletRPCHost
+	switch {
+	case notifierHost == "" && walletHost == "":
+
+	case len(rpcHosts) > 1:
+		return nil, fmt.Errorf("%[1]v.notifierrpchost and "+
+			"%[1]v.walletrpchost can't be combined with several "+
+			"nodes set in %[1]v.rpchost", daemonName)
+
+	case notifierHost == "":
+		notifierHost = walletHost
+
+	case walletHost == "":
+		walletHost = notifierHost
+	}
+	if notifierHost != "" {
+		return []bitcoindBackend{{
+			rpcHost:        notifierHost,
+			zmqPubRawBlock: conf.ZMQPubRawBlock,
+			zmqPubRawTx:    conf.ZMQPubRawTx,
+			walletRPCHost:  walletHost,
+		}}, nil
+	}
+
+	if len(rpcHosts) <= 1 {
+		return []bitcoindBackend{{
+			rpcHost:        conf.RPCHost,
+			zmqPubRawBlock: conf.ZMQPubRawBlock,
+			zmqPubRawTx:    conf.ZMQPubRawTx,
+			walletRPCHost:  conf.RPCHost,
+		}}, nil
+	}
+
+	zmqBlockHosts := splitCommaList(conf.ZMQPubRawBlock)
+	zmqTxHosts := splitCommaList(conf.ZMQPubRawTx)
+	if len(zmqBlockHosts) != len(rpcHosts) ||
+		len(zmqTxHosts) != len(rpcHosts) {
+
+		return nil, fmt.Errorf("%[1]v.zmqpubrawblock and "+
+			"%[1]v.zmqpubrawtx must list an address for each of "+
+			"the %[2]d nodes set in %[1]v.rpchost", daemonName,
+			len(rpcHosts))
+	}
+
+	backends := make([]bitcoindBackend, 0, len(rpcHosts))
+	for i, rpcHost := range rpcHosts {
+		err := checkZMQAddress(
+			daemonName+".zmqpubrawblock", zmqBlockHosts[i],
+		)
+		if err != nil {
+			return nil, err
+		}
+		err = checkZMQAddress(daemonName+".zmqpubrawtx", zmqTxHosts[i])
+		if err != nil {
+			return nil, err
+		}
+		err = checkZMQOptions(zmqBlockHosts[i], zmqTxHosts[i])
+		if err != nil {
+			return nil, err
+		}
+
+		backends = append(backends, bitcoindBackend{
+			rpcHost:        rpcHost,
+			zmqPubRawBlock: zmqBlockHosts[i],
+			zmqPubRawTx:    zmqTxHosts[i],
+			walletRPCHost:  rpcHost,
+		})
+	}
+
+	return backends, nil
+}
+
+// envReferenceRE matches a value which references an environment variable in
+// its entirety, either as $VARNAME or ${VARNAME}.
+var envReferenceRE = regexp.MustCompile(
+	`^\$(?:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)\})$`,
+)
+
+// resolveEnvReference resolves the value of the named option if it references
+// an environment variable as $VARNAME or ${VARNAME}, which keeps secrets such
+// as RPC passwords out of the config file. The variable must be set. Any other
+// value is returned as is, except for $$ being unescaped to a literal $.
+func resolveEnvReference(option, value string) (string, error) {
+	submatches := envReferenceRE.FindStringSubmatch(value)
+	if submatches == nil {
+		return strings.Replace(value, "$$", "$", -1), nil
+	}
+
+	name := submatches[1]
+	if name == "" {
+		name = submatches[2]
+	}
+	resolved, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%v references environment variable "+
+			"%v, which isn't set", option, name)
+	}
+
+	return resolved, nil
+}
+
+// resolveRPCCredentials resolves the RPC username and password of the given
+// daemon, which may reference environment variables.
+func resolveRPCCredentials(daemonName, rpcUser, rpcPass string) (string,
+	string, error) {
+
+	rpcUser, err := resolveEnvReference(daemonName+".rpcuser", rpcUser)
+	if err != nil {
+		return "", "", err
+	}
+	rpcPass, err = resolveEnvReference(daemonName+".rpcpass", rpcPass)
+	if err != nil {
+		return "", "", err
+	}
+
+	return rpcUser, rpcPass, nil
+}
+
+// splitCommaList splits the given comma-separated list, trimming the
+// whitespace around each of its elements and dropping empty ones.
+func splitCommaList(list string) []string {
+	var elems []string
+	for _, elem := range strings.Split(list, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+
+	return elems
+}
+
+// normalizeRPCHost normalizes the RPC host set through the named option to a
+// host with an optional port. As the host is commonly set to a URL such as
+// http://127.0.0.1:8332/, we'll strip its scheme and path, rather than have
+// the malformed host surface as an obscure error of the RPC client much later.
+func normalizeRPCHost(option, rpcHost string) (string, error) {
+	host := strings.TrimSpace(rpcHost)
+	if i := strings.Index(host, "://"); i != -1 {
+		host = host[i+len("://"):]
+	}
+	if i := strings.IndexAny(host, "/?#"); i != -1 {
+		host = host[:i]
+	}
+
+	invalidHost := func(reason string) error {
+		return fmt.Errorf("invalid %v %q: %v, expected host or "+
+			"host:port, e.g. 127.0.0.1:8332", option, rpcHost,
+			reason)
+	}
+
+	switch {
+	case host == "":
+		return "", invalidHost("missing host")
+
+	case strings.Contains(host, "@"):
+		return "", invalidHost("credentials must be set through " +
+			"rpcuser and rpcpass")
+	}
+
+	hostname, port, err := net.SplitHostPort(host)
+	switch {
+	// The host has a port, which must be valid.
+	case err == nil:
+		if hostname == "" {
+			return "", invalidHost("missing host")
+		}
+		portNum, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || portNum == 0 {
+			return "", invalidHost("invalid port")
+		}
+
+	// Otherwise, the host must either be a bracketed IPv6 address, a bare
+	// IPv6 address, or a hostname or IPv4 address without any colons.
+	case strings.HasPrefix(host, "["):
+		if !strings.HasSuffix(host, "]") ||
+			net.ParseIP(host[1:len(host)-1]) == nil {
+
+			return "", invalidHost("malformed IPv6 address")
+		}
+
+	case strings.Contains(host, ":"):
+		if net.ParseIP(host) == nil {
+			return "", invalidHost("malformed host:port")
+		}
+	}
+
+	return host, nil
 }
 
 // checkZMQOptions ensures that the provided addresses to use as the hosts for
 // ZMQ rawblock and rawtx notifications are different.
 func checkZMQOptions(zmqBlockHost, zmqTxHost string) error {
 	if zmqBlockHost == zmqTxHost {
-		return errors.New("zmqpubrawblock and zmqpubrawtx must be set" +
+		return errors.New("zmqpubrawblock and zmqpubrawtx must be set " +
 			"to different addresses")
 	}
 
 	return nil
 }
 
+// checkZMQAddress ensures that the given ZMQ address, set through the named
+// option, is a URL with either a tcp:// scheme and a host:port, or an ipc://
+// scheme and a path.
+func checkZMQAddress(option, addr string) error {
+	// IPC endpoints are Unix domain socket paths, which are passed through
+	// to the ZMQ connection as is. We don't parse them as URLs, as a path
+	// may contain characters that aren't valid within one.
+	if strings.HasPrefix(addr, zmqIPCPrefix) {
+		if strings.TrimPrefix(addr, zmqIPCPrefix) == "" {
+			return fmt.Errorf("invalid %v %q: expected "+
+				"ipc://path", option, addr)
+		}
+
+		return nil
+	}
+
+	zmqURL, err := url.Parse(addr)
+	if err != nil {
+		return fmt.Errorf("invalid %v %q: %v", option, addr, err)
+	}
+
+	switch zmqURL.Scheme {
+	case "tcp":
+		host, port, err := net.SplitHostPort(zmqURL.Host)
+		if err != nil || host == "" || port == "" {
+			return fmt.Errorf("invalid %v %q: expected "+
+				"tcp://host:port", option, addr)
+		}
+
+	default:
+		return fmt.Errorf("invalid %v %q: scheme must be tcp:// or "+
+			"ipc://", option, addr)
+	}
+
+	return nil
+}
+
+// validateFeeEstimateConfTarget ensures that the configured confirmation target
+// for fee estimates is within the supported bounds. A zero target means that
+// none was configured, and is always valid.
+func validateFeeEstimateConfTarget(confTarget uint32) error {
+	if confTarget == 0 {
+		return nil
+	}
+
+	if confTarget < minFeeEstimateConfTarget ||
+		confTarget > maxFeeEstimateConfTarget {
+
+		return fmt.Errorf("feeestimateconftarget must be between %d "+
+			"and %d, got %d", minFeeEstimateConfTarget,
+			maxFeeEstimateConfTarget, confTarget)
+	}
+
+	return nil
+}
+
+// validateOperationConfTargets ensures that the default confirmation targets
+// configured for the fee estimates of each type of on-chain operation are
+// within the supported bounds. As a target configured for all fee estimates
+// overrides them, they can't be combined with it.
+func validateOperationConfTargets(chainCfg *chainConfig) error {
+	confTargets := []struct {
+		option     string
+		confTarget uint32
+	}{
+		{"fundingconftarget", chainCfg.FundingConfTarget},
+		{"closeconftarget", chainCfg.CloseConfTarget},
+		{"sweepconftarget", chainCfg.SweepConfTarget},
+	}
+	for _, target := range confTargets {
+		if target.confTarget == 0 {
+			continue
+		}
+
+		if chainCfg.FeeEstimateConfTarget != 0 {
+			return fmt.Errorf("%v can't be combined with "+
+				"feeestimateconftarget, as it overrides the "+
+				"target of all fee estimates", target.option)
+		}
+
+		if target.confTarget < minFeeEstimateConfTarget ||
+			target.confTarget > maxFeeEstimateConfTarget {
+
+			return fmt.Errorf("%v must be between %d and %d, got "+
+				"%d", target.option, minFeeEstimateConfTarget,
+				maxFeeEstimateConfTarget, target.confTarget)
+		}
+	}
+
+	return nil
+}
+
+// validateFeePollInterval ensures that the configured interval at which live
+// fee estimates are polled is within the supported bounds. A zero interval
+// means that estimates aren't polled, and is always valid.
+func validateFeePollInterval(interval time.Duration) error {
+	if interval == 0 {
+		return nil
+	}
+
+	if interval < minFeePollInterval || interval > maxFeePollInterval {
+		return fmt.Errorf("feepollinterval must be between %v and %v, "+
+			"got %v", minFeePollInterval, maxFeePollInterval,
+			interval)
+	}
+
+	return nil
+}
+
+// validateMaxFeeEstimateAge ensures that the configured maximum age of live fee
+// estimates can be honored. As estimates are only refreshed once per poll, it
+// must exceed feepollinterval, and it can't be combined with the options which
+// resort to static estimates. A zero age means that estimates are used
+// regardless of their age, and is always valid.
+func validateMaxFeeEstimateAge(chainCfg *chainConfig) error {
+	maxAge := chainCfg.MaxFeeEstimateAge
+	switch {
+	case maxAge == 0:
+		return nil
+
+	case maxAge < 0:
+		return errors.New("maxfeeestimateage must be positive")
+
+	case chainCfg.FeeEstimatorMode == feeEstimatorModeStatic:
+		return fmt.Errorf("maxfeeestimateage can't be used with "+
+			"feeestimatormode=%v, as no live estimates are used",
+			feeEstimatorModeStatic)
+
+	case chainCfg.FeeEstimatorFallbackToStatic:
+		return errors.New("maxfeeestimateage can't be combined with " +
+			"feeestimatorfallbacktostatic, as static estimates " +
+			"may be used regardless of their age")
+
+	case chainCfg.FeePollInterval > 0 && maxAge <= chainCfg.FeePollInterval:
+		return fmt.Errorf("maxfeeestimateage must exceed "+
+			"feepollinterval of %v, got %v",
+			chainCfg.FeePollInterval, maxAge)
+	}
+
+	return nil
+}
+
 // normalizeNetwork returns the common name of a network type used to create
 // file paths. This allows differently versioned networks to use the same path.
 func normalizeNetwork(network string) string {
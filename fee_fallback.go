@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// defaultFallbackWarnInterval is the minimum interval between two warnings
+// about a live fee estimator resorting to its fallback fee rate.
+const defaultFallbackWarnInterval = 10 * time.Minute
+
+// FeeFallbackObserver is an optional extension of the RPCObserver, which is
+// additionally notified whenever a live fee estimator resorts to its fallback
+// fee rate, e.g. to count the number of estimates that weren't live.
+type FeeFallbackObserver interface {
+	// OnFeeFallback is invoked whenever the fallback fee rate was used for
+	// the given confirmation target, along with the fee rate.
+	//
+	// NOTE: This may be called concurrently from multiple goroutines.
+	OnFeeFallback(confTarget uint32, feeRate lnwallet.SatPerKWeight)
+}
+
+// fallbackWarningEstimator is a lnwallet.FeeEstimator which warns whenever
+// the wrapped live fee estimator resorts to its fallback fee rate, as fees are
+// likely to be off in that case. The warnings are rate limited, with the
+// number of suppressed fallbacks being reported along with the next warning.
+type fallbackWarningEstimator struct {
+	lnwallet.FallbackFeeEstimator
+
+	// observer, if set, is notified of each fallback.
+	observer FeeFallbackObserver
+
+	// warnInterval is the minimum interval between two warnings.
+	warnInterval time.Duration
+
+	// warnf logs the warning.
+	warnf func(format string, params ...interface{})
+
+	mu          sync.Mutex
+	lastWarning time.Time
+	suppressed  int
+}
+
+// A compile-time assertion to ensure fallbackWarningEstimator meets the
+// lnwallet.FeeEstimator interface.
+var _ lnwallet.FeeEstimator = (*fallbackWarningEstimator)(nil)
+
+// newFallbackWarningEstimator wraps the given fee estimator, such that it
+// warns whenever the fallback fee rate is used, and notifies the RPC observer
+// if it's a FeeFallbackObserver. Fee estimators which don't fall back to a
+// static fee rate are returned as is.
+func newFallbackWarningEstimator(feeEstimator lnwallet.FeeEstimator,
+	rpcObserver RPCObserver) lnwallet.FeeEstimator {
+
+	fallbackEstimator, ok := feeEstimator.(lnwallet.FallbackFeeEstimator)
+	if !ok {
+		return feeEstimator
+	}
+
+	observer, _ := rpcObserver.(FeeFallbackObserver)
+
+	return &fallbackWarningEstimator{
+		FallbackFeeEstimator: fallbackEstimator,
+		observer:             observer,
+		warnInterval:         defaultFallbackWarnInterval,
+		warnf:                ltndLog.Warnf,
+	}
+}
+
+// EstimateFeePerKW takes in a target for the number of blocks until an
+// initial confirmation and returns the estimated fee expressed in sat/kw.
+//
+// NOTE: This method is part of the lnwallet.FeeEstimator interface.
+func (f *fallbackWarningEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	feeRate, fallback, err := f.EstimateFeePerKWFallback(numBlocks)
+	if err != nil || !fallback {
+		return feeRate, err
+	}
+
+	if f.observer != nil {
+		f.observer.OnFeeFallback(numBlocks, feeRate)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if !f.lastWarning.IsZero() &&
+		now.Sub(f.lastWarning) < f.warnInterval {
+
+		f.suppressed++
+		return feeRate, nil
+	}
+
+	f.warnf("Live fee estimate unavailable for conf target of %v, "+
+		"using fallback fee rate of %v sat/kw (%d similar warnings "+
+		"suppressed)", numBlocks, int64(feeRate), f.suppressed)
+
+	f.lastWarning = now
+	f.suppressed = 0
+
+	return feeRate, nil
+}
+
+// fallbackRejectingEstimator is a lnwallet.FeeEstimator which fails whenever
+// the wrapped live fee estimator resorts to its fallback fee rate, for fee
+// dependent operations to fail loudly rather than to proceed with fees that
+// are likely to be off.
+type fallbackRejectingEstimator struct {
+	estimator lnwallet.FallbackFeeEstimator
+}
+
+// A compile-time assertion to ensure fallbackRejectingEstimator meets the
+// lnwallet.FeeEstimator interface.
+var _ lnwallet.FeeEstimator = (*fallbackRejectingEstimator)(nil)
+
+// rejectFeeFallback wraps the given fee estimator, such that it fails rather
+// than resorting to its fallback fee rate if maxfeeestimateage is set. Fee
+// estimators which don't fall back to a static fee rate are returned as is.
+func rejectFeeFallback(feeEstimator lnwallet.FeeEstimator,
+	chainCfg *chainConfig) lnwallet.FeeEstimator {
+
+	if chainCfg.MaxFeeEstimateAge == 0 {
+		return feeEstimator
+	}
+
+	fallbackEstimator, ok := feeEstimator.(lnwallet.FallbackFeeEstimator)
+	if !ok {
+		return feeEstimator
+	}
+
+	return &fallbackRejectingEstimator{estimator: fallbackEstimator}
+}
+
+// EstimateFeePerKW takes in a target for the number of blocks until an
+// initial confirmation and returns the estimated fee expressed in sat/kw.
+//
+// NOTE: This method is part of the lnwallet.FeeEstimator interface.
+func (f *fallbackRejectingEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	feeRate, fallback, err := f.estimator.EstimateFeePerKWFallback(
+		numBlocks,
+	)
+	switch {
+	case err != nil:
+		return 0, err
+
+	case fallback:
+		return 0, fmt.Errorf("live fee estimate unavailable for conf "+
+			"target of %v, refusing to use fallback fee rate of "+
+			"%v sat/kw", numBlocks, int64(feeRate))
+	}
+
+	return feeRate, nil
+}
+
+// Start signals the FeeEstimator to start any processes or goroutines it
+// needs to perform its duty.
+//
+// NOTE: This method is part of the lnwallet.FeeEstimator interface.
+func (f *fallbackRejectingEstimator) Start() error {
+	return f.estimator.Start()
+}
+
+// Stop stops any spawned goroutines and cleans up the resources used by the
+// fee estimator.
+//
+// NOTE: This method is part of the lnwallet.FeeEstimator interface.
+func (f *fallbackRejectingEstimator) Stop() error {
+	return f.estimator.Stop()
+}
@@ -0,0 +1,173 @@
+// +build !rpctest
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// mockFallbackEstimator is a lnwallet.FallbackFeeEstimator which resorts to its
+// fallback fee rate while fallback is set.
+type mockFallbackEstimator struct {
+	lnwallet.StaticFeeEstimator
+
+	fallback bool
+}
+
+// EstimateFeePerKWFallback returns the static fee rate, along with whether
+// it's the fallback fee rate.
+func (m *mockFallbackEstimator) EstimateFeePerKWFallback(
+	numBlocks uint32) (lnwallet.SatPerKWeight, bool, error) {
+
+	return m.FeePerKW, m.fallback, nil
+}
+
+// fallbackObserver is a FeeFallbackObserver which counts the fallbacks it's
+// notified of.
+type fallbackObserver struct {
+	countingObserver
+
+	mu        sync.Mutex
+	fallbacks int
+}
+
+// OnFeeFallback counts the fallback.
+func (f *fallbackObserver) OnFeeFallback(confTarget uint32,
+	feeRate lnwallet.SatPerKWeight) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.fallbacks++
+}
+
+// TestFallbackWarningEstimator ensures that a warning is logged whenever the
+// live fee estimator resorts to its fallback fee rate, rate limited to one per
+// interval, and that the observer is notified of each fallback.
+func TestFallbackWarningEstimator(t *testing.T) {
+	t.Parallel()
+
+	// Fee estimators which don't fall back to a static fee rate shouldn't
+	// be wrapped.
+	static := lnwallet.StaticFeeEstimator{FeePerKW: 1000}
+	if newFallbackWarningEstimator(static, nil) != static {
+		t.Fatalf("expected static fee estimator not to be wrapped")
+	}
+
+	liveEstimator := &mockFallbackEstimator{
+		StaticFeeEstimator: lnwallet.StaticFeeEstimator{
+			FeePerKW: 6250,
+		},
+	}
+	observer := &fallbackObserver{}
+	feeEstimator := newFallbackWarningEstimator(
+		liveEstimator, observer,
+	).(*fallbackWarningEstimator)
+
+	var warnings []string
+	feeEstimator.warnf = func(format string, params ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, params...))
+	}
+
+	// Live estimates shouldn't cause any warnings.
+	if _, err := feeEstimator.EstimateFeePerKW(6); err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if len(warnings) != 0 || observer.fallbacks != 0 {
+		t.Fatalf("unexpected warning for live estimate: %v", warnings)
+	}
+
+	// Once the estimator resorts to the fallback fee rate, only the first
+	// of the fallbacks within the interval should be warned about, while
+	// the observer should be notified of each of them.
+	liveEstimator.fallback = true
+	for i := 0; i < 5; i++ {
+		feeRate, err := feeEstimator.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("unable to estimate fee: %v", err)
+		}
+		if feeRate != 6250 {
+			t.Fatalf("expected fallback fee rate 6250, got %v",
+				feeRate)
+		}
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %v", len(warnings),
+			warnings)
+	}
+	if !strings.Contains(warnings[0], "conf target of 6") ||
+		!strings.Contains(warnings[0], "6250 sat/kw") {
+
+		t.Fatalf("expected warning to include the conf target and "+
+			"fee rate, got: %v", warnings[0])
+	}
+	if observer.fallbacks != 5 {
+		t.Fatalf("expected 5 fallbacks, got %d", observer.fallbacks)
+	}
+
+	// After the interval has passed, the next fallback should be warned
+	// about along with the number of suppressed warnings.
+	interval := feeEstimator.warnInterval
+	feeEstimator.lastWarning = time.Now().Add(-2 * interval)
+	if _, err := feeEstimator.EstimateFeePerKW(3); err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %d: %v", len(warnings),
+			warnings)
+	}
+	if !strings.Contains(warnings[1], "4 similar warnings suppressed") {
+		t.Fatalf("expected suppressed warnings to be reported, got: %v",
+			warnings[1])
+	}
+}
+
+// TestRejectFeeFallback ensures that the live fee estimator fails rather than
+// resorting to its fallback fee rate once maxfeeestimateage is set, while it's
+// returned as is otherwise.
+func TestRejectFeeFallback(t *testing.T) {
+	t.Parallel()
+
+	liveEstimator := &mockFallbackEstimator{
+		StaticFeeEstimator: lnwallet.StaticFeeEstimator{
+			FeePerKW: 6250,
+		},
+	}
+
+	// Without a max age, as well as for fee estimators which don't fall
+	// back to a static fee rate, the fee estimator shouldn't be wrapped.
+	chainCfg := &chainConfig{}
+	if rejectFeeFallback(liveEstimator, chainCfg) != liveEstimator {
+		t.Fatalf("expected fee estimator not to be wrapped without " +
+			"max age")
+	}
+	chainCfg.MaxFeeEstimateAge = time.Minute
+	static := lnwallet.StaticFeeEstimator{FeePerKW: 1000}
+	if rejectFeeFallback(static, chainCfg) != static {
+		t.Fatalf("expected static fee estimator not to be wrapped")
+	}
+
+	feeEstimator := rejectFeeFallback(liveEstimator, chainCfg)
+
+	// Live estimates should be returned as is.
+	feeRate, err := feeEstimator.EstimateFeePerKW(6)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if feeRate != 6250 {
+		t.Fatalf("expected live fee rate 6250, got %v", feeRate)
+	}
+
+	// Once the estimator resorts to the fallback fee rate, estimates
+	// should fail.
+	liveEstimator.fallback = true
+	if _, err := feeEstimator.EstimateFeePerKW(6); err == nil {
+		t.Fatalf("expected fallback fee rate to be rejected")
+	}
+}
@@ -273,9 +273,10 @@ type fundingConfig struct {
 	// used as a seed to generate pending channel ID's.
 	TempChanIDSeed [32]byte
 
-	// DefaultRoutingPolicy is the default routing policy used when
-	// initially announcing channels.
-	DefaultRoutingPolicy htlcswitch.ForwardingPolicy
+	// DefaultRoutingPolicy returns the default routing policy used when
+	// initially announcing channels. As it may be updated while running,
+	// it's queried for each channel.
+	DefaultRoutingPolicy func() htlcswitch.ForwardingPolicy
 
 	// NumRequiredConfs is a function closure that helps the funding
 	// manager decide how many confirmations it should require for a
@@ -1091,7 +1092,7 @@ func (f *fundingManager) handleFundingOpen(fmsg *fundingOpenMsg) {
 	chanReserve := f.cfg.RequiredRemoteChanReserve(amt, msg.DustLimit)
 	maxValue := f.cfg.RequiredRemoteMaxValue(amt)
 	maxHtlcs := f.cfg.RequiredRemoteMaxHTLCs(amt)
-	minHtlc := f.cfg.DefaultRoutingPolicy.MinHTLC
+	minHtlc := f.cfg.DefaultRoutingPolicy().MinHTLC
 
 	// Once the reservation has been created successfully, we add it to
 	// this peer's map of pending reservations to track this particular
@@ -2436,20 +2437,21 @@ func (f *fundingManager) newChanAnnouncement(localPubKey, remotePubKey,
 
 	// We announce the channel with the default values. Some of
 	// these values can later be changed by crafting a new ChannelUpdate.
+	defaultPolicy := f.cfg.DefaultRoutingPolicy()
 	chanUpdateAnn := &lnwire.ChannelUpdate{
 		ShortChannelID: shortChanID,
 		ChainHash:      chainHash,
 		Timestamp:      uint32(time.Now().Unix()),
 		Flags:          chanFlags,
-		TimeLockDelta:  uint16(f.cfg.DefaultRoutingPolicy.TimeLockDelta),
+		TimeLockDelta:  uint16(defaultPolicy.TimeLockDelta),
 
 		// We use the HtlcMinimumMsat that the remote party required us
 		// to use, as our ChannelUpdate will be used to carry HTLCs
 		// towards them.
 		HtlcMinimumMsat: fwdMinHTLC,
 
-		BaseFee: uint32(f.cfg.DefaultRoutingPolicy.BaseFee),
-		FeeRate: uint32(f.cfg.DefaultRoutingPolicy.FeeRate),
+		BaseFee: uint32(defaultPolicy.BaseFee),
+		FeeRate: uint32(defaultPolicy.FeeRate),
 	}
 
 	// With the channel update announcement constructed, we'll generate a
@@ -2688,7 +2690,7 @@ func (f *fundingManager) handleInitFundingMsg(msg *initFundingMsg) {
 
 	// If no minimum HTLC value was specified, use the default one.
 	if minHtlc == 0 {
-		minHtlc = f.cfg.DefaultRoutingPolicy.MinHTLC
+		minHtlc = f.cfg.DefaultRoutingPolicy().MinHTLC
 	}
 
 	// If a pending channel map for this peer isn't already created, then
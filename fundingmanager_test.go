@@ -318,11 +318,13 @@ func createTestFundingManager(t *testing.T, privKey *btcec.PrivateKey,
 
 			return nil, fmt.Errorf("unable to find channel")
 		},
-		DefaultRoutingPolicy: htlcswitch.ForwardingPolicy{
-			MinHTLC:       5,
-			BaseFee:       100,
-			FeeRate:       1000,
-			TimeLockDelta: 10,
+		DefaultRoutingPolicy: func() htlcswitch.ForwardingPolicy {
+			return htlcswitch.ForwardingPolicy{
+				MinHTLC:       5,
+				BaseFee:       100,
+				FeeRate:       1000,
+				TimeLockDelta: 10,
+			}
 		},
 		NumRequiredConfs: func(chanAmt btcutil.Amount,
 			pushAmt lnwire.MilliSatoshi) uint16 {
@@ -433,11 +435,13 @@ func recreateAliceFundingManager(t *testing.T, alice *testNode) {
 		},
 		TempChanIDSeed: oldCfg.TempChanIDSeed,
 		FindChannel:    oldCfg.FindChannel,
-		DefaultRoutingPolicy: htlcswitch.ForwardingPolicy{
-			MinHTLC:       5,
-			BaseFee:       100,
-			FeeRate:       1000,
-			TimeLockDelta: 10,
+		DefaultRoutingPolicy: func() htlcswitch.ForwardingPolicy {
+			return htlcswitch.ForwardingPolicy{
+				MinHTLC:       5,
+				BaseFee:       100,
+				FeeRate:       1000,
+				TimeLockDelta: 10,
+			}
 		},
 		PublishTransaction: func(txn *wire.MsgTx) error {
 			publishChan <- txn
@@ -858,7 +862,7 @@ func assertChannelAnnouncements(t *testing.T, alice, bob *testNode,
 				// _other_ node.
 				other := (j + 1) % 2
 				minHtlc := nodes[other].fundingMgr.cfg.
-					DefaultRoutingPolicy.MinHTLC
+					DefaultRoutingPolicy().MinHTLC
 
 				// We might expect a custom MinHTLC value.
 				if len(customMinHtlc) > 0 {
@@ -112,6 +112,18 @@ func lndMain() error {
 		}
 	}()
 
+	// If we were only asked to check the configuration, we'll validate
+	// that of the chain backend as well, and exit without connecting to
+	// it.
+	if cfg.CheckConfig {
+		if err := validateChainConfig(cfg); err != nil {
+			return err
+		}
+
+		fmt.Println("Configuration is valid")
+		return nil
+	}
+
 	// Show version at startup.
 	ltndLog.Infof("Version %s", version())
 
@@ -274,7 +286,7 @@ func lndMain() error {
 	// Lightning Network Daemon.
 	activeChainControl, chainCleanUp, err := newChainControlFromConfig(
 		cfg, chanDB, privateWalletPw, publicWalletPw, birthday,
-		recoveryWindow, unlockedWallet,
+		recoveryWindow, unlockedWallet, nil,
 	)
 	if err != nil {
 		fmt.Printf("unable to create chain control: %v\n", err)
@@ -298,6 +310,13 @@ func lndMain() error {
 		},
 	})
 	if err != nil {
+		// In watch-only mode, the wallet is only unlocked if it's
+		// passed to us unlocked by the wallet unlocker.
+		if cfg.WatchOnly {
+			err = fmt.Errorf("unable to derive identity key in "+
+				"watch-only mode, the wallet must be unlocked "+
+				"through the wallet unlocker: %v", err)
+		}
 		return err
 	}
 	idPrivKey.Curve = btcec.S256()
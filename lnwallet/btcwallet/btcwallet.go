@@ -2,7 +2,9 @@ package btcwallet
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"strings"
@@ -27,6 +29,12 @@ const (
 )
 
 var (
+	// ErrWatchOnlyNoWallet is returned if no wallet exists yet in
+	// watch-only mode, as a new wallet can't be created without its
+	// private passphrase.
+	ErrWatchOnlyNoWallet = errors.New("a new wallet can't be created " +
+		"in watch-only mode")
+
 	// waddrmgrNamespaceKey is the namespace key that the waddrmgr state is
 	// stored within the top-level waleltdb buckets of btcwallet.
 	waddrmgrNamespaceKey = []byte("waddrmgr")
@@ -38,6 +46,18 @@ var (
 		ExternalAddrType: waddrmgr.WitnessPubKey,
 		InternalAddrType: waddrmgr.WitnessPubKey,
 	}
+
+	// walletMetaBucket is the top-level bucket of the wallet database in
+	// which we record the parameters the wallet is used with.
+	walletMetaBucket = []byte("lnd-wallet-meta")
+
+	// walletNetworkKey is the key within the walletMetaBucket under which
+	// the name of the wallet's network is stored.
+	walletNetworkKey = []byte("network")
+
+	// walletCoinTypeKey is the key within the walletMetaBucket under which
+	// the coin type the wallet derives its lightning keys with is stored.
+	walletCoinTypeKey = []byte("coin-type")
 )
 
 // BtcWallet is an implementation of the lnwallet.WalletController interface
@@ -83,7 +103,10 @@ func New(cfg Config) (*BtcWallet, error) {
 	// Maybe the wallet has already been opened and unlocked by the
 	// WalletUnlocker. So if we get a non-nil value from the config,
 	// we assume everything is in order.
-	var wallet = cfg.Wallet
+	var (
+		wallet = cfg.Wallet
+		unload func() error
+	)
 	if wallet == nil {
 		// No ready wallet was passed, so try to open an existing one.
 		var pubPass []byte
@@ -99,7 +122,11 @@ func New(cfg Config) (*BtcWallet, error) {
 			return nil, err
 		}
 
-		if !walletExists {
+		switch {
+		case !walletExists && cfg.WatchOnly:
+			return nil, ErrWatchOnlyNoWallet
+
+		case !walletExists:
 			// Wallet has never been created, perform initial
 			// set up.
 			wallet, err = loader.CreateNewWallet(
@@ -109,7 +136,8 @@ func New(cfg Config) (*BtcWallet, error) {
 			if err != nil {
 				return nil, err
 			}
-		} else {
+
+		default:
 			// Wallet has been created and been initialized at
 			// this point, open it along with all the required DB
 			// namespaces, and the DB itself.
@@ -118,6 +146,18 @@ func New(cfg Config) (*BtcWallet, error) {
 				return nil, err
 			}
 		}
+		unload = loader.UnloadWallet
+	}
+
+	// Before using the wallet, we'll make sure it belongs to the network
+	// and coin type we're configured with, as its keys and addresses would
+	// be of no use otherwise.
+	err := checkWalletParams(wallet, cfg.NetParams, cfg.CoinType)
+	if err != nil {
+		if unload != nil {
+			unload()
+		}
+		return nil, err
 	}
 
 	return &BtcWallet{
@@ -131,6 +171,86 @@ func New(cfg Config) (*BtcWallet, error) {
 	}, nil
 }
 
+// checkWalletParams ensures that the given wallet is used with the network and
+// coin type it was first used with, which are recorded within its database.
+// Wallets that predate this record have their coin type inferred from the key
+// scopes of their lightning keys instead, before the record is added.
+func checkWalletParams(wallet *base.Wallet, netParams *chaincfg.Params,
+	coinType uint32) error {
+
+	var coinTypeBytes [4]byte
+	binary.BigEndian.PutUint32(coinTypeBytes[:], coinType)
+
+	db := wallet.Database()
+	return walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		meta, err := tx.CreateTopLevelBucket(walletMetaBucket)
+		if err != nil {
+			return err
+		}
+
+		network := meta.Get(walletNetworkKey)
+		if network != nil && string(network) != netParams.Name {
+			return fmt.Errorf("wallet was created for the %s "+
+				"network, but is being opened for %v, make "+
+				"sure lnd is configured for the wallet's "+
+				"network",
+				network, netParams.Name)
+		}
+
+		// If the wallet's coin type wasn't recorded yet, we'll look
+		// at the coin types of its lightning key scopes. A wallet
+		// whose coin type was changed in the past holds several of
+		// them, so we'll accept any of them.
+		existingCoinTypes := lightningCoinTypes(wallet)
+		if recorded := meta.Get(walletCoinTypeKey); len(recorded) == 4 {
+			existingCoinTypes = []uint32{
+				binary.BigEndian.Uint32(recorded),
+			}
+		}
+		if len(existingCoinTypes) > 0 &&
+			!containsCoinType(existingCoinTypes, coinType) {
+
+			return fmt.Errorf("wallet derives its keys with coin "+
+				"type %d, but is being opened with coin type "+
+				"%d, make sure lnd is configured for the "+
+				"wallet's chain and coin type",
+				existingCoinTypes[0], coinType)
+		}
+
+		err = meta.Put(walletNetworkKey, []byte(netParams.Name))
+		if err != nil {
+			return err
+		}
+		return meta.Put(walletCoinTypeKey, coinTypeBytes[:])
+	})
+}
+
+// lightningCoinTypes returns the coin types of the key scopes the given wallet
+// derives lightning keys within.
+func lightningCoinTypes(wallet *base.Wallet) []uint32 {
+	var coinTypes []uint32
+	for _, scopedMgr := range wallet.Manager.ActiveScopedKeyManagers() {
+		scope := scopedMgr.Scope()
+		if scope.Purpose == keychain.BIP0043Purpose {
+			coinTypes = append(coinTypes, scope.Coin)
+		}
+	}
+
+	return coinTypes
+}
+
+// containsCoinType returns whether the given coin type is among the passed
+// ones.
+func containsCoinType(coinTypes []uint32, coinType uint32) bool {
+	for _, c := range coinTypes {
+		if c == coinType {
+			return true
+		}
+	}
+
+	return false
+}
+
 // BackEnd returns the underlying ChainService's name as a string.
 //
 // This is a part of the WalletController interface.
@@ -163,11 +283,29 @@ func (b *BtcWallet) Start() error {
 	b.wallet.Start()
 
 	// Pass the rpc client into the wallet so it can sync up to the
-	// current main chain.
-	b.wallet.SynchronizeRPC(b.chain)
+	// current main chain. btcd's websocket client reconnects on its own,
+	// but loses its notification subscriptions in the process, so we'll
+	// restore them. If we're recovering the wallet, we may limit the
+	// number of addresses it scans for at once, so a large recovery window
+	// doesn't overwhelm the backend.
+	var chainSource chain.Interface = b.chain
+	if _, ok := b.chain.(*chain.RPCClient); ok {
+		chainSource = newResubscribingClient(chainSource)
+	}
+	if b.cfg.RecoveryWindow > 0 && b.cfg.RecoveryScanBatchSize > 0 {
+		chainSource = newBatchedRecoverySource(
+			chainSource, b.cfg.RecoveryScanBatchSize,
+		)
+	}
+	b.wallet.SynchronizeRPC(chainSource)
 
-	if err := b.wallet.Unlock(b.cfg.PrivatePass, nil); err != nil {
-		return err
+	// In watch-only mode, we'll never unlock the wallet, so it doesn't
+	// hold any private key material.
+	if !b.cfg.WatchOnly {
+		err := b.wallet.Unlock(b.cfg.PrivatePass, nil)
+		if err != nil {
+			return err
+		}
 	}
 
 	// We'll now ensure that the KeyScope: (1017, 1) exists within the
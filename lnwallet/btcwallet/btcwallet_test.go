@@ -0,0 +1,197 @@
+package btcwallet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcwallet/walletdb"
+	"github.com/lightningnetwork/lnd/keychain"
+)
+
+// TestWatchOnlyWallet ensures that an existing wallet can be opened in
+// watch-only mode without its private passphrase, in which case it's never
+// unlocked, while a new wallet can't be created in this mode.
+func TestWatchOnlyWallet(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "btcwallet")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := Config{
+		DataDir:   tempDir,
+		NetParams: &chaincfg.RegressionNetParams,
+		CoinType:  keychain.CoinTypeTestnet,
+		WatchOnly: true,
+	}
+
+	// Without an existing wallet, watch-only mode should be refused.
+	if _, err := New(cfg); err != ErrWatchOnlyNoWallet {
+		t.Fatalf("expected %v, got %v", ErrWatchOnlyNoWallet, err)
+	}
+
+	// We'll create the wallet with its private passphrase first, and
+	// close it again.
+	createCfg := cfg
+	createCfg.WatchOnly = false
+	createCfg.PrivatePass = []byte("private-pass")
+	createCfg.HdSeed = bytes.Repeat([]byte{0x01}, 32)
+	wallet, err := New(createCfg)
+	if err != nil {
+		t.Fatalf("unable to create wallet: %v", err)
+	}
+	if err := wallet.db.Close(); err != nil {
+		t.Fatalf("unable to close wallet: %v", err)
+	}
+
+	// Now, the wallet should be opened in watch-only mode without its
+	// private passphrase, and remain locked.
+	wallet, err = New(cfg)
+	if err != nil {
+		t.Fatalf("unable to open watch-only wallet: %v", err)
+	}
+	defer wallet.db.Close()
+
+	if !wallet.wallet.Manager.IsLocked() {
+		t.Fatalf("expected watch-only wallet to be locked")
+	}
+}
+
+// TestWalletParamsMismatch ensures that an existing wallet is only opened for
+// the network and coin type it was created for.
+func TestWalletParamsMismatch(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "btcwallet")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	privatePass := []byte("private-pass")
+	cfg := Config{
+		DataDir:     tempDir,
+		NetParams:   &chaincfg.RegressionNetParams,
+		CoinType:    keychain.CoinTypeTestnet,
+		PrivatePass: privatePass,
+		HdSeed:      bytes.Repeat([]byte{0x01}, 32),
+	}
+
+	// openWallet attempts to open the wallet with the given config,
+	// closing it again if it succeeds.
+	openWallet := func(cfg Config) error {
+		wallet, err := New(cfg)
+		if err != nil {
+			return err
+		}
+
+		return wallet.db.Close()
+	}
+
+	// We'll create the wallet first, which records its parameters.
+	if err := openWallet(cfg); err != nil {
+		t.Fatalf("unable to create wallet: %v", err)
+	}
+
+	// Opening it with another coin type should be refused, while it
+	// should still be opened with the one it was created with.
+	mainnetCfg := cfg
+	mainnetCfg.CoinType = keychain.CoinTypeBitcoin
+	if err := openWallet(mainnetCfg); err == nil {
+		t.Fatalf("expected coin type mismatch to be detected")
+	}
+	if err := openWallet(cfg); err != nil {
+		t.Fatalf("unable to open wallet: %v", err)
+	}
+
+	// We'll now move the wallet to the directory of another network, as
+	// if it was copied there by mistake, which should be refused as well.
+	const walletDBName = "wallet.db"
+	walletPath := filepath.Join(
+		NetworkDir(tempDir, cfg.NetParams), walletDBName,
+	)
+	simNetCfg := cfg
+	simNetCfg.NetParams = &chaincfg.SimNetParams
+	simNetDir := NetworkDir(tempDir, simNetCfg.NetParams)
+	if err := os.MkdirAll(simNetDir, 0700); err != nil {
+		t.Fatalf("unable to create wallet dir: %v", err)
+	}
+	err = os.Rename(walletPath, filepath.Join(simNetDir, walletDBName))
+	if err != nil {
+		t.Fatalf("unable to move wallet: %v", err)
+	}
+	if err := openWallet(simNetCfg); err == nil {
+		t.Fatalf("expected network mismatch to be detected")
+	}
+}
+
+// TestWalletParamsInferCoinType ensures that the coin type of a wallet which
+// predates the record of its parameters is inferred from its lightning key
+// scopes.
+func TestWalletParamsInferCoinType(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "btcwallet")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	privatePass := []byte("private-pass")
+	cfg := Config{
+		DataDir:     tempDir,
+		NetParams:   &chaincfg.RegressionNetParams,
+		CoinType:    keychain.CoinTypeTestnet,
+		PrivatePass: privatePass,
+		HdSeed:      bytes.Repeat([]byte{0x01}, 32),
+	}
+	wallet, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unable to create wallet: %v", err)
+	}
+
+	// We'll derive the wallet's lightning key scope, as it's done once
+	// the wallet is started, and remove the record of its parameters.
+	err = walletdb.Update(wallet.db, func(tx walletdb.ReadWriteTx) error {
+		addrmgrNs := tx.ReadWriteBucket(waddrmgrNamespaceKey)
+
+		manager := wallet.wallet.Manager
+		if err := manager.Unlock(addrmgrNs, privatePass); err != nil {
+			return err
+		}
+		_, err := manager.NewScopedKeyManager(
+			addrmgrNs, wallet.chainKeyScope, lightningAddrSchema,
+		)
+		if err != nil {
+			return err
+		}
+
+		return tx.DeleteTopLevelBucket(walletMetaBucket)
+	})
+	if err != nil {
+		t.Fatalf("unable to prepare wallet: %v", err)
+	}
+	if err := wallet.db.Close(); err != nil {
+		t.Fatalf("unable to close wallet: %v", err)
+	}
+
+	// The wallet should now be refused for another coin type, but still
+	// be opened with the one of its key scope.
+	mainnetCfg := cfg
+	mainnetCfg.CoinType = keychain.CoinTypeBitcoin
+	if _, err := New(mainnetCfg); err == nil {
+		t.Fatalf("expected coin type mismatch to be detected")
+	}
+
+	wallet, err = New(cfg)
+	if err != nil {
+		t.Fatalf("unable to open wallet: %v", err)
+	}
+	wallet.db.Close()
+}
@@ -56,6 +56,12 @@ type Config struct {
 	// instance. Without this, the wallet cannot be decrypted and operated.
 	PrivatePass []byte
 
+	// WatchOnly signals that the wallet should be operated without any of
+	// its private key material. The private password isn't required in
+	// this mode, so the wallet is never unlocked. As a result, the wallet
+	// must already exist, and won't be able to sign anything.
+	WatchOnly bool
+
 	// PublicPass is the optional public password to btcwallet. This is
 	// optionally used to encrypt public material such as public keys and
 	// scripts.
@@ -74,6 +80,12 @@ type Config struct {
 	// default BIP44 derivation paths.
 	RecoveryWindow uint32
 
+	// RecoveryScanBatchSize is the maximum number of addresses the wallet
+	// scans the chain for at once while recovering, to throttle the load
+	// on the backend. If zero, all addresses of the recovery window are
+	// scanned for at once.
+	RecoveryScanBatchSize uint32
+
 	// ChainSource is the primary chain interface. This is used to operate
 	// the wallet and do things such as rescanning, sending transactions,
 	// notifications for received funds, etc.
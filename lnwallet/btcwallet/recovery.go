@@ -0,0 +1,245 @@
+package btcwallet
+
+import (
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwallet/chain"
+	"github.com/btcsuite/btcwallet/waddrmgr"
+)
+
+// batchedRecoverySource is a chain.Interface which splits the requests to
+// filter blocks for the wallet's addresses, which btcwallet issues while
+// recovering a wallet, into batches of a maximum number of addresses. With a
+// large recovery window, each request covers thousands of addresses, which
+// may overwhelm a remote backend, so the batches are carried out one after
+// the other to throttle the load.
+type batchedRecoverySource struct {
+	chain.Interface
+
+	// batchSize is the maximum number of addresses scanned for at once.
+	batchSize uint32
+}
+
+// newBatchedRecoverySource wraps the passed chain source, such that it scans
+// for at most batchSize addresses at once during a recovery.
+func newBatchedRecoverySource(chainSource chain.Interface,
+	batchSize uint32) *batchedRecoverySource {
+
+	return &batchedRecoverySource{
+		Interface: chainSource,
+		batchSize: batchSize,
+	}
+}
+
+// scopedAddrs is a set of addresses of a FilterBlocksRequest, keyed by their
+// key scope and index.
+type scopedAddrs = map[waddrmgr.ScopedIndex]btcutil.Address
+
+// addrBatch is a subset of the addresses of a FilterBlocksRequest.
+type addrBatch struct {
+	external scopedAddrs
+	internal scopedAddrs
+}
+
+// FilterBlocks scans the blocks of the request for the addresses and outpoints
+// it watches, and returns the matches found within the first block containing
+// any, along with its index within the request. The addresses are scanned for
+// in batches, and the matches of all batches within that block are combined.
+// If no block contains any matches, nil is returned.
+//
+// NOTE: This is part of the chain.Interface interface.
+func (b *batchedRecoverySource) FilterBlocks(
+	req *chain.FilterBlocksRequest) (*chain.FilterBlocksResponse, error) {
+
+	batches := b.addrBatches(req)
+
+	var (
+		resp   *chain.FilterBlocksResponse
+		merged bool
+	)
+	for i, batch := range batches {
+		// The watched outpoints are only scanned for along with the
+		// first batch, so they're not matched multiple times.
+		batchReq := &chain.FilterBlocksRequest{
+			Blocks:        req.Blocks,
+			ExternalAddrs: batch.external,
+			InternalAddrs: batch.internal,
+		}
+		if i == 0 {
+			batchReq.WatchedOutPoints = req.WatchedOutPoints
+		}
+
+		// Once a batch had a match, the following ones only need to
+		// scan the blocks up to it, as later matches would be
+		// discarded anyway.
+		if resp != nil {
+			batchReq.Blocks = req.Blocks[:resp.BatchIndex+1]
+		}
+
+		batchResp, err := b.Interface.FilterBlocks(batchReq)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case batchResp == nil:
+
+		case resp == nil || batchResp.BatchIndex < resp.BatchIndex:
+			resp = batchResp
+			merged = false
+
+		case batchResp.BatchIndex == resp.BatchIndex:
+			mergeFilterBlocksResponse(resp, batchResp)
+			merged = true
+		}
+	}
+
+	// The wallet processes the relevant transactions in order, so if they
+	// were gathered from several batches, we'll restore their order
+	// within the block.
+	if merged {
+		if err := b.orderRelevantTxns(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// orderRelevantTxns sorts the relevant transactions of the passed response by
+// their position within the block they were found in.
+func (b *batchedRecoverySource) orderRelevantTxns(
+	resp *chain.FilterBlocksResponse) error {
+
+	block, err := b.Interface.GetBlock(&resp.BlockMeta.Hash)
+	if err != nil {
+		return err
+	}
+
+	positions := make(map[chainhash.Hash]int, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		positions[tx.TxHash()] = i
+	}
+	sort.SliceStable(resp.RelevantTxns, func(i, j int) bool {
+		return positions[resp.RelevantTxns[i].TxHash()] <
+			positions[resp.RelevantTxns[j].TxHash()]
+	})
+
+	return nil
+}
+
+// addrBatches splits the addresses of the passed request into batches of at
+// most batchSize addresses, in the order of their key scopes and indexes. A
+// request without any addresses results in a single empty batch, so its
+// outpoints are still scanned for.
+func (b *batchedRecoverySource) addrBatches(
+	req *chain.FilterBlocksRequest) []addrBatch {
+
+	newBatch := func() addrBatch {
+		return addrBatch{
+			external: make(scopedAddrs),
+			internal: make(scopedAddrs),
+		}
+	}
+
+	batches := []addrBatch{newBatch()}
+	var numAddrs uint32
+	add := func(addrs scopedAddrs, external bool) {
+		indexes := make([]waddrmgr.ScopedIndex, 0, len(addrs))
+		for index := range addrs {
+			indexes = append(indexes, index)
+		}
+		sort.Slice(indexes, func(i, j int) bool {
+			return scopedIndexLess(indexes[i], indexes[j])
+		})
+
+		for _, index := range indexes {
+			if numAddrs == b.batchSize {
+				batches = append(batches, newBatch())
+				numAddrs = 0
+			}
+
+			batch := batches[len(batches)-1]
+			if external {
+				batch.external[index] = addrs[index]
+			} else {
+				batch.internal[index] = addrs[index]
+			}
+			numAddrs++
+		}
+	}
+	add(req.ExternalAddrs, true)
+	add(req.InternalAddrs, false)
+
+	return batches
+}
+
+// scopedIndexLess returns whether the address with index a precedes the one
+// with index b, ordering them by their key scope first.
+func scopedIndexLess(a, b waddrmgr.ScopedIndex) bool {
+	switch {
+	case a.Scope.Purpose != b.Scope.Purpose:
+		return a.Scope.Purpose < b.Scope.Purpose
+
+	case a.Scope.Coin != b.Scope.Coin:
+		return a.Scope.Coin < b.Scope.Coin
+
+	default:
+		return a.Index < b.Index
+	}
+}
+
+// mergeFilterBlocksResponse adds the matches of the passed response to those
+// of the given one, which was found within the same block.
+func mergeFilterBlocksResponse(resp, other *chain.FilterBlocksResponse) {
+	if resp.FoundExternalAddrs == nil {
+		resp.FoundExternalAddrs = make(foundAddrs)
+	}
+	mergeFoundAddrs(resp.FoundExternalAddrs, other.FoundExternalAddrs)
+
+	if resp.FoundInternalAddrs == nil {
+		resp.FoundInternalAddrs = make(foundAddrs)
+	}
+	mergeFoundAddrs(resp.FoundInternalAddrs, other.FoundInternalAddrs)
+
+	if resp.FoundOutPoints == nil {
+		resp.FoundOutPoints = make(map[wire.OutPoint]btcutil.Address)
+	}
+	for op, addr := range other.FoundOutPoints {
+		resp.FoundOutPoints[op] = addr
+	}
+
+	// A transaction may match addresses of several batches, so we'll
+	// make sure to only include it once.
+	relevant := make(map[chainhash.Hash]struct{})
+	for _, tx := range resp.RelevantTxns {
+		relevant[tx.TxHash()] = struct{}{}
+	}
+	for _, tx := range other.RelevantTxns {
+		if _, ok := relevant[tx.TxHash()]; ok {
+			continue
+		}
+		relevant[tx.TxHash()] = struct{}{}
+		resp.RelevantTxns = append(resp.RelevantTxns, tx)
+	}
+}
+
+// foundAddrs is the set of indexes of the addresses found within each key
+// scope, as reported by a FilterBlocksResponse.
+type foundAddrs = map[waddrmgr.KeyScope]map[uint32]struct{}
+
+// mergeFoundAddrs adds the indexes of the found addresses of each key scope in
+// other to those in found.
+func mergeFoundAddrs(found, other foundAddrs) {
+	for scope, indexes := range other {
+		if found[scope] == nil {
+			found[scope] = make(map[uint32]struct{})
+		}
+		for index := range indexes {
+			found[scope][index] = struct{}{}
+		}
+	}
+}
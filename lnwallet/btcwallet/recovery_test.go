@@ -0,0 +1,211 @@
+package btcwallet
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwallet/chain"
+	"github.com/btcsuite/btcwallet/waddrmgr"
+	"github.com/btcsuite/btcwallet/wtxmgr"
+)
+
+// mockRecoverySource is a chain.Interface which simulates the blocks scanned
+// during a recovery. It reports each address as found within the block with
+// the index given by matches, and records the requests it receives.
+type mockRecoverySource struct {
+	chain.Interface
+
+	matches map[waddrmgr.ScopedIndex]uint32
+	block   *wire.MsgBlock
+	reqs    []*chain.FilterBlocksRequest
+}
+
+func (m *mockRecoverySource) FilterBlocks(
+	req *chain.FilterBlocksRequest) (*chain.FilterBlocksResponse, error) {
+
+	m.reqs = append(m.reqs, req)
+
+	var resp *chain.FilterBlocksResponse
+	match := func(addrs scopedAddrs, external bool) {
+		for index := range addrs {
+			blockIndex, ok := m.matches[index]
+			if !ok || blockIndex >= uint32(len(req.Blocks)) {
+				continue
+			}
+			if resp != nil && blockIndex > resp.BatchIndex {
+				continue
+			}
+			if resp == nil || blockIndex < resp.BatchIndex {
+				resp = &chain.FilterBlocksResponse{
+					BatchIndex: blockIndex,
+					BlockMeta:  req.Blocks[blockIndex],
+				}
+				resp.FoundExternalAddrs = make(foundAddrs)
+				resp.FoundInternalAddrs = make(foundAddrs)
+			}
+
+			found := resp.FoundInternalAddrs
+			if external {
+				found = resp.FoundExternalAddrs
+			}
+			if found[index.Scope] == nil {
+				found[index.Scope] = make(map[uint32]struct{})
+			}
+			found[index.Scope][index.Index] = struct{}{}
+
+			// Each address is paid by the transaction at the
+			// position of its index within the block.
+			tx := m.block.Transactions[index.Index]
+			resp.RelevantTxns = append(resp.RelevantTxns, tx)
+		}
+	}
+	match(req.ExternalAddrs, true)
+	match(req.InternalAddrs, false)
+
+	// Like an actual backend, we'll return the relevant transactions in
+	// the order of the block.
+	if resp != nil {
+		sort.Slice(resp.RelevantTxns, func(i, j int) bool {
+			return resp.RelevantTxns[i].LockTime <
+				resp.RelevantTxns[j].LockTime
+		})
+	}
+
+	return resp, nil
+}
+
+func (m *mockRecoverySource) GetBlock(*chainhash.Hash) (*wire.MsgBlock,
+	error) {
+
+	return m.block, nil
+}
+
+// TestBatchedRecoverySource ensures that the addresses scanned for during a
+// recovery are split into batches of the configured size, while the matches
+// within the first block containing any are combined across batches.
+func TestBatchedRecoverySource(t *testing.T) {
+	t.Parallel()
+
+	const (
+		numExternal = 10
+		numInternal = 5
+		batchSize   = 4
+	)
+
+	newAddrs := func(n int, branch byte) scopedAddrs {
+		addrs := make(scopedAddrs)
+		for i := 0; i < n; i++ {
+			var pkHash [20]byte
+			pkHash[0], pkHash[1] = branch, byte(i)
+			addr, err := btcutil.NewAddressWitnessPubKeyHash(
+				pkHash[:], &chaincfg.RegressionNetParams,
+			)
+			if err != nil {
+				t.Fatalf("unable to create address: %v", err)
+			}
+
+			index := waddrmgr.ScopedIndex{
+				Scope: waddrmgr.KeyScopeBIP0084,
+				Index: uint32(i) + uint32(branch)*numExternal,
+			}
+			addrs[index] = addr
+		}
+		return addrs
+	}
+	req := &chain.FilterBlocksRequest{
+		Blocks:        make([]wtxmgr.BlockMeta, 10),
+		ExternalAddrs: newAddrs(numExternal, 0),
+		InternalAddrs: newAddrs(numInternal, 1),
+	}
+
+	// The block containing the matches holds one transaction per address,
+	// ordered by the index of the address it pays to.
+	block := &wire.MsgBlock{}
+	for i := 0; i < numExternal+numInternal; i++ {
+		block.Transactions = append(block.Transactions, &wire.MsgTx{
+			Version:  1,
+			LockTime: uint32(i),
+		})
+	}
+
+	// Several addresses, which end up in different batches, are found
+	// within the third block, while one is only found later on.
+	scope := waddrmgr.KeyScopeBIP0084
+	backend := &mockRecoverySource{
+		matches: map[waddrmgr.ScopedIndex]uint32{
+			{Scope: scope, Index: 1}:  2,
+			{Scope: scope, Index: 7}:  2,
+			{Scope: scope, Index: 9}:  5,
+			{Scope: scope, Index: 12}: 2,
+		},
+		block: block,
+	}
+	source := newBatchedRecoverySource(backend, batchSize)
+
+	resp, err := source.FilterBlocks(req)
+	if err != nil {
+		t.Fatalf("unable to filter blocks: %v", err)
+	}
+
+	// The addresses should have been scanned for in batches of at most the
+	// configured size, covering all of them exactly once.
+	expectedBatches := (numExternal + numInternal + batchSize - 1) /
+		batchSize
+	if len(backend.reqs) != expectedBatches {
+		t.Fatalf("expected %d batches, got %d", expectedBatches,
+			len(backend.reqs))
+	}
+	scanned := make(map[waddrmgr.ScopedIndex]struct{})
+	for _, batchReq := range backend.reqs {
+		numAddrs := len(batchReq.ExternalAddrs) +
+			len(batchReq.InternalAddrs)
+		if numAddrs > batchSize {
+			t.Fatalf("expected at most %d addresses per batch, "+
+				"got %d", batchSize, numAddrs)
+		}
+		for index := range batchReq.ExternalAddrs {
+			scanned[index] = struct{}{}
+		}
+		for index := range batchReq.InternalAddrs {
+			scanned[index] = struct{}{}
+		}
+	}
+	if len(scanned) != numExternal+numInternal {
+		t.Fatalf("expected %d addresses to be scanned for, got %d",
+			numExternal+numInternal, len(scanned))
+	}
+
+	// The matches of all batches within the third block should have been
+	// combined, leaving out the later one.
+	if resp == nil || resp.BatchIndex != 2 {
+		t.Fatalf("expected matches within block 2, got %v", resp)
+	}
+	for _, index := range []uint32{1, 7} {
+		if _, ok := resp.FoundExternalAddrs[scope][index]; !ok {
+			t.Fatalf("expected external address %d to be found",
+				index)
+		}
+	}
+	if _, ok := resp.FoundExternalAddrs[scope][9]; ok {
+		t.Fatalf("expected later match to be left out")
+	}
+	if _, ok := resp.FoundInternalAddrs[scope][12]; !ok {
+		t.Fatalf("expected internal address 12 to be found")
+	}
+
+	// The relevant transactions should be in the order of the block.
+	if len(resp.RelevantTxns) != 3 {
+		t.Fatalf("expected 3 relevant transactions, got %d",
+			len(resp.RelevantTxns))
+	}
+	for i, index := range []uint32{1, 7, 12} {
+		if resp.RelevantTxns[i] != block.Transactions[index] {
+			t.Fatalf("expected relevant transaction %d to pay to "+
+				"address %d", i, index)
+		}
+	}
+}
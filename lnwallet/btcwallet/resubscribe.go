@@ -0,0 +1,167 @@
+package btcwallet
+
+import (
+	"sync"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwallet/chain"
+)
+
+// resubscribingClient is a chain.Interface which restores the notification
+// subscriptions of btcd's websocket client once it reconnects. The client
+// reconnects on its own after btcd is restarted, but btcd doesn't remember
+// the subscriptions of the previous connection, so the wallet would silently
+// stop receiving block and transaction notifications otherwise.
+type resubscribingClient struct {
+	chain.Interface
+
+	// notifyBlocks is true once block notifications were requested.
+	notifyBlocks bool
+
+	// addrs is the set of addresses transaction notifications were
+	// requested for, keyed by their encoding.
+	addrs map[string]btcutil.Address
+
+	// mtx guards notifyBlocks and addrs.
+	mtx sync.Mutex
+
+	notifications chan interface{}
+	forwardOnce   sync.Once
+
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// newResubscribingClient wraps the passed websocket client of btcd, such that
+// its notification subscriptions are restored once it reconnects.
+func newResubscribingClient(chainSource chain.Interface) *resubscribingClient {
+	return &resubscribingClient{
+		Interface:     chainSource,
+		addrs:         make(map[string]btcutil.Address),
+		notifications: make(chan interface{}),
+		quit:          make(chan struct{}),
+	}
+}
+
+// NotifyBlocks requests notifications for new blocks, which are requested
+// again once the client reconnects.
+//
+// NOTE: This is part of the chain.Interface interface.
+func (r *resubscribingClient) NotifyBlocks() error {
+	r.mtx.Lock()
+	r.notifyBlocks = true
+	r.mtx.Unlock()
+
+	return r.Interface.NotifyBlocks()
+}
+
+// NotifyReceived requests notifications for transactions paying to the passed
+// addresses, which are requested again once the client reconnects.
+//
+// NOTE: This is part of the chain.Interface interface.
+func (r *resubscribingClient) NotifyReceived(addrs []btcutil.Address) error {
+	r.mtx.Lock()
+	for _, addr := range addrs {
+		r.addrs[addr.EncodeAddress()] = addr
+	}
+	r.mtx.Unlock()
+
+	return r.Interface.NotifyReceived(addrs)
+}
+
+// Notifications returns the channel the client's notifications are delivered
+// on. Whenever the client reconnects, the subscriptions are restored before
+// the reconnection is passed on.
+//
+// NOTE: This is part of the chain.Interface interface.
+func (r *resubscribingClient) Notifications() <-chan interface{} {
+	r.forwardOnce.Do(func() {
+		go r.forwardNotifications(r.Interface.Notifications())
+	})
+
+	return r.notifications
+}
+
+// Stop stops forwarding the client's notifications, and then the client
+// itself.
+//
+// NOTE: This is part of the chain.Interface interface.
+func (r *resubscribingClient) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.quit)
+	})
+
+	r.Interface.Stop()
+}
+
+// forwardNotifications passes the notifications of the client on, restoring
+// its subscriptions each time it reconnects. The first connection of the
+// client is the one the subscriptions were made on, so it's passed on as is.
+//
+// NOTE: This MUST be run as a goroutine.
+func (r *resubscribingClient) forwardNotifications(
+	notifications <-chan interface{}) {
+
+	defer close(r.notifications)
+
+	var connected bool
+	for {
+		var ntfn interface{}
+		select {
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			ntfn = n
+
+		case <-r.quit:
+			return
+		}
+
+		if _, ok := ntfn.(chain.ClientConnected); ok {
+			if connected {
+				r.resubscribe()
+			}
+			connected = true
+		}
+
+		select {
+		case r.notifications <- ntfn:
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// resubscribe requests the notifications the client was subscribed to before
+// it reconnected.
+func (r *resubscribingClient) resubscribe() {
+	r.mtx.Lock()
+	notifyBlocks := r.notifyBlocks
+	addrs := make([]btcutil.Address, 0, len(r.addrs))
+	for _, addr := range r.addrs {
+		addrs = append(addrs, addr)
+	}
+	r.mtx.Unlock()
+
+	if notifyBlocks {
+		if err := r.Interface.NotifyBlocks(); err != nil {
+			log.Errorf("Unable to restore block notifications "+
+				"after reconnecting: %v", err)
+		} else {
+			log.Infof("Restored block notifications after " +
+				"reconnecting")
+		}
+	}
+
+	if len(addrs) > 0 {
+		if err := r.Interface.NotifyReceived(addrs); err != nil {
+			log.Errorf("Unable to restore transaction "+
+				"notifications for %d addresses after "+
+				"reconnecting: %v", len(addrs), err)
+		} else {
+			log.Infof("Restored transaction notifications for %d "+
+				"addresses after reconnecting", len(addrs))
+		}
+	}
+}
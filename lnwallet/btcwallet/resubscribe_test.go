@@ -0,0 +1,148 @@
+package btcwallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwallet/chain"
+)
+
+// mockWebsocketClient is a chain.Interface which simulates btcd's websocket
+// client, whose notifications are driven by the test. It records the
+// subscriptions it receives.
+type mockWebsocketClient struct {
+	chain.Interface
+
+	notifications chan interface{}
+	subscriptions chan interface{}
+}
+
+func newMockWebsocketClient() *mockWebsocketClient {
+	return &mockWebsocketClient{
+		notifications: make(chan interface{}),
+		subscriptions: make(chan interface{}, 10),
+	}
+}
+
+func (m *mockWebsocketClient) NotifyBlocks() error {
+	m.subscriptions <- "blocks"
+	return nil
+}
+
+func (m *mockWebsocketClient) NotifyReceived(addrs []btcutil.Address) error {
+	m.subscriptions <- len(addrs)
+	return nil
+}
+
+func (m *mockWebsocketClient) Notifications() <-chan interface{} {
+	return m.notifications
+}
+
+func (m *mockWebsocketClient) Stop() {}
+
+// TestResubscribingClient ensures that the notification subscriptions of
+// btcd's websocket client are restored once it reconnects, before the
+// reconnection is passed on, while the initial connection is passed on as is.
+func TestResubscribingClient(t *testing.T) {
+	t.Parallel()
+
+	backend := newMockWebsocketClient()
+	client := newResubscribingClient(backend)
+	notifications := client.Notifications()
+
+	send := func(ntfn interface{}) {
+		t.Helper()
+
+		select {
+		case backend.notifications <- ntfn:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notification not consumed")
+		}
+		select {
+		case n := <-notifications:
+			if n != ntfn {
+				t.Fatalf("expected notification %v, got %v",
+					ntfn, n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notification not passed on")
+		}
+	}
+	assertSubscription := func(expected interface{}) {
+		t.Helper()
+
+		select {
+		case sub := <-backend.subscriptions:
+			if sub != expected {
+				t.Fatalf("expected subscription %v, got %v",
+					expected, sub)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("subscription %v not made", expected)
+		}
+	}
+	assertNoSubscription := func() {
+		t.Helper()
+
+		select {
+		case sub := <-backend.subscriptions:
+			t.Fatalf("unexpected subscription %v", sub)
+		default:
+		}
+	}
+
+	// The initial connection should be passed on without subscribing, as
+	// the wallet subscribes once it's connected.
+	send(chain.ClientConnected{})
+	assertNoSubscription()
+
+	var addrs []btcutil.Address
+	for i := 0; i < 3; i++ {
+		var pkHash [20]byte
+		pkHash[0] = byte(i)
+		addr, err := btcutil.NewAddressWitnessPubKeyHash(
+			pkHash[:], &chaincfg.RegressionNetParams,
+		)
+		if err != nil {
+			t.Fatalf("unable to create address: %v", err)
+		}
+		addrs = append(addrs, addr)
+	}
+	if err := client.NotifyBlocks(); err != nil {
+		t.Fatalf("unable to subscribe to blocks: %v", err)
+	}
+	if err := client.NotifyReceived(addrs[:2]); err != nil {
+		t.Fatalf("unable to subscribe to addresses: %v", err)
+	}
+	if err := client.NotifyReceived(addrs[1:]); err != nil {
+		t.Fatalf("unable to subscribe to addresses: %v", err)
+	}
+	assertSubscription("blocks")
+	assertSubscription(2)
+	assertSubscription(2)
+
+	// Other notifications should be passed on without subscribing again.
+	send(chain.BlockConnected{})
+	assertNoSubscription()
+
+	// Once the client reconnects, the block notifications and those of
+	// all distinct addresses should be restored before the reconnection
+	// is passed on.
+	send(chain.ClientConnected{})
+	assertSubscription("blocks")
+	assertSubscription(3)
+
+	// Once stopped, the client's notifications should no longer be
+	// passed on.
+	client.Stop()
+	select {
+	case _, ok := <-notifications:
+		if ok {
+			t.Fatalf("unexpected notification after stopping")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("notifications not closed after stopping")
+	}
+}
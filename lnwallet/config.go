@@ -54,4 +54,10 @@ type Config struct {
 	// NetParams is the set of parameters that tells the wallet which chain
 	// it will be operating on.
 	NetParams chaincfg.Params
+
+	// AddressType is the type of address generated for the wallet's own
+	// funds, such as the change of funding transactions and the delivery
+	// addresses of cooperative closes. The zero value selects p2wkh
+	// addresses.
+	AddressType AddressType
 }
@@ -2,6 +2,12 @@ package lnwallet
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/rpcclient"
@@ -12,6 +18,10 @@ const (
 	// FeePerKwFloor is the lowest fee rate in sat/kw that we should use for
 	// determining transaction fees.
 	FeePerKwFloor SatPerKWeight = 253
+
+	// webAPIRequestTimeout is the maximum time we'll wait for a response
+	// from a fee estimation web API.
+	webAPIRequestTimeout = 30 * time.Second
 )
 
 // SatPerKVByte represents a fee rate in sat/kb.
@@ -61,6 +71,29 @@ type FeeEstimator interface {
 	Stop() error
 }
 
+// FallbackFeeEstimator is a FeeEstimator backed by live estimates, which falls
+// back to a static fee rate if the backend is unable to provide an estimate.
+type FallbackFeeEstimator interface {
+	FeeEstimator
+
+	// EstimateFeePerKWFallback returns the same fee estimate as
+	// EstimateFeePerKW, along with whether it's the fallback fee rate
+	// rather than a live estimate.
+	EstimateFeePerKWFallback(numBlocks uint32) (SatPerKWeight, bool, error)
+}
+
+// RefreshableFeeEstimator is a FeeEstimator which keeps the live estimates of
+// its backend around for some time, and is able to refresh them on demand,
+// e.g. once fees are known to have spiked.
+type RefreshableFeeEstimator interface {
+	FeeEstimator
+
+	// RefreshFeeEstimates queries the backend for fresh estimates right
+	// away, replacing the ones kept so far. An error is returned if the
+	// backend couldn't be queried.
+	RefreshFeeEstimates() error
+}
+
 // StaticFeeEstimator will return a static value for all fee calculation
 // requests. It is designed to be replaced by a proper fee calculation
 // implementation.
@@ -190,6 +223,17 @@ func (b *BtcdFeeEstimator) Stop() error {
 //
 // NOTE: This method is part of the FeeEstimator interface.
 func (b *BtcdFeeEstimator) EstimateFeePerKW(numBlocks uint32) (SatPerKWeight, error) {
+	feeEstimate, _, err := b.EstimateFeePerKWFallback(numBlocks)
+	return feeEstimate, err
+}
+
+// EstimateFeePerKWFallback returns the same fee estimate as EstimateFeePerKW,
+// along with whether it's the fallback fee rate rather than a live estimate.
+//
+// NOTE: This method is part of the FallbackFeeEstimator interface.
+func (b *BtcdFeeEstimator) EstimateFeePerKWFallback(
+	numBlocks uint32) (SatPerKWeight, bool, error) {
+
 	feeEstimate, err := b.fetchEstimate(numBlocks)
 	switch {
 	// If the estimator doesn't have enough data, or returns an error, then
@@ -200,10 +244,12 @@ func (b *BtcdFeeEstimator) EstimateFeePerKW(numBlocks uint32) (SatPerKWeight, er
 		fallthrough
 
 	case feeEstimate == 0:
-		return b.fallbackFeePerKW, nil
+		return fallbackEstimate(
+			numBlocks, b.fallbackFeePerKW, b.minFeePerKW,
+		), true, nil
 	}
 
-	return feeEstimate, nil
+	return feeEstimate, false, nil
 }
 
 // fetchEstimate returns a fee estimate for a transaction to be confirmed in
@@ -215,6 +261,14 @@ func (b *BtcdFeeEstimator) fetchEstimate(confTarget uint32) (SatPerKWeight, erro
 		return 0, err
 	}
 
+	// If btcd doesn't have enough data to produce an estimate yet, it
+	// returns a non-positive fee rate. We'll signal this with a zero
+	// estimate, so the fallback fee rate is used rather than the fee
+	// floor.
+	if btcPerKB <= 0 {
+		return 0, nil
+	}
+
 	// Next, we'll convert the returned value to satoshis, as it's
 	// currently returned in BTC.
 	satPerKB, err := btcutil.NewAmount(btcPerKB)
@@ -239,9 +293,43 @@ func (b *BtcdFeeEstimator) fetchEstimate(confTarget uint32) (SatPerKWeight, erro
 	return satPerKw, nil
 }
 
+// fallbackEstimate returns the fallback fee rate to use if the backend is
+// unable to provide an estimate for the given confirmation target. The fee
+// floor is enforced on the fallback fee rate as well, so a zero fee rate never
+// leaks through.
+func fallbackEstimate(confTarget uint32, fallbackFeePerKW,
+	minFeePerKW SatPerKWeight) SatPerKWeight {
+
+	feeRate := fallbackFeePerKW
+	if feeRate < minFeePerKW {
+		feeRate = minFeePerKW
+	}
+	if feeRate < FeePerKwFloor {
+		feeRate = FeePerKwFloor
+	}
+
+	walletLog.Debugf("No fee estimate available for conf target of %v, "+
+		"using fallback fee rate of %v sat/kw", confTarget,
+		int64(feeRate))
+
+	return feeRate
+}
+
 // A compile-time assertion to ensure that BtcdFeeEstimator implements the
-// FeeEstimator interface.
-var _ FeeEstimator = (*BtcdFeeEstimator)(nil)
+// FallbackFeeEstimator interface.
+var _ FallbackFeeEstimator = (*BtcdFeeEstimator)(nil)
+
+const (
+	// EstimateModeConservative selects bitcoind's conservative fee
+	// estimation mode, which considers a longer history of blocks and is
+	// less responsive to short-term drops in the prevailing fee market.
+	EstimateModeConservative = "CONSERVATIVE"
+
+	// EstimateModeEconomical selects bitcoind's economical fee estimation
+	// mode, which is more responsive to short-term drops in the prevailing
+	// fee market, potentially returning lower estimates.
+	EstimateModeEconomical = "ECONOMICAL"
+)
 
 // BitcoindFeeEstimator is an implementation of the FeeEstimator interface
 // backed by the RPC interface of an active bitcoind node. This implementation
@@ -258,6 +346,11 @@ type BitcoindFeeEstimator struct {
 	// through the network.
 	minFeePerKW SatPerKWeight
 
+	// estimateMode is the estimation mode estimates are requested with,
+	// either EstimateModeConservative or EstimateModeEconomical. If empty,
+	// bitcoind's default mode is used.
+	estimateMode string
+
 	bitcoindConn *rpcclient.Client
 }
 
@@ -265,9 +358,18 @@ type BitcoindFeeEstimator struct {
 // populated rpc config that is able to successfully connect and authenticate
 // with the bitcoind node, and also a fall back fee rate. The fallback fee rate
 // is used in the occasion that the estimator has insufficient data, or returns
-// zero for a fee estimate.
+// zero for a fee estimate. Estimates are requested with the given estimation
+// mode, or bitcoind's default one if it's empty.
 func NewBitcoindFeeEstimator(rpcConfig rpcclient.ConnConfig,
-	fallBackFeeRate SatPerKWeight) (*BitcoindFeeEstimator, error) {
+	fallBackFeeRate SatPerKWeight,
+	estimateMode string) (*BitcoindFeeEstimator, error) {
+
+	switch estimateMode {
+	case "", EstimateModeConservative, EstimateModeEconomical:
+	default:
+		return nil, fmt.Errorf("unknown fee estimation mode %q",
+			estimateMode)
+	}
 
 	rpcConfig.DisableConnectOnNew = true
 	rpcConfig.DisableAutoReconnect = false
@@ -280,6 +382,7 @@ func NewBitcoindFeeEstimator(rpcConfig rpcclient.ConnConfig,
 
 	return &BitcoindFeeEstimator{
 		fallbackFeePerKW: fallBackFeeRate,
+		estimateMode:     estimateMode,
 		bitcoindConn:     chainConn,
 	}, nil
 }
@@ -342,6 +445,17 @@ func (b *BitcoindFeeEstimator) Stop() error {
 //
 // NOTE: This method is part of the FeeEstimator interface.
 func (b *BitcoindFeeEstimator) EstimateFeePerKW(numBlocks uint32) (SatPerKWeight, error) {
+	feeEstimate, _, err := b.EstimateFeePerKWFallback(numBlocks)
+	return feeEstimate, err
+}
+
+// EstimateFeePerKWFallback returns the same fee estimate as EstimateFeePerKW,
+// along with whether it's the fallback fee rate rather than a live estimate.
+//
+// NOTE: This method is part of the FallbackFeeEstimator interface.
+func (b *BitcoindFeeEstimator) EstimateFeePerKWFallback(
+	numBlocks uint32) (SatPerKWeight, bool, error) {
+
 	feeEstimate, err := b.fetchEstimate(numBlocks)
 	switch {
 	// If the estimator doesn't have enough data, or returns an error, then
@@ -352,10 +466,12 @@ func (b *BitcoindFeeEstimator) EstimateFeePerKW(numBlocks uint32) (SatPerKWeight
 		fallthrough
 
 	case feeEstimate == 0:
-		return b.fallbackFeePerKW, nil
+		return fallbackEstimate(
+			numBlocks, b.fallbackFeePerKW, b.minFeePerKW,
+		), true, nil
 	}
 
-	return feeEstimate, nil
+	return feeEstimate, false, nil
 }
 
 // fetchEstimate returns a fee estimate for a transaction to be confirmed in
@@ -367,23 +483,43 @@ func (b *BitcoindFeeEstimator) fetchEstimate(confTarget uint32) (SatPerKWeight,
 	if err != nil {
 		return 0, err
 	}
-	// TODO: Allow selection of economical/conservative modifiers.
-	resp, err := b.bitcoindConn.RawRequest(
-		"estimatesmartfee", []json.RawMessage{target},
-	)
+	params := []json.RawMessage{target}
+
+	// If an estimation mode was selected, we'll pass it along, as
+	// bitcoind would use its default mode otherwise.
+	if b.estimateMode != "" {
+		mode, err := json.Marshal(b.estimateMode)
+		if err != nil {
+			return 0, err
+		}
+		params = append(params, mode)
+	}
+
+	resp, err := b.bitcoindConn.RawRequest("estimatesmartfee", params)
 	if err != nil {
 		return 0, err
 	}
 
 	// Next, we'll parse the response to get the BTC per KB.
 	feeEstimate := struct {
-		FeeRate float64 `json:"feerate"`
+		FeeRate float64  `json:"feerate"`
+		Errors  []string `json:"errors"`
 	}{}
 	err = json.Unmarshal(resp, &feeEstimate)
 	if err != nil {
 		return 0, err
 	}
 
+	// If bitcoind doesn't have enough data to produce an estimate yet,
+	// e.g. as it was just started or sees little activity, it omits the
+	// fee rate. We'll signal this with a zero estimate, so the fallback
+	// fee rate is used rather than the fee floor.
+	if feeEstimate.FeeRate <= 0 {
+		walletLog.Debugf("bitcoind returned no fee estimate for conf "+
+			"target of %v: %v", confTarget, feeEstimate.Errors)
+		return 0, nil
+	}
+
 	// Next, we'll convert the returned value to satoshis, as it's currently
 	// returned in BTC.
 	satPerKB, err := btcutil.NewAmount(feeEstimate.FeeRate)
@@ -411,5 +547,755 @@ func (b *BitcoindFeeEstimator) fetchEstimate(confTarget uint32) (SatPerKWeight,
 }
 
 // A compile-time assertion to ensure that BitcoindFeeEstimator implements the
+// FallbackFeeEstimator interface.
+var _ FallbackFeeEstimator = (*BitcoindFeeEstimator)(nil)
+
+// FixedTargetFeeEstimator is an implementation of the FeeEstimator interface
+// which wraps another FeeEstimator, and requests all of its estimates for a
+// fixed confirmation target, regardless of the target passed in by the caller.
+// This allows the aggressiveness of all on-chain fee estimates to be
+// controlled in a single place.
+type FixedTargetFeeEstimator struct {
+	// estimator is the underlying FeeEstimator that is queried for
+	// estimates.
+	estimator FeeEstimator
+
+	// confTarget is the confirmation target in blocks that all estimates
+	// will be requested for.
+	confTarget uint32
+}
+
+// NewFixedTargetFeeEstimator creates a new FixedTargetFeeEstimator which
+// requests all of its estimates from the passed estimator for the given
+// confirmation target.
+func NewFixedTargetFeeEstimator(estimator FeeEstimator,
+	confTarget uint32) *FixedTargetFeeEstimator {
+
+	return &FixedTargetFeeEstimator{
+		estimator:  estimator,
+		confTarget: confTarget,
+	}
+}
+
+// Start signals the FeeEstimator to start any processes or goroutines
+// it needs to perform its duty.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (f *FixedTargetFeeEstimator) Start() error {
+	return f.estimator.Start()
+}
+
+// Stop stops any spawned goroutines and cleans up the resources used
+// by the fee estimator.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (f *FixedTargetFeeEstimator) Stop() error {
+	return f.estimator.Stop()
+}
+
+// EstimateFeePerKW returns the estimated fee expressed in sat/kw for the fixed
+// confirmation target of the estimator. The passed target is ignored.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (f *FixedTargetFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (SatPerKWeight, error) {
+
+	return f.estimator.EstimateFeePerKW(f.confTarget)
+}
+
+// A compile-time assertion to ensure that FixedTargetFeeEstimator implements
+// the FeeEstimator interface.
+var _ FeeEstimator = (*FixedTargetFeeEstimator)(nil)
+
+// MaxFeeRateEstimator is an implementation of the FeeEstimator interface which
+// wraps another FeeEstimator, and clamps all of its estimates to a maximum fee
+// rate. This prevents fee spikes in the mempool from resulting in excessive
+// fees being paid for commitment and sweep transactions.
+type MaxFeeRateEstimator struct {
+	// estimator is the underlying FeeEstimator whose estimates are
+	// clamped.
+	estimator FeeEstimator
+
+	// maxFeePerKW is the maximum fee rate that will be returned by the
+	// estimator.
+	maxFeePerKW SatPerKWeight
+}
+
+// NewMaxFeeRateEstimator creates a new MaxFeeRateEstimator which clamps all
+// estimates of the passed estimator to the given maximum fee rate.
+func NewMaxFeeRateEstimator(estimator FeeEstimator,
+	maxFeePerKW SatPerKWeight) *MaxFeeRateEstimator {
+
+	return &MaxFeeRateEstimator{
+		estimator:   estimator,
+		maxFeePerKW: maxFeePerKW,
+	}
+}
+
+// Start signals the FeeEstimator to start any processes or goroutines
+// it needs to perform its duty.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (m *MaxFeeRateEstimator) Start() error {
+	return m.estimator.Start()
+}
+
+// Stop stops any spawned goroutines and cleans up the resources used
+// by the fee estimator.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (m *MaxFeeRateEstimator) Stop() error {
+	return m.estimator.Stop()
+}
+
+// EstimateFeePerKW returns the estimate of the underlying estimator for the
+// given confirmation target, clamped to the maximum fee rate.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (m *MaxFeeRateEstimator) EstimateFeePerKW(
+	numBlocks uint32) (SatPerKWeight, error) {
+
+	feePerKW, err := m.estimator.EstimateFeePerKW(numBlocks)
+	if err != nil {
+		return 0, err
+	}
+
+	if feePerKW > m.maxFeePerKW {
+		walletLog.Infof("Estimated fee rate of %v sat/kw for conf "+
+			"target of %v exceeds maximum fee rate, clamping to "+
+			"%v sat/kw", int64(feePerKW), numBlocks,
+			int64(m.maxFeePerKW))
+
+		feePerKW = m.maxFeePerKW
+	}
+
+	return feePerKW, nil
+}
+
+// A compile-time assertion to ensure that MaxFeeRateEstimator implements the
+// FeeEstimator interface.
+var _ FeeEstimator = (*MaxFeeRateEstimator)(nil)
+
+// MinFeeRateEstimator is an implementation of the FeeEstimator interface which
+// wraps another FeeEstimator, and raises all of its estimates to a minimum fee
+// rate, such as the backend's minimum relay fee. This prevents low estimates
+// and fallback fee rates from producing transactions that are rejected from
+// the mempool.
+type MinFeeRateEstimator struct {
+	// estimator is the underlying FeeEstimator whose estimates are
+	// raised.
+	estimator FeeEstimator
+
+	// minFeePerKW returns the current minimum fee rate, as it may change
+	// over time.
+	minFeePerKW func() SatPerKWeight
+}
+
+// NewMinFeeRateEstimator creates a new MinFeeRateEstimator which raises all
+// estimates of the passed estimator to the minimum fee rate returned by the
+// given function at the time of the estimate.
+func NewMinFeeRateEstimator(estimator FeeEstimator,
+	minFeePerKW func() SatPerKWeight) *MinFeeRateEstimator {
+
+	return &MinFeeRateEstimator{
+		estimator:   estimator,
+		minFeePerKW: minFeePerKW,
+	}
+}
+
+// Start signals the FeeEstimator to start any processes or goroutines
+// it needs to perform its duty.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (m *MinFeeRateEstimator) Start() error {
+	return m.estimator.Start()
+}
+
+// Stop stops any spawned goroutines and cleans up the resources used
+// by the fee estimator.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (m *MinFeeRateEstimator) Stop() error {
+	return m.estimator.Stop()
+}
+
+// EstimateFeePerKW returns the estimate of the underlying estimator for the
+// given confirmation target, raised to the minimum fee rate.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (m *MinFeeRateEstimator) EstimateFeePerKW(
+	numBlocks uint32) (SatPerKWeight, error) {
+
+	feePerKW, err := m.estimator.EstimateFeePerKW(numBlocks)
+	if err != nil {
+		return 0, err
+	}
+
+	minFeePerKW := m.minFeePerKW()
+	if feePerKW < minFeePerKW {
+		walletLog.Debugf("Estimated fee rate of %v sat/kw for conf "+
+			"target of %v is below minimum fee rate, raising to "+
+			"%v sat/kw", int64(feePerKW), numBlocks,
+			int64(minFeePerKW))
+
+		feePerKW = minFeePerKW
+	}
+
+	return feePerKW, nil
+}
+
+// A compile-time assertion to ensure that MinFeeRateEstimator implements the
 // FeeEstimator interface.
-var _ FeeEstimator = (*BitcoindFeeEstimator)(nil)
+var _ FeeEstimator = (*MinFeeRateEstimator)(nil)
+
+// cachedFeeEstimate is a fee estimate for a particular confirmation target
+// cached by the CachedFeeEstimator.
+type cachedFeeEstimate struct {
+	// The mutex is held while the estimate is refreshed, so that
+	// concurrent callers wait for the refreshed estimate rather than
+	// querying the underlying estimator themselves.
+	sync.Mutex
+
+	feePerKW SatPerKWeight
+	expiry   time.Time
+}
+
+// CachedFeeEstimator is an implementation of the FeeEstimator interface which
+// wraps another FeeEstimator, and caches its estimates for each confirmation
+// target for a fixed duration. This reduces the load on live estimators, which
+// would otherwise query their backend for every single estimate.
+type CachedFeeEstimator struct {
+	// estimator is the underlying FeeEstimator whose estimates are
+	// cached.
+	estimator FeeEstimator
+
+	// ttl is the duration for which an estimate is served from the cache
+	// before it's refreshed.
+	ttl time.Duration
+
+	estimates    map[uint32]*cachedFeeEstimate
+	estimatesMtx sync.Mutex
+}
+
+// NewCachedFeeEstimator creates a new CachedFeeEstimator which caches the
+// estimates of the passed estimator for the given duration.
+func NewCachedFeeEstimator(estimator FeeEstimator,
+	ttl time.Duration) *CachedFeeEstimator {
+
+	return &CachedFeeEstimator{
+		estimator: estimator,
+		ttl:       ttl,
+		estimates: make(map[uint32]*cachedFeeEstimate),
+	}
+}
+
+// Start signals the FeeEstimator to start any processes or goroutines
+// it needs to perform its duty.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (c *CachedFeeEstimator) Start() error {
+	return c.estimator.Start()
+}
+
+// Stop stops any spawned goroutines and cleans up the resources used
+// by the fee estimator.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (c *CachedFeeEstimator) Stop() error {
+	return c.estimator.Stop()
+}
+
+// EstimateFeePerKW takes in a target for the number of blocks until an initial
+// confirmation and returns the estimated fee expressed in sat/kw. The estimate
+// is served from the cache if it hasn't expired yet.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (c *CachedFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (SatPerKWeight, error) {
+
+	c.estimatesMtx.Lock()
+	estimate, ok := c.estimates[numBlocks]
+	if !ok {
+		estimate = &cachedFeeEstimate{}
+		c.estimates[numBlocks] = estimate
+	}
+	c.estimatesMtx.Unlock()
+
+	estimate.Lock()
+	defer estimate.Unlock()
+
+	if time.Now().Before(estimate.expiry) {
+		return estimate.feePerKW, nil
+	}
+
+	return c.refreshEstimate(numBlocks, estimate)
+}
+
+// RefreshFeeEstimates queries the underlying estimator for fresh estimates of
+// all cached confirmation targets right away, regardless of whether they've
+// expired yet.
+//
+// NOTE: This method is part of the RefreshableFeeEstimator interface.
+func (c *CachedFeeEstimator) RefreshFeeEstimates() error {
+	c.estimatesMtx.Lock()
+	estimates := make(map[uint32]*cachedFeeEstimate, len(c.estimates))
+	for numBlocks, estimate := range c.estimates {
+		estimates[numBlocks] = estimate
+	}
+	c.estimatesMtx.Unlock()
+
+	for numBlocks, estimate := range estimates {
+		estimate.Lock()
+		_, err := c.refreshEstimate(numBlocks, estimate)
+		estimate.Unlock()
+		if err != nil {
+			return fmt.Errorf("unable to refresh fee estimate for "+
+				"conf target of %v: %v", numBlocks, err)
+		}
+	}
+
+	return nil
+}
+
+// refreshEstimate queries the underlying estimator for a fresh estimate of the
+// given confirmation target and caches it.
+//
+// NOTE: The mutex of the estimate MUST be held.
+func (c *CachedFeeEstimator) refreshEstimate(numBlocks uint32,
+	estimate *cachedFeeEstimate) (SatPerKWeight, error) {
+
+	feePerKW, err := c.estimator.EstimateFeePerKW(numBlocks)
+	if err != nil {
+		return 0, err
+	}
+
+	estimate.feePerKW = feePerKW
+	estimate.expiry = time.Now().Add(c.ttl)
+
+	return feePerKW, nil
+}
+
+// A compile-time assertion to ensure that CachedFeeEstimator implements the
+// RefreshableFeeEstimator interface.
+var _ RefreshableFeeEstimator = (*CachedFeeEstimator)(nil)
+
+// polledFeeEstimate is a fee estimate polled by the PollingFeeEstimator, along
+// with the time it was last refreshed at.
+type polledFeeEstimate struct {
+	feePerKW SatPerKWeight
+	updated  time.Time
+}
+
+// PollingFeeEstimator is an implementation of the FeeEstimator interface which
+// wraps another FeeEstimator, and refreshes its estimates for each
+// confirmation target requested so far at a fixed interval. In contrast to the
+// CachedFeeEstimator, estimates are refreshed in the background, so the
+// interval determines how often the underlying estimator is queried,
+// regardless of the number of estimates requested.
+type PollingFeeEstimator struct {
+	started int32 // To be used atomically.
+	stopped int32 // To be used atomically.
+
+	// estimator is the underlying FeeEstimator whose estimates are
+	// polled.
+	estimator FeeEstimator
+
+	// pollInterval is the interval at which the estimates are refreshed.
+	pollInterval time.Duration
+
+	// maxAge is the maximum age of a polled estimate. Once an estimate
+	// couldn't be refreshed for longer, requests for it fail unless the
+	// underlying estimator is able to provide a fresh one, rather than
+	// returning the stale estimate. If zero, estimates are returned
+	// regardless of their age.
+	maxAge time.Duration
+
+	estimates    map[uint32]polledFeeEstimate
+	estimatesMtx sync.RWMutex
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// NewPollingFeeEstimator creates a new PollingFeeEstimator which refreshes the
+// estimates of the passed estimator every pollInterval. If maxAge is non-zero,
+// estimates which couldn't be refreshed within it are no longer returned.
+func NewPollingFeeEstimator(estimator FeeEstimator, pollInterval,
+	maxAge time.Duration) *PollingFeeEstimator {
+
+	return &PollingFeeEstimator{
+		estimator:    estimator,
+		pollInterval: pollInterval,
+		maxAge:       maxAge,
+		estimates:    make(map[uint32]polledFeeEstimate),
+		quit:         make(chan struct{}),
+	}
+}
+
+// Start signals the FeeEstimator to start any processes or goroutines
+// it needs to perform its duty.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (p *PollingFeeEstimator) Start() error {
+	if !atomic.CompareAndSwapInt32(&p.started, 0, 1) {
+		return nil
+	}
+
+	if err := p.estimator.Start(); err != nil {
+		return err
+	}
+
+	p.wg.Add(1)
+	go p.pollEstimates()
+
+	return nil
+}
+
+// Stop stops any spawned goroutines and cleans up the resources used
+// by the fee estimator.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (p *PollingFeeEstimator) Stop() error {
+	if !atomic.CompareAndSwapInt32(&p.stopped, 0, 1) {
+		return nil
+	}
+
+	close(p.quit)
+	p.wg.Wait()
+
+	return p.estimator.Stop()
+}
+
+// EstimateFeePerKW takes in a target for the number of blocks until an initial
+// confirmation and returns the estimated fee expressed in sat/kw. The latest
+// polled estimate is returned, while the first estimate for a target is
+// queried from the underlying estimator right away. If the polled estimate is
+// older than the maximum age, it's queried right away as well, and an error is
+// returned if that fails.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (p *PollingFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (SatPerKWeight, error) {
+
+	p.estimatesMtx.RLock()
+	estimate, ok := p.estimates[numBlocks]
+	p.estimatesMtx.RUnlock()
+
+	age := time.Since(estimate.updated)
+	stale := p.maxAge > 0 && age > p.maxAge
+	if ok && !stale {
+		return estimate.feePerKW, nil
+	}
+
+	feePerKW, err := p.estimator.EstimateFeePerKW(numBlocks)
+	switch {
+	case err != nil && ok:
+		return 0, fmt.Errorf("fee estimate for conf target of %v "+
+			"wasn't refreshed for %v, exceeding its max age of "+
+			"%v: %v", numBlocks, age, p.maxAge, err)
+
+	case err != nil:
+		return 0, err
+	}
+
+	p.estimatesMtx.Lock()
+	p.estimates[numBlocks] = polledFeeEstimate{
+		feePerKW: feePerKW,
+		updated:  time.Now(),
+	}
+	p.estimatesMtx.Unlock()
+
+	return feePerKW, nil
+}
+
+// pollEstimates periodically refreshes the estimates of all confirmation
+// targets requested so far until the estimator is stopped.
+//
+// NOTE: This MUST be run as a goroutine.
+func (p *PollingFeeEstimator) pollEstimates() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.updateEstimates()
+
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// RefreshFeeEstimates queries the underlying estimator for fresh estimates of
+// all confirmation targets requested so far right away, rather than waiting
+// for the next poll.
+//
+// NOTE: This method is part of the RefreshableFeeEstimator interface.
+func (p *PollingFeeEstimator) RefreshFeeEstimates() error {
+	return p.updateEstimates()
+}
+
+// updateEstimates queries the underlying estimator for fresh estimates of all
+// confirmation targets requested so far. If a query fails, the previous
+// estimate of its target is kept until it exceeds the maximum age, and the
+// first such error is returned once all targets were queried.
+func (p *PollingFeeEstimator) updateEstimates() error {
+	p.estimatesMtx.RLock()
+	targets := make([]uint32, 0, len(p.estimates))
+	for numBlocks := range p.estimates {
+		targets = append(targets, numBlocks)
+	}
+	p.estimatesMtx.RUnlock()
+
+	var firstErr error
+	for _, numBlocks := range targets {
+		feePerKW, err := p.estimator.EstimateFeePerKW(numBlocks)
+		if err != nil {
+			err = fmt.Errorf("unable to refresh fee estimate for "+
+				"conf target of %v: %v", numBlocks, err)
+			walletLog.Error(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		p.estimatesMtx.Lock()
+		p.estimates[numBlocks] = polledFeeEstimate{
+			feePerKW: feePerKW,
+			updated:  time.Now(),
+		}
+		p.estimatesMtx.Unlock()
+	}
+
+	return firstErr
+}
+
+// A compile-time assertion to ensure that PollingFeeEstimator implements the
+// RefreshableFeeEstimator interface.
+var _ RefreshableFeeEstimator = (*PollingFeeEstimator)(nil)
+
+// webAPIFees is the set of recommended fee rates in sat/vbyte returned by a
+// mempool.space-style fee estimation web API.
+type webAPIFees struct {
+	// FastestFee is the fee rate recommended for confirmation within the
+	// next block.
+	FastestFee int64 `json:"fastestFee"`
+
+	// HalfHourFee is the fee rate recommended for confirmation within
+	// three blocks.
+	HalfHourFee int64 `json:"halfHourFee"`
+
+	// HourFee is the fee rate recommended for confirmation within six
+	// blocks.
+	HourFee int64 `json:"hourFee"`
+}
+
+// WebAPIFeeEstimator is an implementation of the FeeEstimator interface which
+// periodically queries a mempool.space-style fee estimation web API, and
+// caches the latest recommended fee rates. This allows light clients, which
+// have no local source of fee estimates, to use live estimates.
+type WebAPIFeeEstimator struct {
+	started int32 // To be used atomically.
+	stopped int32 // To be used atomically.
+
+	// feeURL is the URL of the web API's recommended fees endpoint.
+	feeURL string
+
+	// pollInterval is the interval at which the web API is queried for
+	// fresh fee rates.
+	pollInterval time.Duration
+
+	// fallbackFeePerKW is the fallback fee rate in sat/kw that is returned
+	// if the web API couldn't be queried successfully.
+	fallbackFeePerKW SatPerKWeight
+
+	client *http.Client
+
+	// fees is the latest set of fee rates returned by the web API. It's
+	// nil if the latest query failed.
+	fees    *webAPIFees
+	feesMtx sync.RWMutex
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// NewWebAPIFeeEstimator creates a new WebAPIFeeEstimator which queries the
+// given fee URL every pollInterval, using the passed dial function to connect
+// to the web API. The fallback fee rate is returned whenever the web API
+// couldn't be queried successfully.
+func NewWebAPIFeeEstimator(feeURL string,
+	dial func(network, addr string) (net.Conn, error),
+	pollInterval time.Duration,
+	fallBackFeeRate SatPerKWeight) *WebAPIFeeEstimator {
+
+	return &WebAPIFeeEstimator{
+		feeURL:           feeURL,
+		pollInterval:     pollInterval,
+		fallbackFeePerKW: fallBackFeeRate,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Dial: dial,
+			},
+			Timeout: webAPIRequestTimeout,
+		},
+		quit: make(chan struct{}),
+	}
+}
+
+// Start signals the FeeEstimator to start any processes or goroutines
+// it needs to perform its duty.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (w *WebAPIFeeEstimator) Start() error {
+	if !atomic.CompareAndSwapInt32(&w.started, 0, 1) {
+		return nil
+	}
+
+	// We'll query the web API once before returning, so estimates are
+	// available right away if it's reachable.
+	w.updateFees()
+
+	w.wg.Add(1)
+	go w.pollFees()
+
+	return nil
+}
+
+// Stop stops any spawned goroutines and cleans up the resources used
+// by the fee estimator.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (w *WebAPIFeeEstimator) Stop() error {
+	if !atomic.CompareAndSwapInt32(&w.stopped, 0, 1) {
+		return nil
+	}
+
+	close(w.quit)
+	w.wg.Wait()
+
+	return nil
+}
+
+// EstimateFeePerKW takes in a target for the number of blocks until an initial
+// confirmation and returns the estimated fee expressed in sat/kw. The target
+// is mapped onto the closest recommended fee rate returned by the web API.
+//
+// NOTE: This method is part of the FeeEstimator interface.
+func (w *WebAPIFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (SatPerKWeight, error) {
+
+	w.feesMtx.RLock()
+	fees := w.fees
+	w.feesMtx.RUnlock()
+
+	// If we don't have any fee rates from the web API, then we'll return
+	// the default fall back fee rate.
+	if fees == nil {
+		return w.fallbackFeePerKW, nil
+	}
+
+	var satPerVByte int64
+	switch {
+	case numBlocks <= 1:
+		satPerVByte = fees.FastestFee
+	case numBlocks <= 3:
+		satPerVByte = fees.HalfHourFee
+	default:
+		satPerVByte = fees.HourFee
+	}
+
+	if satPerVByte == 0 {
+		return w.fallbackFeePerKW, nil
+	}
+
+	// Since we use fee rates in sat/kw internally, we'll convert the
+	// recommended fee rate from its sat/vbyte representation to sat/kw,
+	// and enforce our fee floor.
+	satPerKw := SatPerKVByte(satPerVByte * 1000).FeePerKWeight()
+	if satPerKw < FeePerKwFloor {
+		satPerKw = FeePerKwFloor
+	}
+
+	walletLog.Debugf("Returning %v sat/kw for conf target of %v",
+		int64(satPerKw), numBlocks)
+
+	return satPerKw, nil
+}
+
+// pollFees periodically queries the web API for fresh fee rates until the
+// estimator is stopped.
+//
+// NOTE: This MUST be run as a goroutine.
+func (w *WebAPIFeeEstimator) pollFees() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.updateFees()
+
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// RefreshFeeEstimates queries the web API for fresh fee rates right away,
+// rather than waiting for the next poll.
+//
+// NOTE: This method is part of the RefreshableFeeEstimator interface.
+func (w *WebAPIFeeEstimator) RefreshFeeEstimates() error {
+	return w.updateFees()
+}
+
+// updateFees queries the web API for fresh fee rates and caches them. If the
+// query fails, the cached fee rates are discarded, so that the fallback fee
+// rate is used until the web API can be queried successfully again, and the
+// error is returned.
+func (w *WebAPIFeeEstimator) updateFees() error {
+	fees, err := w.fetchFees()
+	if err != nil {
+		walletLog.Errorf("unable to query fee estimation web API: %v",
+			err)
+	}
+
+	w.feesMtx.Lock()
+	w.fees = fees
+	w.feesMtx.Unlock()
+
+	return err
+}
+
+// fetchFees queries the web API for its current set of recommended fee rates.
+func (w *WebAPIFeeEstimator) fetchFees() (*webAPIFees, error) {
+	resp, err := w.client.Get(w.feeURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from %v: %v",
+			w.feeURL, resp.Status)
+	}
+
+	var fees webAPIFees
+	if err := json.NewDecoder(resp.Body).Decode(&fees); err != nil {
+		return nil, fmt.Errorf("unable to decode fees from %v: %v",
+			w.feeURL, err)
+	}
+
+	return &fees, nil
+}
+
+// A compile-time assertion to ensure that WebAPIFeeEstimator implements the
+// RefreshableFeeEstimator interface.
+var _ RefreshableFeeEstimator = (*WebAPIFeeEstimator)(nil)
@@ -1,8 +1,18 @@
 package lnwallet_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/btcsuite/btcutil"
 	"github.com/lightningnetwork/lnd/lnwallet"
 )
@@ -91,3 +101,727 @@ func TestStaticFeeEstimator(t *testing.T) {
 		t.Fatalf("expected fee rate %v, got %v", feePerKw, feeRate)
 	}
 }
+
+// recordingFeeEstimator is a FeeEstimator that records the confirmation
+// targets it's queried for, returning a fee rate derived from the target.
+type recordingFeeEstimator struct {
+	targets []uint32
+}
+
+func (r *recordingFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	r.targets = append(r.targets, numBlocks)
+	return lnwallet.SatPerKWeight(numBlocks * 1000), nil
+}
+
+func (r *recordingFeeEstimator) Start() error {
+	return nil
+}
+
+func (r *recordingFeeEstimator) Stop() error {
+	return nil
+}
+
+// TestFixedTargetFeeEstimator checks that the FixedTargetFeeEstimator always
+// queries the underlying estimator for its configured confirmation target.
+func TestFixedTargetFeeEstimator(t *testing.T) {
+	t.Parallel()
+
+	const confTarget = 12
+
+	recorder := &recordingFeeEstimator{}
+	feeEstimator := lnwallet.NewFixedTargetFeeEstimator(
+		recorder, confTarget,
+	)
+	if err := feeEstimator.Start(); err != nil {
+		t.Fatalf("unable to start fee estimator: %v", err)
+	}
+	defer feeEstimator.Stop()
+
+	for _, numBlocks := range []uint32{1, 6, 144} {
+		feeRate, err := feeEstimator.EstimateFeePerKW(numBlocks)
+		if err != nil {
+			t.Fatalf("unable to get fee rate: %v", err)
+		}
+
+		expectedFeeRate := lnwallet.SatPerKWeight(confTarget * 1000)
+		if feeRate != expectedFeeRate {
+			t.Fatalf("expected fee rate %v, got %v",
+				expectedFeeRate, feeRate)
+		}
+	}
+
+	for _, target := range recorder.targets {
+		if target != confTarget {
+			t.Fatalf("expected estimate for conf target %v, "+
+				"got %v", confTarget, target)
+		}
+	}
+}
+
+// TestMaxFeeRateEstimator checks that the MaxFeeRateEstimator clamps estimates
+// above its maximum fee rate, while passing through all others unchanged.
+func TestMaxFeeRateEstimator(t *testing.T) {
+	t.Parallel()
+
+	const maxFeePerKW = lnwallet.SatPerKWeight(6000)
+
+	feeEstimator := lnwallet.NewMaxFeeRateEstimator(
+		&recordingFeeEstimator{}, maxFeePerKW,
+	)
+	if err := feeEstimator.Start(); err != nil {
+		t.Fatalf("unable to start fee estimator: %v", err)
+	}
+	defer feeEstimator.Stop()
+
+	testCases := []struct {
+		numBlocks       uint32
+		expectedFeeRate lnwallet.SatPerKWeight
+	}{
+		{numBlocks: 2, expectedFeeRate: 2000},
+		{numBlocks: 6, expectedFeeRate: maxFeePerKW},
+		{numBlocks: 144, expectedFeeRate: maxFeePerKW},
+	}
+	for _, test := range testCases {
+		feeRate, err := feeEstimator.EstimateFeePerKW(test.numBlocks)
+		if err != nil {
+			t.Fatalf("unable to get fee rate: %v", err)
+		}
+
+		if feeRate != test.expectedFeeRate {
+			t.Fatalf("expected fee rate %v for conf target %v, "+
+				"got %v", test.expectedFeeRate, test.numBlocks,
+				feeRate)
+		}
+	}
+}
+
+// TestMinFeeRateEstimator checks that the MinFeeRateEstimator raises estimates
+// below its current minimum fee rate, while passing through all others
+// unchanged.
+func TestMinFeeRateEstimator(t *testing.T) {
+	t.Parallel()
+
+	minFeePerKW := lnwallet.SatPerKWeight(5000)
+	feeEstimator := lnwallet.NewMinFeeRateEstimator(
+		&recordingFeeEstimator{}, func() lnwallet.SatPerKWeight {
+			return minFeePerKW
+		},
+	)
+	if err := feeEstimator.Start(); err != nil {
+		t.Fatalf("unable to start fee estimator: %v", err)
+	}
+	defer feeEstimator.Stop()
+
+	testCases := []struct {
+		numBlocks       uint32
+		minFeePerKW     lnwallet.SatPerKWeight
+		expectedFeeRate lnwallet.SatPerKWeight
+	}{
+		{numBlocks: 2, minFeePerKW: 5000, expectedFeeRate: 5000},
+		{numBlocks: 6, minFeePerKW: 5000, expectedFeeRate: 6000},
+		{numBlocks: 144, minFeePerKW: 5000, expectedFeeRate: 144000},
+
+		// Once the minimum fee rate rises, estimates should be raised
+		// to the new one.
+		{numBlocks: 6, minFeePerKW: 8000, expectedFeeRate: 8000},
+	}
+	for _, test := range testCases {
+		minFeePerKW = test.minFeePerKW
+
+		feeRate, err := feeEstimator.EstimateFeePerKW(test.numBlocks)
+		if err != nil {
+			t.Fatalf("unable to get fee rate: %v", err)
+		}
+
+		if feeRate != test.expectedFeeRate {
+			t.Fatalf("expected fee rate %v for conf target %v, "+
+				"got %v", test.expectedFeeRate, test.numBlocks,
+				feeRate)
+		}
+	}
+}
+
+// countingFeeEstimator is a FeeEstimator that counts the number of estimates
+// it has been queried for, taking some time to respond to each of them.
+type countingFeeEstimator struct {
+	numEstimates int32
+}
+
+func (c *countingFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	numEstimates := atomic.AddInt32(&c.numEstimates, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	return lnwallet.SatPerKWeight(numEstimates * 1000), nil
+}
+
+func (c *countingFeeEstimator) Start() error {
+	return nil
+}
+
+func (c *countingFeeEstimator) Stop() error {
+	return nil
+}
+
+// TestCachedFeeEstimator checks that the CachedFeeEstimator only queries the
+// underlying estimator once per confirmation target within its TTL, even with
+// concurrent callers.
+func TestCachedFeeEstimator(t *testing.T) {
+	t.Parallel()
+
+	const ttl = 200 * time.Millisecond
+
+	counter := &countingFeeEstimator{}
+	feeEstimator := lnwallet.NewCachedFeeEstimator(counter, ttl)
+	if err := feeEstimator.Start(); err != nil {
+		t.Fatalf("unable to start fee estimator: %v", err)
+	}
+	defer feeEstimator.Stop()
+
+	// All concurrent callers within the TTL should share the estimate of
+	// a single query.
+	const numCallers = 20
+	var wg sync.WaitGroup
+	feeRates := make(chan lnwallet.SatPerKWeight, numCallers)
+	for i := 0; i < numCallers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			feeRate, err := feeEstimator.EstimateFeePerKW(6)
+			if err != nil {
+				t.Errorf("unable to get fee rate: %v", err)
+				return
+			}
+			feeRates <- feeRate
+		}()
+	}
+	wg.Wait()
+	close(feeRates)
+
+	if n := atomic.LoadInt32(&counter.numEstimates); n != 1 {
+		t.Fatalf("expected 1 estimate to be queried, got %d", n)
+	}
+	for feeRate := range feeRates {
+		if feeRate != 1000 {
+			t.Fatalf("expected cached fee rate of 1000, got %v",
+				feeRate)
+		}
+	}
+
+	// A different confirmation target should be queried separately.
+	if _, err := feeEstimator.EstimateFeePerKW(1); err != nil {
+		t.Fatalf("unable to get fee rate: %v", err)
+	}
+	if n := atomic.LoadInt32(&counter.numEstimates); n != 2 {
+		t.Fatalf("expected 2 estimates to be queried, got %d", n)
+	}
+
+	// Once the TTL has expired, the estimate should be refreshed.
+	time.Sleep(ttl)
+	feeRate, err := feeEstimator.EstimateFeePerKW(6)
+	if err != nil {
+		t.Fatalf("unable to get fee rate: %v", err)
+	}
+	if feeRate != 3000 {
+		t.Fatalf("expected refreshed fee rate of 3000, got %v",
+			feeRate)
+	}
+
+	// A forced refresh should query fresh estimates of all cached targets
+	// right away, even though they haven't expired yet.
+	if err := feeEstimator.RefreshFeeEstimates(); err != nil {
+		t.Fatalf("unable to refresh fee estimates: %v", err)
+	}
+	if n := atomic.LoadInt32(&counter.numEstimates); n != 5 {
+		t.Fatalf("expected 5 estimates to be queried, got %d", n)
+	}
+	feeRate, err = feeEstimator.EstimateFeePerKW(6)
+	if err != nil {
+		t.Fatalf("unable to get fee rate: %v", err)
+	}
+	if feeRate <= 3000 {
+		t.Fatalf("expected refreshed fee rate, got %v", feeRate)
+	}
+	if n := atomic.LoadInt32(&counter.numEstimates); n != 5 {
+		t.Fatalf("expected refreshed estimate to be cached")
+	}
+}
+
+// TestPollingFeeEstimator checks that the PollingFeeEstimator refreshes the
+// estimates of the requested confirmation targets at the configured interval,
+// independently of how often estimates are requested.
+func TestPollingFeeEstimator(t *testing.T) {
+	t.Parallel()
+
+	const (
+		pollInterval = 100 * time.Millisecond
+		numPolls     = 5
+	)
+
+	counter := &countingFeeEstimator{}
+	feeEstimator := lnwallet.NewPollingFeeEstimator(
+		counter, pollInterval, 0,
+	)
+	if err := feeEstimator.Start(); err != nil {
+		t.Fatalf("unable to start fee estimator: %v", err)
+	}
+
+	// The first estimate for a target should be queried right away, while
+	// further requests should be served from the polled estimates.
+	for i := 0; i < 10; i++ {
+		feeRate, err := feeEstimator.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("unable to get fee rate: %v", err)
+		}
+		if feeRate != 1000 {
+			t.Fatalf("expected fee rate of 1000, got %v", feeRate)
+		}
+	}
+	if n := atomic.LoadInt32(&counter.numEstimates); n != 1 {
+		t.Fatalf("expected 1 estimate to be queried, got %d", n)
+	}
+
+	// After a few intervals, the estimate should have been refreshed once
+	// per interval, allowing for some scheduling jitter.
+	time.Sleep(numPolls*pollInterval + pollInterval/2)
+	n := atomic.LoadInt32(&counter.numEstimates)
+	if n < numPolls || n > numPolls+2 {
+		t.Fatalf("expected about %d estimates to be queried, got %d",
+			numPolls+1, n)
+	}
+	feeRate, err := feeEstimator.EstimateFeePerKW(6)
+	if err != nil {
+		t.Fatalf("unable to get fee rate: %v", err)
+	}
+	if feeRate < lnwallet.SatPerKWeight(n-1)*1000 {
+		t.Fatalf("expected refreshed fee rate, got %v", feeRate)
+	}
+
+	// Once stopped, the estimates should no longer be refreshed.
+	if err := feeEstimator.Stop(); err != nil {
+		t.Fatalf("unable to stop fee estimator: %v", err)
+	}
+	n = atomic.LoadInt32(&counter.numEstimates)
+	time.Sleep(2 * pollInterval)
+	if atomic.LoadInt32(&counter.numEstimates) != n {
+		t.Fatalf("expected no estimates to be queried once stopped")
+	}
+
+	// A forced refresh should still query a fresh estimate right away,
+	// rather than waiting for the next poll.
+	if err := feeEstimator.RefreshFeeEstimates(); err != nil {
+		t.Fatalf("unable to refresh fee estimates: %v", err)
+	}
+	if atomic.LoadInt32(&counter.numEstimates) != n+1 {
+		t.Fatalf("expected 1 estimate to be queried on refresh")
+	}
+	feeRate, err = feeEstimator.EstimateFeePerKW(6)
+	if err != nil {
+		t.Fatalf("unable to get fee rate: %v", err)
+	}
+	if feeRate != lnwallet.SatPerKWeight(n+1)*1000 {
+		t.Fatalf("expected refreshed fee rate of %v, got %v",
+			(n+1)*1000, feeRate)
+	}
+}
+
+// flakyFeeEstimator is a FeeEstimator which fails to provide estimates while
+// failing is set, e.g. while its backend is unreachable.
+type flakyFeeEstimator struct {
+	lnwallet.StaticFeeEstimator
+
+	failing int32 // To be used atomically.
+}
+
+func (f *flakyFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	if atomic.LoadInt32(&f.failing) == 1 {
+		return 0, fmt.Errorf("backend unreachable")
+	}
+
+	return f.FeePerKW, nil
+}
+
+// TestPollingFeeEstimatorMaxAge checks that the PollingFeeEstimator fails to
+// return estimates which couldn't be refreshed within their max age, rather
+// than the stale estimates, while they're returned regardless of their age
+// without a max age.
+func TestPollingFeeEstimatorMaxAge(t *testing.T) {
+	t.Parallel()
+
+	const maxAge = 100 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		stale  bool
+	}{
+		{
+			name:   "no max age",
+			maxAge: 0,
+			stale:  false,
+		},
+		{
+			name:   "max age exceeded",
+			maxAge: maxAge,
+			stale:  true,
+		},
+	}
+
+	for _, test := range tests {
+		backend := &flakyFeeEstimator{
+			StaticFeeEstimator: lnwallet.StaticFeeEstimator{
+				FeePerKW: 1000,
+			},
+		}
+
+		// We'll poll rarely enough for the estimates not to be
+		// refreshed in the background throughout the test.
+		feeEstimator := lnwallet.NewPollingFeeEstimator(
+			backend, time.Hour, test.maxAge,
+		)
+		if err := feeEstimator.Start(); err != nil {
+			t.Fatalf("%s: unable to start fee estimator: %v",
+				test.name, err)
+		}
+
+		_, err := feeEstimator.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("%s: unable to get fee rate: %v", test.name,
+				err)
+		}
+
+		// Once the backend fails, the estimate should still be
+		// returned as long as it's within its max age.
+		atomic.StoreInt32(&backend.failing, 1)
+		feeRate, err := feeEstimator.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("%s: unable to get fee rate: %v", test.name,
+				err)
+		}
+		if feeRate != 1000 {
+			t.Fatalf("%s: expected fee rate of 1000, got %v",
+				test.name, feeRate)
+		}
+
+		// After the max age elapsed without the estimate being
+		// refreshed, it should only be returned without a max age.
+		time.Sleep(2 * maxAge)
+		feeRate, err = feeEstimator.EstimateFeePerKW(6)
+		if test.stale != (err != nil) {
+			t.Fatalf("%s: expected stale estimate to fail=%v, "+
+				"got err=%v", test.name, test.stale, err)
+		}
+		if !test.stale && feeRate != 1000 {
+			t.Fatalf("%s: expected fee rate of 1000, got %v",
+				test.name, feeRate)
+		}
+
+		// Once the backend recovers, a fresh estimate should be
+		// returned right away.
+		backend.FeePerKW = 2000
+		atomic.StoreInt32(&backend.failing, 0)
+		feeRate, err = feeEstimator.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("%s: unable to get fee rate: %v", test.name,
+				err)
+		}
+		if test.stale && feeRate != 2000 {
+			t.Fatalf("%s: expected fresh fee rate of 2000, got %v",
+				test.name, feeRate)
+		}
+
+		if err := feeEstimator.Stop(); err != nil {
+			t.Fatalf("%s: unable to stop fee estimator: %v",
+				test.name, err)
+		}
+	}
+}
+
+// TestWebAPIFeeEstimator checks that the WebAPIFeeEstimator maps confirmation
+// targets onto the fee rates returned by the web API, and falls back to the
+// static rate if the web API can't be queried.
+func TestWebAPIFeeEstimator(t *testing.T) {
+	t.Parallel()
+
+	const sampleFees = `{
+		"fastestFee": 40,
+		"halfHourFee": 20,
+		"hourFee": 10,
+		"minimumFee": 1
+	}`
+
+	var failRequests int32
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if atomic.LoadInt32(&failRequests) == 1 {
+				http.Error(w, "unavailable",
+					http.StatusServiceUnavailable)
+				return
+			}
+
+			fmt.Fprint(w, sampleFees)
+		},
+	))
+	defer server.Close()
+
+	const (
+		pollInterval = 10 * time.Millisecond
+		fallbackRate = lnwallet.SatPerKWeight(5000)
+	)
+
+	var numDials int32
+	dial := func(network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&numDials, 1)
+		return net.Dial(network, addr)
+	}
+
+	feeEstimator := lnwallet.NewWebAPIFeeEstimator(
+		server.URL, dial, pollInterval, fallbackRate,
+	)
+	if err := feeEstimator.Start(); err != nil {
+		t.Fatalf("unable to start fee estimator: %v", err)
+	}
+	defer feeEstimator.Stop()
+
+	if atomic.LoadInt32(&numDials) == 0 {
+		t.Fatalf("expected web API to be queried using the custom " +
+			"dialer")
+	}
+
+	tests := []struct {
+		numBlocks uint32
+		feeRate   lnwallet.SatPerKWeight
+	}{
+		{numBlocks: 1, feeRate: 10000},
+		{numBlocks: 2, feeRate: 5000},
+		{numBlocks: 3, feeRate: 5000},
+		{numBlocks: 6, feeRate: 2500},
+		{numBlocks: 144, feeRate: 2500},
+	}
+	for _, test := range tests {
+		feeRate, err := feeEstimator.EstimateFeePerKW(test.numBlocks)
+		if err != nil {
+			t.Fatalf("unable to get fee rate: %v", err)
+		}
+		if feeRate != test.feeRate {
+			t.Fatalf("expected fee rate %v for conf target %v, "+
+				"got %v", test.feeRate, test.numBlocks, feeRate)
+		}
+	}
+
+	// Once the web API starts failing, the fallback rate should be
+	// returned after the next poll.
+	atomic.StoreInt32(&failRequests, 1)
+
+	var feeRate lnwallet.SatPerKWeight
+	for i := 0; i < 100; i++ {
+		var err error
+		feeRate, err = feeEstimator.EstimateFeePerKW(6)
+		if err != nil {
+			t.Fatalf("unable to get fee rate: %v", err)
+		}
+		if feeRate == fallbackRate {
+			break
+		}
+
+		time.Sleep(pollInterval)
+	}
+	if feeRate != fallbackRate {
+		t.Fatalf("expected fallback fee rate %v, got %v",
+			fallbackRate, feeRate)
+	}
+}
+
+// TestBitcoindFeeEstimatorNoEstimate ensures that the fallback fee rate is
+// used if bitcoind is unable to provide a fee estimate, rather than the fee
+// floor or a zero fee rate.
+func TestBitcoindFeeEstimatorNoEstimate(t *testing.T) {
+	t.Parallel()
+
+	// The fee rate returned by estimatesmartfee is omitted until it's set
+	// to a non-zero value, as is the case when bitcoind doesn't have
+	// enough data to produce an estimate.
+	var feeRate atomic.Value
+	feeRate.Store(`{"errors":["Insufficient data or no feerate found"]}`)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Method string          `json:"method"`
+				ID     json.RawMessage `json:"id"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			result := "null"
+			switch req.Method {
+			case "getnetworkinfo":
+				result = `{"relayfee":0.00001}`
+			case "estimatesmartfee":
+				result = feeRate.Load().(string)
+			}
+
+			fmt.Fprintf(w, `{"result":%s,"error":null,"id":%s}`,
+				result, req.ID)
+		},
+	))
+	defer server.Close()
+
+	const fallbackRate = lnwallet.SatPerKWeight(6250)
+
+	feeEstimator, err := lnwallet.NewBitcoindFeeEstimator(
+		rpcclient.ConnConfig{
+			Host: strings.TrimPrefix(server.URL, "http://"),
+			User: "user",
+			Pass: "pass",
+		}, fallbackRate, "",
+	)
+	if err != nil {
+		t.Fatalf("unable to create fee estimator: %v", err)
+	}
+	if err := feeEstimator.Start(); err != nil {
+		t.Fatalf("unable to start fee estimator: %v", err)
+	}
+	defer feeEstimator.Stop()
+
+	fee, fallback, err := feeEstimator.EstimateFeePerKWFallback(6)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if fee != fallbackRate || !fallback {
+		t.Fatalf("expected fallback fee rate %v, got %v "+
+			"(fallback=%v)", fallbackRate, fee, fallback)
+	}
+
+	// Once bitcoind is able to provide an estimate, it should be used
+	// instead. 0.0002 BTC/kvB amounts to 5000 sat/kw.
+	feeRate.Store(`{"feerate":0.0002,"blocks":6}`)
+	fee, fallback, err = feeEstimator.EstimateFeePerKWFallback(6)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if fee != 5000 || fallback {
+		t.Fatalf("expected estimated fee rate 5000, got %v "+
+			"(fallback=%v)", fee, fallback)
+	}
+
+	// The estimate should be the same when requested through the
+	// FeeEstimator interface.
+	fee, err = feeEstimator.EstimateFeePerKW(6)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if fee != 5000 {
+		t.Fatalf("expected estimated fee rate 5000, got %v", fee)
+	}
+}
+
+// TestBitcoindFeeEstimatorMode ensures that the selected estimation mode is
+// passed along with each estimatesmartfee request, while bitcoind's default
+// mode is used if none was selected, and that unknown modes are rejected.
+func TestBitcoindFeeEstimatorMode(t *testing.T) {
+	t.Parallel()
+
+	// We'll record the parameters of each estimatesmartfee request.
+	paramsChan := make(chan []json.RawMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Method string            `json:"method"`
+				Params []json.RawMessage `json:"params"`
+				ID     json.RawMessage   `json:"id"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			result := "null"
+			switch req.Method {
+			case "getnetworkinfo":
+				result = `{"relayfee":0.00001}`
+			case "estimatesmartfee":
+				paramsChan <- req.Params
+				result = `{"feerate":0.0002,"blocks":6}`
+			}
+
+			fmt.Fprintf(w, `{"result":%s,"error":null,"id":%s}`,
+				result, req.ID)
+		},
+	))
+	defer server.Close()
+
+	rpcConfig := rpcclient.ConnConfig{
+		Host: strings.TrimPrefix(server.URL, "http://"),
+		User: "user",
+		Pass: "pass",
+	}
+
+	tests := []struct {
+		mode   string
+		params []string
+	}{
+		{
+			mode:   "",
+			params: []string{"6"},
+		},
+		{
+			mode:   lnwallet.EstimateModeConservative,
+			params: []string{"6", `"CONSERVATIVE"`},
+		},
+		{
+			mode:   lnwallet.EstimateModeEconomical,
+			params: []string{"6", `"ECONOMICAL"`},
+		},
+	}
+
+	for _, test := range tests {
+		feeEstimator, err := lnwallet.NewBitcoindFeeEstimator(
+			rpcConfig, 6250, test.mode,
+		)
+		if err != nil {
+			t.Fatalf("unable to create fee estimator with mode "+
+				"%q: %v", test.mode, err)
+		}
+		if err := feeEstimator.Start(); err != nil {
+			t.Fatalf("unable to start fee estimator: %v", err)
+		}
+
+		fee, err := feeEstimator.EstimateFeePerKW(6)
+		feeEstimator.Stop()
+		if err != nil {
+			t.Fatalf("unable to estimate fee: %v", err)
+		}
+		if fee != 5000 {
+			t.Fatalf("expected estimated fee rate 5000, got %v",
+				fee)
+		}
+
+		params := <-paramsChan
+		if len(params) != len(test.params) {
+			t.Fatalf("mode %q: expected params %v, got %s",
+				test.mode, test.params, params)
+		}
+		for i, param := range params {
+			if string(param) != test.params[i] {
+				t.Fatalf("mode %q: expected params %v, got %s",
+					test.mode, test.params, params)
+			}
+		}
+	}
+
+	_, err := lnwallet.NewBitcoindFeeEstimator(rpcConfig, 6250, "fast")
+	if err == nil {
+		t.Fatalf("expected unknown estimation mode to be rejected")
+	}
+}
@@ -2299,7 +2299,7 @@ func runTests(t *testing.T, walletDriver *lnwallet.WalletDriver,
 
 		case "bitcoind":
 			feeEstimator, err = lnwallet.NewBitcoindFeeEstimator(
-				rpcConfig, 250)
+				rpcConfig, 250, "")
 			if err != nil {
 				t.Fatalf("unable to create bitcoind fee estimator: %v",
 					err)
@@ -20,6 +20,7 @@ import (
 	"github.com/lightningnetwork/lnd/discovery"
 	"github.com/lightningnetwork/lnd/htlcswitch"
 	"github.com/lightningnetwork/lnd/lnwallet"
+	"github.com/lightningnetwork/lnd/lnwallet/btcwallet"
 	"github.com/lightningnetwork/lnd/routing"
 	"github.com/lightningnetwork/lnd/signal"
 )
@@ -80,6 +81,7 @@ var (
 // Initialize package-global logger variables.
 func init() {
 	lnwallet.UseLogger(lnwlLog)
+	btcwallet.UseLogger(lnwlLog)
 	discovery.UseLogger(discLog)
 	chainntnfs.UseLogger(ntfnLog)
 	channeldb.UseLogger(chdbLog)
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// neutrinoBlockHeaderFile is the name of the flat file within
+	// neutrino's data directory that stores the block headers.
+	neutrinoBlockHeaderFile = "block_headers.bin"
+
+	// neutrinoFilterHeaderFile is the name of the flat file within
+	// neutrino's data directory that stores the regular filter headers.
+	neutrinoFilterHeaderFile = "reg_filter_headers.bin"
+)
+
+// validateNeutrinoHeaders ensures that the filter header chain stored within
+// neutrino's data directory is contiguous, as an unclean shutdown may leave
+// the header files truncated or with zero-filled gaps, which causes subtle
+// sync failures later on. The filter header chain must also not extend
+// beyond the block header chain. A data directory without any headers yet is
+// considered valid.
+func validateNeutrinoHeaders(dataDir string) error {
+	filterHeaders, err := ioutil.ReadFile(
+		filepath.Join(dataDir, neutrinoFilterHeaderFile),
+	)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read filter headers: %v", err)
+	}
+
+	if len(filterHeaders)%chainhash.HashSize != 0 {
+		return fmt.Errorf("filter header file is truncated, its size "+
+			"of %d bytes isn't a multiple of the header size",
+			len(filterHeaders))
+	}
+	numFilterHeaders := len(filterHeaders) / chainhash.HashSize
+
+	var blockHeadersSize int64
+	blockHeaderInfo, err := os.Stat(
+		filepath.Join(dataDir, neutrinoBlockHeaderFile),
+	)
+	switch {
+	case err == nil:
+		blockHeadersSize = blockHeaderInfo.Size()
+
+	case !os.IsNotExist(err):
+		return fmt.Errorf("unable to read block headers: %v", err)
+	}
+
+	if blockHeadersSize%wire.MaxBlockHeaderPayload != 0 {
+		return fmt.Errorf("block header file is truncated, its size "+
+			"of %d bytes isn't a multiple of the header size",
+			blockHeadersSize)
+	}
+	numBlockHeaders := blockHeadersSize / wire.MaxBlockHeaderPayload
+
+	if int64(numFilterHeaders) > numBlockHeaders {
+		return fmt.Errorf("filter header chain of %d headers extends "+
+			"beyond block header chain of %d headers",
+			numFilterHeaders, numBlockHeaders)
+	}
+
+	// A zero filter header can't be the result of hashing a filter, so
+	// it can only be a gap left behind by an interrupted write.
+	var zeroHeader [chainhash.HashSize]byte
+	for height := 0; height < numFilterHeaders; height++ {
+		offset := height * chainhash.HashSize
+		header := filterHeaders[offset : offset+chainhash.HashSize]
+		if bytes.Equal(header, zeroHeader[:]) {
+			return fmt.Errorf("filter header chain has a gap at "+
+				"height %d", height)
+		}
+	}
+
+	return nil
+}
+
+// resetNeutrinoHeaders removes the header files within neutrino's data
+// directory along with its database at the given path, which indexes the
+// headers, such that neutrino syncs its headers from scratch once started.
+func resetNeutrinoHeaders(dataDir, dbPath string) error {
+	paths := []string{
+		filepath.Join(dataDir, neutrinoBlockHeaderFile),
+		filepath.Join(dataDir, neutrinoFilterHeaderFile),
+		dbPath,
+	}
+	for _, path := range paths {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove %v: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// filterHeaderCheckpoint is a trusted filter header at a given height of the
+// filter header chain.
+type filterHeaderCheckpoint struct {
+	height uint32
+	header chainhash.Hash
+}
+
+// parseHeightHash parses an entry of the form height:hash, where the hash is
+// hex-encoded in the usual byte-reversed order. The passed name describes the
+// entry within the returned errors.
+func parseHeightHash(entry, name string) (uint32, chainhash.Hash, error) {
+	parts := strings.Split(entry, ":")
+	if len(parts) != 2 {
+		return 0, chainhash.Hash{}, fmt.Errorf("invalid %v %q: "+
+			"expected height:hash", name, entry)
+	}
+
+	height, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 32)
+	if err != nil {
+		return 0, chainhash.Hash{}, fmt.Errorf("invalid height of %v "+
+			"%q: %v", name, entry, err)
+	}
+
+	// chainhash accepts shorter hashes, padding them with zeros, so we'll
+	// make sure the hash is a full 32 bytes ourselves.
+	hash := strings.TrimSpace(parts[1])
+	if _, err := hex.DecodeString(hash); err != nil ||
+		len(hash) != chainhash.MaxHashStringSize {
+
+		return 0, chainhash.Hash{}, fmt.Errorf("invalid hash of %v "+
+			"%q: expected %d hex-encoded bytes", name, entry,
+			chainhash.HashSize)
+	}
+	header, err := chainhash.NewHashFromStr(hash)
+	if err != nil {
+		return 0, chainhash.Hash{}, err
+	}
+
+	return uint32(height), *header, nil
+}
+
+// parseFilterHeaderCheckpoint parses a filter header checkpoint of the form
+// height:hash, where the hash is the hex-encoded filter header in the usual
+// byte-reversed order.
+func parseFilterHeaderCheckpoint(entry string) (filterHeaderCheckpoint,
+	error) {
+
+	height, header, err := parseHeightHash(
+		entry, "filter header checkpoint",
+	)
+	if err != nil {
+		return filterHeaderCheckpoint{}, err
+	}
+
+	return filterHeaderCheckpoint{
+		height: height,
+		header: header,
+	}, nil
+}
+
+// parseFilterHeaderCheckpoints parses the passed filter header checkpoints, or
+// the newline-separated ones within the given file if set, skipping blank lines
+// and comments. Only one of them may be set, and the heights of the
+// checkpoints must be strictly ascending.
+func parseFilterHeaderCheckpoints(entries []string,
+	checkpointFile string) ([]filterHeaderCheckpoint, error) {
+
+	if checkpointFile != "" {
+		if len(entries) > 0 {
+			return nil, errors.New("filter header checkpoints " +
+				"can't be set both individually and through " +
+				"a file")
+		}
+
+		contents, err := ioutil.ReadFile(checkpointFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read filter header "+
+				"checkpoint file: %v", err)
+		}
+
+		for _, line := range strings.Split(string(contents), "\n") {
+			entry := strings.TrimSpace(line)
+			if entry == "" || strings.HasPrefix(entry, "#") {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	checkpoints := make([]filterHeaderCheckpoint, 0, len(entries))
+	for i, entry := range entries {
+		checkpoint, err := parseFilterHeaderCheckpoint(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 && checkpoint.height <= checkpoints[i-1].height {
+			return nil, fmt.Errorf("filter header checkpoints "+
+				"must be in ascending order of height, got %d "+
+				"after %d", checkpoint.height,
+				checkpoints[i-1].height)
+		}
+
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, nil
+}
+
+// checkFilterHeaderCheckpoints ensures that the filter header chain stored
+// within neutrino's data directory matches each of the passed checkpoints it
+// has reached, in order to detect headers obtained from malicious peers.
+func checkFilterHeaderCheckpoints(dataDir string,
+	checkpoints []filterHeaderCheckpoint) error {
+
+	filterHeaders, err := ioutil.ReadFile(
+		filepath.Join(dataDir, neutrinoFilterHeaderFile),
+	)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read filter headers: %v", err)
+	}
+	numFilterHeaders := uint64(len(filterHeaders) / chainhash.HashSize)
+
+	for _, checkpoint := range checkpoints {
+		if uint64(checkpoint.height) >= numFilterHeaders {
+			break
+		}
+
+		offset := int(checkpoint.height) * chainhash.HashSize
+		var header chainhash.Hash
+		copy(header[:], filterHeaders[offset:offset+chainhash.HashSize])
+		if header != checkpoint.header {
+			return fmt.Errorf("filter header %v at height %d "+
+				"doesn't match checkpoint %v", header,
+				checkpoint.height, checkpoint.header)
+		}
+	}
+
+	return nil
+}
+
+// checkNeutrinoHeaders validates the headers within neutrino's data directory,
+// including that the filter headers match the passed checkpoints. If they're
+// corrupt, they're reset along with neutrino's database at the given path if
+// rebuild is set, and an error explaining how to recover is returned
+// otherwise.
+func checkNeutrinoHeaders(dataDir, dbPath string,
+	checkpoints []filterHeaderCheckpoint, rebuild bool) error {
+
+	err := validateNeutrinoHeaders(dataDir)
+	if err == nil {
+		err = checkFilterHeaderCheckpoints(dataDir, checkpoints)
+	}
+	switch {
+	case err == nil:
+		return nil
+
+	case !rebuild:
+		return fmt.Errorf("neutrino's headers within %v are corrupt: "+
+			"%v. Restart with neutrino.rebuildfilterheaders to "+
+			"sync them from scratch", dataDir, err)
+	}
+
+	ltndLog.Warnf("Neutrino's headers within %v are corrupt, removing "+
+		"them to sync them from scratch: %v", dataDir, err)
+
+	return resetNeutrinoHeaders(dataDir, dbPath)
+}
+
+// parseChainTipAssertion parses a chain tip assertion of the form height:hash,
+// where the hash is the hex-encoded block hash in the usual byte-reversed
+// order. No checkpoint is returned if the assertion isn't set.
+func parseChainTipAssertion(assertion string) (*chaincfg.Checkpoint, error) {
+	if assertion == "" {
+		return nil, nil
+	}
+
+	height, hash, err := parseHeightHash(assertion, "chain tip assertion")
+	if err != nil {
+		return nil, err
+	}
+	if height > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid height of chain tip assertion "+
+			"%q: must not exceed %d", assertion, math.MaxInt32)
+	}
+
+	return &chaincfg.Checkpoint{
+		Height: int32(height),
+		Hash:   &hash,
+	}, nil
+}
+
+// neutrinoChainParams returns a copy of the passed chain parameters for
+// neutrino with the asserted chain tip added to their checkpoints, if any.
+// Neutrino verifies the block headers it syncs from its peers against the
+// checkpoints, disconnecting the peers advertising a divergent chain. A
+// checkpoint of the parameters at the same height is overridden by the
+// assertion, while the genesis block can't be, as it's never synced.
+func neutrinoChainParams(params *chaincfg.Params,
+	assertion *chaincfg.Checkpoint) (chaincfg.Params, error) {
+
+	neutrinoParams := *params
+	if assertion == nil {
+		return neutrinoParams, nil
+	}
+
+	if assertion.Height == 0 {
+		if *assertion.Hash != *params.GenesisHash {
+			return chaincfg.Params{}, fmt.Errorf("asserted chain "+
+				"tip %v doesn't match the genesis block %v of "+
+				"%v", assertion.Hash, params.GenesisHash,
+				params.Name)
+		}
+
+		return neutrinoParams, nil
+	}
+
+	// We'll copy the checkpoints rather than modifying them in place, as
+	// they're shared with the rest of the daemon. Neutrino requires them
+	// to be in ascending order of height.
+	checkpoints := make(
+		[]chaincfg.Checkpoint, 0, len(params.Checkpoints)+1,
+	)
+	inserted := false
+	for _, checkpoint := range params.Checkpoints {
+		if !inserted && checkpoint.Height >= assertion.Height {
+			checkpoints = append(checkpoints, *assertion)
+			inserted = true
+
+			if checkpoint.Height == assertion.Height {
+				if *checkpoint.Hash != *assertion.Hash {
+					ltndLog.Warnf("Asserted chain tip %v "+
+						"overrides checkpoint %v at "+
+						"height %d", assertion.Hash,
+						checkpoint.Hash,
+						checkpoint.Height)
+				}
+				continue
+			}
+		}
+
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	if !inserted {
+		checkpoints = append(checkpoints, *assertion)
+	}
+	neutrinoParams.Checkpoints = checkpoints
+
+	return neutrinoParams, nil
+}
@@ -0,0 +1,508 @@
+// +build !rpctest
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// writeNeutrinoHeaders populates the given data directory with header files
+// containing the given number of block headers and the given filter headers.
+func writeNeutrinoHeaders(t *testing.T, dataDir string, numBlockHeaders int,
+	filterHeaders []byte) {
+
+	t.Helper()
+
+	blockHeaders := bytes.Repeat(
+		[]byte{0x01}, numBlockHeaders*wire.MaxBlockHeaderPayload,
+	)
+	err := ioutil.WriteFile(
+		filepath.Join(dataDir, neutrinoBlockHeaderFile), blockHeaders,
+		0600,
+	)
+	if err != nil {
+		t.Fatalf("unable to write block headers: %v", err)
+	}
+
+	err = ioutil.WriteFile(
+		filepath.Join(dataDir, neutrinoFilterHeaderFile), filterHeaders,
+		0600,
+	)
+	if err != nil {
+		t.Fatalf("unable to write filter headers: %v", err)
+	}
+}
+
+// TestValidateNeutrinoHeaders ensures that truncated filter header chains, as
+// well as ones with gaps or extending beyond the block header chain, are
+// detected.
+func TestValidateNeutrinoHeaders(t *testing.T) {
+	validHeaders := bytes.Repeat([]byte{0x02}, 10*chainhash.HashSize)
+
+	gapHeaders := append([]byte(nil), validHeaders...)
+	copy(
+		gapHeaders[5*chainhash.HashSize:],
+		make([]byte, chainhash.HashSize),
+	)
+
+	tests := []struct {
+		name            string
+		numBlockHeaders int
+		filterHeaders   []byte
+		err             string
+	}{
+		{
+			name:            "valid",
+			numBlockHeaders: 10,
+			filterHeaders:   validHeaders,
+		},
+		{
+			name:            "filter headers behind block headers",
+			numBlockHeaders: 20,
+			filterHeaders:   validHeaders,
+		},
+		{
+			name:            "truncated filter headers",
+			numBlockHeaders: 10,
+			filterHeaders:   validHeaders[:len(validHeaders)-10],
+			err:             "filter header file is truncated",
+		},
+		{
+			name:            "filter headers beyond block headers",
+			numBlockHeaders: 5,
+			filterHeaders:   validHeaders,
+			err:             "extends beyond block header chain",
+		},
+		{
+			name:            "gap within filter headers",
+			numBlockHeaders: 10,
+			filterHeaders:   gapHeaders,
+			err:             "gap at height 5",
+		},
+	}
+
+	for _, test := range tests {
+		dataDir, err := ioutil.TempDir("", "neutrino")
+		if err != nil {
+			t.Fatalf("unable to create temp dir: %v", err)
+		}
+		writeNeutrinoHeaders(
+			t, dataDir, test.numBlockHeaders, test.filterHeaders,
+		)
+
+		err = validateNeutrinoHeaders(dataDir)
+		os.RemoveAll(dataDir)
+
+		switch {
+		case test.err == "" && err != nil:
+			t.Fatalf("%v: expected headers to be valid, got: %v",
+				test.name, err)
+
+		case test.err != "" && err == nil:
+			t.Fatalf("%v: expected corruption to be detected",
+				test.name)
+
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Fatalf("%v: expected error containing %q, got: %v",
+				test.name, test.err, err)
+		}
+	}
+
+	// A fresh data directory without any headers is valid.
+	dataDir, err := ioutil.TempDir("", "neutrino")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	if err := validateNeutrinoHeaders(dataDir); err != nil {
+		t.Fatalf("expected empty data dir to be valid, got: %v", err)
+	}
+}
+
+// TestCheckNeutrinoHeadersRebuild ensures that corrupt headers are only
+// removed along with neutrino's database if a rebuild was requested.
+func TestCheckNeutrinoHeadersRebuild(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "neutrino")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	dbPath := filepath.Join(dataDir, defaultNeutrinoDBName)
+	if err := ioutil.WriteFile(dbPath, []byte("db"), 0600); err != nil {
+		t.Fatalf("unable to write db: %v", err)
+	}
+	writeNeutrinoHeaders(
+		t, dataDir, 1, make([]byte, chainhash.HashSize+1),
+	)
+
+	// Without a rebuild, the corruption should be reported along with
+	// the option to recover, leaving the files in place.
+	err = checkNeutrinoHeaders(dataDir, dbPath, nil, false)
+	if err == nil ||
+		!strings.Contains(err.Error(), "rebuildfilterheaders") {
+
+		t.Fatalf("expected error suggesting rebuildfilterheaders, "+
+			"got: %v", err)
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Fatalf("expected db to be left in place: %v", err)
+	}
+
+	// With a rebuild, the headers and the database should be removed.
+	if err := checkNeutrinoHeaders(dataDir, dbPath, nil, true); err != nil {
+		t.Fatalf("unable to rebuild headers: %v", err)
+	}
+	for _, name := range []string{
+		neutrinoBlockHeaderFile, neutrinoFilterHeaderFile,
+		defaultNeutrinoDBName,
+	} {
+		_, err := os.Stat(filepath.Join(dataDir, name))
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected %v to be removed, got: %v", name,
+				err)
+		}
+	}
+
+	// The now empty data directory should pass validation.
+	err = checkNeutrinoHeaders(dataDir, dbPath, nil, false)
+	if err != nil {
+		t.Fatalf("expected reset headers to be valid, got: %v", err)
+	}
+}
+
+// TestParseFilterHeaderCheckpoints ensures that filter header checkpoints are
+// parsed from either the passed entries or a checkpoint file, and that
+// malformed or unordered checkpoints are rejected.
+func TestParseFilterHeaderCheckpoints(t *testing.T) {
+	const (
+		hash1 = "5bd2e7f2f5fa5a7d94bc9bff6a8eb3d5f2e4e7e4e7a1e0b1" +
+			"f6d2c5e2b1a3c4d5"
+		hash2 = "0f3d8e1a2b4c6d8e0f1a3b5c7d9e1f2a4b6c8d0e2f4a6b8c" +
+			"0d2e4f6a8b0c2d0f"
+	)
+
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	checkpointFile := filepath.Join(dir, "checkpoints")
+	contents := "# trusted checkpoints\n\n100:" + hash1 + "\n 200:" +
+		hash2 + " \n"
+	err = ioutil.WriteFile(checkpointFile, []byte(contents), 0600)
+	if err != nil {
+		t.Fatalf("unable to write checkpoint file: %v", err)
+	}
+
+	checkpoints, err := parseFilterHeaderCheckpoints(nil, checkpointFile)
+	if err != nil {
+		t.Fatalf("unable to parse checkpoint file: %v", err)
+	}
+	if len(checkpoints) != 2 || checkpoints[0].height != 100 ||
+		checkpoints[1].height != 200 {
+
+		t.Fatalf("unexpected checkpoints: %v", checkpoints)
+	}
+	if checkpoints[1].header.String() != hash2 {
+		t.Fatalf("expected checkpoint header %v, got %v", hash2,
+			checkpoints[1].header)
+	}
+
+	tests := []struct {
+		name    string
+		entries []string
+		err     string
+	}{
+		{
+			name:    "valid entries",
+			entries: []string{"100:" + hash1, "200:" + hash2},
+		},
+		{
+			name:    "missing hash",
+			entries: []string{"100"},
+			err:     "expected height:hash",
+		},
+		{
+			name:    "invalid height",
+			entries: []string{"-1:" + hash1},
+			err:     "invalid height",
+		},
+		{
+			name:    "short hash",
+			entries: []string{"100:" + hash1[:62]},
+			err:     "invalid hash",
+		},
+		{
+			name:    "non-hex hash",
+			entries: []string{"100:" + hash1[:62] + "zz"},
+			err:     "invalid hash",
+		},
+		{
+			name:    "descending heights",
+			entries: []string{"200:" + hash2, "100:" + hash1},
+			err:     "ascending order",
+		},
+		{
+			name:    "duplicate heights",
+			entries: []string{"100:" + hash1, "100:" + hash2},
+			err:     "ascending order",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := parseFilterHeaderCheckpoints(test.entries, "")
+		switch {
+		case test.err == "" && err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+
+		case test.err != "" && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Fatalf("%s: expected error containing %q, got: %v",
+				test.name, test.err, err)
+		}
+	}
+
+	// Checkpoints can't be set both individually and through a file.
+	_, err = parseFilterHeaderCheckpoints(
+		[]string{"100:" + hash1}, checkpointFile,
+	)
+	if err == nil {
+		t.Fatalf("expected error for checkpoints set twice")
+	}
+}
+
+// TestCheckFilterHeaderCheckpoints ensures that a stored filter header chain
+// is only accepted if it matches each of the checkpoints it has reached.
+func TestCheckFilterHeaderCheckpoints(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "neutrino")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	filterHeaders := make([]byte, 10*chainhash.HashSize)
+	for i := range filterHeaders {
+		filterHeaders[i] = byte(i / chainhash.HashSize)
+	}
+	writeNeutrinoHeaders(t, dataDir, 10, filterHeaders)
+
+	var header5, mismatch chainhash.Hash
+	copy(header5[:], filterHeaders[5*chainhash.HashSize:])
+	mismatch[0] = 0xff
+
+	checkpoints := []filterHeaderCheckpoint{
+		{height: 5, header: header5},
+
+		// The header chain hasn't reached this checkpoint yet, so it
+		// can't be checked.
+		{height: 20, header: mismatch},
+	}
+	err = checkFilterHeaderCheckpoints(dataDir, checkpoints)
+	if err != nil {
+		t.Fatalf("expected matching headers to be valid, got: %v", err)
+	}
+
+	checkpoints[0].header = mismatch
+	err = checkFilterHeaderCheckpoints(dataDir, checkpoints)
+	if err == nil || !strings.Contains(err.Error(), "height 5") {
+		t.Fatalf("expected mismatch at height 5, got: %v", err)
+	}
+
+	// A mismatch should be reported like any other corruption.
+	dbPath := filepath.Join(dataDir, defaultNeutrinoDBName)
+	err = checkNeutrinoHeaders(dataDir, dbPath, checkpoints, false)
+	if err == nil ||
+		!strings.Contains(err.Error(), "rebuildfilterheaders") {
+
+		t.Fatalf("expected error suggesting rebuildfilterheaders, "+
+			"got: %v", err)
+	}
+}
+
+// TestParseChainTipAssertion ensures that well-formed chain tip assertions are
+// parsed into a checkpoint, while malformed ones are rejected.
+func TestParseChainTipAssertion(t *testing.T) {
+	const hash = "000000000000000000063b1b3e5bd7c19e0ed2b4c56db32a" +
+		"4f4c4c3d36e2c4c1"
+
+	checkpoint, err := parseChainTipAssertion("650000:" + hash)
+	if err != nil {
+		t.Fatalf("unable to parse chain tip assertion: %v", err)
+	}
+	if checkpoint.Height != 650000 || checkpoint.Hash.String() != hash {
+		t.Fatalf("expected checkpoint 650000:%v, got %d:%v", hash,
+			checkpoint.Height, checkpoint.Hash)
+	}
+
+	// No checkpoint should be returned if the assertion isn't set.
+	checkpoint, err = parseChainTipAssertion("")
+	if err != nil || checkpoint != nil {
+		t.Fatalf("expected no checkpoint, got %v: %v", checkpoint, err)
+	}
+
+	tests := []struct {
+		name      string
+		assertion string
+		err       string
+	}{
+		{
+			name:      "missing hash",
+			assertion: "650000",
+			err:       "expected height:hash",
+		},
+		{
+			name:      "invalid height",
+			assertion: "tip:" + hash,
+			err:       "invalid height",
+		},
+		{
+			name:      "height out of range",
+			assertion: "3000000000:" + hash,
+			err:       "must not exceed",
+		},
+		{
+			name:      "short hash",
+			assertion: "650000:" + hash[:62],
+			err:       "invalid hash",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := parseChainTipAssertion(test.assertion)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: expected error containing %q, got: %v",
+				test.name, test.err, err)
+		}
+	}
+}
+
+// TestNeutrinoChainParams ensures that an asserted chain tip is added to a copy
+// of the network's checkpoints in order of height, overriding a checkpoint at
+// the same height, and that it must match the genesis block if asserted at
+// height zero.
+func TestNeutrinoChainParams(t *testing.T) {
+	newHash := func(b byte) *chainhash.Hash {
+		var hash chainhash.Hash
+		hash[0] = b
+		return &hash
+	}
+
+	params := &chaincfg.Params{
+		Name:        "testnet",
+		GenesisHash: newHash(0),
+		Checkpoints: []chaincfg.Checkpoint{
+			{Height: 100, Hash: newHash(1)},
+			{Height: 200, Hash: newHash(2)},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		assertion *chaincfg.Checkpoint
+		heights   []int32
+	}{
+		{
+			name:    "no assertion",
+			heights: []int32{100, 200},
+		},
+		{
+			name: "before checkpoints",
+			assertion: &chaincfg.Checkpoint{
+				Height: 50, Hash: newHash(3),
+			},
+			heights: []int32{50, 100, 200},
+		},
+		{
+			name: "between checkpoints",
+			assertion: &chaincfg.Checkpoint{
+				Height: 150, Hash: newHash(3),
+			},
+			heights: []int32{100, 150, 200},
+		},
+		{
+			name: "after checkpoints",
+			assertion: &chaincfg.Checkpoint{
+				Height: 250, Hash: newHash(3),
+			},
+			heights: []int32{100, 200, 250},
+		},
+		{
+			name: "overriding checkpoint",
+			assertion: &chaincfg.Checkpoint{
+				Height: 200, Hash: newHash(3),
+			},
+			heights: []int32{100, 200},
+		},
+		{
+			name: "genesis block",
+			assertion: &chaincfg.Checkpoint{
+				Height: 0, Hash: newHash(0),
+			},
+			heights: []int32{100, 200},
+		},
+	}
+
+	for _, test := range tests {
+		neutrinoParams, err := neutrinoChainParams(
+			params, test.assertion,
+		)
+		if err != nil {
+			t.Fatalf("%s: unable to create chain params: %v",
+				test.name, err)
+		}
+
+		checkpoints := neutrinoParams.Checkpoints
+		if len(checkpoints) != len(test.heights) {
+			t.Fatalf("%s: expected %d checkpoints, got %d",
+				test.name, len(test.heights), len(checkpoints))
+		}
+		for i, height := range test.heights {
+			if checkpoints[i].Height != height {
+				t.Fatalf("%s: expected checkpoint %d at "+
+					"height %d, got %d", test.name, i,
+					height, checkpoints[i].Height)
+			}
+
+			if test.assertion == nil ||
+				test.assertion.Height != height {
+
+				continue
+			}
+			if *checkpoints[i].Hash != *test.assertion.Hash {
+				t.Fatalf("%s: expected asserted hash %v, got "+
+					"%v", test.name, test.assertion.Hash,
+					checkpoints[i].Hash)
+			}
+		}
+	}
+
+	// The checkpoints of the network itself must be left untouched.
+	if len(params.Checkpoints) != 2 ||
+		*params.Checkpoints[1].Hash != *newHash(2) {
+
+		t.Fatalf("network checkpoints modified: %v", params.Checkpoints)
+	}
+
+	// A divergent genesis block can't be asserted.
+	_, err := neutrinoChainParams(params, &chaincfg.Checkpoint{
+		Height: 0, Hash: newHash(3),
+	})
+	if err == nil || !strings.Contains(err.Error(), "genesis block") {
+		t.Fatalf("expected error for divergent genesis block, got: %v",
+			err)
+	}
+}
@@ -456,7 +456,8 @@ func (p *peer) loadActiveChannels(chans []*channeldb.OpenChannel) error {
 			peerLog.Warnf("Unable to find our forwarding policy "+
 				"for channel %v, using default values",
 				chanPoint)
-			forwardingPolicy = &p.server.cc.routingPolicy
+			defaultPolicy := p.server.cc.RoutingPolicy()
+			forwardingPolicy = &defaultPolicy
 		}
 
 		peerLog.Tracef("Using link policy of: %v",
@@ -1498,7 +1499,7 @@ func (p *peer) ChannelSnapshots() []*channeldb.ChannelSnapshot {
 // the case of a cooperative channel close negotiation.
 func (p *peer) genDeliveryScript() ([]byte, error) {
 	deliveryAddr, err := p.server.cc.wallet.NewAddress(
-		lnwallet.WitnessPubKey, false,
+		p.server.cc.wallet.Cfg.AddressType, false,
 	)
 	if err != nil {
 		return nil, err
@@ -1616,7 +1617,7 @@ out:
 			// they currently are always set to the default values
 			// at initial channel creation.
 			fwdMinHtlc := lnChan.FwdMinHtlc()
-			defaultPolicy := p.server.cc.routingPolicy
+			defaultPolicy := p.server.cc.RoutingPolicy()
 			forwardingPolicy := &htlcswitch.ForwardingPolicy{
 				MinHTLC:       fwdMinHtlc,
 				BaseFee:       defaultPolicy.BaseFee,
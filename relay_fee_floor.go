@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+const (
+	// defaultRelayFeePollInterval is the interval at which the
+	// relayFeeFloor queries the backend for its minimum relay fee, as it
+	// rises once the backend's mempool fills up.
+	defaultRelayFeePollInterval = 10 * time.Minute
+)
+
+// rawRequester is an RPC backend which is able to carry out arbitrary RPC
+// calls, such as the rpcclient.Client of btcd and bitcoind.
+type rawRequester interface {
+	// RawRequest carries out the RPC call of the given method with the
+	// passed parameters, and returns its raw result.
+	RawRequest(method string, params []json.RawMessage) (json.RawMessage,
+		error)
+}
+
+// relayFeeFloorConfig houses the parameters and functions the relayFeeFloor
+// requires in order to track the minimum relay fee of the backend.
+type relayFeeFloorConfig struct {
+	// Floor is the minimum fee rate in effect until the backend was
+	// queried for the first time. If Query is nil, it's used throughout.
+	Floor lnwallet.SatPerKWeight
+
+	// Query returns the current minimum relay fee of the backend.
+	Query func() (lnwallet.SatPerKWeight, error)
+
+	// PollInterval is the interval at which the backend is queried.
+	PollInterval time.Duration
+}
+
+// relayFeeFloor tracks the minimum fee rate our transactions need in order to
+// be accepted into the backend's mempool. Fee estimates are raised to it, as
+// low estimates and fallback fee rates would otherwise produce transactions
+// that are rejected.
+type relayFeeFloor struct {
+	started int32 // To be used atomically.
+	stopped int32 // To be used atomically.
+
+	feePerKW int64 // To be used atomically.
+
+	cfg *relayFeeFloorConfig
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// newRelayFeeFloor creates a new relayFeeFloor from the given config.
+func newRelayFeeFloor(cfg *relayFeeFloorConfig) *relayFeeFloor {
+	return &relayFeeFloor{
+		feePerKW: int64(cfg.Floor),
+		cfg:      cfg,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start queries the backend for its minimum relay fee, and launches the
+// goroutine which keeps it up to date. If the backend can't be queried, a
+// warning is logged and the initial floor is used until it can.
+func (f *relayFeeFloor) Start() error {
+	if !atomic.CompareAndSwapInt32(&f.started, 0, 1) {
+		return nil
+	}
+
+	if f.cfg.Query == nil {
+		return nil
+	}
+
+	f.update()
+
+	f.wg.Add(1)
+	go f.poll()
+
+	return nil
+}
+
+// Stop signals the poller to exit, and waits for it to do so.
+func (f *relayFeeFloor) Stop() error {
+	if !atomic.CompareAndSwapInt32(&f.stopped, 0, 1) {
+		return nil
+	}
+
+	close(f.quit)
+	f.wg.Wait()
+
+	return nil
+}
+
+// FeePerKW returns the current minimum fee rate.
+func (f *relayFeeFloor) FeePerKW() lnwallet.SatPerKWeight {
+	return lnwallet.SatPerKWeight(atomic.LoadInt64(&f.feePerKW))
+}
+
+// update queries the backend for its minimum relay fee, and uses it as the
+// floor. The floor never drops below lnwallet.FeePerKwFloor, which is the
+// lowest fee rate any backend relays by default.
+func (f *relayFeeFloor) update() {
+	feePerKW, err := f.cfg.Query()
+	if err != nil {
+		ltndLog.Warnf("Unable to query minimum relay fee, using %v "+
+			"sat/kw: %v", int64(f.FeePerKW()), err)
+		return
+	}
+
+	if feePerKW < lnwallet.FeePerKwFloor {
+		feePerKW = lnwallet.FeePerKwFloor
+	}
+
+	old := atomic.SwapInt64(&f.feePerKW, int64(feePerKW))
+	if old != int64(feePerKW) {
+		ltndLog.Infof("Minimum relay fee is now %v sat/kw",
+			int64(feePerKW))
+	}
+}
+
+// poll periodically queries the backend for its minimum relay fee.
+//
+// NOTE: This MUST be run as a goroutine.
+func (f *relayFeeFloor) poll() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.update()
+
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+// rpcMinRelayFee returns a function which queries the minimum relay fee of a
+// btcd or bitcoind backend through the passed client. The fee is taken from
+// getmempoolinfo, which also reflects the rising minimum once bitcoind's
+// mempool is full, falling back to getnetworkinfo and finally getinfo for
+// backends which don't report it there, such as btcd.
+func rpcMinRelayFee(client rawRequester) func() (lnwallet.SatPerKWeight,
+	error) {
+
+	return func() (lnwallet.SatPerKWeight, error) {
+		var mempoolInfo struct {
+			MinRelayTxFee float64 `json:"minrelaytxfee"`
+			MempoolMinFee float64 `json:"mempoolminfee"`
+		}
+		err := rawRequest(client, "getmempoolinfo", &mempoolInfo)
+		if err == nil {
+			relayFee := mempoolInfo.MinRelayTxFee
+			if mempoolInfo.MempoolMinFee > relayFee {
+				relayFee = mempoolInfo.MempoolMinFee
+			}
+			if relayFee > 0 {
+				return btcPerKBToFeePerKW(relayFee)
+			}
+		}
+
+		var info struct {
+			RelayFee float64 `json:"relayfee"`
+		}
+		err = rawRequest(client, "getnetworkinfo", &info)
+		if err != nil {
+			err = rawRequest(client, "getinfo", &info)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		return btcPerKBToFeePerKW(info.RelayFee)
+	}
+}
+
+// rawRequest carries out the RPC call of the given method without any
+// parameters, and decodes its result into the passed value.
+func rawRequest(client rawRequester, method string,
+	result interface{}) error {
+
+	resp, err := client.RawRequest(method, nil)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(resp, result)
+}
+
+// btcPerKBToFeePerKW converts a fee rate in BTC/kB, as reported by the RPC
+// interface of btcd and bitcoind, to sat/kw.
+func btcPerKBToFeePerKW(btcPerKB float64) (lnwallet.SatPerKWeight, error) {
+	amt, err := btcutil.NewAmount(btcPerKB)
+	if err != nil {
+		return 0, err
+	}
+
+	return lnwallet.SatPerKVByte(amt).FeePerKWeight(), nil
+}
+
+// minRelayFeeFloorConfig returns the config of the relayFeeFloor of the passed
+// chain. An explicit minrelayfeefloor is used as is, while otherwise the floor
+// is queried through the passed function, if any, starting out at
+// lnwallet.FeePerKwFloor.
+func minRelayFeeFloorConfig(chainCfg *chainConfig,
+	query func() (lnwallet.SatPerKWeight, error)) *relayFeeFloorConfig {
+
+	if chainCfg.MinRelayFeeFloor != 0 {
+		return &relayFeeFloorConfig{
+			Floor: lnwallet.SatPerKVByte(
+				chainCfg.MinRelayFeeFloor * 1000,
+			).FeePerKWeight(),
+		}
+	}
+
+	return &relayFeeFloorConfig{
+		Floor:        lnwallet.FeePerKwFloor,
+		Query:        query,
+		PollInterval: defaultRelayFeePollInterval,
+	}
+}
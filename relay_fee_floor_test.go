@@ -0,0 +1,203 @@
+// +build !rpctest
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// mockRawRequester is a rawRequester which serves canned responses for the
+// RPC methods it knows, and fails all others.
+type mockRawRequester struct {
+	responses map[string]string
+}
+
+func (m *mockRawRequester) RawRequest(method string,
+	params []json.RawMessage) (json.RawMessage, error) {
+
+	resp, ok := m.responses[method]
+	if !ok {
+		return nil, errors.New("method not found")
+	}
+
+	return json.RawMessage(resp), nil
+}
+
+// TestRPCMinRelayFee ensures that the minimum relay fee is queried from the
+// RPC methods available on the backend, taking the mempool's rising minimum
+// into account.
+func TestRPCMinRelayFee(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		responses map[string]string
+		feePerKW  lnwallet.SatPerKWeight
+		valid     bool
+	}{
+		{
+			name: "bitcoind mempool min fee",
+			responses: map[string]string{
+				"getmempoolinfo": `{"minrelaytxfee": 0.00001,` +
+					`"mempoolminfee": 0.00005}`,
+				"getnetworkinfo": `{"relayfee": 0.00001}`,
+			},
+			feePerKW: 1250,
+			valid:    true,
+		},
+		{
+			name: "bitcoind min relay fee",
+			responses: map[string]string{
+				"getmempoolinfo": `{"minrelaytxfee": 0.00002,` +
+					`"mempoolminfee": 0.00001}`,
+			},
+			feePerKW: 500,
+			valid:    true,
+		},
+		{
+			name: "old bitcoind",
+			responses: map[string]string{
+				"getmempoolinfo": `{"size": 10}`,
+				"getnetworkinfo": `{"relayfee": 0.00003}`,
+			},
+			feePerKW: 750,
+			valid:    true,
+		},
+		{
+			name: "btcd",
+			responses: map[string]string{
+				"getmempoolinfo": `{"size": 10, "bytes": 2500}`,
+				"getinfo":        `{"relayfee": 0.00001}`,
+			},
+			feePerKW: 250,
+			valid:    true,
+		},
+		{
+			name:      "unsupported backend",
+			responses: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		query := rpcMinRelayFee(&mockRawRequester{
+			responses: test.responses,
+		})
+
+		feePerKW, err := query()
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: unable to query min relay fee: %v",
+				test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+		}
+
+		if feePerKW != test.feePerKW {
+			t.Fatalf("%s: expected %v sat/kw, got %v", test.name,
+				test.feePerKW, feePerKW)
+		}
+	}
+}
+
+// TestRelayFeeFloor ensures that fee estimates below the backend's minimum
+// relay fee are raised to it, and that the floor follows the backend's
+// minimum as it changes.
+func TestRelayFeeFloor(t *testing.T) {
+	t.Parallel()
+
+	var relayFee int64 = 1000
+	feeFloor := newRelayFeeFloor(minRelayFeeFloorConfig(
+		&chainConfig{},
+		func() (lnwallet.SatPerKWeight, error) {
+			feePerKW := atomic.LoadInt64(&relayFee)
+			if feePerKW == 0 {
+				return 0, errors.New("backend unreachable")
+			}
+			return lnwallet.SatPerKWeight(feePerKW), nil
+		},
+	))
+	feeFloor.cfg.PollInterval = 10 * time.Millisecond
+	if err := feeFloor.Start(); err != nil {
+		t.Fatalf("unable to start fee floor: %v", err)
+	}
+	defer feeFloor.Stop()
+
+	estimator := lnwallet.NewMinFeeRateEstimator(
+		lnwallet.StaticFeeEstimator{FeePerKW: 300}, feeFloor.FeePerKW,
+	)
+
+	assertFeeRate := func(expected lnwallet.SatPerKWeight) {
+		t.Helper()
+
+		var feeRate lnwallet.SatPerKWeight
+		for i := 0; i < 500; i++ {
+			var err error
+			feeRate, err = estimator.EstimateFeePerKW(6)
+			if err != nil {
+				t.Fatalf("unable to estimate fee: %v", err)
+			}
+			if feeRate == expected {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("expected fee rate %v, got %v", expected, feeRate)
+	}
+
+	// The estimate of 300 sat/kw is below the minimum relay fee the
+	// backend reported at startup, so it should be raised to it.
+	assertFeeRate(1000)
+
+	// Once the backend's minimum rises, the floor should follow it, while
+	// failing queries should keep the last known floor.
+	atomic.StoreInt64(&relayFee, 2000)
+	assertFeeRate(2000)
+	atomic.StoreInt64(&relayFee, 0)
+	assertFeeRate(2000)
+
+	// A minimum below the lowest fee rate we'd ever use shouldn't lower
+	// the floor beyond it, so the estimate passes through unchanged.
+	atomic.StoreInt64(&relayFee, 100)
+	assertFeeRate(300)
+	if feeFloor.FeePerKW() != lnwallet.FeePerKwFloor {
+		t.Fatalf("expected floor of %v, got %v",
+			lnwallet.FeePerKwFloor, feeFloor.FeePerKW())
+	}
+}
+
+// TestRelayFeeFloorOverride ensures that an explicitly configured floor takes
+// precedence over the backend's minimum relay fee, which isn't queried.
+func TestRelayFeeFloorOverride(t *testing.T) {
+	t.Parallel()
+
+	feeFloor := newRelayFeeFloor(minRelayFeeFloorConfig(
+		&chainConfig{MinRelayFeeFloor: 10},
+		func() (lnwallet.SatPerKWeight, error) {
+			t.Fatalf("backend queried despite override")
+			return 0, nil
+		},
+	))
+	if err := feeFloor.Start(); err != nil {
+		t.Fatalf("unable to start fee floor: %v", err)
+	}
+	defer feeFloor.Stop()
+
+	estimator := lnwallet.NewMinFeeRateEstimator(
+		lnwallet.StaticFeeEstimator{FeePerKW: 300}, feeFloor.FeePerKW,
+	)
+	feeRate, err := estimator.EstimateFeePerKW(6)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if feeRate != 2500 {
+		t.Fatalf("expected fee rate of 2500 sat/kw, got %v", feeRate)
+	}
+}
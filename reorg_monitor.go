@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/lightningnetwork/lnd/chainntnfs"
+)
+
+// reorgMonitorConfig houses the parameters and functions the reorgMonitor
+// requires in order to watch the chain for reorganizations.
+type reorgMonitorConfig struct {
+	// MaxReorgDepth is the maximum number of blocks a reorganization may
+	// disconnect before lnd is shut down. If zero, the depth of
+	// reorganizations is only logged.
+	MaxReorgDepth uint32
+
+	// Shutdown is invoked once with the depth of the first reorganization
+	// exceeding MaxReorgDepth, and is expected to shut down lnd.
+	Shutdown func(depth uint32)
+}
+
+// reorgMonitor is a chainntnfs.ChainNotifier which logs the depth of each
+// reorganization of the chain it notifies about, and shuts down lnd once a
+// reorganization exceeds the maximum depth. A reorganization deeper than
+// expected is a sign of a misconfigured or attacked backend, so we won't keep
+// running on top of it.
+//
+// NOTE: The monitor is just another subscriber to the wrapped notifier's block
+// notifications, so it only learns about a reorganization after the notifier
+// dispatched it. By then, the notifier's other clients may have acted on it
+// already. The limit doesn't prevent that, it only stops lnd afterwards.
+type reorgMonitor struct {
+	started int32 // To be used atomically.
+	stopped int32 // To be used atomically.
+
+	chainntnfs.ChainNotifier
+
+	cfg *reorgMonitorConfig
+
+	// warnf logs the depth of each reorganization.
+	warnf func(format string, params ...interface{})
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// A compile-time assertion to ensure reorgMonitor meets the
+// chainntnfs.ChainNotifier interface.
+var _ chainntnfs.ChainNotifier = (*reorgMonitor)(nil)
+
+// newReorgMonitor wraps the passed chain notifier, such that the
+// reorganizations it notifies about are monitored once it's started.
+func newReorgMonitor(notifier chainntnfs.ChainNotifier,
+	cfg *reorgMonitorConfig) *reorgMonitor {
+
+	return &reorgMonitor{
+		ChainNotifier: notifier,
+		cfg:           cfg,
+		warnf:         ltndLog.Warnf,
+		quit:          make(chan struct{}),
+	}
+}
+
+// Start starts the wrapped chain notifier, and launches the goroutine which
+// monitors the blocks it notifies about.
+//
+// NOTE: This is part of the chainntnfs.ChainNotifier interface.
+func (r *reorgMonitor) Start() error {
+	if !atomic.CompareAndSwapInt32(&r.started, 0, 1) {
+		return nil
+	}
+
+	if err := r.ChainNotifier.Start(); err != nil {
+		return err
+	}
+
+	epochs, err := r.ChainNotifier.RegisterBlockEpochNtfn(nil)
+	if err != nil {
+		return err
+	}
+
+	r.wg.Add(1)
+	go r.monitor(epochs)
+
+	return nil
+}
+
+// Stop signals the monitor to exit, waits for it to do so, and stops the
+// wrapped chain notifier.
+//
+// NOTE: This is part of the chainntnfs.ChainNotifier interface.
+func (r *reorgMonitor) Stop() error {
+	if !atomic.CompareAndSwapInt32(&r.stopped, 0, 1) {
+		return nil
+	}
+
+	close(r.quit)
+	r.wg.Wait()
+
+	return r.ChainNotifier.Stop()
+}
+
+// monitor tracks the tip of the chain through the passed block notifications.
+// As the notifier only notifies about connected blocks, a reorganization is
+// detected once a block is connected at or below the height of the previous
+// tip, in which case all blocks above its parent were disconnected.
+//
+// NOTE: This MUST be run as a goroutine.
+func (r *reorgMonitor) monitor(epochs *chainntnfs.BlockEpochEvent) {
+	defer r.wg.Done()
+	defer epochs.Cancel()
+
+	var tip *chainntnfs.BlockEpoch
+	for {
+		var epoch *chainntnfs.BlockEpoch
+		select {
+		case e, ok := <-epochs.Epochs:
+			if !ok {
+				return
+			}
+			epoch = e
+
+		case <-r.quit:
+			return
+		}
+
+		if tip != nil && epoch.Height <= tip.Height {
+			depth := uint32(tip.Height-epoch.Height) + 1
+			r.warnf("Chain reorganization of depth %d detected, "+
+				"tip %v at height %d replaced by %v at height "+
+				"%d", depth, tip.Hash, tip.Height, epoch.Hash,
+				epoch.Height)
+
+			maxDepth := r.cfg.MaxReorgDepth
+			if maxDepth > 0 && depth > maxDepth {
+				ltndLog.Criticalf("Chain reorganization of "+
+					"depth %d exceeds maxreorgdepth of "+
+					"%d, the backend may be misconfigured "+
+					"or under attack. Shutting down!",
+					depth, maxDepth)
+				r.cfg.Shutdown(depth)
+				return
+			}
+		}
+
+		tip = epoch
+	}
+}
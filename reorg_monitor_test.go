@@ -0,0 +1,141 @@
+// +build !rpctest
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/chainntnfs"
+)
+
+// epochNotifier is a chainntnfs.ChainNotifier which delivers the blocks sent
+// on its epochs channel to a single block epoch client.
+type epochNotifier struct {
+	chainntnfs.ChainNotifier
+
+	epochs chan *chainntnfs.BlockEpoch
+}
+
+func (e *epochNotifier) RegisterBlockEpochNtfn(
+	bestBlock *chainntnfs.BlockEpoch) (*chainntnfs.BlockEpochEvent, error) {
+
+	return &chainntnfs.BlockEpochEvent{
+		Epochs: e.epochs,
+		Cancel: func() {},
+	}, nil
+}
+
+func (e *epochNotifier) Start() error {
+	return nil
+}
+
+func (e *epochNotifier) Stop() error {
+	return nil
+}
+
+// TestReorgMonitor ensures that the depth of each chain reorganization is
+// logged, and that lnd is shut down once a reorganization exceeds the maximum
+// depth.
+func TestReorgMonitor(t *testing.T) {
+	t.Parallel()
+
+	// The connected blocks reorganize the chain twice, first replacing
+	// the tip at height 102, and then the three blocks above height 100.
+	heights := []int32{100, 101, 102, 102, 103, 101, 102, 103, 104}
+
+	tests := []struct {
+		name          string
+		heights       []int32
+		maxReorgDepth uint32
+		depths        []uint32
+		shutdownDepth uint32
+	}{
+		{
+			name:          "no max depth",
+			heights:       heights,
+			maxReorgDepth: 0,
+			depths:        []uint32{1, 3},
+		},
+		{
+			name:          "within max depth",
+			heights:       heights,
+			maxReorgDepth: 3,
+			depths:        []uint32{1, 3},
+		},
+		{
+			name:          "max depth exceeded",
+			heights:       heights[:6],
+			maxReorgDepth: 2,
+			depths:        []uint32{1, 3},
+			shutdownDepth: 3,
+		},
+		{
+			name:          "shallow max depth exceeded",
+			heights:       []int32{100, 101, 102, 101},
+			maxReorgDepth: 1,
+			depths:        []uint32{2},
+			shutdownDepth: 2,
+		},
+	}
+
+	for _, test := range tests {
+		notifier := &epochNotifier{
+			epochs: make(chan *chainntnfs.BlockEpoch),
+		}
+
+		var shutdownDepth uint32
+		monitor := newReorgMonitor(notifier, &reorgMonitorConfig{
+			MaxReorgDepth: test.maxReorgDepth,
+			Shutdown: func(depth uint32) {
+				shutdownDepth = depth
+			},
+		})
+
+		var depths []uint32
+		monitor.warnf = func(format string, params ...interface{}) {
+			var depth uint32
+			fmt.Sscanf(fmt.Sprintf(format, params...),
+				"Chain reorganization of depth %d", &depth)
+			depths = append(depths, depth)
+		}
+
+		if err := monitor.Start(); err != nil {
+			t.Fatalf("%s: unable to start monitor: %v", test.name,
+				err)
+		}
+
+		// If lnd is shut down, it's shut down by the last of the
+		// blocks, as the monitor stops consuming them afterwards.
+		for _, height := range test.heights {
+			epoch := &chainntnfs.BlockEpoch{
+				Hash:   &chainhash.Hash{byte(height)},
+				Height: height,
+			}
+			select {
+			case notifier.epochs <- epoch:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: block at height %d not "+
+					"consumed", test.name, height)
+			}
+		}
+
+		if err := monitor.Stop(); err != nil {
+			t.Fatalf("%s: unable to stop monitor: %v", test.name,
+				err)
+		}
+
+		if !reflect.DeepEqual(depths, test.depths) {
+			t.Fatalf("%s: expected reorg depths %v, got %v",
+				test.name, test.depths, depths)
+		}
+		if shutdownDepth != test.shutdownDepth {
+			t.Fatalf("%s: expected shutdown at depth %d, "+
+				"got %d", test.name, test.shutdownDepth,
+				shutdownDepth)
+		}
+	}
+}
@@ -10,11 +10,21 @@ import (
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil/gcs"
+	"github.com/btcsuite/btcutil/gcs/builder"
 	"github.com/btcsuite/btcwallet/chain"
 	"github.com/btcsuite/btcwallet/wtxmgr"
 	"github.com/lightningnetwork/lnd/channeldb"
 )
 
+// BlockFilterSource is a source of the BIP 158 basic compact filters of
+// blocks, such as bitcoind with its block filter index enabled.
+type BlockFilterSource interface {
+	// GetBlockFilter returns the basic compact filter of the block with
+	// the given hash.
+	GetBlockFilter(blockHash *chainhash.Hash) (*gcs.Filter, error)
+}
+
 // BitcoindFilteredChainView is an implementation of the FilteredChainView
 // interface which is backed by bitcoind.
 type BitcoindFilteredChainView struct {
@@ -42,9 +52,15 @@ type BitcoindFilteredChainView struct {
 	filterUpdates chan filterUpdate
 
 	// chainFilter is the set of utox's that we're currently watching
-	// spends for within the chain.
+	// spends for within the chain, along with their pkScripts, which are
+	// matched against the compact filters of blocks.
 	filterMtx   sync.RWMutex
-	chainFilter map[wire.OutPoint]struct{}
+	chainFilter map[wire.OutPoint][]byte
+
+	// filterSource, if set, provides the compact filters of blocks, such
+	// that only those which may spend any of the watched utxo's are
+	// fetched while filtering blocks.
+	filterSource BlockFilterSource
 
 	// filterBlockReqs is a channel in which requests to filter select
 	// blocks will be sent over.
@@ -64,7 +80,7 @@ func NewBitcoindFilteredChainView(
 	chainConn *chain.BitcoindConn) *BitcoindFilteredChainView {
 
 	chainView := &BitcoindFilteredChainView{
-		chainFilter:     make(map[wire.OutPoint]struct{}),
+		chainFilter:     make(map[wire.OutPoint][]byte),
 		filterUpdates:   make(chan filterUpdate),
 		filterBlockReqs: make(chan *filterBlockReq),
 		quit:            make(chan struct{}),
@@ -76,6 +92,19 @@ func NewBitcoindFilteredChainView(
 	return chainView
 }
 
+// NewBitcoindCfFilteredChainView creates a new instance of a FilteredChainView
+// backed by bitcoind, which matches the blocks it filters against their
+// compact filters obtained from the passed source before fetching them, e.g.
+// to reduce the bandwidth of rescans once the filter is updated.
+func NewBitcoindCfFilteredChainView(chainConn *chain.BitcoindConn,
+	filterSource BlockFilterSource) *BitcoindFilteredChainView {
+
+	chainView := NewBitcoindFilteredChainView(chainConn)
+	chainView.filterSource = filterSource
+
+	return chainView
+}
+
 // Start starts all goroutines necessary for normal operation.
 //
 // NOTE: This is part of the FilteredChainView interface.
@@ -266,6 +295,56 @@ func (b *BitcoindFilteredChainView) chainFilterer() {
 		return filteredTxns
 	}
 
+	// cfFilterBlock filters the block with the given hash and height by
+	// first matching the pkScripts of the watched outputs against its
+	// compact filter, such that the block itself is only fetched if it
+	// may spend any of them.
+	cfFilterBlock := func(blockHash *chainhash.Hash,
+		height uint32) (*FilteredBlock, error) {
+
+		filteredBlock := &FilteredBlock{
+			Hash:   *blockHash,
+			Height: height,
+		}
+
+		b.filterMtx.RLock()
+		pkScripts := make([][]byte, 0, len(b.chainFilter))
+		for _, pkScript := range b.chainFilter {
+			pkScripts = append(pkScripts, pkScript)
+		}
+		b.filterMtx.RUnlock()
+
+		// If we aren't watching any outputs, there's no need to fetch
+		// the filter.
+		if len(pkScripts) == 0 {
+			return filteredBlock, nil
+		}
+
+		filter, err := b.filterSource.GetBlockFilter(blockHash)
+		if err != nil {
+			return nil, err
+		}
+		matched, err := filter.MatchAny(
+			builder.DeriveKey(blockHash), pkScripts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			return filteredBlock, nil
+		}
+
+		// As the filter has a false positive rate, we'll fetch the
+		// block to scan it for any actual spends.
+		block, err := b.chainClient.GetBlock(blockHash)
+		if err != nil {
+			return nil, err
+		}
+		filteredBlock.Transactions = filterBlock(block)
+
+		return filteredBlock, nil
+	}
+
 	decodeJSONBlock := func(block *btcjson.RescannedBlock,
 		height uint32) (*FilteredBlock, error) {
 		hash, err := chainhash.NewHashFromStr(block.Hash)
@@ -299,18 +378,11 @@ func (b *BitcoindFilteredChainView) chainFilterer() {
 		// filter, so we'll apply the update, possibly rewinding our
 		// state partially.
 		case update := <-b.filterUpdates:
-			// First, we'll add all the new UTXO's to the set of
-			// watched UTXO's, eliminating any duplicates in the
-			// process.
+			// The new UTXO's were already added to the set of
+			// watched UTXO's by UpdateFilter.
 			log.Debugf("Updating chain filter with new UTXO's: %v",
 				update.newUtxos)
 
-			b.filterMtx.Lock()
-			for _, newOp := range update.newUtxos {
-				b.chainFilter[newOp] = struct{}{}
-			}
-			b.filterMtx.Unlock()
-
 			// Apply the new TX filter to the chain client, which
 			// will cause all following notifications from and
 			// calls to it return blocks filtered with the new
@@ -350,6 +422,29 @@ func (b *BitcoindFilteredChainView) chainFilterer() {
 					continue
 				}
 
+				// If compact filters are available, we'll
+				// only fetch the block if its filter matches.
+				if b.filterSource != nil {
+					filtered, err := cfFilterBlock(
+						blockHash, i,
+					)
+					if err != nil {
+						log.Warnf("Unable to filter "+
+							"block with hash %v "+
+							"at height %d: %v",
+							blockHash, i, err)
+						continue
+					}
+					if len(filtered.Transactions) == 0 {
+						continue
+					}
+					b.blockQueue.Add(&blockEvent{
+						eventType: connected,
+						block:     filtered,
+					})
+					continue
+				}
+
 				// To avoid dealing with the case where a reorg
 				// is happening while we rescan, we scan one
 				// block at a time, skipping blocks that might
@@ -388,16 +483,29 @@ func (b *BitcoindFilteredChainView) chainFilterer() {
 
 		// We've received a new request to manually filter a block.
 		case req := <-b.filterBlockReqs:
-			// First we'll fetch the block itself as well as some
-			// additional information including its height.
-			block, err := b.chainClient.GetBlock(req.blockHash)
+			// First we'll fetch some additional information about
+			// the block including its height.
+			header, err := b.chainClient.GetBlockHeaderVerbose(
+				req.blockHash)
 			if err != nil {
 				req.err <- err
 				req.resp <- nil
 				continue
 			}
-			header, err := b.chainClient.GetBlockHeaderVerbose(
-				req.blockHash)
+
+			// If compact filters are available, we'll only fetch
+			// the block itself if its filter matches.
+			if b.filterSource != nil {
+				filtered, err := cfFilterBlock(
+					req.blockHash, uint32(header.Height),
+				)
+				req.err <- err
+				req.resp <- filtered
+				continue
+			}
+
+			// Otherwise, we'll fetch the block itself.
+			block, err := b.chainClient.GetBlock(req.blockHash)
 			if err != nil {
 				req.err <- err
 				req.resp <- nil
@@ -443,10 +551,15 @@ func (b *BitcoindFilteredChainView) chainFilterer() {
 func (b *BitcoindFilteredChainView) UpdateFilter(ops []channeldb.EdgePoint,
 	updateHeight uint32) error {
 
+	// We'll add the new UTXO's to the set of watched UTXO's along with
+	// their pkScripts, eliminating any duplicates in the process.
 	newUtxos := make([]wire.OutPoint, len(ops))
+	b.filterMtx.Lock()
 	for i, op := range ops {
 		newUtxos[i] = op.OutPoint
+		b.chainFilter[op.OutPoint] = op.FundingPkScript
 	}
+	b.filterMtx.Unlock()
 
 	select {
 
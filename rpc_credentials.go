@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CredentialProvider supplies the RPC credentials of a chain backend. It
+// allows the credentials to be obtained from an external source, such as a
+// secrets vault, rather than from lnd's config or the backend's files. If set
+// on the chain's config, it's consulted in place of both when parsing the RPC
+// parameters.
+type CredentialProvider interface {
+	// Fetch returns the RPC username and password of the backend of the
+	// given chain.
+	Fetch(chain chainCode) (user, pass string, err error)
+}
+
+// staticCredentialProvider is a CredentialProvider which returns a fixed set
+// of credentials, such as the ones set through rpcuser and rpcpass.
+type staticCredentialProvider struct {
+	user string
+	pass string
+}
+
+// A compile-time check to ensure staticCredentialProvider implements the
+// CredentialProvider interface.
+var _ CredentialProvider = (*staticCredentialProvider)(nil)
+
+// newStaticCredentialProvider returns a CredentialProvider which always
+// returns the passed credentials.
+func newStaticCredentialProvider(user, pass string) *staticCredentialProvider {
+	return &staticCredentialProvider{
+		user: user,
+		pass: pass,
+	}
+}
+
+// Fetch returns the RPC username and password of the backend of the given
+// chain.
+//
+// NOTE: This is part of the CredentialProvider interface.
+func (s *staticCredentialProvider) Fetch(chain chainCode) (string, string,
+	error) {
+
+	return s.user, s.pass, nil
+}
+
+// fileCredentialProvider is a CredentialProvider which reads the credentials
+// from the config file or auth cookie of a btcd or bitcoind backend, the same
+// way the automatic RPC configuration does.
+type fileCredentialProvider struct {
+	// confFile is the path to the backend's config file, i.e. btcd.conf
+	// or bitcoin.conf.
+	confFile string
+
+	// bitcoind signals whether the backend is bitcoind-like, rather than
+	// btcd-like.
+	bitcoind bool
+
+	// cookieRetryTimeout is how long to keep retrying to read bitcoind's
+	// auth cookie if it hasn't been written yet.
+	cookieRetryTimeout time.Duration
+
+	// strictCookiePerms signals whether bitcoind's auth cookie should be
+	// rejected if it's readable by users other than its owner.
+	strictCookiePerms bool
+}
+
+// A compile-time check to ensure fileCredentialProvider implements the
+// CredentialProvider interface.
+var _ CredentialProvider = (*fileCredentialProvider)(nil)
+
+// newBtcdCredentialProvider returns a CredentialProvider which reads the
+// credentials from the btcd.conf at the given path.
+func newBtcdCredentialProvider(confFile string) *fileCredentialProvider {
+	return &fileCredentialProvider{
+		confFile: confFile,
+	}
+}
+
+// newBitcoindCredentialProvider returns a CredentialProvider which reads the
+// credentials from the auth cookie or config of the bitcoind whose
+// bitcoin.conf is found at the given path.
+func newBitcoindCredentialProvider(confFile string,
+	cookieRetryTimeout time.Duration,
+	strictCookiePerms bool) *fileCredentialProvider {
+
+	return &fileCredentialProvider{
+		confFile:           confFile,
+		bitcoind:           true,
+		cookieRetryTimeout: cookieRetryTimeout,
+		strictCookiePerms:  strictCookiePerms,
+	}
+}
+
+// Fetch returns the RPC username and password of the backend of the given
+// chain.
+//
+// NOTE: This is part of the CredentialProvider interface.
+func (f *fileCredentialProvider) Fetch(chain chainCode) (string, string,
+	error) {
+
+	if !f.bitcoind {
+		return extractBtcdRPCParams(f.confFile)
+	}
+
+	user, pass, _, _, err := extractBitcoindRPCParams(
+		f.confFile, f.cookieRetryTimeout, f.strictCookiePerms, chain,
+	)
+	return user, pass, err
+}
+
+// fetchRPCCredentials obtains the RPC credentials of the given daemon from the
+// passed provider, ensuring that both of them were supplied.
+func fetchRPCCredentials(provider CredentialProvider, chain chainCode,
+	daemonName string) (string, string, error) {
+
+	user, pass, err := provider.Fetch(chain)
+	if err != nil {
+		return "", "", newChainBackendError(
+			ErrCredentialsNotFound, fmt.Errorf("unable to fetch "+
+				"%v's RPC credentials: %v", daemonName, err),
+		)
+	}
+	if user == "" || pass == "" {
+		return "", "", newChainBackendError(
+			ErrCredentialsNotFound, errors.New("credential "+
+				"provider must supply both an RPC username "+
+				"and password for "+daemonName),
+		)
+	}
+
+	return user, pass, nil
+}
@@ -0,0 +1,166 @@
+// +build !rpctest
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mockCredentialProvider is a CredentialProvider which returns a static set of
+// credentials, and records the chains they were fetched for.
+type mockCredentialProvider struct {
+	user string
+	pass string
+	err  error
+
+	fetched []chainCode
+}
+
+func (m *mockCredentialProvider) Fetch(chain chainCode) (string, string,
+	error) {
+
+	m.fetched = append(m.fetched, chain)
+	return m.user, m.pass, m.err
+}
+
+// TestFileCredentialProvider ensures that the file-based credential providers
+// read the credentials from btcd's config and bitcoind's auth cookie, while the
+// static one returns its credentials unchanged.
+func TestFileCredentialProvider(t *testing.T) {
+	defer func(params bitcoinNetParams) {
+		activeNetParams = params
+	}(activeNetParams)
+	activeNetParams = bitcoinTestNetParams
+
+	dir, cleanUp := createTestBitcoindDir(t, map[string]string{
+		"btcd.conf": "rpcuser=btcduser\nrpcpass=btcdpass\n",
+		"bitcoin.conf": "zmqpubrawblock=tcp://127.0.0.1:28332\n" +
+			"zmqpubrawtx=tcp://127.0.0.1:28333\n",
+		"testnet3/.cookie": "cookieuser:cookiepass",
+	})
+	defer cleanUp()
+
+	tests := []struct {
+		name     string
+		provider CredentialProvider
+		user     string
+		pass     string
+	}{
+		{
+			name:     "static",
+			provider: newStaticCredentialProvider("user", "pass"),
+			user:     "user",
+			pass:     "pass",
+		},
+		{
+			name: "btcd",
+			provider: newBtcdCredentialProvider(
+				filepath.Join(dir, "btcd.conf"),
+			),
+			user: "btcduser",
+			pass: "btcdpass",
+		},
+		{
+			name: "bitcoind",
+			provider: newBitcoindCredentialProvider(
+				filepath.Join(dir, "bitcoin.conf"), 0, false,
+			),
+			user: "cookieuser",
+			pass: "cookiepass",
+		},
+	}
+
+	for _, test := range tests {
+		user, pass, err := test.provider.Fetch(bitcoinChain)
+		if err != nil {
+			t.Fatalf("%s: unable to fetch credentials: %v",
+				test.name, err)
+		}
+		if user != test.user || pass != test.pass {
+			t.Fatalf("%s: expected credentials %v:%v, got %v:%v",
+				test.name, test.user, test.pass, user, pass)
+		}
+	}
+}
+
+// TestParseRPCParamsCredentialProvider ensures that a credential provider
+// supplies the RPC credentials in place of both the config and the backend's
+// files, which aren't read at all.
+func TestParseRPCParamsCredentialProvider(t *testing.T) {
+	// The backend's directory doesn't exist, so reading any of its files
+	// would fail.
+	const missingDir = "/nonexistent/lnd/backend"
+
+	provider := &mockCredentialProvider{
+		user: "vaultuser",
+		pass: "vaultpass",
+	}
+	chainCfg := &chainConfig{
+		Node:               "btcd",
+		CredentialProvider: provider,
+	}
+	btcdConf := &btcdConfig{
+		Dir:     missingDir,
+		RPCUser: "user",
+		RPCPass: "pass",
+	}
+	err := parseRPCParams(chainCfg, btcdConf, litecoinChain, "test")
+	if err != nil {
+		t.Fatalf("unable to parse rpc params: %v", err)
+	}
+	if btcdConf.RPCUser != "vaultuser" || btcdConf.RPCPass != "vaultpass" {
+		t.Fatalf("expected credentials of provider, got %v:%v",
+			btcdConf.RPCUser, btcdConf.RPCPass)
+	}
+	if len(provider.fetched) != 1 || provider.fetched[0] != litecoinChain {
+		t.Fatalf("expected credentials to be fetched for litecoin, "+
+			"got %v", provider.fetched)
+	}
+
+	// As bitcoin.conf isn't read, bitcoind's ZMQ options need to be set
+	// explicitly.
+	chainCfg.Node = "bitcoind"
+	bitcoindConf := &bitcoindConfig{
+		Dir:     missingDir,
+		RPCHost: "localhost",
+	}
+	err = parseRPCParams(chainCfg, bitcoindConf, bitcoinChain, "test")
+	if err == nil || !strings.Contains(err.Error(), "zmqpubrawblock") {
+		t.Fatalf("expected error naming zmqpubrawblock, got: %v", err)
+	}
+
+	bitcoindConf.ZMQPubRawBlock = "tcp://127.0.0.1:28332"
+	bitcoindConf.ZMQPubRawTx = "tcp://127.0.0.1:28333"
+	err = parseRPCParams(chainCfg, bitcoindConf, bitcoinChain, "test")
+	if err != nil {
+		t.Fatalf("unable to parse rpc params: %v", err)
+	}
+	if bitcoindConf.RPCUser != "vaultuser" ||
+		bitcoindConf.RPCPass != "vaultpass" {
+
+		t.Fatalf("expected credentials of provider, got %v:%v",
+			bitcoindConf.RPCUser, bitcoindConf.RPCPass)
+	}
+	if bitcoindConf.RPCHost != "localhost" {
+		t.Fatalf("expected rpchost to be left unchanged, got %v",
+			bitcoindConf.RPCHost)
+	}
+
+	// Failing to fetch the credentials, or fetching incomplete ones,
+	// should result in an error.
+	provider.err = errors.New("vault sealed")
+	err = parseRPCParams(chainCfg, bitcoindConf, bitcoinChain, "test")
+	if err == nil || !strings.Contains(err.Error(), "vault sealed") {
+		t.Fatalf("expected error of provider, got: %v", err)
+	}
+
+	provider.err = nil
+	provider.pass = ""
+	err = parseRPCParams(chainCfg, btcdConf, bitcoinChain, "test")
+	if err == nil {
+		t.Fatalf("expected incomplete credentials to be rejected")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// rpcLimiter is a semaphore which caps the number of concurrent RPC calls lnd
+// makes to its btcd or bitcoind backend, so that bursts of calls under load
+// don't overwhelm a modest backend and cause cascading timeouts. Calls beyond
+// the limit block until a slot frees up.
+type rpcLimiter struct {
+	slots chan struct{}
+}
+
+// newRPCLimiter returns an rpcLimiter which allows up to maxConcurrency calls
+// to be in flight at once. As a zero maximum imposes no limit, nil is returned
+// in that case, which the wrappers of this file treat as unlimited.
+func newRPCLimiter(maxConcurrency uint32) *rpcLimiter {
+	if maxConcurrency == 0 {
+		return nil
+	}
+
+	return &rpcLimiter{
+		slots: make(chan struct{}, maxConcurrency),
+	}
+}
+
+// limit carries out the passed RPC call once a slot is available, and frees
+// the slot again once it has completed. If the context is canceled while
+// waiting for a slot, the call is abandoned and the context's error is
+// returned.
+func (l *rpcLimiter) limit(ctx context.Context, call func() error) error {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() {
+		<-l.slots
+	}()
+
+	return call()
+}
+
+// limitedChainIO is a lnwallet.BlockChainIO which caps the number of
+// concurrent calls made to the backend through it.
+type limitedChainIO struct {
+	lnwallet.BlockChainIO
+
+	limiter *rpcLimiter
+}
+
+// A compile-time assertion to ensure limitedChainIO meets the
+// lnwallet.BlockChainIO interface.
+var _ lnwallet.BlockChainIO = (*limitedChainIO)(nil)
+
+// limitChainIO wraps the passed lnwallet.BlockChainIO, such that its calls are
+// limited by the given limiter. If it's nil, the chain IO is returned as is.
+func limitChainIO(chainIO lnwallet.BlockChainIO,
+	limiter *rpcLimiter) lnwallet.BlockChainIO {
+
+	if limiter == nil {
+		return chainIO
+	}
+
+	return &limitedChainIO{
+		BlockChainIO: chainIO,
+		limiter:      limiter,
+	}
+}
+
+// GetBestBlock returns the current height and block hash of the valid
+// most-work chain the implementation is aware of.
+//
+// NOTE: This method is part of the lnwallet.BlockChainIO interface.
+func (l *limitedChainIO) GetBestBlock() (*chainhash.Hash, int32, error) {
+	var (
+		hash   *chainhash.Hash
+		height int32
+	)
+	err := l.limiter.limit(context.Background(), func() error {
+		var err error
+		hash, height, err = l.BlockChainIO.GetBestBlock()
+		return err
+	})
+
+	return hash, height, err
+}
+
+// GetUtxo returns the original output referenced by the passed outpoint if it
+// is still a member of the utxo set.
+//
+// NOTE: This method is part of the lnwallet.BlockChainIO interface.
+func (l *limitedChainIO) GetUtxo(op *wire.OutPoint, pkScript []byte,
+	heightHint uint32) (*wire.TxOut, error) {
+
+	var txOut *wire.TxOut
+	err := l.limiter.limit(context.Background(), func() error {
+		var err error
+		txOut, err = l.BlockChainIO.GetUtxo(op, pkScript, heightHint)
+		return err
+	})
+
+	return txOut, err
+}
+
+// GetBlockHash returns the hash of the block in the best blockchain at the
+// given height.
+//
+// NOTE: This method is part of the lnwallet.BlockChainIO interface.
+func (l *limitedChainIO) GetBlockHash(blockHeight int64) (*chainhash.Hash,
+	error) {
+
+	var hash *chainhash.Hash
+	err := l.limiter.limit(context.Background(), func() error {
+		var err error
+		hash, err = l.BlockChainIO.GetBlockHash(blockHeight)
+		return err
+	})
+
+	return hash, err
+}
+
+// GetBlock returns the block in the main chain identified by the given hash.
+//
+// NOTE: This method is part of the lnwallet.BlockChainIO interface.
+func (l *limitedChainIO) GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock,
+	error) {
+
+	var block *wire.MsgBlock
+	err := l.limiter.limit(context.Background(), func() error {
+		var err error
+		block, err = l.BlockChainIO.GetBlock(blockHash)
+		return err
+	})
+
+	return block, err
+}
+
+// limitedFeeEstimator is a lnwallet.FeeEstimator backed by live estimates
+// from the backend, which caps the number of estimates requested
+// concurrently.
+type limitedFeeEstimator struct {
+	lnwallet.FeeEstimator
+
+	limiter *rpcLimiter
+}
+
+// A compile-time assertion to ensure limitedFeeEstimator meets the
+// lnwallet.FeeEstimator interface.
+var _ lnwallet.FeeEstimator = (*limitedFeeEstimator)(nil)
+
+// limitFeeEstimator wraps the passed lnwallet.FeeEstimator, such that its
+// estimates are limited by the given limiter. If it's nil, the estimator is
+// returned as is.
+func limitFeeEstimator(estimator lnwallet.FeeEstimator,
+	limiter *rpcLimiter) lnwallet.FeeEstimator {
+
+	if limiter == nil {
+		return estimator
+	}
+
+	return &limitedFeeEstimator{
+		FeeEstimator: estimator,
+		limiter:      limiter,
+	}
+}
+
+// EstimateFeePerKW takes in a target for the number of blocks until an
+// initial confirmation and returns the estimated fee expressed in sat/kw.
+//
+// NOTE: This method is part of the lnwallet.FeeEstimator interface.
+func (l *limitedFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	var feeRate lnwallet.SatPerKWeight
+	err := l.limiter.limit(context.Background(), func() error {
+		var err error
+		feeRate, err = l.FeeEstimator.EstimateFeePerKW(numBlocks)
+		return err
+	})
+
+	return feeRate, err
+}
+
+// limitSyncStatus wraps the passed sync status query, such that each query is
+// limited by the given limiter. If it's nil, the query is returned as is.
+func limitSyncStatus(syncStatus func() (bool, error),
+	limiter *rpcLimiter) func() (bool, error) {
+
+	if limiter == nil {
+		return syncStatus
+	}
+
+	return func() (bool, error) {
+		var synced bool
+		err := limiter.limit(context.Background(), func() error {
+			var err error
+			synced, err = syncStatus()
+			return err
+		})
+
+		return synced, err
+	}
+}
+
+// limitBestBlock wraps the passed best block query, such that each query is
+// limited by the given limiter. If it's nil, the query is returned as is.
+func limitBestBlock(bestBlock func() (chainhash.Hash, int32, error),
+	limiter *rpcLimiter) func() (chainhash.Hash, int32, error) {
+
+	if limiter == nil {
+		return bestBlock
+	}
+
+	return func() (chainhash.Hash, int32, error) {
+		var (
+			hash   chainhash.Hash
+			height int32
+		)
+		err := limiter.limit(context.Background(), func() error {
+			var err error
+			hash, height, err = bestBlock()
+			return err
+		})
+
+		return hash, height, err
+	}
+}
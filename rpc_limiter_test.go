@@ -0,0 +1,171 @@
+// +build !rpctest
+
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// blockingChainIO is a lnwallet.BlockChainIO whose GetBestBlock calls block
+// until released, while tracking the number of calls in flight.
+type blockingChainIO struct {
+	lnwallet.BlockChainIO
+
+	release chan struct{}
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+// GetBestBlock blocks until the chain IO is released.
+func (b *blockingChainIO) GetBestBlock() (*chainhash.Hash, int32, error) {
+	b.mu.Lock()
+	b.inFlight++
+	if b.inFlight > b.maxInFlight {
+		b.maxInFlight = b.inFlight
+	}
+	b.mu.Unlock()
+
+	<-b.release
+
+	b.mu.Lock()
+	b.inFlight--
+	b.mu.Unlock()
+
+	return &chainhash.Hash{}, fundingBroadcastHeight, nil
+}
+
+// TestRPCLimiterMaxConcurrency ensures that the limited chain IO caps the
+// number of calls in flight to the configured maximum, while the remaining
+// calls wait for a slot and eventually complete.
+func TestRPCLimiterMaxConcurrency(t *testing.T) {
+	t.Parallel()
+
+	const (
+		maxConcurrency = 3
+		numCalls       = 10
+	)
+
+	backend := &blockingChainIO{
+		release: make(chan struct{}),
+	}
+	chainIO := limitChainIO(backend, newRPCLimiter(maxConcurrency))
+
+	var (
+		wg        sync.WaitGroup
+		completed int32
+	)
+	for i := 0; i < numCalls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, _, err := chainIO.GetBestBlock(); err != nil {
+				t.Errorf("unable to get best block: %v", err)
+			}
+			atomic.AddInt32(&completed, 1)
+		}()
+	}
+
+	// Give the calls a chance to pile up. Only the maximum number of them
+	// should reach the backend, with none of them completing yet.
+	time.Sleep(100 * time.Millisecond)
+	backend.mu.Lock()
+	inFlight := backend.inFlight
+	backend.mu.Unlock()
+	if inFlight != maxConcurrency {
+		t.Fatalf("expected %d calls in flight, got %d", maxConcurrency,
+			inFlight)
+	}
+	if atomic.LoadInt32(&completed) != 0 {
+		t.Fatalf("expected no calls to complete yet")
+	}
+
+	// Once the backend starts responding, all calls should complete
+	// without ever exceeding the maximum.
+	close(backend.release)
+	wg.Wait()
+
+	if atomic.LoadInt32(&completed) != numCalls {
+		t.Fatalf("expected %d calls to complete, got %d", numCalls,
+			atomic.LoadInt32(&completed))
+	}
+	if backend.maxInFlight != maxConcurrency {
+		t.Fatalf("expected at most %d calls in flight, got %d",
+			maxConcurrency, backend.maxInFlight)
+	}
+}
+
+// TestRPCLimiterContext ensures that a call waiting for a slot is abandoned
+// once its context is canceled.
+func TestRPCLimiterContext(t *testing.T) {
+	t.Parallel()
+
+	limiter := newRPCLimiter(1)
+
+	// We'll occupy the only slot until the end of the test.
+	release := make(chan struct{})
+	defer close(release)
+	occupied := make(chan struct{})
+	go limiter.limit(context.Background(), func() error {
+		close(occupied)
+		<-release
+		return nil
+	})
+	<-occupied
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 50*time.Millisecond,
+	)
+	defer cancel()
+
+	called := false
+	err := limiter.limit(ctx, func() error {
+		called = true
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline to be exceeded, got: %v", err)
+	}
+	if called {
+		t.Fatalf("call was carried out without a slot")
+	}
+}
+
+// TestRPCLimiterUnlimited ensures that no limit is imposed if the maximum
+// concurrency isn't set, leaving the wrapped chain IO, fee estimator and sync
+// status untouched.
+func TestRPCLimiterUnlimited(t *testing.T) {
+	t.Parallel()
+
+	limiter := newRPCLimiter(0)
+	if limiter != nil {
+		t.Fatalf("expected no limiter")
+	}
+
+	chainIO := &mockChainIO{}
+	if limitChainIO(chainIO, limiter) != chainIO {
+		t.Fatalf("expected chain IO to be left unwrapped")
+	}
+
+	feeEstimator := lnwallet.StaticFeeEstimator{FeePerKW: 1000}
+	if limitFeeEstimator(feeEstimator, limiter) != feeEstimator {
+		t.Fatalf("expected fee estimator to be left unwrapped")
+	}
+
+	synced, err := limitSyncStatus(func() (bool, error) {
+		return true, nil
+	}, limiter)()
+	if err != nil || !synced {
+		t.Fatalf("expected sync status to be passed through, got "+
+			"%v: %v", synced, err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// RPCObserver is an optional hook which is notified of the RPC calls lnd
+// makes to its btcd or bitcoind backend, allowing operators to instrument
+// them, e.g. with Prometheus counters.
+type RPCObserver interface {
+	// OnCall is invoked once the RPC call to the given method has
+	// completed, along with its duration and the error it returned, if
+	// any.
+	//
+	// NOTE: This may be called concurrently from multiple goroutines.
+	OnCall(method string, dur time.Duration, err error)
+}
+
+// observeRPC carries out the passed RPC call, and reports its duration and
+// outcome to the observer under the given method name.
+func observeRPC(observer RPCObserver, method string, call func() error) error {
+	start := time.Now()
+	err := call()
+	observer.OnCall(method, time.Since(start), err)
+
+	return err
+}
+
+// observedChainIO is a lnwallet.BlockChainIO which reports each of the calls
+// made to the backend through it to an RPCObserver.
+type observedChainIO struct {
+	lnwallet.BlockChainIO
+
+	observer RPCObserver
+}
+
+// A compile-time assertion to ensure observedChainIO meets the
+// lnwallet.BlockChainIO interface.
+var _ lnwallet.BlockChainIO = (*observedChainIO)(nil)
+
+// GetBestBlock returns the current height and block hash of the valid
+// most-work chain the implementation is aware of.
+//
+// NOTE: This method is part of the lnwallet.BlockChainIO interface.
+func (o *observedChainIO) GetBestBlock() (*chainhash.Hash, int32, error) {
+	var (
+		hash   *chainhash.Hash
+		height int32
+	)
+	err := observeRPC(o.observer, "getbestblock", func() error {
+		var err error
+		hash, height, err = o.BlockChainIO.GetBestBlock()
+		return err
+	})
+
+	return hash, height, err
+}
+
+// GetUtxo returns the original output referenced by the passed outpoint if it
+// is still a member of the utxo set.
+//
+// NOTE: This method is part of the lnwallet.BlockChainIO interface.
+func (o *observedChainIO) GetUtxo(op *wire.OutPoint, pkScript []byte,
+	heightHint uint32) (*wire.TxOut, error) {
+
+	var txOut *wire.TxOut
+	err := observeRPC(o.observer, "gettxout", func() error {
+		var err error
+		txOut, err = o.BlockChainIO.GetUtxo(op, pkScript, heightHint)
+		return err
+	})
+
+	return txOut, err
+}
+
+// GetBlockHash returns the hash of the block in the best blockchain at the
+// given height.
+//
+// NOTE: This method is part of the lnwallet.BlockChainIO interface.
+func (o *observedChainIO) GetBlockHash(blockHeight int64) (*chainhash.Hash,
+	error) {
+
+	var hash *chainhash.Hash
+	err := observeRPC(o.observer, "getblockhash", func() error {
+		var err error
+		hash, err = o.BlockChainIO.GetBlockHash(blockHeight)
+		return err
+	})
+
+	return hash, err
+}
+
+// GetBlock returns the block in the main chain identified by the given hash.
+//
+// NOTE: This method is part of the lnwallet.BlockChainIO interface.
+func (o *observedChainIO) GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock,
+	error) {
+
+	var block *wire.MsgBlock
+	err := observeRPC(o.observer, "getblock", func() error {
+		var err error
+		block, err = o.BlockChainIO.GetBlock(blockHash)
+		return err
+	})
+
+	return block, err
+}
+
+// observedFeeEstimator is a lnwallet.FeeEstimator backed by live estimates
+// from the backend, which reports each estimate it requests to an
+// RPCObserver.
+type observedFeeEstimator struct {
+	lnwallet.FeeEstimator
+
+	// method is the name of the RPC the backend's fee estimates are
+	// requested with.
+	method string
+
+	observer RPCObserver
+}
+
+// A compile-time assertion to ensure observedFeeEstimator meets the
+// lnwallet.FeeEstimator interface.
+var _ lnwallet.FeeEstimator = (*observedFeeEstimator)(nil)
+
+// EstimateFeePerKW takes in a target for the number of blocks until an
+// initial confirmation and returns the estimated fee expressed in sat/kw.
+//
+// NOTE: This method is part of the lnwallet.FeeEstimator interface.
+func (o *observedFeeEstimator) EstimateFeePerKW(
+	numBlocks uint32) (lnwallet.SatPerKWeight, error) {
+
+	var feeRate lnwallet.SatPerKWeight
+	err := observeRPC(o.observer, o.method, func() error {
+		var err error
+		feeRate, err = o.FeeEstimator.EstimateFeePerKW(numBlocks)
+		return err
+	})
+
+	return feeRate, err
+}
+
+// observedSyncStatus wraps the passed sync status query, such that each query
+// is reported to the observer as a getblockchaininfo call.
+func observedSyncStatus(syncStatus func() (bool, error),
+	observer RPCObserver) func() (bool, error) {
+
+	return func() (bool, error) {
+		var synced bool
+		err := observeRPC(observer, "getblockchaininfo", func() error {
+			var err error
+			synced, err = syncStatus()
+			return err
+		})
+
+		return synced, err
+	}
+}
@@ -0,0 +1,101 @@
+// +build !rpctest
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// countingObserver is an RPCObserver which records the calls it's notified
+// of.
+type countingObserver struct {
+	mu     sync.Mutex
+	calls  []string
+	errors int
+}
+
+// OnCall records the method of the observed call, and whether it failed.
+func (c *countingObserver) OnCall(method string, dur time.Duration,
+	err error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, method)
+	if err != nil {
+		c.errors++
+	}
+}
+
+// TestRPCObserver ensures that the observer is notified of the calls made
+// through the observed chain IO, fee estimator and sync status, and that the
+// results of the underlying calls are passed through unchanged.
+func TestRPCObserver(t *testing.T) {
+	t.Parallel()
+
+	observer := &countingObserver{}
+
+	chainIO := &observedChainIO{
+		BlockChainIO: &mockChainIO{},
+		observer:     observer,
+	}
+	_, height, err := chainIO.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if height != fundingBroadcastHeight {
+		t.Fatalf("expected height %d, got %d", fundingBroadcastHeight,
+			height)
+	}
+	if _, err := chainIO.GetUtxo(&wire.OutPoint{}, nil, 0); err != nil {
+		t.Fatalf("unable to get utxo: %v", err)
+	}
+	if _, err := chainIO.GetBlockHash(100); err != nil {
+		t.Fatalf("unable to get block hash: %v", err)
+	}
+	if _, err := chainIO.GetBlock(&chainhash.Hash{}); err != nil {
+		t.Fatalf("unable to get block: %v", err)
+	}
+
+	feeEstimator := &observedFeeEstimator{
+		FeeEstimator: lnwallet.StaticFeeEstimator{FeePerKW: 1000},
+		method:       "estimatesmartfee",
+		observer:     observer,
+	}
+	feeRate, err := feeEstimator.EstimateFeePerKW(6)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if feeRate != 1000 {
+		t.Fatalf("expected fee rate 1000, got %v", feeRate)
+	}
+
+	// Failed calls should be reported along with their error.
+	errUnreachable := errors.New("backend unreachable")
+	syncStatus := observedSyncStatus(func() (bool, error) {
+		return false, errUnreachable
+	}, observer)
+	if _, err := syncStatus(); err != errUnreachable {
+		t.Fatalf("expected %v, got %v", errUnreachable, err)
+	}
+
+	expectedCalls := []string{
+		"getbestblock", "gettxout", "getblockhash", "getblock",
+		"estimatesmartfee", "getblockchaininfo",
+	}
+	if !reflect.DeepEqual(observer.calls, expectedCalls) {
+		t.Fatalf("expected calls %v, got %v", expectedCalls,
+			observer.calls)
+	}
+	if observer.errors != 1 {
+		t.Fatalf("expected 1 failed call, got %d", observer.errors)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// errWatchOnly is returned by the watchOnlySigner for any attempt to sign.
+var errWatchOnly = errors.New("signing disabled in watch-only mode")
+
+// watchOnlySigner is the signer of the chain control in watch-only mode. As
+// the wallet doesn't hold any private key material in this mode, it refuses to
+// sign anything, so that e.g. an attempt to open a channel fails with a
+// descriptive error.
+type watchOnlySigner struct{}
+
+// A compile-time assertion to ensure watchOnlySigner meets the lnwallet.Signer
+// and lnwallet.MessageSigner interfaces.
+var _ lnwallet.Signer = (*watchOnlySigner)(nil)
+var _ lnwallet.MessageSigner = (*watchOnlySigner)(nil)
+
+// SignOutputRaw always returns errWatchOnly.
+//
+// NOTE: This is part of the lnwallet.Signer interface.
+func (*watchOnlySigner) SignOutputRaw(tx *wire.MsgTx,
+	signDesc *lnwallet.SignDescriptor) ([]byte, error) {
+
+	return nil, errWatchOnly
+}
+
+// ComputeInputScript always returns errWatchOnly.
+//
+// NOTE: This is part of the lnwallet.Signer interface.
+func (*watchOnlySigner) ComputeInputScript(tx *wire.MsgTx,
+	signDesc *lnwallet.SignDescriptor) (*lnwallet.InputScript, error) {
+
+	return nil, errWatchOnly
+}
+
+// SignMessage always returns errWatchOnly.
+//
+// NOTE: This is part of the lnwallet.MessageSigner interface.
+func (*watchOnlySigner) SignMessage(pubKey *btcec.PublicKey,
+	msg []byte) (*btcec.Signature, error) {
+
+	return nil, errWatchOnly
+}
@@ -0,0 +1,38 @@
+// +build !rpctest
+
+package main
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/lnwallet"
+)
+
+// TestWatchOnlySigner ensures that each attempt to sign in watch-only mode
+// fails with a descriptive error.
+func TestWatchOnlySigner(t *testing.T) {
+	t.Parallel()
+
+	signer := &watchOnlySigner{}
+	tx := wire.NewMsgTx(2)
+	signDesc := &lnwallet.SignDescriptor{}
+
+	if _, err := signer.SignOutputRaw(tx, signDesc); err != errWatchOnly {
+		t.Fatalf("expected %v, got %v", errWatchOnly, err)
+	}
+	_, err := signer.ComputeInputScript(tx, signDesc)
+	if err != errWatchOnly {
+		t.Fatalf("expected %v, got %v", errWatchOnly, err)
+	}
+
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	_, err = signer.SignMessage(privKey.PubKey(), []byte("msg"))
+	if err != errWatchOnly {
+		t.Fatalf("expected %v, got %v", errWatchOnly, err)
+	}
+}
@@ -0,0 +1,686 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// zmqGreetingSize is the size of the greeting exchanged by both peers
+	// of a ZMTP 3.0 connection.
+	zmqGreetingSize = 64
+
+	// zmqMaxFrameSize is the maximum size of a frame relayed by the
+	// zmqRelay, which matches the maximum size of a bitcoin message.
+	zmqMaxFrameSize = 0x02000000
+
+	// zmqMaxMessageFrames is the maximum number of frames of a message
+	// relayed by the zmqRelay. bitcoind's messages consist of three.
+	zmqMaxMessageFrames = 16
+
+	// zmqHandshakeTimeout is the maximum time the zmqRelay waits for a
+	// peer to complete the ZMTP handshake.
+	zmqHandshakeTimeout = 10 * time.Second
+
+	// zmqFlagMore is set on all but the last frame of a message.
+	zmqFlagMore = 0x01
+
+	// zmqFlagLong is set on frames whose size is encoded in eight bytes
+	// rather than one.
+	zmqFlagLong = 0x02
+
+	// zmqFlagCommand is set on frames carrying a command rather than a
+	// message.
+	zmqFlagCommand = 0x04
+
+	// zmqCommandReady is the name of the command both peers send to
+	// complete the handshake.
+	zmqCommandReady = "READY"
+
+	// defaultZMQMinReconnectBackoff is the initial delay between two
+	// failed attempts of the zmqRelay to resubscribe to the backend.
+	defaultZMQMinReconnectBackoff = time.Second
+
+	// defaultZMQMaxReconnectBackoff is the maximum delay between two
+	// failed attempts of the zmqRelay to resubscribe to the backend.
+	defaultZMQMaxReconnectBackoff = time.Minute
+)
+
+// zmqFrame is a single frame of a ZMTP 3.0 connection, either a command or
+// one part of a message.
+type zmqFrame struct {
+	flags byte
+	body  []byte
+}
+
+// more returns whether the frame is followed by another one of the same
+// message.
+func (f *zmqFrame) more() bool {
+	return f.flags&zmqFlagMore != 0
+}
+
+// command returns whether the frame carries a command.
+func (f *zmqFrame) command() bool {
+	return f.flags&zmqFlagCommand != 0
+}
+
+// encode appends the frame, as sent over the wire, to the passed buffer.
+func (f *zmqFrame) encode(buf *bytes.Buffer) {
+	flags := f.flags &^ zmqFlagLong
+	if len(f.body) > 255 {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(f.body)))
+
+		buf.WriteByte(flags | zmqFlagLong)
+		buf.Write(size[:])
+	} else {
+		buf.WriteByte(flags)
+		buf.WriteByte(byte(len(f.body)))
+	}
+	buf.Write(f.body)
+}
+
+// readZMQFrame reads a single frame from the passed reader.
+func readZMQFrame(r io.Reader) (*zmqFrame, error) {
+	var flags [1]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return nil, err
+	}
+	if flags[0]&^(zmqFlagMore|zmqFlagLong|zmqFlagCommand) != 0 {
+		return nil, fmt.Errorf("invalid frame flags %#x", flags[0])
+	}
+
+	var size uint64
+	if flags[0]&zmqFlagLong != 0 {
+		var sizeBuf [8]byte
+		if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+			return nil, err
+		}
+		size = binary.BigEndian.Uint64(sizeBuf[:])
+	} else {
+		var sizeBuf [1]byte
+		if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+			return nil, err
+		}
+		size = uint64(sizeBuf[0])
+	}
+	if size > zmqMaxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds maximum of "+
+			"%d bytes", size, zmqMaxFrameSize)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return &zmqFrame{flags: flags[0], body: body}, nil
+}
+
+// zmqGreeting returns the ZMTP 3.0 greeting of a peer using the NULL security
+// mechanism, which is what bitcoind and btcwallet's subscriptions use.
+func zmqGreeting() []byte {
+	greeting := make([]byte, zmqGreetingSize)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3
+	copy(greeting[12:], "NULL")
+
+	return greeting
+}
+
+// checkZMQGreeting ensures the passed greeting of a peer is one of a ZMTP 3.0
+// or later peer using the NULL security mechanism.
+func checkZMQGreeting(greeting []byte) error {
+	switch {
+	case greeting[0] != 0xff || greeting[9] != 0x7f:
+		return errors.New("invalid ZMTP signature")
+
+	case greeting[10] < 3:
+		return fmt.Errorf("unsupported ZMTP version %d", greeting[10])
+
+	case string(greeting[12:17]) != "NULL\x00":
+		return errors.New("unsupported ZMTP security mechanism")
+	}
+
+	return nil
+}
+
+// zmqReady returns the READY command announcing the passed socket type.
+func zmqReady(socketType string) *zmqFrame {
+	const property = "Socket-Type"
+
+	var body bytes.Buffer
+	body.WriteByte(byte(len(zmqCommandReady)))
+	body.WriteString(zmqCommandReady)
+	body.WriteByte(byte(len(property)))
+	body.WriteString(property)
+	binary.Write(&body, binary.BigEndian, uint32(len(socketType)))
+	body.WriteString(socketType)
+
+	return &zmqFrame{flags: zmqFlagCommand, body: body.Bytes()}
+}
+
+// zmqHandshake performs the ZMTP 3.0 handshake over the passed connection,
+// announcing the given socket type. The peer's metadata isn't inspected, as
+// the relay only ever pairs a subscriber with a publisher.
+func zmqHandshake(conn net.Conn, socketType string) error {
+	conn.SetDeadline(time.Now().Add(zmqHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write(zmqGreeting()); err != nil {
+		return err
+	}
+
+	greeting := make([]byte, zmqGreetingSize)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return err
+	}
+	if err := checkZMQGreeting(greeting); err != nil {
+		return err
+	}
+
+	var ready bytes.Buffer
+	zmqReady(socketType).encode(&ready)
+	if _, err := conn.Write(ready.Bytes()); err != nil {
+		return err
+	}
+
+	// The command's body starts with the length of its name, followed by
+	// the name itself.
+	frame, err := readZMQFrame(conn)
+	if err != nil {
+		return err
+	}
+	name := append([]byte{byte(len(zmqCommandReady))}, zmqCommandReady...)
+	if !frame.command() || !bytes.HasPrefix(frame.body, name) {
+		return errors.New("expected READY command")
+	}
+
+	return nil
+}
+
+// dialZMQ connects to the passed ZMQ endpoint, dialing TCP endpoints with the
+// given dial function, and IPC endpoints through their Unix domain socket.
+func dialZMQ(dial func(string, string) (net.Conn, error),
+	endpoint string) (net.Conn, error) {
+
+	switch {
+	case strings.HasPrefix(endpoint, zmqTCPPrefix):
+		return dial("tcp", strings.TrimPrefix(endpoint, zmqTCPPrefix))
+
+	case strings.HasPrefix(endpoint, zmqIPCPrefix):
+		path := strings.TrimPrefix(endpoint, zmqIPCPrefix)
+		return net.Dial("unix", path)
+
+	default:
+		return nil, fmt.Errorf("unsupported ZMQ endpoint %v", endpoint)
+	}
+}
+
+// zmqRelay relays the messages published on a ZMQ endpoint of the backend to
+// the subscribers connecting to a loopback listener. btcwallet's ZMQ
+// subscriptions stop delivering notifications for good once their connection
+// to bitcoind is lost, e.g. as it's restarted, and they can't be rebuilt
+// without tearing down the chain notifier and chain view, which would drop the
+// registrations held with them. Subscribing through the relay instead keeps
+// their connection open, while the relay resubscribes to the backend on their
+// behalf, backing off exponentially, whenever its own connection is lost or
+// reset. Only complete messages are relayed, so the subscribers never observe
+// a message torn by a lost connection.
+type zmqRelay struct {
+	stopped int32 // To be used atomically.
+
+	dial       func(string, string) (net.Conn, error)
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	listener   net.Listener
+
+	// mtx guards the endpoint subscribers are relayed from, along with
+	// the set of active sessions.
+	mtx      sync.Mutex
+	endpoint string
+	sessions map[*zmqRelaySession]struct{}
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// zmqRelaySession is the relay of a single subscriber connected to the
+// zmqRelay, along with its connection to the backend's endpoint.
+type zmqRelaySession struct {
+	local net.Conn
+
+	// mtx guards the subscriptions of the subscriber, which are replayed
+	// whenever the session resubscribes, along with the connection to the
+	// backend's endpoint, which is nil while it's being established.
+	mtx           sync.Mutex
+	subscriptions []*zmqFrame
+	upstream      net.Conn
+
+	done chan struct{}
+}
+
+// newZMQRelay starts a relay of the given ZMQ endpoint, which is dialed with
+// the passed dial function if it's a TCP endpoint. Failed attempts to
+// resubscribe are retried with an exponential backoff between the given
+// minimum and maximum delays.
+func newZMQRelay(endpoint string, dial func(string, string) (net.Conn, error),
+	minBackoff, maxBackoff time.Duration) (*zmqRelay, error) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for ZMQ relay of %v: "+
+			"%v", endpoint, err)
+	}
+
+	r := &zmqRelay{
+		dial:       dial,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		listener:   listener,
+		endpoint:   endpoint,
+		sessions:   make(map[*zmqRelaySession]struct{}),
+		quit:       make(chan struct{}),
+	}
+
+	r.wg.Add(1)
+	go r.acceptConns()
+
+	return r, nil
+}
+
+// Endpoint returns the ZMQ endpoint subscribers should connect to in place of
+// the backend's one.
+func (r *zmqRelay) Endpoint() string {
+	return zmqTCPPrefix + r.listener.Addr().String()
+}
+
+// Reconnect closes the connections to the backend's endpoint, such that each
+// subscriber is resubscribed over a fresh one. This is used to recover from a
+// connection which silently stopped delivering messages.
+func (r *zmqRelay) Reconnect() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for session := range r.sessions {
+		session.closeUpstream()
+	}
+}
+
+// SetEndpoint replaces the backend's endpoint messages are relayed from, and
+// resubscribes all subscribers to the new one.
+func (r *zmqRelay) SetEndpoint(endpoint string) {
+	r.mtx.Lock()
+	r.endpoint = endpoint
+	r.mtx.Unlock()
+
+	r.Reconnect()
+}
+
+// Stop closes the relay's listener along with the connections of all of its
+// sessions, and waits for them to be torn down.
+func (r *zmqRelay) Stop() error {
+	if !atomic.CompareAndSwapInt32(&r.stopped, 0, 1) {
+		return nil
+	}
+
+	close(r.quit)
+	err := r.listener.Close()
+
+	r.mtx.Lock()
+	for session := range r.sessions {
+		session.local.Close()
+		session.closeUpstream()
+	}
+	r.mtx.Unlock()
+
+	r.wg.Wait()
+
+	return err
+}
+
+// acceptConns accepts subscribers on the relay's listener, and relays the
+// backend's messages to each of them until the relay is stopped.
+//
+// NOTE: This MUST be run as a goroutine.
+func (r *zmqRelay) acceptConns() {
+	defer r.wg.Done()
+
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			select {
+			case <-r.quit:
+			default:
+				ltndLog.Errorf("ZMQ relay stopped accepting "+
+					"connections: %v", err)
+			}
+			return
+		}
+
+		session := &zmqRelaySession{
+			local: conn,
+			done:  make(chan struct{}),
+		}
+
+		r.mtx.Lock()
+		select {
+		case <-r.quit:
+			r.mtx.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		r.sessions[session] = struct{}{}
+		r.mtx.Unlock()
+
+		r.wg.Add(1)
+		go r.serve(session)
+	}
+}
+
+// serve completes the handshake with the session's subscriber, after which it
+// subscribes to the backend's endpoint, and relays its messages until the
+// subscriber disconnects or the relay is stopped. Whenever the connection to
+// the backend is lost, it's reestablished with an exponential backoff.
+//
+// NOTE: This MUST be run as a goroutine.
+func (r *zmqRelay) serve(session *zmqRelaySession) {
+	defer r.wg.Done()
+	defer func() {
+		r.mtx.Lock()
+		delete(r.sessions, session)
+		r.mtx.Unlock()
+
+		session.local.Close()
+		session.closeUpstream()
+	}()
+
+	if err := zmqHandshake(session.local, "PUB"); err != nil {
+		ltndLog.Errorf("ZMQ handshake with subscriber failed: %v", err)
+		return
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		session.readSubscriptions()
+	}()
+
+	for {
+		endpoint, upstream, ok := r.subscribe(session)
+		if !ok {
+			return
+		}
+
+		err := session.relay(upstream)
+
+		select {
+		case <-session.done:
+			return
+		case <-r.quit:
+			return
+		default:
+		}
+
+		ltndLog.Warnf("ZMQ connection to %v lost, resubscribing: %v",
+			endpoint, err)
+	}
+}
+
+// subscribe connects to the backend's endpoint, and replays the session's
+// subscriptions over the connection. Failed attempts are retried with an
+// exponential backoff until one succeeds, the subscriber disconnects, or the
+// relay is stopped, in which case false is returned.
+func (r *zmqRelay) subscribe(session *zmqRelaySession) (string, net.Conn,
+	bool) {
+
+	backoff := r.minBackoff
+	for attempt := 1; ; attempt++ {
+		r.mtx.Lock()
+		endpoint := r.endpoint
+		r.mtx.Unlock()
+
+		conn, err := r.connect(endpoint)
+		if err == nil {
+			if !session.setUpstream(conn) {
+				conn.Close()
+				return "", nil, false
+			}
+
+			if attempt > 1 {
+				ltndLog.Infof("Resubscribed to ZMQ endpoint "+
+					"%v after %d attempt(s)", endpoint,
+					attempt)
+			}
+
+			return endpoint, conn, true
+		}
+
+		ltndLog.Errorf("Unable to subscribe to ZMQ endpoint %v "+
+			"(attempt %d), retrying in %v: %v", endpoint, attempt,
+			backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-session.done:
+			return "", nil, false
+		case <-r.quit:
+			return "", nil, false
+		}
+
+		backoff *= 2
+		if backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
+
+// connect establishes a connection to the given ZMQ endpoint of the backend,
+// and completes the handshake as a subscriber.
+func (r *zmqRelay) connect(endpoint string) (net.Conn, error) {
+	conn, err := dialZMQ(r.dial, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := zmqHandshake(conn, "SUB"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// setUpstream replays the session's subscriptions over the passed connection
+// to the backend's endpoint, and makes it the one new subscriptions are
+// forwarded to. False is returned if the subscriber already disconnected.
+func (s *zmqRelaySession) setUpstream(conn net.Conn) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	var buf bytes.Buffer
+	for _, subscription := range s.subscriptions {
+		subscription.encode(&buf)
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		// The error will surface once the connection is read from.
+		conn.Close()
+	}
+	s.upstream = conn
+
+	return true
+}
+
+// closeUpstream closes the session's connection to the backend's endpoint, if
+// any, which causes it to resubscribe unless it's done.
+func (s *zmqRelaySession) closeUpstream() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.upstream != nil {
+		s.upstream.Close()
+		s.upstream = nil
+	}
+}
+
+// readSubscriptions reads the subscriptions sent by the session's subscriber,
+// records them to be replayed once the session resubscribes, and forwards
+// them to the backend's endpoint. Once the subscriber disconnects, the session
+// is marked as done, and its connection to the backend is closed.
+//
+// NOTE: This MUST be run as a goroutine.
+func (s *zmqRelaySession) readSubscriptions() {
+	defer func() {
+		s.mtx.Lock()
+		close(s.done)
+		s.mtx.Unlock()
+
+		s.closeUpstream()
+	}()
+
+	for {
+		frame, err := readZMQFrame(s.local)
+		if err != nil {
+			return
+		}
+
+		// Subscriptions are single frame messages, and any command,
+		// such as a PING, is handled by the relay itself.
+		if frame.command() || frame.more() {
+			continue
+		}
+
+		s.mtx.Lock()
+		s.subscriptions = append(s.subscriptions, frame)
+		if s.upstream != nil {
+			var buf bytes.Buffer
+			frame.encode(&buf)
+			s.upstream.Write(buf.Bytes())
+		}
+		s.mtx.Unlock()
+	}
+}
+
+// relay reads the messages published over the passed connection to the
+// backend's endpoint, and writes each complete one to the session's
+// subscriber, until either connection fails.
+func (s *zmqRelaySession) relay(upstream net.Conn) error {
+	var (
+		message   bytes.Buffer
+		numFrames int
+	)
+	for {
+		frame, err := readZMQFrame(upstream)
+		if err != nil {
+			return err
+		}
+
+		// Commands aren't part of any message, and the subscribers
+		// don't expect any after the handshake.
+		if frame.command() {
+			continue
+		}
+
+		numFrames++
+		if numFrames > zmqMaxMessageFrames {
+			return fmt.Errorf("message exceeds %d frames",
+				zmqMaxMessageFrames)
+		}
+
+		frame.encode(&message)
+		if frame.more() {
+			continue
+		}
+
+		if _, err := s.local.Write(message.Bytes()); err != nil {
+			s.local.Close()
+			return err
+		}
+		message.Reset()
+		numFrames = 0
+	}
+}
+
+// zmqRelays is the set of relays the ZMQ subscriptions to the bitcoind
+// backends are made through.
+type zmqRelays []*zmqRelay
+
+// Reconnect resubscribes the subscribers of all of the relays over fresh
+// connections to the backend.
+func (z zmqRelays) Reconnect() {
+	for _, relay := range z {
+		relay.Reconnect()
+	}
+}
+
+// Stop stops all of the relays, returning the first error encountered.
+func (z zmqRelays) Stop() error {
+	var firstErr error
+	for _, relay := range z {
+		err := relay.Stop()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// startZMQRelays routes the ZMQ subscriptions to the passed bitcoind backends
+// through relays, by replacing their ZMQ endpoints with the ones of relays
+// subscribing to them with the given dial function. The relays resubscribe to
+// bitcoind with an exponential backoff once their connection to it is lost,
+// which btcwallet's subscriptions don't recover from by themselves.
+func startZMQRelays(backends []bitcoindBackend,
+	dial func(string, string) (net.Conn, error)) (zmqRelays, error) {
+
+	var relays zmqRelays
+	relayEndpoint := func(endpoint string) (string, error) {
+		relay, err := newZMQRelay(
+			endpoint, dial, defaultZMQMinReconnectBackoff,
+			defaultZMQMaxReconnectBackoff,
+		)
+		if err != nil {
+			return "", err
+		}
+		relays = append(relays, relay)
+
+		return relay.Endpoint(), nil
+	}
+
+	for i, backend := range backends {
+		var err error
+		backends[i].zmqPubRawBlock, err = relayEndpoint(
+			backend.zmqPubRawBlock,
+		)
+		if err != nil {
+			relays.Stop()
+			return nil, err
+		}
+		backends[i].zmqPubRawTx, err = relayEndpoint(
+			backend.zmqPubRawTx,
+		)
+		if err != nil {
+			relays.Stop()
+			return nil, err
+		}
+	}
+
+	return relays, nil
+}
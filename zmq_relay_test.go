@@ -0,0 +1,295 @@
+// +build !rpctest
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// zmqTestTimeout is the maximum time the ZMQ relay tests wait for a peer.
+const zmqTestTimeout = 5 * time.Second
+
+// acceptZMQSubscriber accepts a connection on the passed listener as a ZMQ
+// publisher, and returns it along with the topic of the first subscription
+// it receives.
+func acceptZMQSubscriber(t *testing.T, listener net.Listener) (net.Conn,
+	string) {
+
+	t.Helper()
+
+	acceptChan := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(acceptChan)
+			return
+		}
+		acceptChan <- conn
+	}()
+
+	var conn net.Conn
+	select {
+	case c, ok := <-acceptChan:
+		if !ok {
+			t.Fatalf("unable to accept subscriber")
+		}
+		conn = c
+	case <-time.After(zmqTestTimeout):
+		t.Fatalf("subscriber didn't connect")
+	}
+
+	if err := zmqHandshake(conn, "PUB"); err != nil {
+		t.Fatalf("handshake with subscriber failed: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(zmqTestTimeout))
+	frame, err := readZMQFrame(conn)
+	if err != nil {
+		t.Fatalf("unable to read subscription: %v", err)
+	}
+	if len(frame.body) == 0 || frame.body[0] != 1 {
+		t.Fatalf("expected subscription, got %x", frame.body)
+	}
+
+	return conn, string(frame.body[1:])
+}
+
+// dialZMQSubscriber connects to the passed ZMQ endpoint the way btcwallet's
+// subscriptions do, and subscribes to the given topic.
+func dialZMQSubscriber(t *testing.T, endpoint, topic string) net.Conn {
+	t.Helper()
+
+	conn, err := dialZMQ(net.Dial, endpoint)
+	if err != nil {
+		t.Fatalf("unable to connect to %v: %v", endpoint, err)
+	}
+
+	// The greeting, READY command and subscription are spelled out byte
+	// by byte, as sent by the ZMQ client used by btcwallet.
+	var handshake bytes.Buffer
+	handshake.Write([]byte{0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0x7f, 3, 0})
+	handshake.WriteString("NULL")
+	handshake.Write(make([]byte, 48))
+	handshake.Write([]byte{4, 25, 5})
+	handshake.WriteString("READY")
+	handshake.Write([]byte{11})
+	handshake.WriteString("Socket-Type")
+	handshake.Write([]byte{0, 0, 0, 3})
+	handshake.WriteString("SUB")
+	if _, err := conn.Write(handshake.Bytes()); err != nil {
+		t.Fatalf("unable to send handshake: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(zmqTestTimeout))
+	greeting := make([]byte, zmqGreetingSize)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		t.Fatalf("unable to read greeting: %v", err)
+	}
+	if err := checkZMQGreeting(greeting); err != nil {
+		t.Fatalf("invalid greeting: %v", err)
+	}
+	ready, err := readZMQFrame(conn)
+	if err != nil {
+		t.Fatalf("unable to read READY command: %v", err)
+	}
+	if !ready.command() || !bytes.Contains(ready.body, []byte("PUB")) {
+		t.Fatalf("expected READY command of publisher, got %x",
+			ready.body)
+	}
+
+	subscription := append([]byte{0, byte(len(topic) + 1), 1}, topic...)
+	if _, err := conn.Write(subscription); err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+
+	return conn
+}
+
+// publishZMQ writes a message of the passed parts to the given connection.
+func publishZMQ(t *testing.T, conn net.Conn, parts ...string) {
+	t.Helper()
+
+	var message bytes.Buffer
+	for i, part := range parts {
+		frame := &zmqFrame{body: []byte(part)}
+		if i < len(parts)-1 {
+			frame.flags = zmqFlagMore
+		}
+		frame.encode(&message)
+	}
+	if _, err := conn.Write(message.Bytes()); err != nil {
+		t.Fatalf("unable to publish message: %v", err)
+	}
+}
+
+// receiveZMQ reads a message from the passed connection, and ensures it
+// consists of the expected parts.
+func receiveZMQ(t *testing.T, conn net.Conn, parts ...string) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(zmqTestTimeout))
+	for i, part := range parts {
+		frame, err := readZMQFrame(conn)
+		if err != nil {
+			t.Fatalf("unable to receive message: %v", err)
+		}
+		if string(frame.body) != part {
+			t.Fatalf("expected part %q, got %q", part, frame.body)
+		}
+		if frame.more() != (i < len(parts)-1) {
+			t.Fatalf("unexpected framing of part %q", part)
+		}
+	}
+}
+
+// TestZMQRelayResubscribe ensures that the zmqRelay resubscribes to a ZMQ
+// endpoint which dropped its connection, e.g. as bitcoind was restarted, and
+// keeps relaying its messages over the subscriber's original connection.
+func TestZMQRelayResubscribe(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+
+	relay, err := newZMQRelay(
+		zmqTCPPrefix+addr, net.Dial, time.Millisecond,
+		10*time.Millisecond,
+	)
+	if err != nil {
+		t.Fatalf("unable to start relay: %v", err)
+	}
+	defer relay.Stop()
+
+	sub := dialZMQSubscriber(t, relay.Endpoint(), "rawblock")
+	defer sub.Close()
+
+	pub, topic := acceptZMQSubscriber(t, listener)
+	if topic != "rawblock" {
+		t.Fatalf("expected subscription to rawblock, got %v", topic)
+	}
+	publishZMQ(t, pub, "rawblock", "block 1", "seq 1")
+	receiveZMQ(t, sub, "rawblock", "block 1", "seq 1")
+
+	// Now, we'll drop the endpoint in the middle of a message, while it
+	// refuses connections for a while.
+	var torn bytes.Buffer
+	(&zmqFrame{flags: zmqFlagMore, body: []byte("rawblock")}).encode(&torn)
+	torn.Write([]byte{zmqFlagMore, 4, 'b'})
+	pub.Write(torn.Bytes())
+	pub.Close()
+	listener.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to listen again: %v", err)
+	}
+	defer listener.Close()
+
+	// Once it accepts connections again, the relay should resubscribe to
+	// the same topic, and relay the next message without any part of the
+	// torn one.
+	pub, topic = acceptZMQSubscriber(t, listener)
+	defer pub.Close()
+	if topic != "rawblock" {
+		t.Fatalf("expected resubscription to rawblock, got %v", topic)
+	}
+	publishZMQ(t, pub, "rawblock", "block 2", "seq 2")
+	receiveZMQ(t, sub, "rawblock", "block 2", "seq 2")
+}
+
+// TestZMQRelayReconnect ensures that the zmqRelay replaces its connection to
+// a ZMQ endpoint which silently stopped delivering messages once requested.
+func TestZMQRelayReconnect(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	relay, err := newZMQRelay(
+		zmqTCPPrefix+listener.Addr().String(), net.Dial,
+		time.Millisecond, 10*time.Millisecond,
+	)
+	if err != nil {
+		t.Fatalf("unable to start relay: %v", err)
+	}
+	defer relay.Stop()
+
+	sub := dialZMQSubscriber(t, relay.Endpoint(), "rawtx")
+	defer sub.Close()
+
+	stalled, _ := acceptZMQSubscriber(t, listener)
+	defer stalled.Close()
+
+	// The stalled connection should be closed once the relay reconnects,
+	// which should replay the subscription over a new one.
+	relay.Reconnect()
+
+	pub, topic := acceptZMQSubscriber(t, listener)
+	defer pub.Close()
+	if topic != "rawtx" {
+		t.Fatalf("expected resubscription to rawtx, got %v", topic)
+	}
+
+	stalled.SetReadDeadline(time.Now().Add(zmqTestTimeout))
+	if _, err := stalled.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected stalled connection to be closed, got %v",
+			err)
+	}
+
+	publishZMQ(t, pub, "rawtx", "tx", "seq")
+	receiveZMQ(t, sub, "rawtx", "tx", "seq")
+}
+
+// TestZMQRelayStop ensures that the zmqRelay can be stopped while it's backing
+// off between failed attempts to subscribe to an unreachable endpoint.
+func TestZMQRelayStop(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	relay, err := newZMQRelay(
+		zmqTCPPrefix+addr, net.Dial, time.Hour, time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("unable to start relay: %v", err)
+	}
+
+	sub := dialZMQSubscriber(t, relay.Endpoint(), "rawblock")
+	defer sub.Close()
+
+	stopped := make(chan struct{})
+	go func() {
+		relay.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(zmqTestTimeout):
+		t.Fatalf("relay didn't stop")
+	}
+
+	// The subscriber's connection should be closed along with the relay,
+	// which may reset it as the subscription was never read.
+	sub.SetReadDeadline(time.Now().Add(zmqTestTimeout))
+	_, err = sub.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); err == nil || ok && netErr.Timeout() {
+		t.Fatalf("expected subscriber to be disconnected, got %v", err)
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwallet/chain"
+)
+
+const (
+	// defaultZMQCheckInterval is the interval at which the zmqWatchdog
+	// checks whether block notifications are still being delivered over
+	// ZMQ.
+	defaultZMQCheckInterval = time.Minute
+
+	// defaultZMQStaleThreshold is how long the blocks delivered over ZMQ
+	// may lag behind the backend's best block before the connection is
+	// considered stalled.
+	defaultZMQStaleThreshold = 2 * time.Minute
+
+	// defaultZMQMinReachableBackoff is the initial delay between two
+	// failed checks of whether the backend is reachable again.
+	defaultZMQMinReachableBackoff = 5 * time.Second
+
+	// defaultZMQMaxReachableBackoff is the maximum delay between two
+	// failed checks of whether the backend is reachable again.
+	defaultZMQMaxReachableBackoff = 5 * time.Minute
+
+	// defaultZMQSelfTestTimeout is the maximum time the ZMQ self-test
+	// waits for a block to be delivered over ZMQ at startup. It's kept
+	// short so startup doesn't stall on quiet networks, and needs to be
+	// raised to reliably wait for the next block on other networks.
+	defaultZMQSelfTestTimeout = 2 * time.Minute
+)
+
+// zmqWatchdogConfig houses the functions and parameters the zmqWatchdog
+// requires in order to monitor the liveness of a ZMQ connection.
+type zmqWatchdogConfig struct {
+	// BestHeight returns the height of the backend's best block, as
+	// reported over RPC.
+	BestHeight func() (int32, error)
+
+	// NotifiedHeight returns the height of the latest block that was
+	// delivered over ZMQ.
+	NotifiedHeight func() int32
+
+	// Reachable returns an error if the backend can't be connected to.
+	// Once the ZMQ connection stalled, it's retried with an exponential
+	// backoff until it succeeds.
+	Reachable func() error
+
+	// Reconnect is invoked once the backend is reachable again after the
+	// ZMQ connection stalled, and is expected to replace the connection
+	// with a fresh subscription.
+	Reconnect func()
+
+	// CheckInterval is the interval at which the liveness of the ZMQ
+	// connection is checked.
+	CheckInterval time.Duration
+
+	// StaleThreshold is how long the blocks delivered over ZMQ may lag
+	// behind the best block without a new one being delivered, before
+	// the connection is considered stalled.
+	StaleThreshold time.Duration
+
+	// MinBackoff is the initial delay between two failed reachability
+	// checks. It's doubled after each failed check.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between two failed reachability
+	// checks.
+	MaxBackoff time.Duration
+}
+
+// zmqWatchdog monitors the liveness of a ZMQ connection which delivers block
+// notifications. If the connection silently stops delivering blocks, as it
+// does when the backend is restarted or stops publishing, the height of the
+// latest notified block will stop advancing while the backend's best height,
+// as reported over RPC, keeps increasing. Once the notified blocks have been
+// lagging behind for longer than the stale threshold, the watchdog waits for
+// the backend to be reachable, backing off exponentially, and then reconnects
+// the ZMQ subscriptions, after which it resumes monitoring them.
+type zmqWatchdog struct {
+	started int32 // To be used atomically.
+	stopped int32 // To be used atomically.
+
+	cfg *zmqWatchdogConfig
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// newZMQWatchdog creates a new zmqWatchdog from the given config.
+func newZMQWatchdog(cfg *zmqWatchdogConfig) *zmqWatchdog {
+	return &zmqWatchdog{
+		cfg:  cfg,
+		quit: make(chan struct{}),
+	}
+}
+
+// Start launches the goroutine which monitors the ZMQ connection.
+func (w *zmqWatchdog) Start() error {
+	if !atomic.CompareAndSwapInt32(&w.started, 0, 1) {
+		return nil
+	}
+
+	w.wg.Add(1)
+	go w.watch()
+
+	return nil
+}
+
+// Stop signals the watchdog to exit, and waits for it to do so.
+func (w *zmqWatchdog) Stop() error {
+	if !atomic.CompareAndSwapInt32(&w.stopped, 0, 1) {
+		return nil
+	}
+
+	close(w.quit)
+	w.wg.Wait()
+
+	return nil
+}
+
+// watch periodically checks whether new blocks are still being delivered over
+// ZMQ. If they aren't, it reconnects the ZMQ subscriptions once the backend is
+// reachable again.
+//
+// NOTE: This MUST be run as a goroutine.
+func (w *zmqWatchdog) watch() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	var (
+		lastNotifiedHeight = w.cfg.NotifiedHeight()
+		reconnectHeight    int32
+		behindSince        time.Time
+	)
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.quit:
+			return
+		}
+
+		notifiedHeight := w.cfg.NotifiedHeight()
+		bestHeight, err := w.cfg.BestHeight()
+		if err != nil {
+			ltndLog.Warnf("Unable to query best height to check "+
+				"ZMQ liveness: %v", err)
+			continue
+		}
+
+		// As long as we've been notified of the best block, or no
+		// block was mined since we last reconnected, the connection is
+		// considered alive.
+		if notifiedHeight >= bestHeight ||
+			bestHeight <= reconnectHeight {
+
+			lastNotifiedHeight = notifiedHeight
+			behindSince = time.Time{}
+			continue
+		}
+
+		// Otherwise, we'll measure how long the notified blocks have
+		// been lagging behind, since we first noticed it or since the
+		// latest block was delivered, as it may just be catching up.
+		if behindSince.IsZero() ||
+			notifiedHeight != lastNotifiedHeight {
+
+			lastNotifiedHeight = notifiedHeight
+			behindSince = time.Now()
+		}
+		lag := time.Since(behindSince)
+		if lag < w.cfg.StaleThreshold {
+			continue
+		}
+
+		ltndLog.Errorf("ZMQ block notifications stalled at height %d "+
+			"for %v while the best height is %d, reconnecting "+
+			"once the backend is reachable again", notifiedHeight,
+			lag, bestHeight)
+
+		if !w.waitReachable() {
+			return
+		}
+
+		ltndLog.Infof("Reconnecting ZMQ subscriptions")
+		w.cfg.Reconnect()
+
+		// The blocks missed in the meantime are only caught up on once
+		// the next one is delivered, so until one is mined, the new
+		// subscriptions can't be told apart from stalled ones.
+		reconnectHeight = bestHeight
+		lastNotifiedHeight = w.cfg.NotifiedHeight()
+		behindSince = time.Time{}
+	}
+}
+
+// waitReachable checks whether the backend is reachable until it is, backing
+// off exponentially between failed checks. It returns false if the watchdog
+// was stopped in the meantime.
+func (w *zmqWatchdog) waitReachable() bool {
+	backoff := w.cfg.MinBackoff
+	for attempt := 1; ; attempt++ {
+		err := w.cfg.Reachable()
+		if err == nil {
+			ltndLog.Infof("Backend reachable again after %d "+
+				"attempt(s)", attempt)
+			return true
+		}
+
+		ltndLog.Errorf("Backend unreachable (attempt %d), retrying "+
+			"in %v: %v", attempt, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-w.quit:
+			return false
+		}
+
+		backoff *= 2
+		if backoff > w.cfg.MaxBackoff {
+			backoff = w.cfg.MaxBackoff
+		}
+	}
+}
+
+// newBitcoindZMQWatchdog creates a zmqWatchdog for the ZMQ connection of the
+// given bitcoind connection. It uses a dedicated client of the connection to
+// track the height of the blocks delivered over ZMQ, and to query the best
+// height over RPC. The connection is checked at the given interval, and
+// considered stalled once the notified blocks lag behind for longer than the
+// given threshold. A zero interval or threshold selects the default one. The
+// returned clean up function stops the watchdog along with the client.
+func newBitcoindZMQWatchdog(bitcoindConn *chain.BitcoindConn,
+	reachable func() error, reconnect func(), checkInterval,
+	staleThreshold time.Duration) (*zmqWatchdog, func() error, error) {
+
+	if checkInterval == 0 {
+		checkInterval = defaultZMQCheckInterval
+	}
+	if staleThreshold == 0 {
+		staleThreshold = defaultZMQStaleThreshold
+	}
+
+	client := bitcoindConn.NewBitcoindClient()
+	if err := client.Start(); err != nil {
+		return nil, nil, err
+	}
+	if err := client.NotifyBlocks(); err != nil {
+		client.Stop()
+		return nil, nil, err
+	}
+
+	_, bestHeight, err := client.GetBestBlock()
+	if err != nil {
+		client.Stop()
+		return nil, nil, err
+	}
+	notifiedHeight := bestHeight
+
+	watchdog := newZMQWatchdog(&zmqWatchdogConfig{
+		BestHeight: func() (int32, error) {
+			_, height, err := client.GetBestBlock()
+			return height, err
+		},
+		NotifiedHeight: func() int32 {
+			return atomic.LoadInt32(&notifiedHeight)
+		},
+		Reachable:      reachable,
+		Reconnect:      reconnect,
+		CheckInterval:  checkInterval,
+		StaleThreshold: staleThreshold,
+		MinBackoff:     defaultZMQMinReachableBackoff,
+		MaxBackoff:     defaultZMQMaxReachableBackoff,
+	})
+
+	// We'll track the height of each block delivered to the client until
+	// the watchdog is stopped.
+	watchdog.wg.Add(1)
+	go func() {
+		defer watchdog.wg.Done()
+
+		for {
+			select {
+			case ntfn, ok := <-client.Notifications():
+				if !ok {
+					return
+				}
+
+				block, ok := ntfn.(chain.BlockConnected)
+				if !ok {
+					continue
+				}
+				atomic.StoreInt32(&notifiedHeight, block.Height)
+
+			case <-watchdog.quit:
+				return
+			}
+		}
+	}()
+
+	cleanUp := func() error {
+		err := watchdog.Stop()
+		client.Stop()
+		return err
+	}
+
+	return watchdog, cleanUp, nil
+}
+
+// zmqSelfTest ensures that blocks are delivered over ZMQ, by waiting for a
+// block notification to arrive on the passed notification stream within the
+// given timeout. If a generate function is passed, it's called to mine a block
+// first, so the test doesn't depend on the network producing one in time. As
+// generating may not be permitted by the backend, a failure to do so is only
+// logged, and we'll keep waiting for a block mined otherwise.
+func zmqSelfTest(ctx context.Context, notifications <-chan interface{},
+	generate func() error, timeout time.Duration) error {
+
+	deadline := time.After(timeout)
+
+	if generate != nil {
+		if err := generate(); err != nil {
+			ltndLog.Warnf("Unable to generate a block for the ZMQ "+
+				"self-test, waiting for one to be mined: %v",
+				err)
+		}
+	}
+
+	ltndLog.Infof("Waiting up to %v for a block to be delivered over ZMQ",
+		timeout)
+
+	for {
+		select {
+		case ntfn, ok := <-notifications:
+			if !ok {
+				return errors.New("ZMQ self-test failed: " +
+					"notification stream closed before a " +
+					"block was delivered")
+			}
+
+			block, ok := ntfn.(chain.BlockConnected)
+			if !ok {
+				continue
+			}
+
+			ltndLog.Infof("ZMQ self-test succeeded, block %v at "+
+				"height %d was delivered", block.Hash,
+				block.Height)
+			return nil
+
+		case <-deadline:
+			return fmt.Errorf("ZMQ self-test failed: no block was "+
+				"delivered over ZMQ within %v, make sure "+
+				"zmqpubrawblock matches the address bitcoind "+
+				"publishes raw blocks on, and that it's "+
+				"reachable from lnd, or raise "+
+				"zmqselftesttimeout if no block was mined in "+
+				"time", timeout)
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// bitcoindZMQSelfTest runs the ZMQ self-test against the given bitcoind
+// connection, using a dedicated client of it which is only subscribed to block
+// notifications for the duration of the test. A zero timeout selects the
+// default one.
+func bitcoindZMQSelfTest(ctx context.Context, bitcoindConn *chain.BitcoindConn,
+	generate func() error, timeout time.Duration) error {
+
+	if timeout == 0 {
+		timeout = defaultZMQSelfTestTimeout
+	}
+
+	client := bitcoindConn.NewBitcoindClient()
+	if err := client.Start(); err != nil {
+		return err
+	}
+	defer client.Stop()
+
+	if err := client.NotifyBlocks(); err != nil {
+		return err
+	}
+
+	return zmqSelfTest(ctx, client.Notifications(), generate, timeout)
+}
+
+// regtestBlockGenerator returns a function which mines a single block on
+// bitcoind's regtest network through the given RPC connection. As bitcoind's
+// wallet may be disabled, the block's reward is paid to an anyone-can-spend
+// P2WSH address rather than one of its own.
+func regtestBlockGenerator(rpcConfig rpcclient.ConnConfig,
+	netParams *chaincfg.Params) (func() error, error) {
+
+	scriptHash := sha256.Sum256([]byte{txscript.OP_TRUE})
+	addr, err := btcutil.NewAddressWitnessScriptHash(
+		scriptHash[:], netParams,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		client, err := rpcclient.New(&rpcConfig, nil)
+		if err != nil {
+			return err
+		}
+		defer client.Shutdown()
+
+		numBlocks, err := json.Marshal(1)
+		if err != nil {
+			return err
+		}
+		address, err := json.Marshal(addr.EncodeAddress())
+		if err != nil {
+			return err
+		}
+
+		_, err = client.RawRequest(
+			"generatetoaddress",
+			[]json.RawMessage{numBlocks, address},
+		)
+		return err
+	}, nil
+}
@@ -0,0 +1,334 @@
+// +build !rpctest
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcwallet/chain"
+	"github.com/btcsuite/btcwallet/wtxmgr"
+)
+
+// TestZMQWatchdogReconnect ensures that the zmqWatchdog detects a ZMQ
+// connection which stopped delivering blocks, only reconnects it once the
+// backend is reachable again, and keeps monitoring the new connection.
+func TestZMQWatchdogReconnect(t *testing.T) {
+	t.Parallel()
+
+	const numFailures = 2
+
+	var (
+		bestHeight     int32 = 100
+		notifiedHeight int32 = 100
+		numChecks      int32
+	)
+	reconnect := make(chan int32, 1)
+	watchdog := newZMQWatchdog(&zmqWatchdogConfig{
+		BestHeight: func() (int32, error) {
+			return atomic.LoadInt32(&bestHeight), nil
+		},
+		NotifiedHeight: func() int32 {
+			return atomic.LoadInt32(&notifiedHeight)
+		},
+		Reachable: func() error {
+			check := atomic.AddInt32(&numChecks, 1)
+			if check <= numFailures {
+				return errors.New("endpoint unreachable")
+			}
+			return nil
+		},
+		Reconnect: func() {
+			reconnect <- atomic.LoadInt32(&numChecks)
+		},
+		CheckInterval:  10 * time.Millisecond,
+		StaleThreshold: 30 * time.Millisecond,
+		MinBackoff:     time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	})
+	if err := watchdog.Start(); err != nil {
+		t.Fatalf("unable to start watchdog: %v", err)
+	}
+	defer watchdog.Stop()
+
+	// While blocks are being delivered over ZMQ, we shouldn't check
+	// whether the backend is reachable, let alone reconnect.
+	for i := 0; i < 5; i++ {
+		atomic.AddInt32(&bestHeight, 1)
+		atomic.AddInt32(&notifiedHeight, 1)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&numChecks) != 0 {
+		t.Fatalf("unexpected reachability check")
+	}
+
+	// Now, we'll simulate the ZMQ endpoint being dropped by only
+	// advancing the best height. This should cause the watchdog to
+	// reconnect once the failed reachability checks have been retried.
+	atomic.AddInt32(&bestHeight, 1)
+
+	select {
+	case checks := <-reconnect:
+		if checks != numFailures+1 {
+			t.Fatalf("expected reconnect after %d reachability "+
+				"checks, got %d", numFailures+1, checks)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watchdog didn't reconnect")
+	}
+
+	// The missed block is only delivered along with the next one, so the
+	// watchdog shouldn't reconnect again until one is mined.
+	select {
+	case <-reconnect:
+		t.Fatalf("reconnected before a block was mined")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Once the next block is mined and delivered over the new connection,
+	// the watchdog should keep monitoring it, and reconnect once it stalls
+	// as well.
+	atomic.AddInt32(&bestHeight, 1)
+	atomic.StoreInt32(&notifiedHeight, atomic.LoadInt32(&bestHeight))
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-reconnect:
+		t.Fatalf("reconnected while blocks are delivered")
+	default:
+	}
+
+	atomic.AddInt32(&bestHeight, 1)
+
+	select {
+	case <-reconnect:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watchdog didn't reconnect a second time")
+	}
+}
+
+// TestZMQWatchdogStopWhileUnreachable ensures that the zmqWatchdog can be
+// stopped while it's backing off between failed reachability checks, without
+// reconnecting.
+func TestZMQWatchdogStopWhileUnreachable(t *testing.T) {
+	t.Parallel()
+
+	checked := make(chan struct{}, 1)
+	watchdog := newZMQWatchdog(&zmqWatchdogConfig{
+		BestHeight: func() (int32, error) {
+			return 101, nil
+		},
+		NotifiedHeight: func() int32 {
+			return 100
+		},
+		Reachable: func() error {
+			select {
+			case checked <- struct{}{}:
+			default:
+			}
+			return errors.New("endpoint unreachable")
+		},
+		Reconnect: func() {
+			t.Errorf("unexpected reconnect while unreachable")
+		},
+		CheckInterval: 10 * time.Millisecond,
+		MinBackoff:    time.Hour,
+		MaxBackoff:    time.Hour,
+	})
+	if err := watchdog.Start(); err != nil {
+		t.Fatalf("unable to start watchdog: %v", err)
+	}
+
+	select {
+	case <-checked:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watchdog didn't check whether backend is reachable")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		watchdog.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watchdog didn't stop while backing off")
+	}
+}
+
+// TestZMQWatchdogStaleThreshold ensures that the zmqWatchdog only considers a
+// ZMQ connection stalled once the notified blocks have lagged behind the best
+// block for longer than the stale threshold, and not while they're still
+// catching up.
+func TestZMQWatchdogStaleThreshold(t *testing.T) {
+	t.Parallel()
+
+	const staleThreshold = 200 * time.Millisecond
+
+	var (
+		bestHeight     int32 = 110
+		notifiedHeight int32 = 100
+	)
+	reconnect := make(chan time.Time, 1)
+	watchdog := newZMQWatchdog(&zmqWatchdogConfig{
+		BestHeight: func() (int32, error) {
+			return atomic.LoadInt32(&bestHeight), nil
+		},
+		NotifiedHeight: func() int32 {
+			return atomic.LoadInt32(&notifiedHeight)
+		},
+		Reachable: func() error {
+			return nil
+		},
+		Reconnect: func() {
+			reconnect <- time.Now()
+		},
+		CheckInterval:  10 * time.Millisecond,
+		StaleThreshold: staleThreshold,
+		MinBackoff:     time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+	if err := watchdog.Start(); err != nil {
+		t.Fatalf("unable to start watchdog: %v", err)
+	}
+	defer watchdog.Stop()
+
+	// While the notified blocks are catching up with the best block, the
+	// connection shouldn't be considered stalled, even though they lag
+	// behind for longer than the threshold in total.
+	for i := 0; i < 10; i++ {
+		atomic.AddInt32(&notifiedHeight, 1)
+		time.Sleep(staleThreshold / 4)
+	}
+	select {
+	case <-reconnect:
+		t.Fatalf("unexpected reconnect while catching up")
+	default:
+	}
+
+	// Now, we'll simulate a stalled ZMQ stream by only advancing the best
+	// height. The watchdog should reconnect once the threshold has passed
+	// since the last block was notified.
+	stalled := time.Now()
+	atomic.AddInt32(&bestHeight, 1)
+
+	select {
+	case reconnectTime := <-reconnect:
+		if reconnectTime.Sub(stalled) < staleThreshold {
+			t.Fatalf("reconnected after %v, before the stale "+
+				"threshold of %v", reconnectTime.Sub(stalled),
+				staleThreshold)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watchdog didn't reconnect")
+	}
+}
+
+// TestZMQSelfTest ensures that the ZMQ self-test only succeeds once a block is
+// delivered on the notification stream within the timeout, mining one first if
+// possible.
+func TestZMQSelfTest(t *testing.T) {
+	t.Parallel()
+
+	blockConnected := chain.BlockConnected(wtxmgr.BlockMeta{
+		Block: wtxmgr.Block{Height: 101},
+	})
+
+	tests := []struct {
+		name string
+
+		// notifications are the notifications delivered on the stream
+		// right away.
+		notifications []interface{}
+
+		// generate is the notification delivered on the stream once a
+		// block is generated. If nil, no block can be generated.
+		generate interface{}
+
+		// generateErr is the error returned when generating a block.
+		generateErr error
+
+		// closeStream indicates whether the stream is closed after
+		// delivering the notifications.
+		closeStream bool
+
+		valid bool
+	}{
+		{
+			name: "block delivered",
+			notifications: []interface{}{
+				chain.ClientConnected{}, blockConnected,
+			},
+			valid: true,
+		},
+		{
+			name:     "generated block delivered",
+			generate: blockConnected,
+			valid:    true,
+		},
+		{
+			name:          "generating fails but block delivered",
+			notifications: []interface{}{blockConnected},
+			generate:      blockConnected,
+			generateErr:   errors.New("method not found"),
+			valid:         true,
+		},
+		{
+			name:          "no block delivered",
+			notifications: []interface{}{chain.ClientConnected{}},
+			valid:         false,
+		},
+		{
+			name:        "generating fails",
+			generate:    blockConnected,
+			generateErr: errors.New("method not found"),
+			valid:       false,
+		},
+		{
+			name:        "stream closed",
+			closeStream: true,
+			valid:       false,
+		},
+	}
+
+	for _, test := range tests {
+		notifications := make(chan interface{}, 10)
+		for _, ntfn := range test.notifications {
+			notifications <- ntfn
+		}
+		if test.closeStream {
+			close(notifications)
+		}
+
+		var generate func() error
+		if test.generate != nil {
+			generate = func() error {
+				if test.generateErr != nil {
+					return test.generateErr
+				}
+
+				notifications <- test.generate
+				return nil
+			}
+		}
+
+		err := zmqSelfTest(
+			context.Background(), notifications, generate,
+			50*time.Millisecond,
+		)
+		switch {
+		case test.valid && err != nil:
+			t.Fatalf("%s: expected self-test to succeed: %v",
+				test.name, err)
+
+		case !test.valid && err == nil:
+			t.Fatalf("%s: expected self-test to fail", test.name)
+		}
+	}
+}